@@ -0,0 +1,486 @@
+package app
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrBitOffset    = errors.New("ERR bit offset is not an integer or out of range")
+	ErrBitValue     = errors.New("ERR bit is not an integer or out of range")
+	ErrBitFieldType = errors.New("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+)
+
+// MAX_BIT_OFFSET is the highest bit a string of MAX_STRING_SIZE bytes has.
+const MAX_BIT_OFFSET = MAX_STRING_SIZE*8 - 1
+
+// BITOP operations.
+const (
+	BITOP_AND = iota
+	BITOP_OR
+	BITOP_XOR
+	BITOP_NOT
+)
+
+// BITFIELD subcommands.
+const (
+	BITFIELD_GET = iota
+	BITFIELD_SET
+	BITFIELD_INCRBY
+)
+
+// BITFIELD overflow behaviors.
+const (
+	BITFIELD_WRAP = iota
+	BITFIELD_SAT
+	BITFIELD_FAIL
+)
+
+// ParseBitOffset parses a bit offset. For BITFIELD, which passes the width
+// of the field as bits, an offset prefixed with "#" counts fields rather
+// than bits.
+func ParseBitOffset(arg string, bits uint) (uint64, error) {
+	multiplier := int64(1)
+	if bits > 0 && strings.HasPrefix(arg, "#") {
+		arg = arg[1:]
+		multiplier = int64(bits)
+	}
+	n, ok := ParseInt(arg)
+	if !ok || n < 0 || n > MAX_BIT_OFFSET/multiplier {
+		return 0, ErrBitOffset
+	}
+	return uint64(n * multiplier), nil
+}
+
+// bitAt returns the bit of s at offset, counting from the most significant
+// bit of the first byte. Bits past the end of s are clear.
+func bitAt(s string, offset uint64) int {
+	i := offset >> 3
+	if i >= uint64(len(s)) {
+		return 0
+	}
+	return int(s[i]>>(7-offset&7)) & 1
+}
+
+// growBits returns s as a byte slice long enough to hold the bit at offset.
+func growBits(s string, offset uint64) []byte {
+	size := len(s)
+	if needed := int(offset>>3) + 1; needed > size {
+		size = needed
+	}
+	buf := make([]byte, size)
+	copy(buf, s)
+	return buf
+}
+
+// SetBit sets or clears the bit at offset of the string stored at key,
+// growing it as needed, and returns the previous bit.
+func (ms *MemoryStorage) SetBit(key string, offset uint64, bit int) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	var current string
+	if exists {
+		var err error
+		if current, err = stringValue(item); err != nil {
+			return 0, err
+		}
+	}
+	old := bitAt(current, offset)
+	buf := growBits(current, offset)
+	mask := byte(1) << (7 - offset&7)
+	if bit == 1 {
+		buf[offset>>3] |= mask
+	} else {
+		buf[offset>>3] &^= mask
+	}
+	item.Value = string(buf)
+	ms.set(key, item)
+	ms.notify(NOTIFY_STRING, "setbit", key)
+	return old, nil
+}
+
+// GetBit returns the bit at offset of the string stored at key.
+func (ms *MemoryStorage) GetBit(key string, offset uint64) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	if !exists {
+		ms.keyMiss(key)
+		return 0, nil
+	}
+	value, err := stringValue(item)
+	if err != nil {
+		return 0, err
+	}
+	return bitAt(value, offset), nil
+}
+
+// BitRange is the range of BITCOUNT and BITPOS, in bytes or, when Bit is
+// set, in bits. Negative indexes count from the end of the string.
+type BitRange struct {
+	Start, End int64
+	EndGiven   bool
+	Bit        bool
+}
+
+// bounds resolves r against a string of size bytes into an inclusive range
+// of bits, reporting false when it is empty.
+func (r BitRange) bounds(size int64) (int64, int64, bool) {
+	total := size
+	if r.Bit {
+		total = size * 8
+	}
+	start, end := r.Start, r.End
+	if !r.EndGiven {
+		end = total - 1
+	}
+	if start < 0 && end < 0 && start > end {
+		return 0, 0, false
+	}
+	if start < 0 {
+		start += total
+	}
+	if end < 0 {
+		end += total
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= total {
+		end = total - 1
+	}
+	if start > end {
+		return 0, 0, false
+	}
+	if !r.Bit {
+		start, end = start*8, end*8+7
+	}
+	return start, end, true
+}
+
+// BitCount counts the set bits of the string stored at key, within r when
+// it is given.
+func (ms *MemoryStorage) BitCount(key string, r *BitRange) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	if !exists {
+		ms.keyMiss(key)
+		return 0, nil
+	}
+	value, err := stringValue(item)
+	if err != nil {
+		return 0, err
+	}
+	if r == nil {
+		r = &BitRange{}
+	}
+	start, end, ok := r.bounds(int64(len(value)))
+	if !ok {
+		return 0, nil
+	}
+
+	n := 0
+	first, last := start>>3, end>>3
+	for i := first; i <= last; i++ {
+		b := value[i]
+		if i == first {
+			b &= 0xff >> (start & 7)
+		}
+		if i == last {
+			b &= 0xff << (7 - end&7)
+		}
+		n += bits.OnesCount8(b)
+	}
+	return int64(n), nil
+}
+
+// BitPos returns the offset of the first bit of the string stored at key
+// set to bit, within r when it is given, or -1 if there is none. A string
+// is taken to be padded with clear bits unless r has an explicit end.
+func (ms *MemoryStorage) BitPos(key string, bit int, r *BitRange) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	if !exists {
+		ms.keyMiss(key)
+		if bit == 1 {
+			return -1, nil
+		}
+		return 0, nil
+	}
+	value, err := stringValue(item)
+	if err != nil {
+		return 0, err
+	}
+	if r == nil {
+		r = &BitRange{}
+	}
+	start, end, ok := r.bounds(int64(len(value)))
+	if !ok {
+		return -1, nil
+	}
+
+	for pos := start; pos <= end; {
+		b := value[pos>>3]
+		// Skip whole bytes that cannot hold the bit.
+		if pos&7 == 0 && pos+7 <= end && ((bit == 1 && b == 0) || (bit == 0 && b == 0xff)) {
+			pos += 8
+			continue
+		}
+		if int(b>>(7-pos&7))&1 == bit {
+			return pos, nil
+		}
+		pos++
+	}
+	if bit == 0 && !r.EndGiven {
+		return int64(len(value)) * 8, nil
+	}
+	return -1, nil
+}
+
+// BitOp stores at dst the bitwise operation op of the strings stored at
+// keys, shorter strings being padded with zero bytes, and returns the
+// length of the result. An empty result deletes dst.
+func (ms *MemoryStorage) BitOp(op int, dst string, keys []string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	sources := make([]string, len(keys))
+	size := 0
+	for i, key := range keys {
+		item, exists := ms.lookup(key)
+		if !exists {
+			continue
+		}
+		value, err := stringValue(item)
+		if err != nil {
+			return 0, err
+		}
+		sources[i] = value
+		if len(value) > size {
+			size = len(value)
+		}
+	}
+	if size == 0 {
+		if ms.remove(dst) {
+			ms.notify(NOTIFY_GENERIC, "del", dst)
+		}
+		return 0, nil
+	}
+
+	byteAt := func(s string, i int) byte {
+		if i < len(s) {
+			return s[i]
+		}
+		return 0
+	}
+	result := make([]byte, size)
+	for i := range result {
+		b := byteAt(sources[0], i)
+		switch op {
+		case BITOP_NOT:
+			b = ^b
+		case BITOP_AND:
+			for _, s := range sources[1:] {
+				b &= byteAt(s, i)
+			}
+		case BITOP_OR:
+			for _, s := range sources[1:] {
+				b |= byteAt(s, i)
+			}
+		case BITOP_XOR:
+			for _, s := range sources[1:] {
+				b ^= byteAt(s, i)
+			}
+		}
+		result[i] = b
+	}
+	ms.set(dst, Item{Value: string(result)})
+	ms.notify(NOTIFY_STRING, "set", dst)
+	return size, nil
+}
+
+// BitFieldType is the type of a BITFIELD integer: signed up to 64 bits or
+// unsigned up to 63.
+type BitFieldType struct {
+	Signed bool
+	Bits   uint
+}
+
+// ParseBitFieldType parses a BITFIELD type such as i16 or u8.
+func ParseBitFieldType(arg string) (BitFieldType, error) {
+	if len(arg) < 2 || (arg[0] != 'i' && arg[0] != 'u') {
+		return BitFieldType{}, ErrBitFieldType
+	}
+	t := BitFieldType{Signed: arg[0] == 'i'}
+	n, err := strconv.Atoi(arg[1:])
+	if err != nil || n < 1 || (t.Signed && n > 64) || (!t.Signed && n > 63) {
+		return BitFieldType{}, ErrBitFieldType
+	}
+	t.Bits = uint(n)
+	return t, nil
+}
+
+// get reads the integer of type t at offset of buf.
+func (t BitFieldType) get(buf []byte, offset uint64) int64 {
+	var v uint64
+	for j := uint64(0); j < uint64(t.Bits); j++ {
+		pos := offset + j
+		var bit uint64
+		if i := pos >> 3; i < uint64(len(buf)) {
+			bit = uint64(buf[i]>>(7-pos&7)) & 1
+		}
+		v = v<<1 | bit
+	}
+	if t.Signed && t.Bits < 64 && v&(1<<(t.Bits-1)) != 0 {
+		v |= math.MaxUint64 << t.Bits
+	}
+	return int64(v)
+}
+
+// put writes the low bits of v as an integer of type t at offset of buf.
+func (t BitFieldType) put(buf []byte, offset uint64, v int64) {
+	for j := uint64(0); j < uint64(t.Bits); j++ {
+		pos := offset + j
+		mask := byte(1) << (7 - pos&7)
+		if (uint64(v)>>(uint64(t.Bits)-1-j))&1 == 1 {
+			buf[pos>>3] |= mask
+		} else {
+			buf[pos>>3] &^= mask
+		}
+	}
+}
+
+// wrap truncates value+incr to the width of t, sign extending it when t is
+// signed.
+func (t BitFieldType) wrap(value int64, incr int64) int64 {
+	c := uint64(value) + uint64(incr)
+	if t.Bits < 64 {
+		mask := uint64(math.MaxUint64) << t.Bits
+		if t.Signed && c&(1<<(t.Bits-1)) != 0 {
+			c |= mask
+		} else {
+			c &^= mask
+		}
+	}
+	return int64(c)
+}
+
+// add returns value+incr in the range of t, following the overflow
+// behavior, and false when the FAIL behavior refuses it.
+func (t BitFieldType) add(value int64, incr int64, overflow int) (int64, bool) {
+	var over, under bool
+	var max, min int64
+	if t.Signed {
+		max = math.MaxInt64
+		if t.Bits < 64 {
+			max = int64(1)<<(t.Bits-1) - 1
+		}
+		min = -max - 1
+		maxIncr, minIncr := max-value, min-value
+		over = value > max || (t.Bits != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr)
+		under = !over && (value < min || (t.Bits != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr))
+	} else {
+		umax := uint64(1)<<t.Bits - 1
+		max = int64(umax)
+		maxIncr, minIncr := int64(umax-uint64(value)), -value
+		over = uint64(value) > umax || (incr > 0 && incr > maxIncr)
+		under = !over && incr < 0 && incr < minIncr
+	}
+	switch {
+	case !over && !under:
+		return value + incr, true
+	case overflow == BITFIELD_FAIL:
+		return 0, false
+	case overflow == BITFIELD_SAT && over:
+		return max, true
+	case overflow == BITFIELD_SAT:
+		return min, true
+	default:
+		return t.wrap(value, incr), true
+	}
+}
+
+// BitFieldOp is one GET, SET or INCRBY of BITFIELD. Value is the value to
+// set or the increment, and Overflow the behavior in effect for it.
+type BitFieldOp struct {
+	Kind     int
+	Type     BitFieldType
+	Offset   uint64
+	Value    int64
+	Overflow int
+}
+
+// BitFieldResult is the reply to a BitFieldOp: the value read, the old
+// value for SET or the new one for INCRBY. Failed is set when the FAIL
+// overflow behavior left the field unchanged.
+type BitFieldResult struct {
+	Value  int64
+	Failed bool
+}
+
+// BitField performs ops in order on the string stored at key. Writing
+// grows the string to hold the furthest field written, even if an
+// overflow then prevents the write.
+func (ms *MemoryStorage) BitField(key string, ops []BitFieldOp) ([]BitFieldResult, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	var current string
+	if exists {
+		var err error
+		if current, err = stringValue(item); err != nil {
+			return nil, err
+		}
+	}
+	write := false
+	furthest := uint64(0)
+	for _, op := range ops {
+		if op.Kind != BITFIELD_GET {
+			write = true
+			if last := op.Offset + uint64(op.Type.Bits) - 1; last > furthest {
+				furthest = last
+			}
+		}
+	}
+	buf := []byte(current)
+	if write {
+		buf = growBits(current, furthest)
+	}
+
+	results := make([]BitFieldResult, len(ops))
+	for i, op := range ops {
+		old := op.Type.get(buf, op.Offset)
+		var value int64
+		var ok bool
+		switch op.Kind {
+		case BITFIELD_GET:
+			results[i].Value = old
+			continue
+		case BITFIELD_SET:
+			value, ok = op.Type.add(op.Value, 0, op.Overflow)
+			results[i].Value = old
+		case BITFIELD_INCRBY:
+			value, ok = op.Type.add(old, op.Value, op.Overflow)
+			results[i].Value = value
+		}
+		if !ok {
+			results[i] = BitFieldResult{Failed: true}
+			continue
+		}
+		op.Type.put(buf, op.Offset, value)
+	}
+	if write {
+		item.Value = string(buf)
+		ms.set(key, item)
+		ms.notify(NOTIFY_STRING, "setbit", key)
+	}
+	return results, nil
+}
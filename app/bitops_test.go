@@ -0,0 +1,103 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBitCountAndPos(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.Save("foobar", "foobar", nil)
+	ms.Save("a", "\xff\xf0\x00", nil)
+	ms.Save("b", "\x00\xff\xf0", nil)
+	ms.Save("ones", "\xff\xff\xff", nil)
+
+	for _, tt := range []struct {
+		r    *BitRange
+		want int64
+	}{
+		{nil, 26},
+		{&BitRange{Start: 0, End: 0, EndGiven: true}, 4},
+		{&BitRange{Start: 1, End: 1, EndGiven: true}, 6},
+		{&BitRange{Start: 5, End: 30, EndGiven: true, Bit: true}, 17},
+		{&BitRange{Start: -2, End: -1, EndGiven: true}, 7},
+		{&BitRange{Start: -1, End: -2, EndGiven: true}, 0},
+	} {
+		if n, _ := ms.BitCount("foobar", tt.r); n != tt.want {
+			t.Errorf("BitCount(%+v) = %d, want %d", tt.r, n, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		key  string
+		bit  int
+		r    *BitRange
+		want int64
+	}{
+		{"a", 0, nil, 12},
+		{"b", 1, &BitRange{Start: 0, End: -1}, 8},
+		{"b", 1, &BitRange{Start: 2, End: -1}, 16},
+		{"b", 1, &BitRange{Start: 7, End: 15, EndGiven: true, Bit: true}, 8},
+		{"ones", 0, nil, 24},
+		{"ones", 0, &BitRange{Start: 0, End: -1, EndGiven: true}, -1},
+		{"missing", 0, nil, 0},
+		{"missing", 1, nil, -1},
+	} {
+		if pos, _ := ms.BitPos(tt.key, tt.bit, tt.r); pos != tt.want {
+			t.Errorf("BitPos(%s, %d, %+v) = %d, want %d", tt.key, tt.bit, tt.r, pos, tt.want)
+		}
+	}
+}
+
+func TestBitFieldOverflow(t *testing.T) {
+	ms := NewMemoryStorage()
+	u2, _ := ParseBitFieldType("u2")
+	var got []int64
+	for i := 0; i < 4; i++ {
+		results, _ := ms.BitField("k", []BitFieldOp{
+			{Kind: BITFIELD_INCRBY, Type: u2, Offset: 100, Value: 1},
+			{Kind: BITFIELD_INCRBY, Type: u2, Offset: 102, Value: 1, Overflow: BITFIELD_SAT},
+		})
+		got = append(got, results[0].Value, results[1].Value)
+	}
+	if want := []int64{1, 1, 2, 2, 3, 3, 0, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrapping and saturating u2 counters = %v, want %v", got, want)
+	}
+	if n, _ := ms.StrLen("k"); n != 13 {
+		t.Errorf("string grown to %d bytes, want 13", n)
+	}
+
+	i8, _ := ParseBitFieldType("i8")
+	for _, tt := range []struct {
+		overflow int
+		want     BitFieldResult
+	}{
+		{BITFIELD_WRAP, BitFieldResult{Value: -128}},
+		{BITFIELD_SAT, BitFieldResult{Value: 127}},
+		{BITFIELD_FAIL, BitFieldResult{Failed: true}},
+	} {
+		results, _ := ms.BitField("i", []BitFieldOp{
+			{Kind: BITFIELD_SET, Type: i8, Value: 127},
+			{Kind: BITFIELD_INCRBY, Type: i8, Value: 1, Overflow: tt.overflow},
+		})
+		if results[1] != tt.want {
+			t.Errorf("overflow %d = %+v, want %+v", tt.overflow, results[1], tt.want)
+		}
+	}
+
+	u8, _ := ParseBitFieldType("u8")
+	results, _ := ms.BitField("u", []BitFieldOp{
+		{Kind: BITFIELD_SET, Type: u8, Value: -1},
+		{Kind: BITFIELD_GET, Type: u8},
+		{Kind: BITFIELD_SET, Type: u8, Value: 300, Overflow: BITFIELD_SAT},
+		{Kind: BITFIELD_GET, Type: u8},
+	})
+	if results[1].Value != 255 || results[3].Value != 255 {
+		t.Errorf("unsigned SET out of range = %+v", results)
+	}
+	for _, name := range []string{"u64", "i65", "x8", "i0", "u"} {
+		if _, err := ParseBitFieldType(name); err != ErrBitFieldType {
+			t.Errorf("ParseBitFieldType(%q) accepted", name)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package app
+
+// BlockRequest describes the list, sorted set or stream operation a blocked
+// client waits to perform on the first of Keys that holds elements.
+type BlockRequest struct {
+	Keys []string
+	// Head selects the end elements are popped from.
+	Head bool
+	// Count is the maximum number of elements to pop.
+	Count int
+	// With Move set the element is pushed to Dst instead, at its head when
+	// ToHead is set.
+	Move   bool
+	Dst    string
+	ToHead bool
+	// With ZSet set members are popped from a sorted set instead, the
+	// lowest scores first when Head is set.
+	ZSet bool
+	// With Stream set up to Count entries, all of them when zero, are read
+	// from the streams at Keys instead, after the ID at the same position
+	// in IDs or "$" for the last one. With a Group the ID ">" reads entries
+	// never delivered to the group on behalf of Consumer.
+	Stream   bool
+	IDs      []string
+	Group    string
+	Consumer string
+	NoAck    bool
+	// Propagate returns the command that replicates the operation once it
+	// has been performed on key.
+	Propagate func(key string, values []string) []string
+}
+
+// BlockResult is the outcome of a BlockRequest.
+type BlockResult struct {
+	Key     string
+	Values  []string
+	Members []ScoreMember
+	Streams []StreamRead
+	Err     error
+}
+
+// Waiter is a client parked on a BlockRequest. Its Ready channel is closed
+// once the request has been served.
+type Waiter struct {
+	req    BlockRequest
+	ready  chan struct{}
+	served bool
+	result BlockResult
+}
+
+// Ready returns the channel closed when the waiter is served.
+func (w *Waiter) Ready() <-chan struct{} {
+	return w.ready
+}
+
+// signalReady queues key to have its blocked clients served, if it has any.
+// The caller must hold the mutex.
+func (ms *MemoryStorage) signalReady(key string) {
+	if len(ms.blocked[key]) == 0 {
+		return
+	}
+	if _, queued := ms.readySet[key]; queued {
+		return
+	}
+	ms.readySet[key] = struct{}{}
+	ms.readyKeys = append(ms.readyKeys, key)
+}
+
+// available reports whether key holds elements req can take, failing when
+// it holds a value of another type. The caller must hold the mutex.
+func (ms *MemoryStorage) available(req BlockRequest, key string) (bool, error) {
+	if req.Stream {
+		return ms.streamReadable(req, keyIndex(req.Keys, key))
+	}
+	if req.ZSet {
+		z, err := ms.lookupZSet(key)
+		return z != nil, err
+	}
+	list, err := ms.lookupList(key)
+	return list != nil, err
+}
+
+// perform runs req against key, which must hold elements. The caller must
+// hold the mutex.
+func (ms *MemoryStorage) perform(req BlockRequest, key string) BlockResult {
+	if req.Stream {
+		entries := ms.streamRead(req, keyIndex(req.Keys, key))
+		return BlockResult{Key: key, Streams: []StreamRead{{Key: key, Entries: entries}}}
+	}
+	if req.ZSet {
+		members, _ := ms.zpop(key, req.Count, !req.Head)
+		return BlockResult{Key: key, Members: members}
+	}
+	if req.Move {
+		value, _, err := ms.lmove(key, req.Dst, req.Head, req.ToHead)
+		if err != nil {
+			return BlockResult{Key: key, Err: err}
+		}
+		return BlockResult{Key: key, Values: []string{value}}
+	}
+	values, _, _ := ms.pop(key, req.Count, req.Head)
+	return BlockResult{Key: key, Values: values}
+}
+
+// BlockOn performs req right away if one of its keys holds elements. If
+// none does and wait is set, it registers a Waiter behind the clients
+// already blocked on those keys instead; otherwise both results are nil.
+// A stream request reads every stream that has entries for it at once.
+func (ms *MemoryStorage) BlockOn(req BlockRequest, wait bool) (*BlockResult, *Waiter) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if req.Stream {
+		// Streams are read all at once rather than the first that can be.
+		req.IDs = append([]string(nil), req.IDs...)
+		streams, key, err := ms.streamReadAll(&req)
+		if err != nil {
+			return &BlockResult{Key: key, Err: err}, nil
+		}
+		if len(streams) > 0 {
+			return &BlockResult{Streams: streams}, nil
+		}
+	} else {
+		for _, key := range req.Keys {
+			ok, err := ms.available(req, key)
+			if err != nil {
+				return &BlockResult{Key: key, Err: err}, nil
+			}
+			if ok {
+				result := ms.perform(req, key)
+				return &result, nil
+			}
+		}
+	}
+	if !wait {
+		return nil, nil
+	}
+
+	w := &Waiter{req: req, ready: make(chan struct{})}
+	for _, key := range req.Keys {
+		ms.blocked[key] = append(ms.blocked[key], w)
+	}
+	return nil, w
+}
+
+// Unblock withdraws w and returns its result if it was served meanwhile.
+func (ms *MemoryStorage) Unblock(w *Waiter) *BlockResult {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if w.served {
+		return &w.result
+	}
+	ms.unregister(w)
+	return nil
+}
+
+// unregister removes w from the queue of every key it waits on. The caller
+// must hold the mutex.
+func (ms *MemoryStorage) unregister(w *Waiter) {
+	for _, key := range w.req.Keys {
+		queue := ms.blocked[key]
+		for i, other := range queue {
+			if other == w {
+				queue = append(queue[:i], queue[i+1:]...)
+				break
+			}
+		}
+		if len(queue) == 0 {
+			delete(ms.blocked, key)
+		} else {
+			ms.blocked[key] = queue
+		}
+	}
+}
+
+// ServeBlocked serves the clients blocked on keys that received elements
+// since the last call, oldest waiter first, and returns the commands that
+// replicate what they did. Moving an element to a key with waiters of its
+// own makes that key ready in turn, so chains of BLMOVE are followed until
+// no ready key is left.
+func (ms *MemoryStorage) ServeBlocked() [][]string {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	var propagate [][]string
+	for len(ms.readyKeys) > 0 {
+		key := ms.readyKeys[0]
+		ms.readyKeys = ms.readyKeys[1:]
+		delete(ms.readySet, key)
+
+		for {
+			w := ms.nextWaiter(key)
+			if w == nil {
+				break
+			}
+			ms.unregister(w)
+			w.result = ms.perform(w.req, key)
+			w.served = true
+			if w.result.Err == nil && w.req.Propagate != nil {
+				propagate = append(propagate, w.req.Propagate(key, w.result.Values))
+			}
+			close(w.ready)
+		}
+	}
+	return propagate
+}
+
+// nextWaiter returns the oldest client blocked on key that can be served
+// with what key holds now. Clients waiting for another type keep waiting.
+// The caller must hold the mutex.
+func (ms *MemoryStorage) nextWaiter(key string) *Waiter {
+	for _, w := range ms.blocked[key] {
+		if ok, err := ms.available(w.req, key); ok && err == nil {
+			return w
+		}
+	}
+	return nil
+}
+
+func keyIndex(keys []string, key string) int {
+	for i, k := range keys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
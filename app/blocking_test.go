@@ -0,0 +1,61 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestServeBlockedFIFO(t *testing.T) {
+	ms := NewMemoryStorage()
+	pop := func(key string, values []string) []string { return []string{"LPOP", key} }
+	var waiters []*Waiter
+	for i := 0; i < 3; i++ {
+		result, w := ms.BlockOn(BlockRequest{Keys: []string{"q"}, Head: true, Count: 1, Propagate: pop}, true)
+		if result != nil || w == nil {
+			t.Fatalf("BlockOn on an empty key = %v, %v", result, w)
+		}
+		waiters = append(waiters, w)
+	}
+
+	ms.Push("q", []string{"a", "b"}, false, false)
+	propagated := ms.ServeBlocked()
+	if want := [][]string{{"LPOP", "q"}, {"LPOP", "q"}}; !reflect.DeepEqual(propagated, want) {
+		t.Fatalf("propagated %v, want %v", propagated, want)
+	}
+	for i, want := range []string{"a", "b"} {
+		select {
+		case <-waiters[i].Ready():
+		default:
+			t.Fatalf("waiter %d not served", i)
+		}
+		if result := ms.Unblock(waiters[i]); result == nil || result.Values[0] != want {
+			t.Errorf("waiter %d got %v, want %q", i, result, want)
+		}
+	}
+	if result := ms.Unblock(waiters[2]); result != nil {
+		t.Errorf("third waiter served with %v", result)
+	}
+	if len(ms.blocked) != 0 {
+		t.Errorf("waiters left behind: %v", ms.blocked)
+	}
+}
+
+func TestServeBlockedMoveChain(t *testing.T) {
+	ms := NewMemoryStorage()
+	_, second := ms.BlockOn(BlockRequest{Keys: []string{"mid"}, Head: true, Count: 1, Move: true, Dst: "dst"}, true)
+	_, first := ms.BlockOn(BlockRequest{Keys: []string{"src"}, Head: true, Count: 1, Move: true, Dst: "mid"}, true)
+
+	ms.Push("src", []string{"x"}, false, false)
+	ms.ServeBlocked()
+	for _, w := range []*Waiter{first, second} {
+		if result := ms.Unblock(w); result == nil || result.Values[0] != "x" {
+			t.Fatalf("waiter got %v, want x", result)
+		}
+	}
+	if values, _ := ms.LRange("dst", 0, -1); !reflect.DeepEqual(values, []string{"x"}) {
+		t.Errorf("dst = %v, want [x]", values)
+	}
+	if n := ms.CountExisting([]string{"src", "mid"}); n != 0 {
+		t.Errorf("%d intermediate lists left", n)
+	}
+}
@@ -1,10 +1,31 @@
 package app
 
+import (
+	"errors"
+	"os"
+	"rednav/utils"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
 type Config struct {
 	Port        int
 	Host        string
 	Master_host string
 	Master_port int
+	RequirePass string
+	// NotifyKeyspaceEvents holds the keyspace event classes published from
+	// startup on, see ParseKeyspaceEvents.
+	NotifyKeyspaceEvents int
+	// Dir and DBFilename locate the RDB file the dataset is loaded from at
+	// startup and saved to by SAVE and BGSAVE.
+	Dir        string
+	DBFilename string
+	// ClusterEnabled is set on the nodes of a cluster, where the keys and
+	// shard channels of a command must hash to the same slot. Rednav runs
+	// standalone, so it is never set.
+	ClusterEnabled bool
 }
 
 func NewConfig(host string, port int, replica_host string, replica_port int) *Config {
@@ -13,5 +34,121 @@ func NewConfig(host string, port int, replica_host string, replica_port int) *Co
 		Port:        port,
 		Master_host: replica_host,
 		Master_port: replica_port,
+		Dir:         ".",
+		DBFilename:  "dump.rdb",
+	}
+}
+
+var (
+	ErrConfigImmutable = errors.New("can't set immutable config")
+	ErrDBFilenamePath  = errors.New("dbfilename can't be a path, just a filename")
+)
+
+// configParameter is a parameter CONFIG GET reports; those without set are
+// fixed at startup.
+type configParameter struct {
+	name string
+	get  func(v *Vault) string
+	set  func(v *Vault, value string) error
+}
+
+var configParameters = []configParameter{
+	{
+		name: "port",
+		get:  func(v *Vault) string { return strconv.Itoa(v.config.Port) },
+	},
+	{
+		name: "bind",
+		get:  func(v *Vault) string { return v.config.Host },
+	},
+	{
+		name: "requirepass",
+		get:  func(v *Vault) string { return v.config.RequirePass },
+	},
+	{
+		name: "cluster-enabled",
+		get: func(v *Vault) string {
+			if v.config.ClusterEnabled {
+				return "yes"
+			}
+			return "no"
+		},
+	},
+	{
+		name: "notify-keyspace-events",
+		get:  func(v *Vault) string { return FormatKeyspaceEvents(v.memory.NotifyKeyspaceEvents()) },
+		set: func(v *Vault, value string) error {
+			flags, err := ParseKeyspaceEvents(value)
+			if err != nil {
+				return err
+			}
+			v.memory.SetNotifyKeyspaceEvents(flags)
+			return nil
+		},
+	},
+	{
+		name: "dir",
+		get: func(v *Vault) string {
+			v.persistence.mu.Lock()
+			defer v.persistence.mu.Unlock()
+			return v.persistence.dir
+		},
+		set: func(v *Vault, value string) error {
+			info, err := os.Stat(value)
+			if err != nil {
+				return errors.Unwrap(err)
+			}
+			if !info.IsDir() {
+				return syscall.ENOTDIR
+			}
+			v.persistence.mu.Lock()
+			defer v.persistence.mu.Unlock()
+			v.persistence.dir = value
+			return nil
+		},
+	},
+	{
+		name: "dbfilename",
+		get: func(v *Vault) string {
+			v.persistence.mu.Lock()
+			defer v.persistence.mu.Unlock()
+			return v.persistence.dbfilename
+		},
+		set: func(v *Vault, value string) error {
+			if strings.ContainsRune(value, os.PathSeparator) {
+				return ErrDBFilenamePath
+			}
+			v.persistence.mu.Lock()
+			defer v.persistence.mu.Unlock()
+			v.persistence.dbfilename = value
+			return nil
+		},
+	},
+}
+
+// ConfigGet returns the names and values of the parameters matching a
+// glob-style pattern.
+func (v *Vault) ConfigGet(pattern string) ([]string, []string) {
+	var names, values []string
+	for _, p := range configParameters {
+		if utils.StringMatch(pattern, p.name, true) {
+			names = append(names, p.name)
+			values = append(values, p.get(v))
+		}
+	}
+	return names, values
+}
+
+// ConfigSet changes a parameter, reporting whether it exists.
+func (v *Vault) ConfigSet(name string, value string) (bool, error) {
+	for _, p := range configParameters {
+		if p.name != name {
+			continue
+		}
+		if p.set == nil {
+			return true, ErrConfigImmutable
+		}
+		return true, p.set(v, value)
 	}
+	return false, nil
 }
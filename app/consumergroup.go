@@ -0,0 +1,681 @@
+package app
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ErrNoGroup     = errors.New("NOGROUP No such key or consumer group")
+	ErrBusyGroup   = errors.New("BUSYGROUP Consumer Group name already exists")
+	ErrXGroupNoKey = errors.New("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+)
+
+// streamNACK is an entry of a pending entries list: delivered to a
+// consumer but not acknowledged yet. Times are in Unix milliseconds.
+type streamNACK struct {
+	id            StreamID
+	consumer      *streamConsumer
+	deliveryTime  int64
+	deliveryCount int64
+}
+
+type streamConsumer struct {
+	name     string
+	seenTime int64
+	// activeTime is when the consumer last read or claimed entries, -1
+	// until it does.
+	activeTime int64
+	pending    int
+}
+
+// streamGroup is a consumer group. Its pending entries list is kept sorted
+// by ID and shared by its consumers, each NACK pointing to its owner.
+type streamGroup struct {
+	lastID StreamID
+	// entriesRead counts the entries the group read since the stream was
+	// created, -1 when unknown.
+	entriesRead int64
+	pel         []*streamNACK
+	consumers   map[string]*streamConsumer
+}
+
+func newStreamGroup(lastID StreamID, entriesRead int64) *streamGroup {
+	return &streamGroup{lastID: lastID, entriesRead: entriesRead, consumers: make(map[string]*streamConsumer)}
+}
+
+func nowMs() int64 {
+	return time.Now().UnixMilli()
+}
+
+// consumer returns the named consumer, creating it when create is set.
+func (g *streamGroup) consumer(name string, create bool) *streamConsumer {
+	c, exists := g.consumers[name]
+	if !exists && create {
+		c = &streamConsumer{name: name, seenTime: nowMs(), activeTime: -1}
+		g.consumers[name] = c
+	}
+	return c
+}
+
+// createConsumer returns the named consumer of g, a group of the stream at
+// key, creating it if needed. The caller must hold the mutex.
+func (ms *MemoryStorage) createConsumer(key string, g *streamGroup, name string) *streamConsumer {
+	if c := g.consumer(name, false); c != nil {
+		return c
+	}
+	c := g.consumer(name, true)
+	ms.notify(NOTIFY_STREAM, "xgroup-createconsumer", key)
+	return c
+}
+
+// pelSearch returns the position of the first NACK whose ID is id or larger.
+func (g *streamGroup) pelSearch(id StreamID) int {
+	return sort.Search(len(g.pel), func(i int) bool {
+		return g.pel[i].id.Compare(id) >= 0
+	})
+}
+
+func (g *streamGroup) pelFind(id StreamID) (int, *streamNACK) {
+	i := g.pelSearch(id)
+	if i < len(g.pel) && g.pel[i].id == id {
+		return i, g.pel[i]
+	}
+	return i, nil
+}
+
+func (g *streamGroup) pelInsert(i int, nack *streamNACK) {
+	g.pel = append(g.pel, nil)
+	copy(g.pel[i+1:], g.pel[i:])
+	g.pel[i] = nack
+	nack.consumer.pending++
+}
+
+func (g *streamGroup) pelRemove(i int) {
+	g.pel[i].consumer.pending--
+	g.pel = append(g.pel[:i], g.pel[i+1:]...)
+}
+
+// assign hands nack over to c.
+func (nack *streamNACK) assign(c *streamConsumer) {
+	nack.consumer.pending--
+	nack.consumer = c
+	c.pending++
+}
+
+// deliver hands c up to count entries never delivered to the group,
+// recording them as pending unless noAck is set.
+func (g *streamGroup) deliver(s *streamValue, c *streamConsumer, count int, noAck bool) []StreamEntry {
+	now := nowMs()
+	c.seenTime = now
+	start, ok := g.lastID.Next()
+	if !ok {
+		return nil
+	}
+	entries := s.rangeOf(start, maxStreamID, count, false)
+	for _, entry := range entries {
+		if g.entriesRead != -1 && !s.hasTombstones(entry.ID) {
+			g.entriesRead++
+		} else if s.entriesAdded > 0 {
+			g.entriesRead = s.estimateEntriesRead(entry.ID)
+		}
+		g.lastID = entry.ID
+		if noAck {
+			continue
+		}
+		// The ID may be pending already when the group was moved back.
+		i, nack := g.pelFind(entry.ID)
+		if nack != nil {
+			nack.assign(c)
+			nack.deliveryTime, nack.deliveryCount = now, 1
+		} else {
+			g.pelInsert(i, &streamNACK{id: entry.ID, consumer: c, deliveryTime: now, deliveryCount: 1})
+		}
+	}
+	if len(entries) > 0 {
+		c.activeTime = now
+	}
+	return entries
+}
+
+// history returns up to count entries pending for c with an ID above
+// after, counting them as delivered once more. Deleted entries come back
+// with nil fields.
+func (g *streamGroup) history(s *streamValue, c *streamConsumer, after StreamID, count int) []StreamEntry {
+	now := nowMs()
+	c.seenTime = now
+	entries := []StreamEntry{}
+	start, ok := after.Next()
+	if !ok {
+		return entries
+	}
+	for _, nack := range g.pel[g.pelSearch(start):] {
+		if count > 0 && len(entries) >= count {
+			break
+		}
+		if nack.consumer != c {
+			continue
+		}
+		entry, exists := s.lookupEntry(nack.id)
+		if !exists {
+			entries = append(entries, StreamEntry{ID: nack.id})
+			continue
+		}
+		nack.deliveryTime = now
+		nack.deliveryCount++
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (g *streamGroup) copy() *streamGroup {
+	dup := newStreamGroup(g.lastID, g.entriesRead)
+	for name, c := range g.consumers {
+		clone := *c
+		dup.consumers[name] = &clone
+	}
+	dup.pel = make([]*streamNACK, len(g.pel))
+	for i, nack := range g.pel {
+		clone := *nack
+		clone.consumer = dup.consumers[nack.consumer.name]
+		dup.pel[i] = &clone
+	}
+	return dup
+}
+
+// lookupGroup returns the stream at key and its named group, failing with
+// ErrNoGroup when either is missing. The caller must hold the mutex.
+func (ms *MemoryStorage) lookupGroup(key string, group string) (*streamValue, *streamGroup, error) {
+	s, err := ms.lookupStream(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s == nil || s.groups[group] == nil {
+		return nil, nil, ErrNoGroup
+	}
+	return s, s.groups[group], nil
+}
+
+// parseGroupID parses the ID a group is created or moved at, "$" standing
+// for the last ID of s.
+func parseGroupID(s *streamValue, arg string) (StreamID, error) {
+	if arg == "$" {
+		return s.lastID, nil
+	}
+	id, ok := ParseStreamID(arg, 0)
+	if !ok {
+		return id, ErrStreamID
+	}
+	return id, nil
+}
+
+// XGroupCreate creates a consumer group on the stream at key, which is
+// created empty when missing if mkStream is set. The group starts after id
+// having read entriesRead entries, -1 when unknown.
+func (ms *MemoryStorage) XGroupCreate(key string, group string, id string, mkStream bool, entriesRead int64) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupStream(key)
+	if err != nil {
+		return err
+	}
+	current := s
+	if current == nil {
+		if !mkStream {
+			return ErrXGroupNoKey
+		}
+		current = newStream()
+	}
+	lastID, err := parseGroupID(current, id)
+	if err != nil {
+		return err
+	}
+	if current.groups[group] != nil {
+		return ErrBusyGroup
+	}
+	if s == nil {
+		s = current
+		ms.set(key, Item{Value: s})
+	}
+	s.groups[group] = newStreamGroup(lastID, entriesRead)
+	ms.signalModified(key)
+	ms.notify(NOTIFY_STREAM, "xgroup-create", key)
+	return nil
+}
+
+// XGroupSetID moves the last delivered ID of a consumer group.
+func (ms *MemoryStorage) XGroupSetID(key string, group string, id string, entriesRead int64) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupStream(key)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return ErrXGroupNoKey
+	}
+	g := s.groups[group]
+	if g == nil {
+		return ErrNoGroup
+	}
+	lastID, err := parseGroupID(s, id)
+	if err != nil {
+		return err
+	}
+	g.lastID, g.entriesRead = lastID, entriesRead
+	ms.signalModified(key)
+	ms.notify(NOTIFY_STREAM, "xgroup-setid", key)
+	return nil
+}
+
+// XGroupDestroy deletes a consumer group and reports whether it existed.
+func (ms *MemoryStorage) XGroupDestroy(key string, group string) (bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupStream(key)
+	if err != nil {
+		return false, err
+	}
+	if s == nil {
+		return false, ErrXGroupNoKey
+	}
+	if s.groups[group] == nil {
+		return false, nil
+	}
+	delete(s.groups, group)
+	ms.signalModified(key)
+	ms.notify(NOTIFY_STREAM, "xgroup-destroy", key)
+	return true, nil
+}
+
+// XGroupCreateConsumer adds a consumer to a group and reports whether it
+// was created.
+func (ms *MemoryStorage) XGroupCreateConsumer(key string, group string, consumer string) (bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupStream(key)
+	if err != nil {
+		return false, err
+	}
+	if s == nil {
+		return false, ErrXGroupNoKey
+	}
+	g := s.groups[group]
+	if g == nil {
+		return false, ErrNoGroup
+	}
+	if g.consumer(consumer, false) != nil {
+		return false, nil
+	}
+	ms.createConsumer(key, g, consumer)
+	ms.signalModified(key)
+	return true, nil
+}
+
+// XGroupDelConsumer deletes a consumer along with its pending entries and
+// returns how many it had.
+func (ms *MemoryStorage) XGroupDelConsumer(key string, group string, consumer string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupStream(key)
+	if err != nil {
+		return 0, err
+	}
+	if s == nil {
+		return 0, ErrXGroupNoKey
+	}
+	g := s.groups[group]
+	if g == nil {
+		return 0, ErrNoGroup
+	}
+	c := g.consumer(consumer, false)
+	if c == nil {
+		return 0, nil
+	}
+	pending := c.pending
+	kept := g.pel[:0]
+	for _, nack := range g.pel {
+		if nack.consumer != c {
+			kept = append(kept, nack)
+		}
+	}
+	g.pel = kept
+	delete(g.consumers, consumer)
+	ms.signalModified(key)
+	ms.notify(NOTIFY_STREAM, "xgroup-delconsumer", key)
+	return pending, nil
+}
+
+// XAck acknowledges entries pending in a group and returns how many were.
+func (ms *MemoryStorage) XAck(key string, group string, ids []StreamID) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	_, g, err := ms.lookupGroup(key, group)
+	if err == ErrNoGroup {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	acked := 0
+	for _, id := range ids {
+		if i, nack := g.pelFind(id); nack != nil {
+			g.pelRemove(i)
+			acked++
+		}
+	}
+	return acked, nil
+}
+
+// StreamConsumerPending is the number of entries pending for a consumer.
+type StreamConsumerPending struct {
+	Name  string
+	Count int
+}
+
+// StreamPendingSummary sums up the pending entries list of a group.
+type StreamPendingSummary struct {
+	Count       int
+	First, Last StreamID
+	Consumers   []StreamConsumerPending
+}
+
+// StreamPending is an entry of a pending entries list, with its idle time
+// in milliseconds.
+type StreamPending struct {
+	ID            StreamID
+	Consumer      string
+	Idle          int64
+	DeliveryCount int64
+}
+
+// XPendingSummary sums up the pending entries list of a group, its
+// consumers ordered by name.
+func (ms *MemoryStorage) XPendingSummary(key string, group string) (StreamPendingSummary, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	var summary StreamPendingSummary
+	_, g, err := ms.lookupGroup(key, group)
+	if err != nil || len(g.pel) == 0 {
+		return summary, err
+	}
+	summary.Count = len(g.pel)
+	summary.First, summary.Last = g.pel[0].id, g.pel[len(g.pel)-1].id
+	for _, c := range g.consumers {
+		if c.pending > 0 {
+			summary.Consumers = append(summary.Consumers, StreamConsumerPending{Name: c.name, Count: c.pending})
+		}
+	}
+	sort.Slice(summary.Consumers, func(i, j int) bool {
+		return summary.Consumers[i].Name < summary.Consumers[j].Name
+	})
+	return summary, nil
+}
+
+// XPending returns up to count entries pending in a group with IDs between
+// start and end, idle for at least minIdle milliseconds, only those of
+// consumer when it is not empty.
+func (ms *MemoryStorage) XPending(key string, group string, start StreamID, end StreamID, count int, consumer string, minIdle int64) ([]StreamPending, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	_, g, err := ms.lookupGroup(key, group)
+	if err != nil {
+		return nil, err
+	}
+	now := nowMs()
+	pending := []StreamPending{}
+	for _, nack := range g.pel[g.pelSearch(start):] {
+		if len(pending) >= count || nack.id.Compare(end) > 0 {
+			break
+		}
+		idle := now - nack.deliveryTime
+		if (consumer != "" && nack.consumer.name != consumer) || idle < minIdle {
+			continue
+		}
+		pending = append(pending, StreamPending{ID: nack.id, Consumer: nack.consumer.name, Idle: idle, DeliveryCount: nack.deliveryCount})
+	}
+	return pending, nil
+}
+
+// StreamClaim holds the options of XCLAIM. DeliveryTime is in Unix
+// milliseconds, zero for now, and a negative RetryCount leaves the delivery
+// count to be incremented. A LastID above the one of the group moves it.
+type StreamClaim struct {
+	MinIdle      int64
+	DeliveryTime int64
+	RetryCount   int64
+	Force        bool
+	JustID       bool
+	LastID       StreamID
+}
+
+// claim hands nack over to c as XCLAIM and XAUTOCLAIM do.
+func (nack *streamNACK) claim(c *streamConsumer, deliveryTime int64, retryCount int64, justID bool) {
+	nack.assign(c)
+	nack.deliveryTime = deliveryTime
+	if retryCount >= 0 {
+		nack.deliveryCount = retryCount
+	} else if !justID {
+		nack.deliveryCount++
+	}
+}
+
+// XClaim transfers the pending entries ids idle for at least opts.MinIdle
+// milliseconds to consumer. It returns the claimed entries, with nil fields
+// under JustID, and the IDs whose entries were deleted, which are dropped
+// from the pending entries list instead.
+func (ms *MemoryStorage) XClaim(key string, group string, consumer string, ids []StreamID, opts StreamClaim) ([]StreamEntry, []StreamID, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, g, err := ms.lookupGroup(key, group)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := nowMs()
+	deliveryTime := opts.DeliveryTime
+	if deliveryTime == 0 || deliveryTime > now {
+		deliveryTime = now
+	}
+	if opts.LastID.Compare(g.lastID) > 0 {
+		g.lastID = opts.LastID
+	}
+	c := ms.createConsumer(key, g, consumer)
+	c.seenTime = now
+
+	claimed := []StreamEntry{}
+	var deleted []StreamID
+	for _, id := range ids {
+		i, nack := g.pelFind(id)
+		entry, exists := s.lookupEntry(id)
+		if nack == nil {
+			if !opts.Force || !exists {
+				continue
+			}
+			nack = &streamNACK{id: id, consumer: c, deliveryTime: now, deliveryCount: 1}
+			g.pelInsert(i, nack)
+		}
+		if opts.MinIdle > 0 && now-nack.deliveryTime < opts.MinIdle {
+			continue
+		}
+		if !exists {
+			g.pelRemove(i)
+			deleted = append(deleted, id)
+			continue
+		}
+		nack.claim(c, deliveryTime, opts.RetryCount, opts.JustID)
+		if opts.JustID {
+			entry.Fields = nil
+		}
+		claimed = append(claimed, entry)
+		c.activeTime = now
+	}
+	return claimed, deleted, nil
+}
+
+// XAutoClaim transfers to consumer up to count pending entries from start
+// on that have been idle for at least minIdle milliseconds, examining at
+// most ten times count of them. It returns the ID to continue from, 0-0
+// once the whole list was scanned, the claimed entries and the IDs of
+// deleted entries dropped on the way.
+func (ms *MemoryStorage) XAutoClaim(key string, group string, consumer string, minIdle int64, start StreamID, count int, justID bool) (StreamID, []StreamEntry, []StreamID, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, g, err := ms.lookupGroup(key, group)
+	if err != nil {
+		return StreamID{}, nil, nil, err
+	}
+	now := nowMs()
+	c := ms.createConsumer(key, g, consumer)
+	c.seenTime = now
+
+	claimed := []StreamEntry{}
+	deleted := []StreamID{}
+	i := g.pelSearch(start)
+	for attempts := count * 10; attempts > 0 && len(claimed) < count && i < len(g.pel); attempts-- {
+		nack := g.pel[i]
+		if now-nack.deliveryTime < minIdle {
+			i++
+			continue
+		}
+		entry, exists := s.lookupEntry(nack.id)
+		if !exists {
+			deleted = append(deleted, nack.id)
+			g.pelRemove(i)
+			continue
+		}
+		nack.claim(c, now, -1, justID)
+		if justID {
+			entry.Fields = nil
+		}
+		claimed = append(claimed, entry)
+		c.activeTime = now
+		i++
+	}
+	next := StreamID{}
+	if i < len(g.pel) {
+		next = g.pel[i].id
+	}
+	return next, claimed, deleted, nil
+}
+
+// StreamInfo describes a stream as XINFO STREAM does. First and Last are
+// nil for an empty stream.
+type StreamInfo struct {
+	Length       int
+	LastID       StreamID
+	MaxDeletedID StreamID
+	EntriesAdded uint64
+	FirstID      StreamID
+	Groups       int
+	First, Last  *StreamEntry
+}
+
+// StreamGroupInfo describes a consumer group as XINFO GROUPS does. An
+// unknown EntriesRead or Lag is -1.
+type StreamGroupInfo struct {
+	Name        string
+	Consumers   int
+	Pending     int
+	LastID      StreamID
+	EntriesRead int64
+	Lag         int64
+}
+
+// StreamConsumerInfo describes a consumer as XINFO CONSUMERS does, with
+// times in milliseconds. Inactive is -1 for a consumer that never read.
+type StreamConsumerInfo struct {
+	Name     string
+	Pending  int
+	Idle     int64
+	Inactive int64
+}
+
+// XInfoStream describes the stream at key, returning false if it is missing.
+func (ms *MemoryStorage) XInfoStream(key string) (StreamInfo, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupStream(key)
+	if s == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || s == nil {
+		return StreamInfo{}, false, err
+	}
+	info := StreamInfo{
+		Length:       s.Len(),
+		LastID:       s.lastID,
+		MaxDeletedID: s.maxDeletedID,
+		EntriesAdded: s.entriesAdded,
+		FirstID:      s.firstID(),
+		Groups:       len(s.groups),
+	}
+	if s.Len() > 0 {
+		first, last := s.entries[0], s.entries[s.Len()-1]
+		info.First, info.Last = &first, &last
+	}
+	return info, true, nil
+}
+
+// lag returns how many entries of s the group has yet to read, -1 when it
+// cannot be told.
+func (g *streamGroup) lag(s *streamValue) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+	if g.entriesRead != -1 && !s.hasTombstones(g.lastID) {
+		return int64(s.entriesAdded) - g.entriesRead
+	}
+	if read := s.estimateEntriesRead(g.lastID); read != -1 {
+		return int64(s.entriesAdded) - read
+	}
+	return -1
+}
+
+// XInfoGroups describes the consumer groups of the stream at key, ordered
+// by name. It returns false if the stream is missing.
+func (ms *MemoryStorage) XInfoGroups(key string) ([]StreamGroupInfo, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupStream(key)
+	if s == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || s == nil {
+		return nil, false, err
+	}
+	groups := []StreamGroupInfo{}
+	for name, g := range s.groups {
+		groups = append(groups, StreamGroupInfo{
+			Name:        name,
+			Consumers:   len(g.consumers),
+			Pending:     len(g.pel),
+			LastID:      g.lastID,
+			EntriesRead: g.entriesRead,
+			Lag:         g.lag(s),
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, true, nil
+}
+
+// XInfoConsumers describes the consumers of a group, ordered by name.
+func (ms *MemoryStorage) XInfoConsumers(key string, group string) ([]StreamConsumerInfo, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	_, g, err := ms.lookupGroup(key, group)
+	if err != nil {
+		return nil, err
+	}
+	now := nowMs()
+	consumers := []StreamConsumerInfo{}
+	for _, c := range g.consumers {
+		inactive := int64(-1)
+		if c.activeTime != -1 {
+			inactive = now - c.activeTime
+		}
+		consumers = append(consumers, StreamConsumerInfo{Name: c.name, Pending: c.pending, Idle: now - c.seenTime, Inactive: inactive})
+	}
+	sort.Slice(consumers, func(i, j int) bool { return consumers[i].Name < consumers[j].Name })
+	return consumers, nil
+}
@@ -0,0 +1,12 @@
+package app
+
+import "hash/crc64"
+
+// RDB files end with the CRC-64/Jones checksum of everything before it,
+// reflected, with no initial or final inversion. hash/crc64 inverts the
+// value on the way in and out, so crc64Update undoes both.
+var crc64JonesTable = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+func crc64Update(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, crc64JonesTable, p)
+}
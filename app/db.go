@@ -12,22 +12,202 @@ type Item struct {
 	Lifetime time.Time
 }
 
-// Stream struct to hold entries.
-type Stream struct {
-	Entries map[string]interface{}
-}
-
 // MemoryStorage struct to handle storage of items and streams.
 type MemoryStorage struct {
-	storage map[string]Item
-	mutex   sync.Mutex
+	storage *dict[Item]
+	// volatile lists the keys that carry a lifetime and expires maps each of
+	// them to its position in volatile, so the active expiry cycle can draw
+	// uniform random samples of volatile keys.
+	volatile []string
+	expires  map[string]int
+	// volatileHashes lists the hashes that may hold fields with an
+	// expiration, indexed by hashPos the same way, for the active expiry
+	// of fields.
+	volatileHashes []string
+	hashPos        map[string]int
+	stats          ExpireStats
+	lazyfree       LazyFreeStats
+	// blocked queues the clients waiting on each key in arrival order, and
+	// readyKeys the keys with waiters that received elements.
+	blocked   map[string][]*Waiter
+	readyKeys []string
+	readySet  map[string]struct{}
+	// watched lists the WATCHes on each key.
+	watched map[string][]*Watch
+	// notifyFlags selects the keyspace events handed to publish.
+	notifyFlags int
+	publish     func(channel string, message string)
+	// shared holds the values read by the snapshots being encoded, of which
+	// there are snapshots; they must be copied before being modified.
+	shared    map[interface{}]struct{}
+	snapshots int
+	// replica leaves expiry to the master: expired keys are hidden from
+	// clients but kept until the master deletes them, and seen as alive by
+	// the commands of the master, applied with masterLink set. On a master,
+	// propagate replays the deletions done by expiry on the replicas.
+	replica    bool
+	masterLink bool
+	propagate  func(command []string)
+	mutex      sync.Mutex
 }
 
 // NewMemoryStorage creates a new instance of MemoryStorage.
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		storage: make(map[string]Item),
+		storage:  newDict[Item](),
+		expires:  make(map[string]int),
+		hashPos:  make(map[string]int),
+		blocked:  make(map[string][]*Waiter),
+		readySet: make(map[string]struct{}),
+		watched:  make(map[string][]*Watch),
+	}
+}
+
+// lookup returns the live item stored at key, deleting it first if its
+// lifetime is over. The caller must hold the mutex.
+func (ms *MemoryStorage) lookup(key string) (Item, bool) {
+	item, exists := ms.storage.Get(key)
+	if !exists {
+		return Item{}, false
+	}
+	if !item.Lifetime.IsZero() && ms.Expired(item.Lifetime) && !ms.masterLink {
+		if !ms.replica {
+			ms.expire(key)
+		}
+		return Item{}, false
+	}
+	item = ms.unshare(key, item)
+	if h, ok := item.Value.(*hashValue); ok && h.volatile > 0 && !ms.replica && ms.purgeHash(key, h, time.Now()) {
+		return Item{}, false
+	}
+	return item, true
+}
+
+// unshare replaces the value of key with a copy if a snapshot still reads
+// it, so that the caller may modify it. The caller must hold the mutex.
+func (ms *MemoryStorage) unshare(key string, item Item) Item {
+	if !ms.isShared(item.Value) {
+		return item
+	}
+	delete(ms.shared, item.Value)
+	item.Value = copyValue(item.Value)
+	ms.storage.Set(key, item)
+	return item
+}
+
+// isShared reports whether a snapshot being encoded reads value. The
+// caller must hold the mutex.
+func (ms *MemoryStorage) isShared(value interface{}) bool {
+	if len(ms.shared) == 0 || !mutable(value) {
+		return false
 	}
+	_, shared := ms.shared[value]
+	return shared
+}
+
+// live reports whether item is visible to clients at now: its lifetime is
+// not over and, for a hash, not all its fields have expired.
+func live(item Item, now time.Time) bool {
+	if !item.Lifetime.IsZero() && now.After(item.Lifetime) {
+		return false
+	}
+	if h, ok := item.Value.(*hashValue); ok {
+		return h.live(now)
+	}
+	return true
+}
+
+// expire deletes key, whose lifetime is over. The caller must hold the
+// mutex.
+func (ms *MemoryStorage) expire(key string) {
+	ms.remove(key)
+	ms.stats.ExpiredKeys++
+	ms.propagateExpiry([]string{"DEL", key})
+	ms.notify(NOTIFY_EXPIRED, "expired", key)
+}
+
+// propagateExpiry hands the command replaying a deletion done by expiry to
+// the replicas. The caller must hold the mutex.
+func (ms *MemoryStorage) propagateExpiry(command []string) {
+	if ms.propagate != nil {
+		ms.propagate(command)
+	}
+}
+
+// SetExpiryPropagator sets the function the deletions done by expiry are
+// propagated with.
+func (ms *MemoryStorage) SetExpiryPropagator(propagate func(command []string)) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.propagate = propagate
+}
+
+// SetReplica makes expiry wait for the master, see lookup.
+func (ms *MemoryStorage) SetReplica(replica bool) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.replica = replica
+}
+
+// SetMasterLink tells whether the commands run next come from the master,
+// to which keys live until it deletes them.
+func (ms *MemoryStorage) SetMasterLink(applying bool) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.masterLink = applying
+}
+
+// set stores item at key, keeping the expires index in sync. The caller must
+// hold the mutex.
+func (ms *MemoryStorage) set(key string, item Item) {
+	if ms.notifyFlags&NOTIFY_NEW != 0 {
+		if _, exists := ms.storage.Get(key); !exists {
+			ms.notify(NOTIFY_NEW, "new", key)
+		}
+	}
+	ms.storage.Set(key, item)
+	ms.signalModified(key)
+	switch item.Value.(type) {
+	case *quicklist, *zsetValue, *streamValue:
+		ms.signalReady(key)
+	}
+	if h, ok := item.Value.(*hashValue); ok && h.volatile > 0 {
+		ms.setVolatileHash(key)
+	} else {
+		ms.unsetVolatileHash(key)
+	}
+	if item.Lifetime.IsZero() {
+		ms.unsetVolatile(key)
+	} else if _, volatile := ms.expires[key]; !volatile {
+		ms.expires[key] = len(ms.volatile)
+		ms.volatile = append(ms.volatile, key)
+	}
+}
+
+// unsetVolatile drops key from the volatile index, moving the last volatile
+// key into its slot.
+func (ms *MemoryStorage) unsetVolatile(key string) {
+	pos, volatile := ms.expires[key]
+	if !volatile {
+		return
+	}
+	last := ms.volatile[len(ms.volatile)-1]
+	ms.volatile[pos] = last
+	ms.expires[last] = pos
+	ms.volatile = ms.volatile[:len(ms.volatile)-1]
+	delete(ms.expires, key)
+}
+
+// remove deletes key, reporting whether it was present. The caller must hold
+// the mutex.
+func (ms *MemoryStorage) remove(key string) bool {
+	if !ms.storage.Delete(key) {
+		return false
+	}
+	ms.unsetVolatile(key)
+	ms.unsetVolatileHash(key)
+	ms.signalModified(key)
+	return true
 }
 
 // Save stores a value with an optional lifetime.
@@ -38,14 +218,14 @@ func (ms *MemoryStorage) Save(key string, value interface{}, lifetime *time.Time
 	if lifetime != nil {
 		item.Lifetime = *lifetime
 	}
-	ms.storage[key] = item
+	ms.set(key, item)
 }
 
 // Get retrieves a value by key.
 func (ms *MemoryStorage) Get(key string) interface{} {
 	ms.mutex.Lock()
 	defer ms.mutex.Unlock()
-	item, exists := ms.storage[key]
+	item, exists := ms.lookup(key)
 	fmt.Print("INFO || MEMORY || GET key=", key, " value=", item.Value, "\n")
 	if !exists {
 		return nil
@@ -58,18 +238,29 @@ func (ms *MemoryStorage) Get(key string) interface{} {
 func (ms *MemoryStorage) GetType(key string) string {
 	ms.mutex.Lock()
 	defer ms.mutex.Unlock()
-	item, exists := ms.storage[key]
-	if !exists || (!item.Lifetime.IsZero() && ms.Expired(item.Lifetime)) {
+	item, exists := ms.lookup(key)
+	if !exists {
 		return "none"
 	}
+	return typeName(item.Value)
+}
 
-	switch item.Value.(type) {
-	case string:
+// typeName returns the Redis type of a stored value, as reported by TYPE.
+// Counters stored as int64 are strings to clients.
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case string, int64:
 		return "string"
-	case int:
-		return "integer"
-	case float64:
-		return "float"
+	case *quicklist:
+		return "list"
+	case *hashValue:
+		return "hash"
+	case *setValue:
+		return "set"
+	case *zsetValue:
+		return "zset"
+	case *streamValue:
+		return "stream"
 	default:
 		return "unknown"
 	}
@@ -79,8 +270,9 @@ func (ms *MemoryStorage) GetType(key string) string {
 func (ms *MemoryStorage) Delete(key string) int {
 	ms.mutex.Lock()
 	defer ms.mutex.Unlock()
-	if _, exists := ms.storage[key]; exists {
-		delete(ms.storage, key)
+	if _, exists := ms.lookup(key); exists {
+		ms.remove(key)
+		ms.notify(NOTIFY_GENERIC, "del", key)
 		return 1
 	}
 	return 0
@@ -95,20 +287,21 @@ func (ms *MemoryStorage) Expired(lifetime time.Time) bool {
 func (ms *MemoryStorage) PrintAll() {
 	ms.mutex.Lock()
 	defer ms.mutex.Unlock()
-	if len(ms.storage) == 0 {
+	if ms.storage.Len() == 0 {
 		fmt.Println("Memory is empty")
 		return
 	}
-	for key, item := range ms.storage {
+	ms.storage.Range(func(key string, item Item) bool {
 		fmt.Printf("%s: %v\n", key, item.Value)
-	}
+		return true
+	})
 }
 
 // Exists checks if a key exists in storage.
 func (ms *MemoryStorage) Exists(key string) bool {
 	ms.mutex.Lock()
 	defer ms.mutex.Unlock()
-	_, exists := ms.storage[key]
+	_, exists := ms.lookup(key)
 	return exists
 }
 
@@ -116,10 +309,14 @@ func (ms *MemoryStorage) Exists(key string) bool {
 func (ms *MemoryStorage) Keys() []string {
 	ms.mutex.Lock()
 	defer ms.mutex.Unlock()
-	keys := make([]string, 0, len(ms.storage))
-	for key := range ms.storage {
-		keys = append(keys, key)
-	}
+	keys := make([]string, 0, ms.storage.Len())
+	now := time.Now()
+	ms.storage.Range(func(key string, item Item) bool {
+		if live(item, now) {
+			keys = append(keys, key)
+		}
+		return true
+	})
 	return keys
 }
 
@@ -127,5 +324,14 @@ func (ms *MemoryStorage) Keys() []string {
 func (ms *MemoryStorage) Flush() {
 	ms.mutex.Lock()
 	defer ms.mutex.Unlock()
-	ms.storage = make(map[string]Item)
+	for key := range ms.watched {
+		if _, exists := ms.storage.Get(key); exists {
+			ms.signalModified(key)
+		}
+	}
+	ms.storage = newDict[Item]()
+	ms.volatile = nil
+	ms.expires = make(map[string]int)
+	ms.volatileHashes = nil
+	ms.hashPos = make(map[string]int)
 }
@@ -0,0 +1,253 @@
+package app
+
+import (
+	"hash/maphash"
+	"math/bits"
+)
+
+const (
+	DICT_INITIAL_SIZE = 4
+	// A table shrinks when less than 1/DICT_MIN_FILL of its buckets are used.
+	DICT_MIN_FILL = 8
+)
+
+type dictEntry[V any] struct {
+	key  string
+	val  V
+	next *dictEntry[V]
+}
+
+// dict is a chained hash table with power of two sizes and incremental
+// rehashing, modeled on Redis's dict. Unlike a Go map it can be iterated
+// with a stateless cursor (see Scan) that stays valid while the table grows
+// or shrinks between calls.
+type dict[V any] struct {
+	seed  maphash.Seed
+	table [2][]*dictEntry[V]
+	used  [2]int
+	// rehashIdx is the next bucket of table[0] to move to table[1], or -1
+	// when no rehash is in progress.
+	rehashIdx int
+}
+
+func newDict[V any]() *dict[V] {
+	return &dict[V]{seed: maphash.MakeSeed(), rehashIdx: -1}
+}
+
+func (d *dict[V]) hash(key string) uint64 {
+	return maphash.String(d.seed, key)
+}
+
+func (d *dict[V]) isRehashing() bool {
+	return d.rehashIdx != -1
+}
+
+// Len returns the number of entries.
+func (d *dict[V]) Len() int {
+	return d.used[0] + d.used[1]
+}
+
+// rehashStep moves one bucket from the old table to the new one, visiting
+// at most ten empty buckets on the way.
+func (d *dict[V]) rehashStep() {
+	if !d.isRehashing() {
+		return
+	}
+	for empty := 0; d.rehashIdx < len(d.table[0]) && d.table[0][d.rehashIdx] == nil; empty++ {
+		if empty == 10 {
+			return
+		}
+		d.rehashIdx++
+	}
+	if d.rehashIdx < len(d.table[0]) {
+		mask := uint64(len(d.table[1]) - 1)
+		for entry := d.table[0][d.rehashIdx]; entry != nil; {
+			next := entry.next
+			idx := d.hash(entry.key) & mask
+			entry.next = d.table[1][idx]
+			d.table[1][idx] = entry
+			d.used[0]--
+			d.used[1]++
+			entry = next
+		}
+		d.table[0][d.rehashIdx] = nil
+		d.rehashIdx++
+	}
+	if d.used[0] == 0 {
+		d.table[0], d.table[1] = d.table[1], nil
+		d.used[0], d.used[1] = d.used[1], 0
+		d.rehashIdx = -1
+	}
+}
+
+// resize starts rehashing into a table able to hold size entries.
+func (d *dict[V]) resize(size int) {
+	newSize := DICT_INITIAL_SIZE
+	for newSize < size {
+		newSize *= 2
+	}
+	if d.table[0] == nil {
+		d.table[0] = make([]*dictEntry[V], newSize)
+		return
+	}
+	if newSize == len(d.table[0]) {
+		return
+	}
+	d.table[1] = make([]*dictEntry[V], newSize)
+	d.rehashIdx = 0
+}
+
+func (d *dict[V]) find(key string) *dictEntry[V] {
+	if d.Len() == 0 {
+		return nil
+	}
+	h := d.hash(key)
+	for t := 0; t < 2; t++ {
+		if d.table[t] == nil {
+			break
+		}
+		for entry := d.table[t][h&uint64(len(d.table[t])-1)]; entry != nil; entry = entry.next {
+			if entry.key == key {
+				return entry
+			}
+		}
+		if !d.isRehashing() {
+			break
+		}
+	}
+	return nil
+}
+
+// Get returns the value stored at key.
+func (d *dict[V]) Get(key string) (V, bool) {
+	d.rehashStep()
+	if entry := d.find(key); entry != nil {
+		return entry.val, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Set stores val at key and reports whether the key was added.
+func (d *dict[V]) Set(key string, val V) bool {
+	d.rehashStep()
+	if entry := d.find(key); entry != nil {
+		entry.val = val
+		return false
+	}
+	if d.table[0] == nil {
+		d.resize(DICT_INITIAL_SIZE)
+	} else if !d.isRehashing() && d.used[0] >= len(d.table[0]) {
+		d.resize(d.used[0] * 2)
+	}
+
+	t := 0
+	if d.isRehashing() {
+		t = 1
+	}
+	idx := d.hash(key) & uint64(len(d.table[t])-1)
+	d.table[t][idx] = &dictEntry[V]{key: key, val: val, next: d.table[t][idx]}
+	d.used[t]++
+	return true
+}
+
+// Delete removes key and reports whether it was present.
+func (d *dict[V]) Delete(key string) bool {
+	if d.Len() == 0 {
+		return false
+	}
+	d.rehashStep()
+	h := d.hash(key)
+	for t := 0; t < 2; t++ {
+		if d.table[t] == nil {
+			break
+		}
+		idx := h & uint64(len(d.table[t])-1)
+		for prev, entry := (*dictEntry[V])(nil), d.table[t][idx]; entry != nil; prev, entry = entry, entry.next {
+			if entry.key != key {
+				continue
+			}
+			if prev == nil {
+				d.table[t][idx] = entry.next
+			} else {
+				prev.next = entry.next
+			}
+			d.used[t]--
+			d.shrinkIfNeeded()
+			return true
+		}
+		if !d.isRehashing() {
+			break
+		}
+	}
+	return false
+}
+
+func (d *dict[V]) shrinkIfNeeded() {
+	size := len(d.table[0])
+	if d.isRehashing() || size <= DICT_INITIAL_SIZE || d.used[0]*DICT_MIN_FILL >= size {
+		return
+	}
+	d.resize(d.used[0])
+}
+
+// Range calls fn for every entry until it returns false. fn must not modify
+// the dict.
+func (d *dict[V]) Range(fn func(key string, val V) bool) {
+	for t := 0; t < 2; t++ {
+		for _, entry := range d.table[t] {
+			for ; entry != nil; entry = entry.next {
+				if !fn(entry.key, entry.val) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Scan calls fn for the entries of the bucket addressed by cursor and
+// returns the next cursor, 0 once the iteration is complete. The cursor is
+// advanced by incrementing its reversed bits, so buckets are visited in an
+// order where every bucket of a smaller or larger table maps to a contiguous
+// run; an entry present during the whole iteration is therefore returned at
+// least once even if the table is resized between calls. fn must not modify
+// the dict.
+func (d *dict[V]) Scan(cursor uint64, fn func(key string, val V)) uint64 {
+	if d.Len() == 0 {
+		return 0
+	}
+	emit := func(entry *dictEntry[V]) {
+		for ; entry != nil; entry = entry.next {
+			fn(entry.key, entry.val)
+		}
+	}
+
+	if !d.isRehashing() {
+		m0 := uint64(len(d.table[0]) - 1)
+		emit(d.table[0][cursor&m0])
+		cursor |= ^m0
+		cursor = bits.Reverse64(cursor)
+		cursor++
+		return bits.Reverse64(cursor)
+	}
+
+	t0, t1 := d.table[0], d.table[1]
+	if len(t0) > len(t1) {
+		t0, t1 = t1, t0
+	}
+	m0, m1 := uint64(len(t0)-1), uint64(len(t1)-1)
+	emit(t0[cursor&m0])
+	// Visit every bucket of the larger table that expands the bucket of the
+	// smaller one.
+	for {
+		emit(t1[cursor&m1])
+		cursor |= ^m1
+		cursor = bits.Reverse64(cursor)
+		cursor++
+		cursor = bits.Reverse64(cursor)
+		if cursor&(m0^m1) == 0 {
+			break
+		}
+	}
+	return cursor
+}
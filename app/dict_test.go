@@ -0,0 +1,73 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDictSetGetDelete(t *testing.T) {
+	d := newDict[int]()
+	for i := 0; i < 1000; i++ {
+		if !d.Set(fmt.Sprint(i), i) {
+			t.Fatalf("Key %d reported as existing", i)
+		}
+	}
+	if d.Set("7", 70) {
+		t.Errorf("Overwrite reported as insert")
+	}
+	for i := 0; i < 1000; i += 2 {
+		if !d.Delete(fmt.Sprint(i)) {
+			t.Fatalf("Key %d not deleted", i)
+		}
+	}
+	if d.Len() != 500 {
+		t.Fatalf("Unexpected length %d", d.Len())
+	}
+	for i := 0; i < 1000; i++ {
+		val, exists := d.Get(fmt.Sprint(i))
+		if exists != (i%2 == 1) {
+			t.Fatalf("Key %d: exists=%v", i, exists)
+		}
+		if i == 7 && val != 70 {
+			t.Errorf("Overwritten value lost: %d", val)
+		}
+	}
+}
+
+// Keys present for the whole iteration must be returned even when the table
+// grows and shrinks between SCAN calls.
+func TestDictScanWhileResizing(t *testing.T) {
+	d := newDict[int]()
+	for i := 0; i < 500; i++ {
+		d.Set(fmt.Sprintf("stable:%d", i), i)
+	}
+
+	seen := make(map[string]bool)
+	cursor, step := uint64(0), 0
+	for {
+		cursor = d.Scan(cursor, func(key string, val int) {
+			seen[key] = true
+		})
+		// Grow the table during the first half of the iteration and shrink
+		// it during the second.
+		if step < 50 {
+			for i := 0; i < 100; i++ {
+				d.Set(fmt.Sprintf("churn:%d:%d", step, i), i)
+			}
+		} else {
+			for i := 0; i < 100; i++ {
+				d.Delete(fmt.Sprintf("churn:%d:%d", step-50, i))
+			}
+		}
+		step++
+		if cursor == 0 {
+			break
+		}
+	}
+
+	for i := 0; i < 500; i++ {
+		if !seen[fmt.Sprintf("stable:%d", i)] {
+			t.Fatalf("Key stable:%d missed by scan after %d steps", i, step)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package app
+
+import "errors"
+
+// Errors returned by storage operations. Their text is the error reply sent
+// to clients, so each starts with the Redis error code.
+var (
+	ErrWrongType  = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	ErrNotInteger = errors.New("ERR value is not an integer or out of range")
+	ErrSyntax     = errors.New("ERR syntax error")
+)
@@ -0,0 +1,237 @@
+package app
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// Active expiry runs ACTIVE_EXPIRE_HZ times per second and may use up to
+	// ACTIVE_EXPIRE_CPU_PERC percent of each period, like Redis with hz 10.
+	ACTIVE_EXPIRE_HZ            = 10
+	ACTIVE_EXPIRE_CPU_PERC      = 25
+	ACTIVE_EXPIRE_KEYS_PER_LOOP = 20
+	// Keep sampling while more than this percentage of sampled keys were
+	// already expired.
+	ACTIVE_EXPIRE_ACCEPTABLE_STALE = 10
+)
+
+// ExpireStats are the expiry counters reported by INFO.
+type ExpireStats struct {
+	ExpiredKeys             int64
+	ExpiredStalePerc        float64
+	ExpiredTimeCapReached   int64
+	ExpireCycleCPUMillis    int64
+	expireCycleCPUMicrosAcc int64
+}
+
+// ActiveExpireLoop runs the active expiry cycle until stop is closed,
+// holding exclusive during each cycle so that the deletions it propagates
+// are not interleaved with a command and its own propagation.
+func (ms *MemoryStorage) ActiveExpireLoop(stop <-chan struct{}, exclusive sync.Locker) {
+	ticker := time.NewTicker(time.Second / ACTIVE_EXPIRE_HZ)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			exclusive.Lock()
+			ms.ActiveExpireCycle()
+			exclusive.Unlock()
+		}
+	}
+}
+
+// ActiveExpireCycle reclaims expired keys nobody reads. It repeatedly
+// samples volatile keys and deletes the expired ones, going on as long as the
+// share of expired keys in the sample stays above the acceptable threshold
+// and the time budget is not exhausted. The mutex is released between
+// samples so clients are never stalled for a whole cycle.
+func (ms *MemoryStorage) ActiveExpireCycle() {
+	start := time.Now()
+	timelimit := time.Second / ACTIVE_EXPIRE_HZ * ACTIVE_EXPIRE_CPU_PERC / 100
+
+	var totalSampled, totalExpired int64
+	timedOut := false
+	for iteration := 0; ; iteration++ {
+		sampled, expired := ms.expireSample(ACTIVE_EXPIRE_KEYS_PER_LOOP)
+		totalSampled += int64(sampled)
+		totalExpired += int64(expired)
+
+		if iteration%16 == 0 && time.Since(start) > timelimit {
+			timedOut = true
+			break
+		}
+		if sampled == 0 || expired*100/sampled <= ACTIVE_EXPIRE_ACCEPTABLE_STALE {
+			break
+		}
+	}
+
+	// Hashes with volatile fields are sampled the same way, with what is
+	// left of the time budget.
+	for iteration := 0; !timedOut; iteration++ {
+		sampled, expired := ms.expireHashSample(ACTIVE_EXPIRE_KEYS_PER_LOOP)
+		if iteration%16 == 0 && time.Since(start) > timelimit {
+			timedOut = true
+			break
+		}
+		if sampled == 0 || expired*100/sampled <= ACTIVE_EXPIRE_ACCEPTABLE_STALE {
+			break
+		}
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if timedOut {
+		ms.stats.ExpiredTimeCapReached++
+	}
+	ms.stats.expireCycleCPUMicrosAcc += time.Since(start).Microseconds()
+	ms.stats.ExpireCycleCPUMillis = ms.stats.expireCycleCPUMicrosAcc / 1000
+
+	// Running average of the share of sampled keys found already expired.
+	current := 0.0
+	if totalSampled > 0 {
+		current = float64(totalExpired) / float64(totalSampled)
+	}
+	ms.stats.ExpiredStalePerc = current*0.05 + ms.stats.ExpiredStalePerc*0.95
+}
+
+// expireSample checks n random volatile keys, deleting the expired ones.
+func (ms *MemoryStorage) expireSample(n int) (int, int) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	sampled, expired := 0, 0
+	now := time.Now()
+	for sampled < n && len(ms.volatile) > 0 {
+		key := ms.volatile[rand.Intn(len(ms.volatile))]
+		sampled++
+		if item, _ := ms.storage.Get(key); now.After(item.Lifetime) {
+			ms.expire(key)
+			expired++
+		}
+	}
+	return sampled, expired
+}
+
+// expireHashSample checks n random hashes with volatile fields, deleting
+// their expired fields and the hashes left empty. It returns how many hashes
+// were sampled and how many had expired fields.
+func (ms *MemoryStorage) expireHashSample(n int) (int, int) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	sampled, expired := 0, 0
+	now := time.Now()
+	for sampled < n && len(ms.volatileHashes) > 0 {
+		key := ms.volatileHashes[rand.Intn(len(ms.volatileHashes))]
+		sampled++
+		item, _ := ms.storage.Get(key)
+		if !item.Lifetime.IsZero() && now.After(item.Lifetime) {
+			ms.expire(key)
+			expired++
+			continue
+		}
+		h := ms.unshare(key, item).Value.(*hashValue)
+		if fields := h.Len(); ms.purgeHash(key, h, now) || h.Len() < fields {
+			expired++
+		}
+	}
+	return sampled, expired
+}
+
+// ExpireStats returns a snapshot of the expiry counters.
+func (ms *MemoryStorage) ExpireStats() ExpireStats {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return ms.stats
+}
+
+// KeyspaceStats returns the number of keys and of keys with a lifetime, and
+// the average remaining time to live in milliseconds of a sample of them.
+func (ms *MemoryStorage) KeyspaceStats() (int, int, int64) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	var ttlSum int64
+	sampled := 0
+	now := time.Now()
+	for sampled < 100 && sampled < len(ms.volatile) {
+		key := ms.volatile[rand.Intn(len(ms.volatile))]
+		item, _ := ms.storage.Get(key)
+		if ttl := item.Lifetime.Sub(now).Milliseconds(); ttl > 0 {
+			ttlSum += ttl
+		}
+		sampled++
+	}
+	avgTTL := int64(0)
+	if sampled > 0 {
+		avgTTL = ttlSum / int64(sampled)
+	}
+	return ms.storage.Len(), len(ms.expires), avgTTL
+}
+
+// Conditions for Expire, matching the NX, XX, GT and LT options of EXPIRE.
+const (
+	EXPIRE_NX = 1 << iota
+	EXPIRE_XX
+	EXPIRE_GT
+	EXPIRE_LT
+)
+
+// Expire sets the lifetime of key to at if the conditions in flags hold. A
+// key without lifetime counts as never expiring for GT and LT. A lifetime in
+// the past deletes the key. It returns 1 when the key was changed and 0 when
+// it does not exist or a condition failed, along with whether it was deleted.
+func (ms *MemoryStorage) Expire(key string, at time.Time, flags int) (int, bool) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	if !exists {
+		return 0, false
+	}
+
+	volatile := !item.Lifetime.IsZero()
+	switch {
+	case flags&EXPIRE_NX != 0 && volatile:
+		return 0, false
+	case flags&EXPIRE_XX != 0 && !volatile:
+		return 0, false
+	case flags&EXPIRE_GT != 0 && (!volatile || !at.After(item.Lifetime)):
+		return 0, false
+	case flags&EXPIRE_LT != 0 && volatile && !at.Before(item.Lifetime):
+		return 0, false
+	}
+
+	if !at.After(time.Now()) {
+		ms.remove(key)
+		ms.notify(NOTIFY_GENERIC, "del", key)
+		return 1, true
+	}
+	item.Lifetime = at
+	ms.set(key, item)
+	ms.notify(NOTIFY_GENERIC, "expire", key)
+	return 1, false
+}
+
+// GetLifetime returns the lifetime of key, which is the zero time for keys
+// that never expire, and whether the key exists.
+func (ms *MemoryStorage) GetLifetime(key string) (time.Time, bool) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	return item.Lifetime, exists
+}
+
+// Persist removes the lifetime of key. It returns 1 if the key had one.
+func (ms *MemoryStorage) Persist(key string) int {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	if !exists || item.Lifetime.IsZero() {
+		return 0
+	}
+	item.Lifetime = time.Time{}
+	ms.set(key, item)
+	ms.notify(NOTIFY_GENERIC, "persist", key)
+	return 1
+}
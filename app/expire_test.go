@@ -0,0 +1,97 @@
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLazyExpiry(t *testing.T) {
+	ms := NewMemoryStorage()
+	past := time.Now().Add(-time.Millisecond)
+	ms.Save("gone", "v", &past)
+	ms.Save("kept", "v", nil)
+
+	if ms.Get("gone") != nil || ms.Exists("gone") {
+		t.Errorf("Expired key is still readable")
+	}
+	if keys := ms.Keys(); len(keys) != 1 || keys[0] != "kept" {
+		t.Errorf("Unexpected keys: %v", keys)
+	}
+	if stats := ms.ExpireStats(); stats.ExpiredKeys != 1 {
+		t.Errorf("Unexpected expired_keys: %d", stats.ExpiredKeys)
+	}
+}
+
+func TestActiveExpireCycle(t *testing.T) {
+	ms := NewMemoryStorage()
+	past := time.Now().Add(-time.Millisecond)
+	future := time.Now().Add(time.Hour)
+	for i := 0; i < 1000; i++ {
+		ms.Save(fmt.Sprintf("old:%d", i), "v", &past)
+		ms.Save(fmt.Sprintf("new:%d", i), "v", &future)
+	}
+
+	for i := 0; i < 20; i++ {
+		ms.ActiveExpireCycle()
+	}
+
+	// Cycles stop once a sample looks mostly fresh, so a small stale share
+	// may remain, but live keys must never be touched.
+	keys, expires, _ := ms.KeyspaceStats()
+	reclaimed := ms.ExpireStats().ExpiredKeys
+	if keys != expires || int64(keys)+reclaimed != 2000 {
+		t.Fatalf("Unexpected keyspace after expiry: keys=%d expires=%d reclaimed=%d", keys, expires, reclaimed)
+	}
+	if reclaimed < 700 {
+		t.Errorf("Active expiry only reclaimed %d of 1000 keys", reclaimed)
+	}
+}
+
+func TestReplicaExpiry(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.SetReplica(true)
+	past := time.Now().Add(-time.Millisecond)
+	ms.Save("counter", "5", &past)
+
+	if ms.Exists("counter") || len(ms.Keys()) != 0 {
+		t.Error("an expired key is visible on a replica")
+	}
+	if ms.storage.Len() != 1 || ms.ExpireStats().ExpiredKeys != 0 {
+		t.Fatal("a replica deleted an expired key by itself")
+	}
+
+	// The master may not have expired the key yet, so its commands still
+	// see it.
+	ms.SetMasterLink(true)
+	if n, err := ms.IncrBy("counter", 1); n != 6 || err != nil {
+		t.Errorf("INCR from the master = %d, %v, want 6", n, err)
+	}
+	ms.Delete("counter")
+	ms.SetMasterLink(false)
+	if ms.storage.Len() != 0 {
+		t.Error("the DEL of the master left the key")
+	}
+}
+
+func TestExpiryPropagation(t *testing.T) {
+	ms := NewMemoryStorage()
+	var propagated [][]string
+	ms.SetExpiryPropagator(func(command []string) {
+		propagated = append(propagated, command)
+	})
+	past := time.Now().Add(-time.Millisecond)
+	ms.Save("lazy", "v", &past)
+	ms.Save("active", "v", &past)
+	ms.HSet("h", []string{"f", "v", "g", "w"}, false)
+	ms.HExpire("h", time.Now().Add(time.Millisecond), 0, []string{"f"})
+	time.Sleep(2 * time.Millisecond)
+
+	ms.Exists("lazy")
+	ms.ActiveExpireCycle()
+	want := [][]string{{"DEL", "lazy"}, {"DEL", "active"}, {"HDEL", "h", "f"}}
+	if !reflect.DeepEqual(propagated, want) {
+		t.Errorf("propagated %q, want %q", propagated, want)
+	}
+}
@@ -0,0 +1,232 @@
+package app
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+var ErrGeoMember = errors.New("ERR could not decode requested zset member")
+
+// Orders of GEOSEARCH results.
+const (
+	GEO_SORT_NONE = iota
+	GEO_SORT_ASC
+	GEO_SORT_DESC
+)
+
+// GeoShape is the area GEOSEARCH looks in: a circle of Radius or a box of
+// Width by Height, in a unit of Conversion meters, around a position or a
+// member of the index.
+type GeoShape struct {
+	Longitude, Latitude float64
+	Member              string
+	FromMember          bool
+	Box                 bool
+	Radius              float64
+	Width, Height       float64
+	Conversion          float64
+}
+
+// GeoSearchSpec describes a GEOSEARCH. With Any the search stops once Count
+// points are found instead of returning the Count nearest.
+type GeoSearchSpec struct {
+	Shape GeoShape
+	Count int
+	Any   bool
+	Sort  int
+}
+
+// GeoPoint is a member found by GEOSEARCH, its distance from the center of
+// the search being in the unit of the shape.
+type GeoPoint struct {
+	Member              string
+	Score               float64
+	Longitude, Latitude float64
+	Dist                float64
+}
+
+// bounds returns the smallest and largest longitudes and latitudes of s.
+func (s GeoShape) bounds() (float64, float64, float64, float64) {
+	height, width := s.Radius, s.Radius
+	if s.Box {
+		height, width = s.Height/2, s.Width/2
+	}
+	height *= s.Conversion
+	width *= s.Conversion
+	latDelta := radDeg(height / EARTH_RADIUS_IN_METERS)
+	longDeltaTop := radDeg(width / EARTH_RADIUS_IN_METERS / math.Cos(degRad(s.Latitude+latDelta)))
+	longDeltaBottom := radDeg(width / EARTH_RADIUS_IN_METERS / math.Cos(degRad(s.Latitude-latDelta)))
+	longDelta := longDeltaTop
+	if s.Latitude < 0 {
+		longDelta = longDeltaBottom
+	}
+	return s.Longitude - longDelta, s.Latitude - latDelta, s.Longitude + longDelta, s.Latitude + latDelta
+}
+
+// areas returns the geohash cells to scan for s: the cell holding its
+// center, at a precision that makes cells about the size of s, and those
+// of the eight neighbors that s reaches. Unneeded cells are zero.
+func (s GeoShape) areas() [9]geoHash {
+	minLong, minLat, maxLong, maxLat := s.bounds()
+	radius := s.Radius * s.Conversion
+	if s.Box {
+		radius = math.Sqrt((s.Width/2)*(s.Width/2)+(s.Height/2)*(s.Height/2)) * s.Conversion
+	}
+	steps := geoEstimateSteps(radius, s.Latitude)
+	hash, _ := geohashEncode(geoLongRange, geoLatRange, s.Longitude, s.Latitude, steps)
+	neighbors := geoNeighbors(hash)
+	area := geohashDecode(hash)
+
+	// The neighbors may not reach the edges of the shape, in which case
+	// larger cells are needed.
+	north, south := geohashDecode(neighbors[geoNorth]), geohashDecode(neighbors[geoSouth])
+	east, west := geohashDecode(neighbors[geoEast]), geohashDecode(neighbors[geoWest])
+	if steps > 1 && (north.latitude.max < maxLat || south.latitude.min > minLat ||
+		east.longitude.max < maxLong || west.longitude.min > minLong) {
+		steps--
+		hash, _ = geohashEncode(geoLongRange, geoLatRange, s.Longitude, s.Latitude, steps)
+		neighbors = geoNeighbors(hash)
+		area = geohashDecode(hash)
+	}
+
+	// Drop the neighbors the shape does not reach.
+	if steps >= 2 {
+		if area.latitude.min < minLat {
+			neighbors[geoSouth], neighbors[geoSouthWest], neighbors[geoSouthEast] = geoHash{}, geoHash{}, geoHash{}
+		}
+		if area.latitude.max > maxLat {
+			neighbors[geoNorth], neighbors[geoNorthEast], neighbors[geoNorthWest] = geoHash{}, geoHash{}, geoHash{}
+		}
+		if area.longitude.min < minLong {
+			neighbors[geoWest], neighbors[geoSouthWest], neighbors[geoNorthWest] = geoHash{}, geoHash{}, geoHash{}
+		}
+		if area.longitude.max > maxLong {
+			neighbors[geoEast], neighbors[geoSouthEast], neighbors[geoNorthEast] = geoHash{}, geoHash{}, geoHash{}
+		}
+	}
+	return neighbors
+}
+
+// contains reports whether the position is within s, and its distance in
+// meters from the center of s.
+func (s GeoShape) contains(longitude float64, latitude float64) (float64, bool) {
+	if !s.Box {
+		dist := GeoDistance(s.Longitude, s.Latitude, longitude, latitude)
+		return dist, dist <= s.Radius*s.Conversion
+	}
+	if geoLatDistance(latitude, s.Latitude) > s.Height*s.Conversion/2 {
+		return 0, false
+	}
+	if GeoDistance(longitude, latitude, s.Longitude, latitude) > s.Width*s.Conversion/2 {
+		return 0, false
+	}
+	return GeoDistance(s.Longitude, s.Latitude, longitude, latitude), true
+}
+
+// geoSearch returns the members of z within the shape of spec, scanning
+// the cells around its center one score range at a time.
+func (z *zsetValue) geoSearch(spec GeoSearchSpec) []GeoPoint {
+	shape := spec.Shape
+	limit := 0
+	if spec.Any {
+		limit = spec.Count
+	}
+	var points []GeoPoint
+	areas := shape.areas()
+	last := -1
+	for i, hash := range areas {
+		if hash.isZero() {
+			continue
+		}
+		// Large searches can make neighbors the same cell.
+		if last >= 0 && areas[last] == hash {
+			continue
+		}
+		if limit > 0 && len(points) >= limit {
+			break
+		}
+		last = i
+
+		shift := 52 - hash.step*2
+		r := ScoreRange{Min: float64(hash.bits << shift), Max: float64((hash.bits + 1) << shift), MaxEx: true}
+		for x := z.zsl.firstInRange(r); x != nil && r.lteMax(x.score); x = x.level[0].forward {
+			longitude, latitude := GeoDecode(x.score)
+			dist, ok := shape.contains(longitude, latitude)
+			if !ok {
+				continue
+			}
+			points = append(points, GeoPoint{
+				Member:    x.member,
+				Score:     x.score,
+				Longitude: longitude,
+				Latitude:  latitude,
+				Dist:      dist / shape.Conversion,
+			})
+			if limit > 0 && len(points) >= limit {
+				break
+			}
+		}
+	}
+
+	sorting := spec.Sort
+	if spec.Count > 0 && sorting == GEO_SORT_NONE && !spec.Any {
+		sorting = GEO_SORT_ASC
+	}
+	switch sorting {
+	case GEO_SORT_ASC:
+		sort.SliceStable(points, func(i, j int) bool { return points[i].Dist < points[j].Dist })
+	case GEO_SORT_DESC:
+		sort.SliceStable(points, func(i, j int) bool { return points[i].Dist > points[j].Dist })
+	}
+	if spec.Count > 0 && len(points) > spec.Count {
+		points = points[:spec.Count]
+	}
+	return points
+}
+
+// geoSearch resolves the center of spec and searches the geo index at key.
+// The caller must hold the mutex.
+func (ms *MemoryStorage) geoSearch(key string, spec GeoSearchSpec) ([]GeoPoint, error) {
+	z, err := ms.lookupZSet(key)
+	if err != nil || z == nil {
+		return nil, err
+	}
+	if spec.Shape.FromMember {
+		score, exists := z.score(spec.Shape.Member)
+		if !exists {
+			return nil, ErrGeoMember
+		}
+		spec.Shape.Longitude, spec.Shape.Latitude = GeoDecode(score)
+	}
+	return z.geoSearch(spec), nil
+}
+
+// GeoSearch returns the members of the geo index at key within an area.
+func (ms *MemoryStorage) GeoSearch(key string, spec GeoSearchSpec) ([]GeoPoint, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return ms.geoSearch(key, spec)
+}
+
+// GeoSearchStore stores in dst the members of the geo index at src within
+// an area, scored by their geohash or, with storeDist, by their distance,
+// and returns how many there are.
+func (ms *MemoryStorage) GeoSearchStore(dst string, src string, spec GeoSearchSpec, storeDist bool) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	points, err := ms.geoSearch(src, spec)
+	if err != nil {
+		return 0, err
+	}
+	result := newZSet()
+	for _, p := range points {
+		if storeDist {
+			result.add(p.Member, p.Dist)
+		} else {
+			result.add(p.Member, p.Score)
+		}
+	}
+	ms.storeZSet(dst, result, "geosearchstore")
+	return result.Len(), nil
+}
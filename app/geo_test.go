@@ -0,0 +1,91 @@
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// The expected values come from the examples of the Redis documentation.
+func TestGeoEncoding(t *testing.T) {
+	for _, tt := range []struct {
+		lon, lat float64
+		score    float64
+		hash     string
+		pos      string
+	}{
+		{13.361389, 38.115556, 3479099956230698, "sqc8b49rny0", "13.36138933897018433,38.11555639549629859"},
+		{15.087269, 37.502669, 3479447370796909, "sqdtr74hyu0", "15.08726745843887329,37.50266842333162032"},
+	} {
+		score, ok := GeoEncode(tt.lon, tt.lat)
+		if !ok || score != tt.score {
+			t.Errorf("GeoEncode(%v, %v) = %v, want %v", tt.lon, tt.lat, score, tt.score)
+		}
+		if hash := GeoHashString(score); hash != tt.hash {
+			t.Errorf("GeoHashString(%v) = %s, want %s", score, hash, tt.hash)
+		}
+		lon, lat := GeoDecode(score)
+		if pos := strconv.FormatFloat(lon, 'f', 17, 64) + "," + strconv.FormatFloat(lat, 'f', 17, 64); pos != tt.pos {
+			t.Errorf("GeoDecode(%v) = %s, want %s", score, pos, tt.pos)
+		}
+	}
+	if _, ok := GeoEncode(0, 86); ok {
+		t.Errorf("latitude beyond the Mercator range encoded")
+	}
+}
+
+func TestGeoSearch(t *testing.T) {
+	ms := NewMemoryStorage()
+	var pairs []ScoreMember
+	for _, p := range []struct {
+		member   string
+		lon, lat float64
+	}{
+		{"Palermo", 13.361389, 38.115556},
+		{"Catania", 15.087269, 37.502669},
+		{"edge1", 12.758489, 38.788135},
+		{"edge2", 17.241510, 38.788135},
+	} {
+		score, _ := GeoEncode(p.lon, p.lat)
+		pairs = append(pairs, ScoreMember{Member: p.member, Score: score})
+	}
+	ms.ZAdd("Sicily", pairs, 0)
+
+	search := func(spec GeoSearchSpec) []string {
+		points, err := ms.GeoSearch("Sicily", spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found []string
+		for _, p := range points {
+			found = append(found, fmt.Sprintf("%s %.4f", p.Member, p.Dist))
+		}
+		return found
+	}
+	km := GeoShape{Longitude: 15, Latitude: 37, Conversion: 1000}
+
+	radius := km
+	radius.Radius = 200
+	if got, want := search(GeoSearchSpec{Shape: radius, Sort: GEO_SORT_ASC}), []string{"Catania 56.4413", "Palermo 190.4424"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BYRADIUS 200 km = %v, want %v", got, want)
+	}
+	box := km
+	box.Box, box.Width, box.Height = true, 400, 400
+	want := []string{"Catania 56.4413", "Palermo 190.4424", "edge2 279.7403", "edge1 279.7405"}
+	if got := search(GeoSearchSpec{Shape: box, Sort: GEO_SORT_ASC}); !reflect.DeepEqual(got, want) {
+		t.Errorf("BYBOX 400 400 km = %v, want %v", got, want)
+	}
+	if got := search(GeoSearchSpec{Shape: box, Count: 2, Sort: GEO_SORT_DESC}); !reflect.DeepEqual(got, []string{"edge1 279.7405", "edge2 279.7403"}) {
+		t.Errorf("BYBOX DESC COUNT 2 = %v", got)
+	}
+
+	member := GeoShape{FromMember: true, Member: "Palermo", Radius: 1, Conversion: 1}
+	if got := search(GeoSearchSpec{Shape: member}); !reflect.DeepEqual(got, []string{"Palermo 0.0000"}) {
+		t.Errorf("FROMMEMBER BYRADIUS 1 m = %v", got)
+	}
+	member.Member = "Rome"
+	if _, err := ms.GeoSearch("Sicily", GeoSearchSpec{Shape: member}); err != ErrGeoMember {
+		t.Errorf("FROMMEMBER of a missing member: %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package app
+
+import "math"
+
+// Geo indexes are sorted sets scored with 52 bit geohashes: 26 bits of
+// longitude and 26 of latitude, interleaved, over the range of latitudes
+// the Web Mercator projection covers. The math below follows the geohash
+// implementation of Redis so that scores and search results agree with it.
+const (
+	GEO_STEP_MAX           = 26
+	GEO_LAT_MIN            = -85.05112878
+	GEO_LAT_MAX            = 85.05112878
+	GEO_LONG_MIN           = -180
+	GEO_LONG_MAX           = 180
+	EARTH_RADIUS_IN_METERS = 6372797.560856
+	MERCATOR_MAX           = 20037726.37
+)
+
+// geoHash is a geohash of step bits per coordinate, interleaved with the
+// latitude in the even bits and the longitude in the odd ones.
+type geoHash struct {
+	bits uint64
+	step uint
+}
+
+func (h geoHash) isZero() bool {
+	return h.bits == 0 && h.step == 0
+}
+
+// geoRange is a range of longitudes or latitudes.
+type geoRange struct {
+	min, max float64
+}
+
+var (
+	geoLongRange = geoRange{GEO_LONG_MIN, GEO_LONG_MAX}
+	geoLatRange  = geoRange{GEO_LAT_MIN, GEO_LAT_MAX}
+)
+
+// geoArea is the cell a geohash stands for.
+type geoArea struct {
+	hash      geoHash
+	longitude geoRange
+	latitude  geoRange
+}
+
+// interleave64 interleaves the bits of x and y, x going to the even bits.
+func interleave64(xlo uint32, ylo uint32) uint64 {
+	b := [...]uint64{0x5555555555555555, 0x3333333333333333, 0x0F0F0F0F0F0F0F0F, 0x00FF00FF00FF00FF, 0x0000FFFF0000FFFF}
+	s := [...]uint{1, 2, 4, 8, 16}
+	x, y := uint64(xlo), uint64(ylo)
+	for i := len(s) - 1; i >= 0; i-- {
+		x = (x | x<<s[i]) & b[i]
+		y = (y | y<<s[i]) & b[i]
+	}
+	return x | y<<1
+}
+
+// deinterleave64 reverses interleave64, returning x in the low 32 bits and
+// y in the high ones.
+func deinterleave64(interleaved uint64) uint64 {
+	b := [...]uint64{0x5555555555555555, 0x3333333333333333, 0x0F0F0F0F0F0F0F0F, 0x00FF00FF00FF00FF, 0x0000FFFF0000FFFF, 0x00000000FFFFFFFF}
+	s := [...]uint{0, 1, 2, 4, 8, 16}
+	x, y := interleaved, interleaved>>1
+	for i := range s {
+		x = (x | x>>s[i]) & b[i]
+		y = (y | y>>s[i]) & b[i]
+	}
+	return x | y<<32
+}
+
+// geohashEncode returns the geohash of step bits per coordinate of a
+// position within the given ranges, or false if it is outside of them.
+func geohashEncode(longRange geoRange, latRange geoRange, longitude float64, latitude float64, step uint) (geoHash, bool) {
+	if longitude > GEO_LONG_MAX || longitude < GEO_LONG_MIN || latitude > GEO_LAT_MAX || latitude < GEO_LAT_MIN {
+		return geoHash{}, false
+	}
+	if latitude < latRange.min || latitude > latRange.max || longitude < longRange.min || longitude > longRange.max {
+		return geoHash{}, false
+	}
+	latOffset := (latitude - latRange.min) / (latRange.max - latRange.min)
+	longOffset := (longitude - longRange.min) / (longRange.max - longRange.min)
+	latOffset *= float64(uint64(1) << step)
+	longOffset *= float64(uint64(1) << step)
+	return geoHash{bits: interleave64(uint32(latOffset), uint32(longOffset)), step: step}, true
+}
+
+// geohashDecode returns the cell of hash over the WGS84 ranges.
+func geohashDecode(hash geoHash) geoArea {
+	sep := deinterleave64(hash.bits)
+	latScale := geoLatRange.max - geoLatRange.min
+	longScale := geoLongRange.max - geoLongRange.min
+	ilato, ilono := uint32(sep), uint32(sep>>32)
+	cells := float64(uint64(1) << hash.step)
+	return geoArea{
+		hash: hash,
+		latitude: geoRange{
+			geoLatRange.min + float64(ilato)/cells*latScale,
+			geoLatRange.min + (float64(ilato)+1)/cells*latScale,
+		},
+		longitude: geoRange{
+			geoLongRange.min + float64(ilono)/cells*longScale,
+			geoLongRange.min + (float64(ilono)+1)/cells*longScale,
+		},
+	}
+}
+
+// center returns the longitude and latitude of the middle of a.
+func (a geoArea) center() (float64, float64) {
+	longitude := math.Max(GEO_LONG_MIN, math.Min(GEO_LONG_MAX, (a.longitude.min+a.longitude.max)/2))
+	latitude := math.Max(GEO_LAT_MIN, math.Min(GEO_LAT_MAX, (a.latitude.min+a.latitude.max)/2))
+	return longitude, latitude
+}
+
+// moveX moves hash by d cells along the longitude.
+func (h geoHash) moveX(d int) geoHash {
+	if d == 0 {
+		return h
+	}
+	x := h.bits & 0xaaaaaaaaaaaaaaaa
+	y := h.bits & 0x5555555555555555
+	zz := uint64(0x5555555555555555) >> (64 - h.step*2)
+	if d > 0 {
+		x += zz + 1
+	} else {
+		x |= zz
+		x -= zz + 1
+	}
+	x &= uint64(0xaaaaaaaaaaaaaaaa) >> (64 - h.step*2)
+	return geoHash{bits: x | y, step: h.step}
+}
+
+// moveY moves hash by d cells along the latitude.
+func (h geoHash) moveY(d int) geoHash {
+	if d == 0 {
+		return h
+	}
+	x := h.bits & 0xaaaaaaaaaaaaaaaa
+	y := h.bits & 0x5555555555555555
+	zz := uint64(0xaaaaaaaaaaaaaaaa) >> (64 - h.step*2)
+	if d > 0 {
+		y += zz + 1
+	} else {
+		y |= zz
+		y -= zz + 1
+	}
+	y &= uint64(0x5555555555555555) >> (64 - h.step*2)
+	return geoHash{bits: x | y, step: h.step}
+}
+
+// Indexes of the cells geoNeighbors returns.
+const (
+	geoCenter = iota
+	geoNorth
+	geoSouth
+	geoEast
+	geoWest
+	geoNorthEast
+	geoNorthWest
+	geoSouthEast
+	geoSouthWest
+)
+
+// geoNeighbors returns hash and the eight cells around it.
+func geoNeighbors(hash geoHash) [9]geoHash {
+	return [9]geoHash{
+		geoCenter:    hash,
+		geoNorth:     hash.moveY(1),
+		geoSouth:     hash.moveY(-1),
+		geoEast:      hash.moveX(1),
+		geoWest:      hash.moveX(-1),
+		geoNorthEast: hash.moveX(1).moveY(1),
+		geoNorthWest: hash.moveX(-1).moveY(1),
+		geoSouthEast: hash.moveX(1).moveY(-1),
+		geoSouthWest: hash.moveX(-1).moveY(-1),
+	}
+}
+
+func degRad(deg float64) float64 {
+	return deg * (math.Pi / 180.0)
+}
+
+func radDeg(rad float64) float64 {
+	return rad / (math.Pi / 180.0)
+}
+
+// geoLatDistance returns the distance in meters between two latitudes.
+func geoLatDistance(lat1 float64, lat2 float64) float64 {
+	return EARTH_RADIUS_IN_METERS * math.Abs(degRad(lat2)-degRad(lat1))
+}
+
+// GeoDistance returns the distance in meters between two positions with
+// the haversine formula.
+func GeoDistance(lon1 float64, lat1 float64, lon2 float64, lat2 float64) float64 {
+	lon1r, lon2r := degRad(lon1), degRad(lon2)
+	v := math.Sin((lon2r - lon1r) / 2)
+	if v == 0 {
+		return geoLatDistance(lat1, lat2)
+	}
+	lat1r, lat2r := degRad(lat1), degRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2.0 * EARTH_RADIUS_IN_METERS * math.Asin(math.Sqrt(a))
+}
+
+// geoEstimateSteps returns the geohash precision whose cells are about the
+// size of a search of radius meters around latitude.
+func geoEstimateSteps(radius float64, latitude float64) uint {
+	if radius == 0 {
+		return GEO_STEP_MAX
+	}
+	step := 1
+	for radius < MERCATOR_MAX {
+		radius *= 2
+		step++
+	}
+	step -= 2 // Make sure the range is included in most of the base cases.
+
+	// Cells get narrower towards the poles.
+	if latitude > 66 || latitude < -66 {
+		step--
+		if latitude > 80 || latitude < -80 {
+			step--
+		}
+	}
+	return uint(max(1, min(GEO_STEP_MAX, step)))
+}
+
+// GeoEncode returns the score of a position in a geo index.
+func GeoEncode(longitude float64, latitude float64) (float64, bool) {
+	hash, ok := geohashEncode(geoLongRange, geoLatRange, longitude, latitude, GEO_STEP_MAX)
+	return float64(hash.bits), ok
+}
+
+// GeoDecode returns the position a geo index score stands for.
+func GeoDecode(score float64) (float64, float64) {
+	return geohashDecode(geoHash{bits: uint64(score), step: GEO_STEP_MAX}).center()
+}
+
+// GeoHashString returns the standard 11 character geohash of the position
+// a geo index score stands for. Standard geohashes cover latitudes from -90
+// to 90, so the position is encoded again over that range.
+func GeoHashString(score float64) string {
+	const alphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+	longitude, latitude := GeoDecode(score)
+	hash, _ := geohashEncode(geoRange{-180, 180}, geoRange{-90, 90}, longitude, latitude, GEO_STEP_MAX)
+	buf := make([]byte, 11)
+	for i := range buf {
+		idx := 0
+		if i < 10 {
+			idx = int(hash.bits>>(52-(i+1)*5)) & 0x1f
+		}
+		buf[i] = alphabet[idx]
+	}
+	return string(buf)
+}
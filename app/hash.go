@@ -0,0 +1,647 @@
+package app
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"rednav/utils"
+	"strconv"
+	"time"
+)
+
+const (
+	// A hash keeps the compact encoding while it has at most
+	// HASH_MAX_LISTPACK_ENTRIES fields, none longer than
+	// HASH_MAX_LISTPACK_VALUE bytes, like Redis's hash-max-listpack-*.
+	HASH_MAX_LISTPACK_ENTRIES = 128
+	HASH_MAX_LISTPACK_VALUE   = 64
+)
+
+var (
+	ErrHashNotInteger = errors.New("ERR hash value is not an integer")
+	ErrHashNotFloat   = errors.New("ERR hash value is not a float")
+)
+
+// Results of the per field expiration commands, as replied to clients.
+const (
+	HFIELD_MISSING       = -2
+	HFIELD_NO_TTL        = -1
+	HFIELD_NOT_MET       = 0
+	HFIELD_UPDATED       = 1
+	HFIELD_DELETED       = 2
+	HFIELD_PERSISTED     = 1
+	HFIELD_NOT_PERSISTED = -1
+)
+
+type hashEntry struct {
+	field  string
+	value  string
+	expire time.Time
+}
+
+func (e hashEntry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+// hashValue is the hash value. Small hashes are a slice of entries in
+// insertion order, scanned linearly; once one grows past the listpack
+// limits it is converted to a dict for good.
+type hashValue struct {
+	small []hashEntry
+	table *dict[hashEntry]
+	// volatile counts the fields carrying an expiration.
+	volatile int
+}
+
+func newHash() *hashValue {
+	return &hashValue{}
+}
+
+func (h *hashValue) Len() int {
+	if h.table != nil {
+		return h.table.Len()
+	}
+	return len(h.small)
+}
+
+func (h *hashValue) find(field string) int {
+	for i := range h.small {
+		if h.small[i].field == field {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *hashValue) get(field string) (hashEntry, bool) {
+	if h.table != nil {
+		return h.table.Get(field)
+	}
+	if i := h.find(field); i >= 0 {
+		return h.small[i], true
+	}
+	return hashEntry{}, false
+}
+
+// put stores entry, replacing the field if present, and reports whether the
+// field was added.
+func (h *hashValue) put(entry hashEntry) bool {
+	old, exists := h.get(entry.field)
+	if exists && !old.expire.IsZero() {
+		h.volatile--
+	}
+	if !entry.expire.IsZero() {
+		h.volatile++
+	}
+
+	if h.table == nil && (len(entry.field) > HASH_MAX_LISTPACK_VALUE || len(entry.value) > HASH_MAX_LISTPACK_VALUE ||
+		(!exists && len(h.small) >= HASH_MAX_LISTPACK_ENTRIES)) {
+		h.convert()
+	}
+	if h.table != nil {
+		h.table.Set(entry.field, entry)
+	} else if i := h.find(entry.field); i >= 0 {
+		h.small[i] = entry
+	} else {
+		h.small = append(h.small, entry)
+	}
+	return !exists
+}
+
+// set stores value at field and reports whether the field was added. The
+// field's expiration is cleared unless keepTTL is set.
+func (h *hashValue) set(field string, value string, keepTTL bool) bool {
+	entry := hashEntry{field: field, value: value}
+	if keepTTL {
+		if old, exists := h.get(field); exists {
+			entry.expire = old.expire
+		}
+	}
+	return h.put(entry)
+}
+
+func (h *hashValue) del(field string) bool {
+	old, exists := h.get(field)
+	if !exists {
+		return false
+	}
+	if !old.expire.IsZero() {
+		h.volatile--
+	}
+	if h.table != nil {
+		h.table.Delete(field)
+		return true
+	}
+	i := h.find(field)
+	h.small = append(h.small[:i], h.small[i+1:]...)
+	return true
+}
+
+func (h *hashValue) convert() {
+	h.table = newDict[hashEntry]()
+	for _, entry := range h.small {
+		h.table.Set(entry.field, entry)
+	}
+	h.small = nil
+}
+
+// each calls fn for every field until it returns false.
+func (h *hashValue) each(fn func(entry hashEntry) bool) {
+	if h.table != nil {
+		h.table.Range(func(field string, entry hashEntry) bool {
+			return fn(entry)
+		})
+		return
+	}
+	for _, entry := range h.small {
+		if !fn(entry) {
+			return
+		}
+	}
+}
+
+func (h *hashValue) entries() []hashEntry {
+	entries := make([]hashEntry, 0, h.Len())
+	h.each(func(entry hashEntry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+	return entries
+}
+
+// purge deletes the fields whose expiration has passed.
+func (h *hashValue) purge(now time.Time) []string {
+	if h.volatile == 0 {
+		return nil
+	}
+	var expired []string
+	h.each(func(entry hashEntry) bool {
+		if entry.expired(now) {
+			expired = append(expired, entry.field)
+		}
+		return true
+	})
+	for _, field := range expired {
+		h.del(field)
+	}
+	return expired
+}
+
+// live reports whether some field of the hash has not expired at now.
+func (h *hashValue) live(now time.Time) bool {
+	if h.volatile < h.Len() {
+		return true
+	}
+	alive := false
+	h.each(func(entry hashEntry) bool {
+		alive = !entry.expired(now)
+		return !alive
+	})
+	return alive
+}
+
+func (h *hashValue) copy() *hashValue {
+	dup := &hashValue{volatile: h.volatile}
+	if h.table == nil {
+		dup.small = append([]hashEntry(nil), h.small...)
+		return dup
+	}
+	dup.table = newDict[hashEntry]()
+	h.table.Range(func(field string, entry hashEntry) bool {
+		dup.table.Set(field, entry)
+		return true
+	})
+	return dup
+}
+
+// lookupHash returns the hash stored at key, lookup having removed its
+// expired fields. The caller must hold the mutex.
+func (ms *MemoryStorage) lookupHash(key string) (*hashValue, error) {
+	item, exists := ms.lookup(key)
+	if !exists {
+		return nil, nil
+	}
+	h, ok := item.Value.(*hashValue)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return h, nil
+}
+
+// purgeHash deletes the fields of the hash h stored at key whose expiration
+// has passed, deleting the key if none is left, which it reports. The
+// caller must hold the mutex.
+func (ms *MemoryStorage) purgeHash(key string, h *hashValue, now time.Time) bool {
+	expired := h.purge(now)
+	if h.volatile == 0 {
+		ms.unsetVolatileHash(key)
+	}
+	if len(expired) == 0 {
+		return false
+	}
+	ms.propagateExpiry(append([]string{"HDEL", key}, expired...))
+	ms.notify(NOTIFY_HASH, "hexpired", key)
+	if h.Len() == 0 {
+		ms.remove(key)
+		ms.notify(NOTIFY_GENERIC, "del", key)
+		return true
+	}
+	ms.signalModified(key)
+	return false
+}
+
+// setVolatileHash adds key to the hashes whose fields the active expiry
+// cycle samples. The caller must hold the mutex.
+func (ms *MemoryStorage) setVolatileHash(key string) {
+	if _, exists := ms.hashPos[key]; exists {
+		return
+	}
+	ms.hashPos[key] = len(ms.volatileHashes)
+	ms.volatileHashes = append(ms.volatileHashes, key)
+}
+
+// unsetVolatileHash drops key from the sampled hashes, moving the last one
+// into its slot. The caller must hold the mutex.
+func (ms *MemoryStorage) unsetVolatileHash(key string) {
+	pos, exists := ms.hashPos[key]
+	if !exists {
+		return
+	}
+	last := ms.volatileHashes[len(ms.volatileHashes)-1]
+	ms.volatileHashes[pos] = last
+	ms.hashPos[last] = pos
+	ms.volatileHashes = ms.volatileHashes[:len(ms.volatileHashes)-1]
+	delete(ms.hashPos, key)
+}
+
+// createHash returns the hash stored at key, creating it if needed. The
+// caller must hold the mutex.
+func (ms *MemoryStorage) createHash(key string) (*hashValue, error) {
+	h, err := ms.lookupHash(key)
+	if err != nil || h != nil {
+		return h, err
+	}
+	h = newHash()
+	ms.set(key, Item{Value: h})
+	return h, nil
+}
+
+// HSet stores the field value pairs of pairs in the hash at key and returns
+// how many fields were added. With nx set an existing field is left alone.
+func (ms *MemoryStorage) HSet(key string, pairs []string, nx bool) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	h, err := ms.createHash(key)
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for i := 0; i < len(pairs); i += 2 {
+		if nx {
+			if _, exists := h.get(pairs[i]); exists {
+				continue
+			}
+		}
+		if h.set(pairs[i], pairs[i+1], false) {
+			added++
+		}
+	}
+	ms.signalModified(key)
+	if !nx || added > 0 {
+		ms.notify(NOTIFY_HASH, "hset", key)
+	}
+	return added, nil
+}
+
+// HGet returns the value of field in the hash at key.
+func (ms *MemoryStorage) HGet(key string, field string) (string, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	h, err := ms.lookupHash(key)
+	if h == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || h == nil {
+		return "", false, err
+	}
+	entry, exists := h.get(field)
+	return entry.value, exists, nil
+}
+
+// HMGet returns the values of fields in the hash at key.
+func (ms *MemoryStorage) HMGet(key string, fields []string) ([]string, []bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	h, err := ms.lookupHash(key)
+	if h == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make([]string, len(fields))
+	found := make([]bool, len(fields))
+	if h != nil {
+		for i, field := range fields {
+			entry, exists := h.get(field)
+			values[i], found[i] = entry.value, exists
+		}
+	}
+	return values, found, nil
+}
+
+// HDel removes fields from the hash at key, deleting the key once it is
+// empty, and returns how many were removed.
+func (ms *MemoryStorage) HDel(key string, fields []string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	h, err := ms.lookupHash(key)
+	if err != nil || h == nil {
+		return 0, err
+	}
+	removed := 0
+	for _, field := range fields {
+		if h.del(field) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		ms.notify(NOTIFY_HASH, "hdel", key)
+	}
+	if h.Len() == 0 {
+		ms.remove(key)
+		ms.notify(NOTIFY_GENERIC, "del", key)
+	} else if removed > 0 {
+		ms.signalModified(key)
+	}
+	return removed, nil
+}
+
+// HLen returns the number of fields of the hash at key.
+func (ms *MemoryStorage) HLen(key string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	h, err := ms.lookupHash(key)
+	if h == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || h == nil {
+		return 0, err
+	}
+	return h.Len(), nil
+}
+
+// HGetAll returns the fields of the hash at key and their values.
+func (ms *MemoryStorage) HGetAll(key string) ([]string, []string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	h, err := ms.lookupHash(key)
+	if h == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || h == nil {
+		return nil, nil, err
+	}
+	fields := make([]string, 0, h.Len())
+	values := make([]string, 0, h.Len())
+	h.each(func(entry hashEntry) bool {
+		fields = append(fields, entry.field)
+		values = append(values, entry.value)
+		return true
+	})
+	return fields, values, nil
+}
+
+// HIncrBy adds delta to the integer stored at field in the hash at key,
+// keeping the field's expiration, and returns the new value.
+func (ms *MemoryStorage) HIncrBy(key string, field string, delta int64) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	h, err := ms.createHash(key)
+	if err != nil {
+		return 0, err
+	}
+	var current int64
+	if entry, exists := h.get(field); exists {
+		var ok bool
+		if current, ok = ParseInt(entry.value); !ok {
+			return 0, ErrHashNotInteger
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+	h.set(field, strconv.FormatInt(current+delta, 10), true)
+	ms.signalModified(key)
+	ms.notify(NOTIFY_HASH, "hincrby", key)
+	return current + delta, nil
+}
+
+// HIncrByFloat adds delta to the number stored at field in the hash at key,
+// keeping the field's expiration, and returns the new value as stored.
+func (ms *MemoryStorage) HIncrByFloat(key string, field string, delta float64) (string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	h, err := ms.createHash(key)
+	if err != nil {
+		return "", err
+	}
+	var current float64
+	if entry, exists := h.get(field); exists {
+		var ok bool
+		if current, ok = ParseFloat(entry.value); !ok {
+			return "", ErrHashNotFloat
+		}
+	}
+	result := current + delta
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return "", ErrNaNOrInfinity
+	}
+	value := FormatFloat(result)
+	h.set(field, value, true)
+	ms.signalModified(key)
+	ms.notify(NOTIFY_HASH, "hincrbyfloat", key)
+	return value, nil
+}
+
+// HRandField returns random fields of the hash at key with their values.
+// A positive count returns up to count distinct fields, a negative one
+// exactly -count fields that may repeat.
+func (ms *MemoryStorage) HRandField(key string, count int64) ([]string, []string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	h, err := ms.lookupHash(key)
+	if h == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || h == nil || count == 0 {
+		return nil, nil, err
+	}
+	entries := h.entries()
+
+	var picked []hashEntry
+	switch {
+	case count < 0:
+		picked = make([]hashEntry, -count)
+		for i := range picked {
+			picked[i] = entries[rand.Intn(len(entries))]
+		}
+	case count >= int64(len(entries)):
+		picked = entries
+	default:
+		for i := 0; i < int(count); i++ {
+			j := i + rand.Intn(len(entries)-i)
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+		picked = entries[:count]
+	}
+
+	fields := make([]string, len(picked))
+	values := make([]string, len(picked))
+	for i, entry := range picked {
+		fields[i], values[i] = entry.field, entry.value
+	}
+	return fields, values, nil
+}
+
+// HScan incrementally iterates the hash at key, returning the next cursor
+// with the matching fields and their values. A hash in the compact encoding
+// is returned whole.
+func (ms *MemoryStorage) HScan(key string, cursor uint64, count int, pattern string) (uint64, []string, []string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	h, err := ms.lookupHash(key)
+	if h == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || h == nil {
+		return 0, nil, nil, err
+	}
+
+	var visited []hashEntry
+	if h.table == nil {
+		visited, cursor = h.entries(), 0
+	} else {
+		for maxIterations := count * 10; ; maxIterations-- {
+			cursor = h.table.Scan(cursor, func(field string, entry hashEntry) {
+				visited = append(visited, entry)
+			})
+			if cursor == 0 || maxIterations <= 1 || len(visited) >= count {
+				break
+			}
+		}
+	}
+
+	var fields, values []string
+	for _, entry := range visited {
+		if pattern != "" && pattern != "*" && !utils.StringMatch(pattern, entry.field, false) {
+			continue
+		}
+		fields = append(fields, entry.field)
+		values = append(values, entry.value)
+	}
+	return cursor, fields, values, nil
+}
+
+// HExpire sets the expiration of fields of the hash at key to at if the
+// conditions in flags hold, returning for each field one of the HFIELD_*
+// results. A time in the past deletes the field. It returns nil if the key
+// does not exist.
+func (ms *MemoryStorage) HExpire(key string, at time.Time, flags int, fields []string) ([]int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	h, err := ms.lookupHash(key)
+	if err != nil || h == nil {
+		return nil, err
+	}
+	now := time.Now()
+	changed := false
+	results := make([]int, len(fields))
+	for i, field := range fields {
+		entry, exists := h.get(field)
+		volatile := !entry.expire.IsZero()
+		switch {
+		case !exists:
+			results[i] = HFIELD_MISSING
+		case flags&EXPIRE_NX != 0 && volatile,
+			flags&EXPIRE_XX != 0 && !volatile,
+			flags&EXPIRE_GT != 0 && (!volatile || !at.After(entry.expire)),
+			flags&EXPIRE_LT != 0 && volatile && !at.Before(entry.expire):
+			results[i] = HFIELD_NOT_MET
+		case !at.After(now):
+			h.del(field)
+			results[i], changed = HFIELD_DELETED, true
+		default:
+			entry.expire = at
+			h.put(entry)
+			results[i], changed = HFIELD_UPDATED, true
+		}
+	}
+	if changed {
+		ms.notify(NOTIFY_HASH, "hexpire", key)
+	}
+	if h.volatile > 0 {
+		ms.setVolatileHash(key)
+	}
+	if h.Len() == 0 {
+		ms.remove(key)
+		ms.notify(NOTIFY_GENERIC, "del", key)
+	} else if changed {
+		ms.signalModified(key)
+	}
+	return results, nil
+}
+
+// HPersist removes the expiration of fields of the hash at key, returning
+// for each field HFIELD_MISSING, HFIELD_NOT_PERSISTED or HFIELD_PERSISTED.
+// It returns nil if the key does not exist.
+func (ms *MemoryStorage) HPersist(key string, fields []string) ([]int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	h, err := ms.lookupHash(key)
+	if err != nil || h == nil {
+		return nil, err
+	}
+	persisted := false
+	results := make([]int, len(fields))
+	for i, field := range fields {
+		entry, exists := h.get(field)
+		switch {
+		case !exists:
+			results[i] = HFIELD_MISSING
+		case entry.expire.IsZero():
+			results[i] = HFIELD_NOT_PERSISTED
+		default:
+			entry.expire = time.Time{}
+			h.put(entry)
+			results[i], persisted = HFIELD_PERSISTED, true
+		}
+	}
+	if persisted {
+		ms.signalModified(key)
+		ms.notify(NOTIFY_HASH, "hpersist", key)
+	}
+	return results, nil
+}
+
+// HLifetimes returns the expiration of fields of the hash at key, the zero
+// time for fields without one, and whether each field exists. It returns
+// nil slices if the key does not exist.
+func (ms *MemoryStorage) HLifetimes(key string, fields []string) ([]time.Time, []bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	h, err := ms.lookupHash(key)
+	if h == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || h == nil {
+		return nil, nil, err
+	}
+	lifetimes := make([]time.Time, len(fields))
+	found := make([]bool, len(fields))
+	for i, field := range fields {
+		entry, exists := h.get(field)
+		lifetimes[i], found[i] = entry.expire, exists
+	}
+	return lifetimes, found, nil
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHashEncodingConversion(t *testing.T) {
+	ms := NewMemoryStorage()
+	for i := 0; i < HASH_MAX_LISTPACK_ENTRIES; i++ {
+		ms.HSet("h", []string{"f" + strconv.Itoa(i), "v"}, false)
+	}
+	h, _ := ms.lookupHash("h")
+	if h.table != nil {
+		t.Fatalf("hash with %d fields converted", h.Len())
+	}
+	ms.HSet("h", []string{"one-more", "v"}, false)
+	if h.table == nil {
+		t.Fatal("hash past the entries limit not converted")
+	}
+	if n, _ := ms.HLen("h"); n != HASH_MAX_LISTPACK_ENTRIES+1 {
+		t.Errorf("HLen = %d", n)
+	}
+
+	ms.HSet("long", []string{"f", string(make([]byte, HASH_MAX_LISTPACK_VALUE+1))}, false)
+	if h, _ := ms.lookupHash("long"); h.table == nil {
+		t.Error("hash with a long value not converted")
+	}
+}
+
+func TestHashFieldExpiration(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.HSet("h", []string{"a", "1", "b", "2"}, false)
+	results, _ := ms.HExpire("h", time.Now().Add(20*time.Millisecond), 0, []string{"a", "missing"})
+	if results[0] != HFIELD_UPDATED || results[1] != HFIELD_MISSING {
+		t.Fatalf("HExpire = %v", results)
+	}
+	if _, err := ms.HIncrBy("h", "a", 1); err != nil {
+		t.Fatal(err)
+	}
+	if lifetimes, _, _ := ms.HLifetimes("h", []string{"a"}); lifetimes[0].IsZero() {
+		t.Error("HINCRBY dropped the field expiration")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, exists, _ := ms.HGet("h", "a"); exists {
+		t.Error("expired field still readable")
+	}
+	if n, _ := ms.HLen("h"); n != 1 {
+		t.Errorf("HLen = %d after the field expired, want 1", n)
+	}
+
+	ms.HExpire("h", time.Now().Add(-time.Second), 0, []string{"b"})
+	if ms.Exists("h") {
+		t.Error("hash left behind once its last field was expired")
+	}
+}
+
+func TestHashActiveFieldExpiration(t *testing.T) {
+	ms := NewMemoryStorage()
+	soon := time.Now().Add(20 * time.Millisecond)
+	for i := 0; i < 50; i++ {
+		key := "h" + strconv.Itoa(i)
+		ms.HSet(key, []string{"a", "1", "b", "2"}, false)
+		ms.HExpire(key, soon, 0, []string{"a", "b"})
+	}
+	ms.HSet("partial", []string{"a", "1", "b", "2"}, false)
+	ms.HExpire("partial", soon, 0, []string{"a"})
+	ms.HSet("persistent", []string{"a", "1"}, false)
+	if len(ms.volatileHashes) != 51 {
+		t.Fatalf("%d hashes with volatile fields, want 51", len(ms.volatileHashes))
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	// Hashes whose fields all expired are invisible even before they are
+	// reclaimed.
+	if keys := ms.Keys(); len(keys) != 2 {
+		t.Errorf("Keys = %q, want partial and persistent", keys)
+	}
+	if ms.GetType("h0") != "none" || ms.Exists("h1") {
+		t.Error("a hash with only expired fields is still visible")
+	}
+
+	ms.ActiveExpireCycle()
+	if n := ms.storage.Len(); n != 2 {
+		t.Errorf("%d keys left after the expire cycle, want 2", n)
+	}
+	item, _ := ms.storage.Get("partial")
+	if h := item.Value.(*hashValue); h.Len() != 1 || h.volatile != 0 {
+		t.Errorf("partial has %d fields, %d volatile, want 1 and 0", h.Len(), h.volatile)
+	}
+	if len(ms.volatileHashes) != 0 || len(ms.hashPos) != 0 {
+		t.Errorf("%d hashes still sampled", len(ms.volatileHashes))
+	}
+
+	// Overwriting a hash with another type stops sampling it.
+	ms.HSet("h", []string{"a", "1"}, false)
+	ms.HExpire("h", time.Now().Add(time.Hour), 0, []string{"a"})
+	ms.SetString("h", "v", SetOptions{})
+	if len(ms.volatileHashes) != 0 {
+		t.Error("a string is sampled as a hash")
+	}
+	ms.ActiveExpireCycle()
+}
@@ -0,0 +1,405 @@
+package app
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+var (
+	ErrNotHLL       = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	ErrHLLCorrupted = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+// HyperLogLogs are plain strings laid out exactly as Redis lays them out, so
+// that they can be exchanged with it: a 16 byte header ("HYLL", the
+// encoding, three unused bytes and the cached cardinality in little endian,
+// its most significant bit flagging it stale) followed by the registers,
+// either packed six bits each (dense) or run length encoded (sparse).
+const (
+	HLL_P                    = 14
+	HLL_Q                    = 64 - HLL_P
+	HLL_REGISTERS            = 1 << HLL_P
+	HLL_BITS                 = 6
+	HLL_REGISTER_MAX         = 1<<HLL_BITS - 1
+	HLL_HDR_SIZE             = 16
+	HLL_DENSE_SIZE           = HLL_HDR_SIZE + (HLL_REGISTERS*HLL_BITS+7)/8
+	HLL_DENSE                = 0
+	HLL_SPARSE               = 1
+	HLL_SPARSE_VAL_MAX_VALUE = 32
+	HLL_SPARSE_VAL_MAX_LEN   = 4
+	HLL_SPARSE_ZERO_MAX_LEN  = 64
+	HLL_SPARSE_XZERO_MAX_LEN = 16384
+	HLL_SPARSE_MAX_BYTES     = 3000
+	HLL_ALPHA_INF            = 0.721347520444481703680
+	HLL_HASH_SEED            = 0xadc83b19
+)
+
+// hllRegisters holds one register per byte, the form every operation
+// works on before encoding the result back.
+type hllRegisters [HLL_REGISTERS]uint8
+
+// murmurHash64A is the 64 bit MurmurHash2 variant Redis hashes elements
+// with, reading blocks in little endian.
+func murmurHash64A(data string, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ (uint64(len(data)) * m)
+	for len(data) >= 8 {
+		k := binary.LittleEndian.Uint64([]byte(data[:8]))
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * i)
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// hllPatLen returns the register ele falls in and the length of the run of
+// zeros ending its hash, plus one, which the register keeps the maximum of.
+func hllPatLen(ele string) (int, uint8) {
+	hash := murmurHash64A(ele, HLL_HASH_SEED)
+	index := int(hash & (HLL_REGISTERS - 1))
+	hash >>= HLL_P
+	hash |= 1 << HLL_Q
+	return index, uint8(bits.TrailingZeros64(hash) + 1)
+}
+
+// newHLL returns an empty sparse HyperLogLog with a valid cached
+// cardinality of zero.
+func newHLL() string {
+	var regs hllRegisters
+	return encodeHLL(&regs, HLL_SPARSE, false)
+}
+
+// checkHLL verifies the header of a HyperLogLog and returns its encoding.
+func checkHLL(s string) (int, error) {
+	if len(s) < HLL_HDR_SIZE || s[:4] != "HYLL" || s[4] > HLL_SPARSE {
+		return 0, ErrNotHLL
+	}
+	if s[4] == HLL_DENSE && len(s) != HLL_DENSE_SIZE {
+		return 0, ErrNotHLL
+	}
+	return int(s[4]), nil
+}
+
+// decodeHLL reads the registers of the HyperLogLog s.
+func decodeHLL(s string) (*hllRegisters, int, error) {
+	encoding, err := checkHLL(s)
+	if err != nil {
+		return nil, 0, err
+	}
+	var regs hllRegisters
+	p := s[HLL_HDR_SIZE:]
+	if encoding == HLL_DENSE {
+		for i := range regs {
+			b := i * HLL_BITS / 8
+			fb := uint(i * HLL_BITS & 7)
+			v := uint(p[b]) >> fb
+			if b+1 < len(p) {
+				v |= uint(p[b+1]) << (8 - fb)
+			}
+			regs[i] = uint8(v & HLL_REGISTER_MAX)
+		}
+		return &regs, encoding, nil
+	}
+
+	idx := 0
+	for i := 0; i < len(p); i++ {
+		var run int
+		var value uint8
+		switch op := p[i]; {
+		case op&0xc0 == 0x00: // ZERO: 00llllll
+			run = int(op&0x3f) + 1
+		case op&0xc0 == 0x40: // XZERO: 01llllll llllllll
+			if i+1 >= len(p) {
+				return nil, 0, ErrHLLCorrupted
+			}
+			run = int(op&0x3f)<<8 | int(p[i+1]) + 1
+			i++
+		default: // VAL: 1vvvvvll
+			value = (op>>2)&0x1f + 1
+			run = int(op&0x3) + 1
+		}
+		if idx+run > HLL_REGISTERS {
+			return nil, 0, ErrHLLCorrupted
+		}
+		for j := 0; j < run; j++ {
+			regs[idx+j] = value
+		}
+		idx += run
+	}
+	if idx != HLL_REGISTERS {
+		return nil, 0, ErrHLLCorrupted
+	}
+	return &regs, encoding, nil
+}
+
+// encodeSparse run length encodes regs, reporting false when a register is
+// too large for the sparse encoding or the result too long to be worth it.
+func encodeSparse(regs *hllRegisters) ([]byte, bool) {
+	var p []byte
+	for i := 0; i < HLL_REGISTERS; {
+		value := regs[i]
+		run := 1
+		for i+run < HLL_REGISTERS && regs[i+run] == value {
+			run++
+		}
+		i += run
+		if value > HLL_SPARSE_VAL_MAX_VALUE {
+			return nil, false
+		}
+		for run > 0 {
+			var n int
+			switch {
+			case value != 0:
+				n = min(run, HLL_SPARSE_VAL_MAX_LEN)
+				p = append(p, 0x80|(value-1)<<2|byte(n-1))
+			case run > HLL_SPARSE_ZERO_MAX_LEN:
+				n = min(run, HLL_SPARSE_XZERO_MAX_LEN)
+				p = append(p, 0x40|byte((n-1)>>8), byte(n-1))
+			default:
+				n = run
+				p = append(p, byte(n-1))
+			}
+			run -= n
+		}
+		if len(p) > HLL_SPARSE_MAX_BYTES {
+			return nil, false
+		}
+	}
+	return p, true
+}
+
+// encodeHLL builds the HyperLogLog holding regs, in the sparse encoding
+// when asked for and possible, with its cached cardinality flagged stale
+// when stale is set.
+func encodeHLL(regs *hllRegisters, encoding int, stale bool) string {
+	var buf []byte
+	if encoding == HLL_SPARSE {
+		if p, ok := encodeSparse(regs); ok {
+			buf = make([]byte, HLL_HDR_SIZE, HLL_HDR_SIZE+len(p))
+			buf[4] = HLL_SPARSE
+			buf = append(buf, p...)
+		}
+	}
+	if buf == nil {
+		buf = make([]byte, HLL_DENSE_SIZE)
+		buf[4] = HLL_DENSE
+		p := buf[HLL_HDR_SIZE:]
+		for i, value := range regs {
+			b := i * HLL_BITS / 8
+			fb := uint(i * HLL_BITS & 7)
+			p[b] |= value << fb
+			if b+1 < len(p) {
+				p[b+1] |= value >> (8 - fb)
+			}
+		}
+	}
+	copy(buf, "HYLL")
+	if stale {
+		buf[15] |= 0x80
+	}
+	return string(buf)
+}
+
+// withCachedCount returns the HyperLogLog s with count cached in its header.
+func withCachedCount(s string, count uint64) string {
+	buf := []byte(s)
+	binary.LittleEndian.PutUint64(buf[8:HLL_HDR_SIZE], count)
+	return string(buf)
+}
+
+// cachedCount returns the cardinality cached in the header of s, if valid.
+func cachedCount(s string) (uint64, bool) {
+	if s[15]&0x80 != 0 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64([]byte(s[8:HLL_HDR_SIZE])), true
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+// hllCount estimates the cardinality of regs with the improved estimator
+// by Otmar Ertl, which Redis uses since 5.0.
+func hllCount(regs *hllRegisters) uint64 {
+	var histogram [64]int
+	for _, value := range regs {
+		histogram[value]++
+	}
+	m := float64(HLL_REGISTERS)
+	z := m * hllTau((m-float64(histogram[HLL_Q+1]))/m)
+	for j := HLL_Q; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histogram[0])/m)
+	return uint64(math.Round(HLL_ALPHA_INF * m * m / z))
+}
+
+// lookupHLL returns the HyperLogLog stored at key. The caller must hold the
+// mutex.
+func (ms *MemoryStorage) lookupHLL(key string) (Item, string, bool, error) {
+	item, exists := ms.lookup(key)
+	if !exists {
+		return item, "", false, nil
+	}
+	value, err := stringValue(item)
+	if err != nil {
+		return item, "", false, err
+	}
+	if _, err := checkHLL(value); err != nil {
+		return item, "", false, err
+	}
+	return item, value, true, nil
+}
+
+// PFAdd adds elements to the HyperLogLog stored at key, creating it if
+// needed, and reports whether it changed.
+func (ms *MemoryStorage) PFAdd(key string, elements []string) (bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, value, exists, err := ms.lookupHLL(key)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		value = newHLL()
+	}
+	regs, encoding, err := decodeHLL(value)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	for _, ele := range elements {
+		index, count := hllPatLen(ele)
+		if count > regs[index] {
+			regs[index] = count
+			changed = true
+		}
+	}
+	if changed {
+		value = encodeHLL(regs, encoding, true)
+	}
+	if changed || !exists {
+		item.Value = value
+		ms.set(key, item)
+		ms.notify(NOTIFY_STRING, "pfadd", key)
+	}
+	return changed || !exists, nil
+}
+
+// PFCount estimates the cardinality of the union of the HyperLogLogs
+// stored at keys. Counting a single one caches the result in its header.
+func (ms *MemoryStorage) PFCount(keys []string) (uint64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if len(keys) == 1 {
+		item, value, exists, err := ms.lookupHLL(keys[0])
+		if err != nil || !exists {
+			return 0, err
+		}
+		if count, ok := cachedCount(value); ok {
+			return count, nil
+		}
+		regs, _, err := decodeHLL(value)
+		if err != nil {
+			return 0, err
+		}
+		count := hllCount(regs)
+		item.Value = withCachedCount(value, count)
+		ms.set(keys[0], item)
+		return count, nil
+	}
+
+	var union hllRegisters
+	for _, key := range keys {
+		if _, err := ms.mergeHLL(key, &union); err != nil {
+			return 0, err
+		}
+	}
+	return hllCount(&union), nil
+}
+
+// mergeHLL raises the registers of union to those of the HyperLogLog
+// stored at key, if any, and returns its encoding. The caller must hold the
+// mutex.
+func (ms *MemoryStorage) mergeHLL(key string, union *hllRegisters) (int, error) {
+	_, value, exists, err := ms.lookupHLL(key)
+	if err != nil || !exists {
+		return HLL_SPARSE, err
+	}
+	regs, encoding, err := decodeHLL(value)
+	if err != nil {
+		return 0, err
+	}
+	for i, value := range regs {
+		union[i] = max(union[i], value)
+	}
+	return encoding, nil
+}
+
+// PFMerge stores at dst the union of the HyperLogLogs stored at dst and
+// keys. The result is dense if any of them is.
+func (ms *MemoryStorage) PFMerge(dst string, keys []string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	var union hllRegisters
+	encoding := HLL_SPARSE
+	for _, key := range append([]string{dst}, keys...) {
+		e, err := ms.mergeHLL(key, &union)
+		if err != nil {
+			return err
+		}
+		if e == HLL_DENSE {
+			encoding = HLL_DENSE
+		}
+	}
+	item, _ := ms.lookup(dst)
+	item.Value = encodeHLL(&union, encoding, true)
+	ms.set(dst, item)
+	ms.notify(NOTIFY_STRING, "pfadd", dst)
+	return nil
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestHLLPatLen(t *testing.T) {
+	// Expected values computed with the C implementation used by Redis.
+	for _, tt := range []struct {
+		ele   string
+		index int
+		count uint8
+	}{
+		{"a", 12711, 2},
+		{"b", 15780, 1},
+		{"hello", 9216, 1},
+		{"foobarbaz", 7560, 2},
+		{"1234567", 10327, 3},
+		{"abcdefghijklmnopq", 4271, 1},
+		{"", 5938, 2},
+	} {
+		if index, count := hllPatLen(tt.ele); index != tt.index || count != tt.count {
+			t.Errorf("hllPatLen(%q) = %d, %d, want %d, %d", tt.ele, index, count, tt.index, tt.count)
+		}
+	}
+}
+
+func TestHLLEncodings(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.PFAdd("hll", []string{"a"})
+	value, _, _ := ms.GetString("hll")
+	want := "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80" + "\x71\xa6\x84\x4e\x57"
+	if value != want {
+		t.Fatalf("sparse encoding = %q, want %q", value, want)
+	}
+	if n, _ := ms.PFCount([]string{"hll"}); n != 1 {
+		t.Errorf("PFCOUNT = %d, want 1", n)
+	}
+	if value, _, _ = ms.GetString("hll"); value[8] != 1 || value[15] != 0 {
+		t.Errorf("cardinality not cached: %q", value[:HLL_HDR_SIZE])
+	}
+
+	var regs hllRegisters
+	for i := range regs {
+		regs[i] = uint8(rand.Intn(HLL_REGISTER_MAX + 1))
+	}
+	dense := encodeHLL(&regs, HLL_SPARSE, true)
+	if len(dense) != HLL_DENSE_SIZE || dense[4] != HLL_DENSE {
+		t.Fatalf("registers too large for the sparse encoding kept it")
+	}
+	if decoded, _, err := decodeHLL(dense); err != nil || *decoded != regs {
+		t.Errorf("dense round trip failed: %v", err)
+	}
+
+	ms.Save("bad", value+"\x00", nil)
+	if _, err := ms.PFCount([]string{"bad", "hll"}); err != ErrHLLCorrupted {
+		t.Errorf("corrupted sparse HLL: %v", err)
+	}
+	ms.Save("str", "HYLLx", nil)
+	if _, err := ms.PFAdd("str", nil); err != ErrNotHLL {
+		t.Errorf("PFADD on a plain string: %v", err)
+	}
+}
+
+func TestHLLCardinality(t *testing.T) {
+	ms := NewMemoryStorage()
+	if changed, _ := ms.PFAdd("hll1", []string{"foo", "bar", "zap", "a"}); !changed {
+		t.Errorf("PFADD of new elements reported no change")
+	}
+	if changed, _ := ms.PFAdd("hll1", []string{"foo"}); changed {
+		t.Errorf("PFADD of a known element reported a change")
+	}
+	ms.PFAdd("hll2", []string{"a", "b", "c", "foo"})
+	ms.PFMerge("hll3", []string{"hll1", "hll2"})
+	if n, _ := ms.PFCount([]string{"hll3"}); n != 6 {
+		t.Errorf("PFCOUNT of the merge = %d, want 6", n)
+	}
+
+	const n = 100000
+	elements := make([]string, 0, 1000)
+	for i := 0; i < n; i++ {
+		elements = append(elements, strconv.Itoa(i))
+		if len(elements) == cap(elements) {
+			ms.PFAdd("big", elements)
+			elements = elements[:0]
+		}
+	}
+	value, _, _ := ms.GetString("big")
+	if value[4] != HLL_DENSE {
+		t.Errorf("large HLL still sparse")
+	}
+	count, _ := ms.PFCount([]string{"big"})
+	if math.Abs(float64(count)-n)/n > 0.05 {
+		t.Errorf("PFCOUNT = %d, want about %d", count, n)
+	}
+	if union, _ := ms.PFCount([]string{"big", "hll1", "missing"}); union < count {
+		t.Errorf("PFCOUNT of the union = %d, below %d", union, count)
+	}
+}
@@ -0,0 +1,281 @@
+package app
+
+import (
+	"errors"
+	"rednav/utils"
+	"sync/atomic"
+	"time"
+)
+
+// Values whose free effort exceeds this are released in the background by
+// UNLINK, like Redis's lazyfree-lazy-user-del.
+const LAZYFREE_THRESHOLD = 64
+
+var (
+	ErrNoSuchKey  = errors.New("ERR no such key")
+	ErrSameObject = errors.New("ERR source and destination objects are the same")
+)
+
+// LazyFreeStats are the lazy free counters reported by INFO.
+type LazyFreeStats struct {
+	Pending int64
+	Freed   int64
+}
+
+// freeEffort estimates the work needed to release a value, roughly the
+// number of allocations it holds.
+func freeEffort(value interface{}) int {
+	switch value := value.(type) {
+	case *quicklist:
+		return value.nodes
+	case *hashValue:
+		return value.Len()
+	case *setValue:
+		return value.Len()
+	case *zsetValue:
+		return value.Len()
+	case *streamValue:
+		return value.Len()
+	default:
+		return 1
+	}
+}
+
+// releaseValue drops the internal references of a value so the garbage
+// collector can reclaim it piecewise.
+func releaseValue(value interface{}) {
+	switch value := value.(type) {
+	case *quicklist:
+		for node := value.head; node != nil; {
+			next := node.next
+			node.prev, node.next, node.entries = nil, nil, nil
+			node = next
+		}
+	case *hashValue:
+		value.small, value.table = nil, nil
+	case *setValue:
+		value.ints, value.table = nil, nil
+	case *zsetValue:
+		value.table, value.zsl = nil, nil
+	case *streamValue:
+		value.entries, value.groups = nil, nil
+	default:
+	}
+}
+
+// mutable reports whether a stored value is modified in place rather than
+// replaced.
+func mutable(value interface{}) bool {
+	switch value.(type) {
+	case *quicklist, *hashValue, *setValue, *zsetValue, *streamValue:
+		return true
+	}
+	return false
+}
+
+// copyValue returns a deep copy of a stored value, used by COPY.
+func copyValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case *quicklist:
+		return value.Copy()
+	case *hashValue:
+		return value.copy()
+	case *setValue:
+		return value.copy()
+	case *zsetValue:
+		return value.copy()
+	case *streamValue:
+		return value.copy()
+	default:
+		// Strings and numbers are immutable.
+		return value
+	}
+}
+
+// DeleteKeys removes the given keys and returns how many existed.
+func (ms *MemoryStorage) DeleteKeys(keys []string) int {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	deleted := 0
+	for _, key := range keys {
+		if _, exists := ms.lookup(key); exists {
+			ms.remove(key)
+			ms.notify(NOTIFY_GENERIC, "del", key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Unlink removes the given keys from the keyspace and returns how many
+// existed. Only the unlinking happens under the mutex; large values are
+// released afterwards in the background.
+func (ms *MemoryStorage) Unlink(keys []string) int {
+	ms.mutex.Lock()
+	unlinked := 0
+	var values []interface{}
+	now := time.Now()
+	for _, key := range keys {
+		// A snapshot being encoded still reads a shared value: it is
+		// unlinked without the copy lookup would make and never released.
+		if item, exists := ms.storage.Get(key); exists && ms.isShared(item.Value) && live(item, now) {
+			ms.remove(key)
+			ms.notify(NOTIFY_GENERIC, "del", key)
+			unlinked++
+			continue
+		}
+		if item, exists := ms.lookup(key); exists {
+			ms.remove(key)
+			ms.notify(NOTIFY_GENERIC, "del", key)
+			unlinked++
+			values = append(values, item.Value)
+		}
+	}
+	ms.mutex.Unlock()
+
+	for _, value := range values {
+		ms.lazyFree(value)
+	}
+	return unlinked
+}
+
+// lazyFree releases value on a background goroutine when it is expensive
+// enough to be worth it.
+func (ms *MemoryStorage) lazyFree(value interface{}) {
+	if freeEffort(value) <= LAZYFREE_THRESHOLD {
+		return
+	}
+	atomic.AddInt64(&ms.lazyfree.Pending, 1)
+	go func() {
+		releaseValue(value)
+		atomic.AddInt64(&ms.lazyfree.Pending, -1)
+		atomic.AddInt64(&ms.lazyfree.Freed, 1)
+	}()
+}
+
+// LazyFreeStats returns a snapshot of the lazy free counters.
+func (ms *MemoryStorage) LazyFreeStats() LazyFreeStats {
+	return LazyFreeStats{
+		Pending: atomic.LoadInt64(&ms.lazyfree.Pending),
+		Freed:   atomic.LoadInt64(&ms.lazyfree.Freed),
+	}
+}
+
+// CountExisting returns how many of the given keys exist, counting repeated
+// keys every time.
+func (ms *MemoryStorage) CountExisting(keys []string) int {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	count := 0
+	for _, key := range keys {
+		if _, exists := ms.lookup(key); exists {
+			count++
+		}
+	}
+	return count
+}
+
+// Rename moves the value and lifetime of src to dst, overwriting dst unless
+// nx is set. It returns 1 if renamed and 0 if nx prevented it.
+func (ms *MemoryStorage) Rename(src string, dst string, nx bool) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(src)
+	if !exists {
+		return 0, ErrNoSuchKey
+	}
+	if src == dst {
+		if nx {
+			return 0, nil
+		}
+		return 1, nil
+	}
+	if _, exists := ms.lookup(dst); exists && nx {
+		return 0, nil
+	}
+	ms.remove(src)
+	ms.set(dst, item)
+	ms.notify(NOTIFY_GENERIC, "rename_from", src)
+	ms.notify(NOTIFY_GENERIC, "rename_to", dst)
+	return 1, nil
+}
+
+// Copy stores a deep copy of src, including its lifetime, at dst. Unless
+// replace is set an existing dst is left alone. It returns 1 if copied.
+func (ms *MemoryStorage) Copy(src string, dst string, replace bool) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if src == dst {
+		return 0, ErrSameObject
+	}
+	item, exists := ms.lookup(src)
+	if !exists {
+		return 0, nil
+	}
+	if _, exists := ms.lookup(dst); exists && !replace {
+		return 0, nil
+	}
+	ms.set(dst, Item{Value: copyValue(item.Value), Lifetime: item.Lifetime})
+	ms.notify(NOTIFY_GENERIC, "copy_to", dst)
+	return 1, nil
+}
+
+// KeysMatching returns the live keys matching a glob pattern.
+func (ms *MemoryStorage) KeysMatching(pattern string) []string {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if !utils.IsGlobPattern(pattern) {
+		if _, exists := ms.lookup(pattern); exists {
+			return []string{pattern}
+		}
+		return []string{}
+	}
+
+	keys := []string{}
+	now := time.Now()
+	ms.storage.Range(func(key string, item Item) bool {
+		if !live(item, now) {
+			return true
+		}
+		if pattern == "*" || utils.StringMatch(pattern, key, false) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+// Scan continues a keyspace iteration from cursor, visiting buckets until
+// about count keys were collected. It returns the next cursor (0 when the
+// iteration is over) and the live keys found that match pattern and, if not
+// empty, the type typ.
+func (ms *MemoryStorage) Scan(cursor uint64, count int, pattern string, typ string) (uint64, []string) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	var visited []string
+	for maxIterations := count * 10; ; maxIterations-- {
+		cursor = ms.storage.Scan(cursor, func(key string, item Item) {
+			visited = append(visited, key)
+		})
+		if cursor == 0 || maxIterations <= 1 || len(visited) >= count {
+			break
+		}
+	}
+
+	keys := make([]string, 0, len(visited))
+	for _, key := range visited {
+		item, exists := ms.lookup(key)
+		if !exists {
+			continue
+		}
+		if pattern != "" && pattern != "*" && !utils.StringMatch(pattern, key, false) {
+			continue
+		}
+		if typ != "" && typeName(item.Value) != typ {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return cursor, keys
+}
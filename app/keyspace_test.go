@@ -0,0 +1,135 @@
+package app
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeleteKeys(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.SetString("a", "1", SetOptions{})
+	ms.Push("b", []string{"x", "y"}, false, false)
+	ms.SetString("gone", "1", SetOptions{Lifetime: time.Now().Add(-time.Second)})
+	if got := ms.DeleteKeys([]string{"a", "b", "a", "gone", "missing"}); got != 2 {
+		t.Errorf("DeleteKeys = %d, want 2", got)
+	}
+	if ms.storage.Len() != 0 || len(ms.volatile) != 0 {
+		t.Errorf("%d keys and %d volatile keys left", ms.storage.Len(), len(ms.volatile))
+	}
+}
+
+func TestUnlink(t *testing.T) {
+	ms := NewMemoryStorage()
+	var big []string
+	for i := 0; i < 10*LAZYFREE_THRESHOLD; i++ {
+		big = append(big, "member"+strconv.Itoa(i))
+	}
+	// A snapshot being encoded must not see its values released.
+	ms.SAdd("shared", big)
+	s := ms.snapshot()
+	defer s.release()
+	ms.SAdd("big", big)
+	ms.SetString("small", "v", SetOptions{})
+	if got := ms.Unlink([]string{"big", "shared", "small", "missing"}); got != 3 {
+		t.Errorf("Unlink = %d, want 3", got)
+	}
+	if ms.storage.Len() != 0 {
+		t.Errorf("%d keys left", ms.storage.Len())
+	}
+	for deadline := time.Now().Add(5 * time.Second); ms.LazyFreeStats() != (LazyFreeStats{Freed: 1}); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("lazy free stats = %+v, want one value freed", ms.LazyFreeStats())
+		}
+	}
+	for i, key := range s.keys {
+		if key == "shared" && s.items[i].Value.(*setValue).Len() != len(big) {
+			t.Error("a value read by a snapshot was released")
+		}
+	}
+}
+
+func TestCountExisting(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.SetString("a", "1", SetOptions{})
+	if got := ms.CountExisting([]string{"a", "a", "b"}); got != 2 {
+		t.Errorf("CountExisting = %d, want 2", got)
+	}
+}
+
+func TestRename(t *testing.T) {
+	ms := NewMemoryStorage()
+	hour := time.Now().Add(time.Hour)
+	ms.SetString("src", "v", SetOptions{Lifetime: hour})
+	ms.SetString("taken", "old", SetOptions{})
+
+	if _, err := ms.Rename("missing", "dst", false); err != ErrNoSuchKey {
+		t.Errorf("renaming a missing key = %v", err)
+	}
+	if n, _ := ms.Rename("src", "taken", true); n != 0 {
+		t.Error("RENAMENX overwrote an existing key")
+	}
+	if n, err := ms.Rename("src", "dst", false); n != 1 || err != nil {
+		t.Fatalf("Rename = %d, %v", n, err)
+	}
+	if ms.Exists("src") {
+		t.Error("the source still exists")
+	}
+	item, _ := ms.storage.Get("dst")
+	if item.Value != "v" || !item.Lifetime.Equal(hour) {
+		t.Errorf("dst = %v expiring at %v", item.Value, item.Lifetime)
+	}
+	if _, volatile := ms.expires["dst"]; !volatile || len(ms.volatile) != 1 {
+		t.Error("the lifetime did not move with the key")
+	}
+}
+
+func TestCopyIsDeep(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.Push("list", []string{"a", "b"}, false, false)
+	ms.SetString("dst", "v", SetOptions{})
+	if n, _ := ms.Copy("list", "dst", false); n != 0 {
+		t.Error("COPY without REPLACE overwrote dst")
+	}
+	if _, err := ms.Copy("list", "list", true); err != ErrSameObject {
+		t.Errorf("copying a key onto itself = %v", err)
+	}
+	if n, _ := ms.Copy("list", "dst", true); n != 1 {
+		t.Fatal("COPY REPLACE did not copy")
+	}
+	ms.Push("list", []string{"c"}, false, false)
+	if got, _ := ms.LRange("dst", 0, -1); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("the copy = %q, changed along with the source", got)
+	}
+}
+
+func TestKeysAndScan(t *testing.T) {
+	ms := NewMemoryStorage()
+	for _, key := range []string{"user:1", "user:2", "order:1"} {
+		ms.SetString(key, "v", SetOptions{})
+	}
+	ms.Push("user:list", []string{"a"}, false, false)
+	ms.SetString("user:gone", "v", SetOptions{Lifetime: time.Now().Add(-time.Second)})
+
+	keys := ms.KeysMatching("user:*")
+	sort.Strings(keys)
+	if want := []string{"user:1", "user:2", "user:list"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("KEYS user:* = %q, want %q", keys, want)
+	}
+
+	var scanned []string
+	for cursor := uint64(0); ; {
+		var keys []string
+		cursor, keys = ms.Scan(cursor, 1, "user:*", "string")
+		scanned = append(scanned, keys...)
+		if cursor == 0 {
+			break
+		}
+	}
+	sort.Strings(scanned)
+	if want := []string{"user:1", "user:2"}; !reflect.DeepEqual(scanned, want) {
+		t.Errorf("SCAN MATCH user:* TYPE string = %q, want %q", scanned, want)
+	}
+}
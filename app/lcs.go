@@ -0,0 +1,93 @@
+package app
+
+import (
+	"errors"
+	"math"
+)
+
+var (
+	ErrLCSWrongType = errors.New("ERR The specified keys must contain string values")
+	ErrLCSTooLong   = errors.New("ERR String too long for LCS")
+)
+
+// LCSMatch is a run of bytes common to both strings of an LCS, as inclusive
+// byte ranges of each.
+type LCSMatch struct {
+	AStart, AEnd int
+	BStart, BEnd int
+}
+
+// Len returns the number of bytes of the match.
+func (m LCSMatch) Len() int {
+	return m.AEnd - m.AStart + 1
+}
+
+// LCS computes the longest common subsequence of a and b with the usual
+// dynamic programming table and walks it back from the end, collecting the
+// contiguous runs of at least minMatchLen bytes. Matches are therefore
+// returned from the end of the strings towards their start, as Redis does.
+func LCS(a string, b string, minMatchLen int) (string, []LCSMatch, error) {
+	rows, cols := len(a)+1, len(b)+1
+	if uint64(rows)*uint64(cols) >= math.MaxUint32/4 {
+		return "", nil, ErrLCSTooLong
+	}
+
+	// table[i*cols+j] is the length of the LCS of a[:i] and b[:j].
+	table := make([]uint32, rows*cols)
+	for i := 1; i < rows; i++ {
+		for j := 1; j < cols; j++ {
+			switch {
+			case a[i-1] == b[j-1]:
+				table[i*cols+j] = table[(i-1)*cols+j-1] + 1
+			case table[(i-1)*cols+j] > table[i*cols+j-1]:
+				table[i*cols+j] = table[(i-1)*cols+j]
+			default:
+				table[i*cols+j] = table[i*cols+j-1]
+			}
+		}
+	}
+
+	idx := int(table[len(table)-1])
+	result := make([]byte, idx)
+	var matches []LCSMatch
+	var current LCSMatch
+	inRange := false
+	for i, j := len(a), len(b); i > 0 && j > 0; {
+		emit := false
+		if a[i-1] == b[j-1] {
+			result[idx-1] = a[i-1]
+			if !inRange {
+				current = LCSMatch{AStart: i - 1, AEnd: i - 1, BStart: j - 1, BEnd: j - 1}
+				inRange = true
+			} else if current.AStart == i && current.BStart == j {
+				// Extend the run backwards.
+				current.AStart--
+				current.BStart--
+			} else {
+				emit = true
+			}
+			// A run reaching the start of either string is complete.
+			if current.AStart == 0 || current.BStart == 0 {
+				emit = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if table[(i-1)*cols+j] > table[i*cols+j-1] {
+				i--
+			} else {
+				j--
+			}
+			emit = inRange
+		}
+
+		if emit {
+			if minMatchLen == 0 || current.Len() >= minMatchLen {
+				matches = append(matches, current)
+			}
+			inRange = false
+		}
+	}
+	return string(result), matches, nil
+}
@@ -0,0 +1,27 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLCS(t *testing.T) {
+	lcs, matches, err := LCS("ohmytext", "mynewtext", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lcs != "mytext" {
+		t.Errorf("LCS = %q, want \"mytext\"", lcs)
+	}
+	want := []LCSMatch{{4, 7, 5, 8}, {2, 3, 0, 1}}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("matches = %v, want %v", matches, want)
+	}
+
+	if _, matches, _ = LCS("ohmytext", "mynewtext", 4); len(matches) != 1 || matches[0].Len() != 4 {
+		t.Errorf("matches with MINMATCHLEN 4 = %v, want only the 4 byte run", matches)
+	}
+	if lcs, matches, _ = LCS("", "abc", 0); lcs != "" || len(matches) != 0 {
+		t.Errorf("LCS with an empty string = %q, %v", lcs, matches)
+	}
+}
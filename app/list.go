@@ -0,0 +1,314 @@
+package app
+
+import "errors"
+
+var ErrIndexOutOfRange = errors.New("ERR index out of range")
+
+// lookupList returns the list stored at key. The caller must hold the mutex.
+func (ms *MemoryStorage) lookupList(key string) (*quicklist, error) {
+	item, exists := ms.lookup(key)
+	if !exists {
+		return nil, nil
+	}
+	list, ok := item.Value.(*quicklist)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return list, nil
+}
+
+// listEvent names the keyspace event of pushing or popping at an end of a
+// list.
+func listEvent(head bool, op string) string {
+	if head {
+		return "l" + op
+	}
+	return "r" + op
+}
+
+// Push adds values to the head or the tail of the list stored at key, one
+// after the other, and returns the new length. Unless xx is set the list is
+// created if needed; with xx a missing key is left alone and 0 returned.
+func (ms *MemoryStorage) Push(key string, values []string, head bool, xx bool) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	list, err := ms.lookupList(key)
+	if err != nil {
+		return 0, err
+	}
+	if list == nil {
+		if xx {
+			return 0, nil
+		}
+		list = newQuicklist()
+		ms.set(key, Item{Value: list})
+	}
+	for _, value := range values {
+		if head {
+			list.PushHead(value)
+		} else {
+			list.PushTail(value)
+		}
+	}
+	ms.signalModified(key)
+	ms.signalReady(key)
+	ms.notify(NOTIFY_LIST, listEvent(head, "push"), key)
+	return list.Len(), nil
+}
+
+// Pop removes and returns up to count elements from the head or the tail of
+// the list stored at key, deleting the key once the list is empty. It also
+// reports whether the key existed.
+func (ms *MemoryStorage) Pop(key string, count int, head bool) ([]string, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return ms.pop(key, count, head)
+}
+
+// pop implements Pop. The caller must hold the mutex.
+func (ms *MemoryStorage) pop(key string, count int, head bool) ([]string, bool, error) {
+	list, err := ms.lookupList(key)
+	if err != nil || list == nil {
+		return nil, false, err
+	}
+	if count > list.Len() {
+		count = list.Len()
+	}
+	values := make([]string, 0, count)
+	for len(values) < count {
+		var value string
+		if head {
+			value, _ = list.PopHead()
+		} else {
+			value, _ = list.PopTail()
+		}
+		values = append(values, value)
+	}
+	if count > 0 {
+		ms.notify(NOTIFY_LIST, listEvent(head, "pop"), key)
+	}
+	if list.Len() == 0 {
+		ms.remove(key)
+		ms.notify(NOTIFY_GENERIC, "del", key)
+	} else if count > 0 {
+		ms.signalModified(key)
+	}
+	return values, true, nil
+}
+
+// LLen returns the length of the list stored at key.
+func (ms *MemoryStorage) LLen(key string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	list, err := ms.lookupList(key)
+	if list == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || list == nil {
+		return 0, err
+	}
+	return list.Len(), nil
+}
+
+// listRange clamps the inclusive range start..stop, where negative offsets
+// count from the tail, to a list of length n. It reports false when the
+// range is empty.
+func listRange(start int64, stop int64, n int) (int, int, bool) {
+	size := int64(n)
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop || start >= size {
+		return 0, 0, false
+	}
+	return int(start), int(stop), true
+}
+
+// LRange returns the elements of the list stored at key between start and
+// stop inclusive.
+func (ms *MemoryStorage) LRange(key string, start int64, stop int64) ([]string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	list, err := ms.lookupList(key)
+	if list == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || list == nil {
+		return nil, err
+	}
+	from, to, ok := listRange(start, stop, list.Len())
+	if !ok {
+		return nil, nil
+	}
+	return list.Range(from, to), nil
+}
+
+// LIndex returns the element at index in the list stored at key.
+func (ms *MemoryStorage) LIndex(key string, index int64) (string, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	list, err := ms.lookupList(key)
+	if list == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || list == nil || index != int64(int(index)) {
+		return "", false, err
+	}
+	value, ok := list.Index(int(index))
+	return value, ok, nil
+}
+
+// LPos returns the indexes of element in the list stored at key, as
+// described by quicklist.Positions.
+func (ms *MemoryStorage) LPos(key string, element string, rank int64, count int64, maxlen int64) ([]int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	list, err := ms.lookupList(key)
+	if list == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || list == nil {
+		return nil, err
+	}
+	return list.Positions(element, int(rank), int(count), int(maxlen)), nil
+}
+
+// LSet replaces the element at index in the list stored at key.
+func (ms *MemoryStorage) LSet(key string, index int64, value string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	list, err := ms.lookupList(key)
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		return ErrNoSuchKey
+	}
+	if index != int64(int(index)) || !list.Set(int(index), value) {
+		return ErrIndexOutOfRange
+	}
+	ms.signalModified(key)
+	ms.notify(NOTIFY_LIST, "lset", key)
+	return nil
+}
+
+// LInsert inserts value before or after the first occurrence of pivot in
+// the list stored at key. It returns the new length, -1 when pivot is not
+// found and 0 when the key does not exist.
+func (ms *MemoryStorage) LInsert(key string, before bool, pivot string, value string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	list, err := ms.lookupList(key)
+	if err != nil || list == nil {
+		return 0, err
+	}
+	if !list.Insert(pivot, value, before) {
+		return -1, nil
+	}
+	ms.signalModified(key)
+	ms.notify(NOTIFY_LIST, "linsert", key)
+	return list.Len(), nil
+}
+
+// LRem removes occurrences of value from the list stored at key, as
+// described by quicklist.Remove, and returns how many were removed.
+func (ms *MemoryStorage) LRem(key string, count int64, value string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	list, err := ms.lookupList(key)
+	if err != nil || list == nil {
+		return 0, err
+	}
+	if count != int64(int(count)) {
+		count = 0
+	}
+	removed := list.Remove(int(count), value)
+	if removed > 0 {
+		ms.notify(NOTIFY_LIST, "lrem", key)
+	}
+	if list.Len() == 0 {
+		ms.remove(key)
+		ms.notify(NOTIFY_GENERIC, "del", key)
+	} else if removed > 0 {
+		ms.signalModified(key)
+	}
+	return removed, nil
+}
+
+// LTrim keeps only the elements of the list stored at key between start and
+// stop inclusive, deleting the key if none remain.
+func (ms *MemoryStorage) LTrim(key string, start int64, stop int64) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	list, err := ms.lookupList(key)
+	if err != nil || list == nil {
+		return err
+	}
+	from, to, ok := listRange(start, stop, list.Len())
+	ms.notify(NOTIFY_LIST, "ltrim", key)
+	if !ok {
+		ms.remove(key)
+		ms.notify(NOTIFY_GENERIC, "del", key)
+		return nil
+	}
+	list.Trim(from, to)
+	ms.signalModified(key)
+	return nil
+}
+
+// LMove pops an element from one end of the list at src and pushes it to
+// one end of the list at dst, creating it if needed. It reports whether an
+// element was moved.
+func (ms *MemoryStorage) LMove(src string, dst string, fromHead bool, toHead bool) (string, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return ms.lmove(src, dst, fromHead, toHead)
+}
+
+// lmove implements LMove. The caller must hold the mutex.
+func (ms *MemoryStorage) lmove(src string, dst string, fromHead bool, toHead bool) (string, bool, error) {
+	list, err := ms.lookupList(src)
+	if err != nil || list == nil {
+		return "", false, err
+	}
+	target, err := ms.lookupList(dst)
+	if err != nil {
+		return "", false, err
+	}
+
+	var value string
+	if fromHead {
+		value, _ = list.PopHead()
+	} else {
+		value, _ = list.PopTail()
+	}
+	if target == nil {
+		target = newQuicklist()
+		ms.set(dst, Item{Value: target})
+	}
+	if toHead {
+		target.PushHead(value)
+	} else {
+		target.PushTail(value)
+	}
+	ms.signalModified(dst)
+	ms.signalReady(dst)
+	ms.notify(NOTIFY_LIST, listEvent(toHead, "push"), dst)
+	ms.notify(NOTIFY_LIST, listEvent(fromHead, "pop"), src)
+	if list.Len() == 0 {
+		ms.remove(src)
+		ms.notify(NOTIFY_GENERIC, "del", src)
+	} else {
+		ms.signalModified(src)
+	}
+	return value, true, nil
+}
@@ -0,0 +1,205 @@
+package app
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+var ErrListpackCorrupted = errors.New("corrupted listpack")
+
+// Listpacks are how RDB files store small lists, hashes, sorted sets and
+// the nodes of streams: a header with the total size and the number of
+// elements, the elements, each as an encoding byte, its data and the
+// length of both written backwards, and a closing 0xFF. Elements that are
+// integers in canonical form are stored as such.
+const (
+	LP_HDR_SIZE   = 6
+	LP_EOF        = 0xff
+	LP_COUNT_NONE = 0xffff
+)
+
+// listpackWriter builds a listpack element by element.
+type listpackWriter struct {
+	buf   []byte
+	count int
+}
+
+func newListpackWriter() *listpackWriter {
+	return &listpackWriter{buf: make([]byte, LP_HDR_SIZE, 64)}
+}
+
+func (lp *listpackWriter) appendString(s string) {
+	if n, ok := ParseInt(s); ok {
+		lp.appendInt(n)
+		return
+	}
+	start := len(lp.buf)
+	switch l := len(s); {
+	case l < 1<<6:
+		lp.buf = append(lp.buf, 0x80|byte(l))
+	case l < 1<<12:
+		lp.buf = append(lp.buf, 0xe0|byte(l>>8), byte(l))
+	default:
+		lp.buf = append(lp.buf, 0xf0)
+		lp.buf = binary.LittleEndian.AppendUint32(lp.buf, uint32(l))
+	}
+	lp.buf = append(lp.buf, s...)
+	lp.appendBacklen(len(lp.buf) - start)
+}
+
+func (lp *listpackWriter) appendInt(n int64) {
+	start := len(lp.buf)
+	switch {
+	case n >= 0 && n <= 127:
+		lp.buf = append(lp.buf, byte(n))
+	case n >= -1<<12 && n < 1<<12:
+		u := uint64(n) & (1<<13 - 1)
+		lp.buf = append(lp.buf, 0xc0|byte(u>>8), byte(u))
+	case n >= -1<<15 && n < 1<<15:
+		lp.buf = append(lp.buf, 0xf1)
+		lp.buf = binary.LittleEndian.AppendUint16(lp.buf, uint16(n))
+	case n >= -1<<23 && n < 1<<23:
+		u := uint32(n)
+		lp.buf = append(lp.buf, 0xf2, byte(u), byte(u>>8), byte(u>>16))
+	case n >= -1<<31 && n < 1<<31:
+		lp.buf = append(lp.buf, 0xf3)
+		lp.buf = binary.LittleEndian.AppendUint32(lp.buf, uint32(n))
+	default:
+		lp.buf = append(lp.buf, 0xf4)
+		lp.buf = binary.LittleEndian.AppendUint64(lp.buf, uint64(n))
+	}
+	lp.appendBacklen(len(lp.buf) - start)
+}
+
+// appendBacklen closes an element of l bytes with l in 7 bit groups, most
+// significant first, all but the first flagged with the high bit, so that
+// the listpack can be walked from its end.
+func (lp *listpackWriter) appendBacklen(l int) {
+	n := backlenSize(l)
+	lp.buf = append(lp.buf, byte(l>>(7*(n-1))))
+	for i := n - 2; i >= 0; i-- {
+		lp.buf = append(lp.buf, byte(l>>(7*i))&127|128)
+	}
+	lp.count++
+}
+
+// bytes closes the listpack and returns it.
+func (lp *listpackWriter) bytes() []byte {
+	lp.buf = append(lp.buf, LP_EOF)
+	binary.LittleEndian.PutUint32(lp.buf, uint32(len(lp.buf)))
+	count := lp.count
+	if count >= LP_COUNT_NONE {
+		count = LP_COUNT_NONE
+	}
+	binary.LittleEndian.PutUint16(lp.buf[4:], uint16(count))
+	return lp.buf
+}
+
+// listpackElements decodes the elements of a listpack, integers turned
+// back into their decimal form.
+func listpackElements(lp []byte) ([]string, error) {
+	if len(lp) < LP_HDR_SIZE+1 || int(binary.LittleEndian.Uint32(lp)) != len(lp) || lp[len(lp)-1] != LP_EOF {
+		return nil, ErrListpackCorrupted
+	}
+	var elements []string
+	if count := binary.LittleEndian.Uint16(lp[4:]); count != LP_COUNT_NONE {
+		elements = make([]string, 0, count)
+	}
+	p := lp[LP_HDR_SIZE : len(lp)-1]
+	for len(p) > 0 {
+		element, size, err := listpackElement(p)
+		if err != nil {
+			return nil, err
+		}
+		size += backlenSize(size)
+		if size > len(p) {
+			return nil, ErrListpackCorrupted
+		}
+		elements = append(elements, element)
+		p = p[size:]
+	}
+	return elements, nil
+}
+
+// listpackElement decodes the element p starts with and returns it along
+// with the size of its encoding and data.
+func listpackElement(p []byte) (string, int, error) {
+	need := func(n int) bool { return len(p) >= n }
+	b := p[0]
+	switch {
+	case b&0x80 == 0:
+		return strconv.Itoa(int(b)), 1, nil
+	case b&0xc0 == 0x80:
+		l := int(b & 0x3f)
+		if !need(1 + l) {
+			break
+		}
+		return string(p[1 : 1+l]), 1 + l, nil
+	case b&0xe0 == 0xc0:
+		if !need(2) {
+			break
+		}
+		u := int64(b&0x1f)<<8 | int64(p[1])
+		if u >= 1<<12 {
+			u -= 1 << 13
+		}
+		return strconv.FormatInt(u, 10), 2, nil
+	case b&0xf0 == 0xe0:
+		if !need(2) {
+			break
+		}
+		l := int(b&0x0f)<<8 | int(p[1])
+		if !need(2 + l) {
+			break
+		}
+		return string(p[2 : 2+l]), 2 + l, nil
+	case b == 0xf0:
+		if !need(5) {
+			break
+		}
+		l := int(binary.LittleEndian.Uint32(p[1:]))
+		if l < 0 || !need(5+l) {
+			break
+		}
+		return string(p[5 : 5+l]), 5 + l, nil
+	case b == 0xf1:
+		if !need(3) {
+			break
+		}
+		return strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(p[1:]))), 10), 3, nil
+	case b == 0xf2:
+		if !need(4) {
+			break
+		}
+		u := int32(uint32(p[1])<<8|uint32(p[2])<<16|uint32(p[3])<<24) >> 8
+		return strconv.FormatInt(int64(u), 10), 4, nil
+	case b == 0xf3:
+		if !need(5) {
+			break
+		}
+		return strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(p[1:]))), 10), 5, nil
+	case b == 0xf4:
+		if !need(9) {
+			break
+		}
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(p[1:])), 10), 9, nil
+	}
+	return "", 0, ErrListpackCorrupted
+}
+
+// backlenSize returns how many bytes the back length of an element of l
+// bytes takes, with the thresholds of Redis.
+func backlenSize(l int) int {
+	switch {
+	case l <= 127:
+		return 1
+	case l < 16383:
+		return 2
+	case l < 2097151:
+		return 3
+	case l < 268435455:
+		return 4
+	}
+	return 5
+}
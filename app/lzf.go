@@ -0,0 +1,112 @@
+package app
+
+import "errors"
+
+var ErrLZFCorrupted = errors.New("corrupted LZF data")
+
+// LZF is the compression of RDB strings, as liblzf does it: a stream of
+// literal runs, whose control byte 000LLLLL is followed by L+1 bytes, and
+// back references, LLLooooo [LLLLLLLL] oooooooo copying L+2 bytes from
+// o+1 bytes back, L taking the extra byte once it reaches 7.
+const (
+	LZF_MAX_LIT = 1 << 5
+	LZF_MAX_OFF = 1 << 13
+	LZF_MAX_REF = 1<<8 + 1<<3
+	LZF_HLOG    = 14
+)
+
+// lzfCompress compresses in, returning nil unless that saves at least
+// four bytes, the point below which Redis stores strings uncompressed.
+func lzfCompress(in []byte) []byte {
+	if len(in) <= 4 {
+		return nil
+	}
+	limit := len(in) - 4
+	out := make([]byte, 0, limit)
+	var htab [1 << LZF_HLOG]int
+	lit := 0
+	flushLiterals := func(end int) {
+		for lit < end {
+			n := min(end-lit, LZF_MAX_LIT)
+			out = append(out, byte(n-1))
+			out = append(out, in[lit:lit+n]...)
+			lit += n
+		}
+	}
+
+	for i := 0; i+2 < len(in); {
+		h := (uint32(in[i])<<16 | uint32(in[i+1])<<8 | uint32(in[i+2])) * 2654435761 >> (32 - LZF_HLOG)
+		ref := htab[h] - 1
+		htab[h] = i + 1
+		if ref < 0 || i-ref-1 >= LZF_MAX_OFF || in[ref] != in[i] || in[ref+1] != in[i+1] || in[ref+2] != in[i+2] {
+			i++
+			continue
+		}
+		maxLen := min(LZF_MAX_REF, len(in)-i)
+		n := 3
+		for n < maxLen && in[ref+n] == in[i+n] {
+			n++
+		}
+		flushLiterals(i)
+		off, l := i-ref-1, n-2
+		if l < 7 {
+			out = append(out, byte(l<<5|off>>8))
+		} else {
+			out = append(out, byte(7<<5|off>>8), byte(l-7))
+		}
+		out = append(out, byte(off))
+		i += n
+		lit = i
+		if len(out) > limit {
+			return nil
+		}
+	}
+	flushLiterals(len(in))
+	if len(out) > limit {
+		return nil
+	}
+	return out
+}
+
+// lzfDecompress expands in, which must decompress to exactly size bytes.
+func lzfDecompress(in []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < LZF_MAX_LIT {
+			n := ctrl + 1
+			if i+n > len(in) || len(out)+n > size {
+				return nil, ErrLZFCorrupted
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, ErrLZFCorrupted
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, ErrLZFCorrupted
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		n += 2
+		if ref < 0 || len(out)+n > size {
+			return nil, ErrLZFCorrupted
+		}
+		// References may overlap what they produce, so copy byte by byte.
+		for j := 0; j < n; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != size {
+		return nil, ErrLZFCorrupted
+	}
+	return out, nil
+}
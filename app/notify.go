@@ -0,0 +1,140 @@
+package app
+
+import (
+	"errors"
+	"strings"
+)
+
+// Classes of keyspace events, selected by the letters of
+// notify-keyspace-events. NOTIFY_KEYSPACE and NOTIFY_KEYEVENT choose the
+// channels events are published to, the others which events are.
+const (
+	NOTIFY_KEYSPACE = 1 << iota // K
+	NOTIFY_KEYEVENT             // E
+	NOTIFY_GENERIC              // g
+	NOTIFY_STRING               // $
+	NOTIFY_LIST                 // l
+	NOTIFY_SET                  // s
+	NOTIFY_HASH                 // h
+	NOTIFY_ZSET                 // z
+	NOTIFY_EXPIRED              // x
+	NOTIFY_EVICTED              // e
+	NOTIFY_STREAM               // t
+	NOTIFY_KEY_MISS             // m
+	NOTIFY_MODULE               // d
+	NOTIFY_NEW                  // n
+
+	// NOTIFY_ALL is what 'A' stands for; key misses and new keys have to be
+	// asked for by name.
+	NOTIFY_ALL = NOTIFY_GENERIC | NOTIFY_STRING | NOTIFY_LIST | NOTIFY_SET | NOTIFY_HASH |
+		NOTIFY_ZSET | NOTIFY_EXPIRED | NOTIFY_EVICTED | NOTIFY_STREAM | NOTIFY_MODULE
+)
+
+// ErrNotifyClass rejects notify-keyspace-events with an unknown letter.
+var ErrNotifyClass = errors.New("Invalid event class character. Use 'Ag$lshzxeKEtmdn'.")
+
+// notifyLetters maps each class to its letter, in the order Redis lists
+// them.
+var notifyLetters = []struct {
+	class  int
+	letter byte
+}{
+	{NOTIFY_GENERIC, 'g'},
+	{NOTIFY_STRING, '$'},
+	{NOTIFY_LIST, 'l'},
+	{NOTIFY_SET, 's'},
+	{NOTIFY_HASH, 'h'},
+	{NOTIFY_ZSET, 'z'},
+	{NOTIFY_EXPIRED, 'x'},
+	{NOTIFY_EVICTED, 'e'},
+	{NOTIFY_STREAM, 't'},
+	{NOTIFY_MODULE, 'd'},
+	{NOTIFY_KEYSPACE, 'K'},
+	{NOTIFY_KEYEVENT, 'E'},
+	{NOTIFY_KEY_MISS, 'm'},
+	{NOTIFY_NEW, 'n'},
+}
+
+// ParseKeyspaceEvents turns the letters of notify-keyspace-events into
+// classes.
+func ParseKeyspaceEvents(s string) (int, error) {
+	flags := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == 'A' {
+			flags |= NOTIFY_ALL
+			continue
+		}
+		found := false
+		for _, l := range notifyLetters {
+			if l.letter == s[i] {
+				flags |= l.class
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, ErrNotifyClass
+		}
+	}
+	return flags, nil
+}
+
+// FormatKeyspaceEvents turns classes back into letters, folding the
+// classes 'A' stands for.
+func FormatKeyspaceEvents(flags int) string {
+	var b strings.Builder
+	if flags&NOTIFY_ALL == NOTIFY_ALL {
+		b.WriteByte('A')
+	}
+	for _, l := range notifyLetters {
+		if flags&l.class == 0 || (l.class&NOTIFY_ALL != 0 && flags&NOTIFY_ALL == NOTIFY_ALL) {
+			continue
+		}
+		b.WriteByte(l.letter)
+	}
+	return b.String()
+}
+
+// SetKeyspaceNotifier sets the function keyspace events are published
+// with.
+func (ms *MemoryStorage) SetKeyspaceNotifier(publish func(channel string, message string)) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.publish = publish
+}
+
+// SetNotifyKeyspaceEvents selects the classes of events published.
+func (ms *MemoryStorage) SetNotifyKeyspaceEvents(flags int) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.notifyFlags = flags
+}
+
+func (ms *MemoryStorage) NotifyKeyspaceEvents() int {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return ms.notifyFlags
+}
+
+// notify publishes an event of class on key, to __keyspace@0__:<key> with
+// the event as the message and to __keyevent@0__:<event> with the key, as
+// far as notify-keyspace-events asks for them. The caller must hold the
+// mutex.
+func (ms *MemoryStorage) notify(class int, event string, key string) {
+	if ms.notifyFlags&class == 0 || ms.publish == nil {
+		return
+	}
+	if ms.notifyFlags&NOTIFY_KEYSPACE != 0 {
+		ms.publish("__keyspace@0__:"+key, event)
+	}
+	if ms.notifyFlags&NOTIFY_KEYEVENT != 0 {
+		ms.publish("__keyevent@0__:"+event, key)
+	}
+}
+
+// keyMiss publishes a keymiss event for a read of key that found nothing.
+// Only read commands report misses, as in Redis; writes and EXISTS or TYPE
+// don't. The caller must hold the mutex.
+func (ms *MemoryStorage) keyMiss(key string) {
+	ms.notify(NOTIFY_KEY_MISS, "keymiss", key)
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKeyspaceEventsFlags(t *testing.T) {
+	for _, tt := range []struct {
+		in, out string
+	}{
+		{"", ""},
+		{"KEA", "AKE"},
+		{"Ex", "xE"},
+		{"g$lshzxetdKE", "AKE"},
+		{"nKm", "Kmn"},
+	} {
+		flags, err := ParseKeyspaceEvents(tt.in)
+		if err != nil {
+			t.Fatalf("ParseKeyspaceEvents(%q): %v", tt.in, err)
+		}
+		if got := FormatKeyspaceEvents(flags); got != tt.out {
+			t.Errorf("FormatKeyspaceEvents(ParseKeyspaceEvents(%q)) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+	if _, err := ParseKeyspaceEvents("KEQ"); err != ErrNotifyClass {
+		t.Errorf("ParseKeyspaceEvents(KEQ) = %v, want ErrNotifyClass", err)
+	}
+}
+
+func TestKeyspaceEvents(t *testing.T) {
+	ms := NewMemoryStorage()
+	var published []string
+	ms.SetKeyspaceNotifier(func(channel string, message string) {
+		published = append(published, channel+" "+message)
+	})
+	expect := func(what string, want ...string) {
+		t.Helper()
+		if !reflect.DeepEqual(published, want) {
+			t.Errorf("%s published %q, want %q", what, published, want)
+		}
+		published = nil
+	}
+
+	ms.SetNotifyKeyspaceEvents(NOTIFY_KEYEVENT | NOTIFY_ALL)
+	ms.SetString("k", "v", SetOptions{Lifetime: time.Now().Add(time.Hour)})
+	expect("SET EX", "__keyevent@0__:set k", "__keyevent@0__:expire k")
+	ms.Rename("k", "j", false)
+	expect("RENAME", "__keyevent@0__:rename_from k", "__keyevent@0__:rename_to j")
+	ms.Push("l", []string{"a"}, true, false)
+	ms.LMove("l", "m", true, false)
+	expect("LMOVE", "__keyevent@0__:lpush l", "__keyevent@0__:rpush m", "__keyevent@0__:lpop l", "__keyevent@0__:del l")
+	ms.SetOpStore(SET_OP_UNION, "m", []string{"none"})
+	expect("SUNIONSTORE of nothing", "__keyevent@0__:del m")
+
+	ms.SetNotifyKeyspaceEvents(NOTIFY_KEYSPACE | NOTIFY_EXPIRED | NOTIFY_NEW)
+	ms.HSet("h", []string{"f", "v"}, false)
+	expect("HSET with n only", "__keyspace@0__:h new")
+	ms.Expire("h", time.Now().Add(time.Millisecond), 0)
+	time.Sleep(2 * time.Millisecond)
+	ms.Exists("h")
+	expect("expiry", "__keyspace@0__:h expired")
+
+	// Only reads report misses.
+	ms.SetNotifyKeyspaceEvents(NOTIFY_KEYEVENT | NOTIFY_KEY_MISS)
+	ms.GetString("none")
+	ms.HGet("none", "f")
+	ms.Exists("none")
+	ms.Delete("none")
+	expect("reads of a missing key", "__keyevent@0__:keymiss none", "__keyevent@0__:keymiss none")
+}
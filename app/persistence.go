@@ -0,0 +1,170 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBgsaveInProgress = errors.New("ERR Background save already in progress")
+	ErrSaveInProgress   = errors.New("ERR Save already in progress")
+)
+
+// persistence tracks where the dataset is saved to and how the last save
+// went. At most one save, by SAVE or in the background, runs at a time;
+// its flag is held until the file is written.
+type persistence struct {
+	mu               sync.Mutex
+	dir              string
+	dbfilename       string
+	saveInProgress   bool
+	bgsaveInProgress bool
+	lastSave         time.Time
+	lastBgsaveOK     bool
+}
+
+func (v *Vault) rdbPath() string {
+	v.persistence.mu.Lock()
+	defer v.persistence.mu.Unlock()
+	return filepath.Join(v.persistence.dir, v.persistence.dbfilename)
+}
+
+// RDBSnapshot returns the dataset as an RDB file, as sent to replicas on a
+// full resync.
+func (v *Vault) RDBSnapshot() ([]byte, error) {
+	return v.memory.SnapshotRDB()
+}
+
+// LoadRDB replaces the dataset with the content of an RDB file.
+func (v *Vault) LoadRDB(data []byte) error {
+	return v.memory.LoadRDB(data)
+}
+
+// LoadRDBFile loads the dataset saved at dir/dbfilename, if any.
+func (v *Vault) LoadRDBFile() error {
+	data, err := os.ReadFile(v.rdbPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return v.memory.LoadRDB(data)
+}
+
+// startSave flags a save, by SAVE or in the background, as in progress
+// unless one already is, and returns the path of the file to write.
+func (v *Vault) startSave(background bool) (string, error) {
+	v.persistence.mu.Lock()
+	defer v.persistence.mu.Unlock()
+	switch {
+	case v.persistence.bgsaveInProgress:
+		return "", ErrBgsaveInProgress
+	case v.persistence.saveInProgress:
+		return "", ErrSaveInProgress
+	}
+	if background {
+		v.persistence.bgsaveInProgress = true
+	} else {
+		v.persistence.saveInProgress = true
+	}
+	return filepath.Join(v.persistence.dir, v.persistence.dbfilename), nil
+}
+
+// SaveRDB writes the dataset to dir/dbfilename before returning.
+func (v *Vault) SaveRDB() error {
+	path, err := v.startSave(false)
+	if err != nil {
+		return err
+	}
+	data, err := v.memory.SnapshotRDB()
+	if err == nil {
+		err = v.writeRDBFile(path, data)
+	}
+	v.persistence.mu.Lock()
+	defer v.persistence.mu.Unlock()
+	v.persistence.saveInProgress = false
+	if err == nil {
+		v.persistence.lastSave = time.Now()
+	}
+	return err
+}
+
+// BackgroundSaveRDB snapshots the dataset and writes it to dir/dbfilename
+// in the background. Only taking the snapshot holds up other commands; the
+// values are encoded and compressed by the background goroutine.
+func (v *Vault) BackgroundSaveRDB() error {
+	path, err := v.startSave(true)
+	if err != nil {
+		return err
+	}
+	s := v.memory.snapshot()
+	go func() {
+		data, err := s.encode()
+		s.release()
+		if err == nil {
+			err = v.writeRDBFile(path, data)
+		}
+		v.persistence.mu.Lock()
+		defer v.persistence.mu.Unlock()
+		v.persistence.bgsaveInProgress = false
+		v.persistence.lastBgsaveOK = err == nil
+		if err != nil {
+			fmt.Println("ERROR || Background saving failed:", err)
+			return
+		}
+		v.persistence.lastSave = time.Now()
+		fmt.Println("INFO || Background saving terminated with success")
+	}()
+	return nil
+}
+
+// writeRDBFile writes data to a temporary file next to path and renames it
+// over path once it is synced, so a crash never leaves a partial file.
+func (v *Vault) writeRDBFile(path string, data []byte) error {
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf("temp-%d.rdb", os.Getpid()))
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// LastSave returns when the dataset was last saved, or the server started.
+func (v *Vault) LastSave() time.Time {
+	v.persistence.mu.Lock()
+	defer v.persistence.mu.Unlock()
+	return v.persistence.lastSave
+}
+
+// persistenceInfo renders the Persistence section of INFO.
+func (v *Vault) persistenceInfo() string {
+	v.persistence.mu.Lock()
+	defer v.persistence.mu.Unlock()
+	inProgress := 0
+	if v.persistence.bgsaveInProgress {
+		inProgress = 1
+	}
+	status := "ok"
+	if !v.persistence.lastBgsaveOK {
+		status = "err"
+	}
+	return fmt.Sprintf("# Persistence\r\nloading:0\r\nrdb_bgsave_in_progress:%d\r\nrdb_last_save_time:%d\r\nrdb_last_bgsave_status:%s\r\n",
+		inProgress, v.persistence.lastSave.Unix(), status)
+}
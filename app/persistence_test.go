@@ -0,0 +1,126 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRDBVersion(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.HSet("h", []string{"f", "v", "g", "w"}, false)
+	header := func() string {
+		t.Helper()
+		rdb, err := ms.SnapshotRDB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := NewMemoryStorage().LoadRDB(rdb); err != nil {
+			t.Fatal(err)
+		}
+		return string(rdb[:9])
+	}
+	if got := header(); got != "REDIS0011" {
+		t.Errorf("header without field expirations = %q, want REDIS0011", got)
+	}
+	ms.HExpire("h", time.Now().Add(time.Hour), 0, []string{"g"})
+	if got := header(); got != "REDIS0012" {
+		t.Errorf("header with field expirations = %q, want REDIS0012", got)
+	}
+}
+
+func TestSnapshotCopyOnWrite(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.SetString("s", "old", SetOptions{})
+	ms.Push("l", []string{"a", "b"}, false, false)
+	ms.HSet("h", []string{"f", "old"}, false)
+
+	s := ms.snapshot()
+	ms.SetString("s", "new", SetOptions{})
+	ms.Push("l", []string{"c"}, false, false)
+	ms.HSet("h", []string{"f", "new"}, false)
+	ms.SetString("added", "v", SetOptions{})
+	rdb, err := s.encode()
+	s.release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms.shared != nil {
+		t.Error("values still shared after the last snapshot was released")
+	}
+
+	loaded := NewMemoryStorage()
+	if err := loaded.LoadRDB(rdb); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Exists("added") {
+		t.Error("the snapshot holds a key added after it was taken")
+	}
+	if got, _, _ := loaded.GetString("s"); got != "old" {
+		t.Errorf("snapshot s = %q, want old", got)
+	}
+	if got, _ := loaded.LRange("l", 0, -1); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("snapshot l = %q, want [a b]", got)
+	}
+	if got, _, _ := loaded.HGet("h", "f"); got != "old" {
+		t.Errorf("snapshot h.f = %q, want old", got)
+	}
+	if got, _ := ms.LRange("l", 0, -1); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("l = %q, want [a b c]", got)
+	}
+	if got, _, _ := ms.HGet("h", "f"); got != "new" {
+		t.Errorf("h.f = %q, want new", got)
+	}
+}
+
+func TestSavesDoNotOverlap(t *testing.T) {
+	config := NewConfig("localhost", 0, "", 0)
+	config.Dir = t.TempDir()
+	v := NewVault(config)
+	defer v.Close()
+	v.memory.SetString("k", "v", SetOptions{})
+
+	// Hold each flag the way a running save does.
+	if _, err := v.startSave(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.SaveRDB(); err != ErrBgsaveInProgress {
+		t.Errorf("SAVE during BGSAVE = %v, want ErrBgsaveInProgress", err)
+	}
+	if err := v.BackgroundSaveRDB(); err != ErrBgsaveInProgress {
+		t.Errorf("BGSAVE during BGSAVE = %v, want ErrBgsaveInProgress", err)
+	}
+	v.persistence.bgsaveInProgress = false
+	if _, err := v.startSave(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.BackgroundSaveRDB(); err != ErrSaveInProgress {
+		t.Errorf("BGSAVE during SAVE = %v, want ErrSaveInProgress", err)
+	}
+	v.persistence.saveInProgress = false
+
+	if err := v.BackgroundSaveRDB(); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		v.persistence.mu.Lock()
+		done := !v.persistence.bgsaveInProgress
+		v.persistence.mu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("BGSAVE did not finish")
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(config.Dir, config.DBFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewMemoryStorage()
+	if err := loaded.LoadRDB(data); err != nil || !loaded.Exists("k") {
+		t.Errorf("saved file = %v, k missing", err)
+	}
+}
@@ -0,0 +1,365 @@
+package app
+
+const (
+	// A quicklist node holds at most QUICKLIST_NODE_ENTRIES elements and
+	// QUICKLIST_NODE_BYTES bytes of payload, like Redis's default
+	// list-max-listpack-size of -2 (8 KB).
+	QUICKLIST_NODE_ENTRIES = 128
+	QUICKLIST_NODE_BYTES   = 8 * 1024
+)
+
+type quicklistNode struct {
+	prev, next *quicklistNode
+	entries    []string
+	bytes      int
+}
+
+func (n *quicklistNode) full() bool {
+	return len(n.entries) >= QUICKLIST_NODE_ENTRIES || n.bytes >= QUICKLIST_NODE_BYTES
+}
+
+// quicklist is the list value: a doubly linked list of small slices, so
+// pushes and pops at both ends are cheap while elements stay packed instead
+// of costing a list node each.
+type quicklist struct {
+	head, tail *quicklistNode
+	count      int
+	nodes      int
+}
+
+func newQuicklist() *quicklist {
+	return &quicklist{}
+}
+
+// Len returns the number of elements.
+func (ql *quicklist) Len() int {
+	return ql.count
+}
+
+func (ql *quicklist) linkAfter(prev *quicklistNode, node *quicklistNode) {
+	node.prev = prev
+	if prev == nil {
+		node.next = ql.head
+		ql.head = node
+	} else {
+		node.next = prev.next
+		prev.next = node
+	}
+	if node.next != nil {
+		node.next.prev = node
+	} else {
+		ql.tail = node
+	}
+	ql.nodes++
+}
+
+func (ql *quicklist) unlink(node *quicklistNode) {
+	if node.prev != nil {
+		node.prev.next = node.next
+	} else {
+		ql.head = node.next
+	}
+	if node.next != nil {
+		node.next.prev = node.prev
+	} else {
+		ql.tail = node.prev
+	}
+	node.prev, node.next = nil, nil
+	ql.nodes--
+}
+
+// PushHead inserts value at the head of the list.
+func (ql *quicklist) PushHead(value string) {
+	if ql.head == nil || ql.head.full() {
+		ql.linkAfter(nil, &quicklistNode{})
+	}
+	node := ql.head
+	node.entries = append(node.entries, "")
+	copy(node.entries[1:], node.entries)
+	node.entries[0] = value
+	node.bytes += len(value)
+	ql.count++
+}
+
+// PushTail appends value at the tail of the list.
+func (ql *quicklist) PushTail(value string) {
+	if ql.tail == nil || ql.tail.full() {
+		ql.linkAfter(ql.tail, &quicklistNode{})
+	}
+	node := ql.tail
+	node.entries = append(node.entries, value)
+	node.bytes += len(value)
+	ql.count++
+}
+
+// PopHead removes and returns the head element.
+func (ql *quicklist) PopHead() (string, bool) {
+	if ql.count == 0 {
+		return "", false
+	}
+	value := ql.head.entries[0]
+	ql.deleteAt(ql.head, 0)
+	return value, true
+}
+
+// PopTail removes and returns the tail element.
+func (ql *quicklist) PopTail() (string, bool) {
+	if ql.count == 0 {
+		return "", false
+	}
+	value := ql.tail.entries[len(ql.tail.entries)-1]
+	ql.deleteAt(ql.tail, len(ql.tail.entries)-1)
+	return value, true
+}
+
+// deleteAt removes the element at offset i of node, dropping the node when
+// it becomes empty.
+func (ql *quicklist) deleteAt(node *quicklistNode, i int) {
+	node.bytes -= len(node.entries[i])
+	copy(node.entries[i:], node.entries[i+1:])
+	node.entries[len(node.entries)-1] = ""
+	node.entries = node.entries[:len(node.entries)-1]
+	ql.count--
+	if len(node.entries) == 0 {
+		ql.unlink(node)
+	}
+}
+
+// normalize resolves a possibly negative index into an offset from the
+// head, reporting whether it is in range.
+func (ql *quicklist) normalize(index int) (int, bool) {
+	if index < 0 {
+		index += ql.count
+	}
+	return index, index >= 0 && index < ql.count
+}
+
+// locate returns the node holding the element at offset index from the
+// head, walking from whichever end is closer.
+func (ql *quicklist) locate(index int) (*quicklistNode, int) {
+	if index < ql.count/2 {
+		for node := ql.head; node != nil; node = node.next {
+			if index < len(node.entries) {
+				return node, index
+			}
+			index -= len(node.entries)
+		}
+		return nil, 0
+	}
+	index = ql.count - 1 - index
+	for node := ql.tail; node != nil; node = node.prev {
+		if index < len(node.entries) {
+			return node, len(node.entries) - 1 - index
+		}
+		index -= len(node.entries)
+	}
+	return nil, 0
+}
+
+// Index returns the element at index; negative indexes count from the tail.
+func (ql *quicklist) Index(index int) (string, bool) {
+	index, ok := ql.normalize(index)
+	if !ok {
+		return "", false
+	}
+	node, i := ql.locate(index)
+	return node.entries[i], true
+}
+
+// Set replaces the element at index, reporting whether it is in range.
+func (ql *quicklist) Set(index int, value string) bool {
+	index, ok := ql.normalize(index)
+	if !ok {
+		return false
+	}
+	node, i := ql.locate(index)
+	node.bytes += len(value) - len(node.entries[i])
+	node.entries[i] = value
+	return true
+}
+
+// Range returns the elements from offset start to stop inclusive, which
+// must be in range.
+func (ql *quicklist) Range(start int, stop int) []string {
+	values := make([]string, 0, stop-start+1)
+	node, i := ql.locate(start)
+	for ; node != nil && len(values) < cap(values); node, i = node.next, 0 {
+		end := i + cap(values) - len(values)
+		if end > len(node.entries) {
+			end = len(node.entries)
+		}
+		values = append(values, node.entries[i:end]...)
+	}
+	return values
+}
+
+// Insert adds value before or after the first occurrence of pivot,
+// reporting whether pivot was found. A full node is split in two.
+func (ql *quicklist) Insert(pivot string, value string, before bool) bool {
+	for node := ql.head; node != nil; node = node.next {
+		for i, entry := range node.entries {
+			if entry != pivot {
+				continue
+			}
+			if !before {
+				i++
+			}
+			node.entries = append(node.entries, "")
+			copy(node.entries[i+1:], node.entries[i:])
+			node.entries[i] = value
+			node.bytes += len(value)
+			ql.count++
+			if len(node.entries) > QUICKLIST_NODE_ENTRIES || node.bytes > 2*QUICKLIST_NODE_BYTES {
+				ql.split(node)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// split moves the second half of node to a new node linked after it.
+func (ql *quicklist) split(node *quicklistNode) {
+	half := len(node.entries) / 2
+	moved := &quicklistNode{entries: append([]string(nil), node.entries[half:]...)}
+	for _, entry := range moved.entries {
+		moved.bytes += len(entry)
+	}
+	node.entries = node.entries[:half:half]
+	node.bytes -= moved.bytes
+	ql.linkAfter(node, moved)
+}
+
+// Remove deletes up to count occurrences of value, scanning from the head
+// when count is positive and from the tail when it is negative; zero removes
+// them all. It returns the number removed.
+func (ql *quicklist) Remove(count int, value string) int {
+	removed := 0
+	if count >= 0 {
+		for node := ql.head; node != nil; {
+			next := node.next
+			for i := 0; i < len(node.entries); {
+				if node.entries[i] == value && (count == 0 || removed < count) {
+					ql.deleteAt(node, i)
+					removed++
+					continue
+				}
+				i++
+			}
+			node = next
+		}
+		return removed
+	}
+	for node := ql.tail; node != nil; {
+		prev := node.prev
+		for i := len(node.entries) - 1; i >= 0 && removed < -count; i-- {
+			if node.entries[i] == value {
+				ql.deleteAt(node, i)
+				removed++
+			}
+		}
+		node = prev
+	}
+	return removed
+}
+
+// Positions returns the indexes of the occurrences of value, scanning from
+// the head when rank is positive and from the tail when it is negative, and
+// skipping the first |rank|-1 matches. At most count indexes are returned,
+// all of them when count is 0, and only the first maxlen elements scanned
+// are compared, all of them when maxlen is 0.
+func (ql *quicklist) Positions(value string, rank int, count int, maxlen int) []int {
+	var positions []int
+	skip := rank - 1
+	if rank < 0 {
+		skip = -rank - 1
+	}
+	scanned := 0
+	match := func(entry string, index int) bool {
+		scanned++
+		if entry == value {
+			if skip > 0 {
+				skip--
+			} else {
+				positions = append(positions, index)
+			}
+		}
+		return (count == 0 || len(positions) < count) && (maxlen == 0 || scanned < maxlen)
+	}
+	if rank > 0 {
+		index := 0
+		for node := ql.head; node != nil; node = node.next {
+			for _, entry := range node.entries {
+				if !match(entry, index) {
+					return positions
+				}
+				index++
+			}
+		}
+		return positions
+	}
+	index := ql.count - 1
+	for node := ql.tail; node != nil; node = node.prev {
+		for i := len(node.entries) - 1; i >= 0; i-- {
+			if !match(node.entries[i], index) {
+				return positions
+			}
+			index--
+		}
+	}
+	return positions
+}
+
+// Trim keeps only the elements from offset start to stop inclusive, which
+// must be in range.
+func (ql *quicklist) Trim(start int, stop int) {
+	for drop := start; drop > 0; {
+		node := ql.head
+		if drop >= len(node.entries) {
+			drop -= len(node.entries)
+			ql.count -= len(node.entries)
+			ql.unlink(node)
+			continue
+		}
+		for _, entry := range node.entries[:drop] {
+			node.bytes -= len(entry)
+		}
+		node.entries = append(node.entries[:0], node.entries[drop:]...)
+		ql.count -= drop
+		drop = 0
+	}
+	for drop := ql.count - (stop - start + 1); drop > 0; {
+		node := ql.tail
+		if drop >= len(node.entries) {
+			drop -= len(node.entries)
+			ql.count -= len(node.entries)
+			ql.unlink(node)
+			continue
+		}
+		keep := len(node.entries) - drop
+		for _, entry := range node.entries[keep:] {
+			node.bytes -= len(entry)
+		}
+		node.entries = node.entries[:keep]
+		ql.count -= drop
+		drop = 0
+	}
+}
+
+// Values returns every element from head to tail.
+func (ql *quicklist) Values() []string {
+	if ql.count == 0 {
+		return nil
+	}
+	return ql.Range(0, ql.count-1)
+}
+
+// Copy returns a deep copy of the list.
+func (ql *quicklist) Copy() *quicklist {
+	dup := newQuicklist()
+	for node := ql.head; node != nil; node = node.next {
+		dup.linkAfter(dup.tail, &quicklistNode{entries: append([]string(nil), node.entries...), bytes: node.bytes})
+	}
+	dup.count = ql.count
+	return dup
+}
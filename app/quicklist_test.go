@@ -0,0 +1,93 @@
+package app
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// checkList compares ql against want and verifies the node bookkeeping.
+func checkList(t *testing.T, ql *quicklist, want []string) {
+	t.Helper()
+	if got := ql.Values(); !reflect.DeepEqual(got, want) && !(len(got) == 0 && len(want) == 0) {
+		t.Fatalf("values = %v, want %v", got, want)
+	}
+	count, nodes := 0, 0
+	for node := ql.head; node != nil; node = node.next {
+		if len(node.entries) == 0 {
+			t.Fatal("empty node left in the list")
+		}
+		bytes := 0
+		for _, entry := range node.entries {
+			bytes += len(entry)
+		}
+		if bytes != node.bytes {
+			t.Fatalf("node bytes = %d, want %d", node.bytes, bytes)
+		}
+		count += len(node.entries)
+		nodes++
+	}
+	if count != ql.Len() || nodes != ql.nodes {
+		t.Fatalf("count %d nodes %d, list says %d and %d", count, nodes, ql.Len(), ql.nodes)
+	}
+}
+
+func TestQuicklist(t *testing.T) {
+	ql := newQuicklist()
+	var want []string
+	for i := 0; i < 1000; i++ {
+		ql.PushTail(strconv.Itoa(i))
+		want = append(want, strconv.Itoa(i))
+	}
+	ql.PushHead("head")
+	want = append([]string{"head"}, want...)
+	checkList(t, ql, want)
+	if ql.nodes < 2 {
+		t.Fatalf("1001 elements fit in %d node", ql.nodes)
+	}
+
+	for _, i := range []int{0, 1, 500, 1000, -1, -1001} {
+		j := i
+		if j < 0 {
+			j += len(want)
+		}
+		if got, ok := ql.Index(i); !ok || got != want[j] {
+			t.Errorf("Index(%d) = %q, want %q", i, got, want[j])
+		}
+	}
+
+	// Inserting into a full node splits it.
+	for i := 0; i < 200; i++ {
+		ql.Insert("500", "x", true)
+	}
+	pos := 501
+	want = append(want[:pos], append(make([]string, 200), want[pos:]...)...)
+	for i := 0; i < 200; i++ {
+		want[pos+i] = "x"
+	}
+	checkList(t, ql, want)
+
+	if n := ql.Remove(-3, "x"); n != 3 {
+		t.Fatalf("Remove(-3) = %d", n)
+	}
+	want = append(want[:pos+197], want[pos+200:]...)
+	checkList(t, ql, want)
+	if n := ql.Remove(0, "x"); n != 197 {
+		t.Fatalf("Remove(0) = %d", n)
+	}
+	want = append(want[:pos], want[pos+197:]...)
+	checkList(t, ql, want)
+
+	ql.Trim(300, 700)
+	want = want[300:701]
+	checkList(t, ql, want)
+
+	for len(want) > 0 {
+		value, _ := ql.PopTail()
+		if value != want[len(want)-1] {
+			t.Fatalf("PopTail = %q, want %q", value, want[len(want)-1])
+		}
+		want = want[:len(want)-1]
+	}
+	checkList(t, ql, nil)
+}
@@ -0,0 +1,538 @@
+package app
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Snapshots are RDB files of version 11, the format of Redis 7.2, so that
+// they can be exchanged with it, unless they hold hashes with field
+// expirations, which take version 12. Values are written in the encodings
+// Redis would pick for them, plain ones rather than listpacks where Redis
+// has a choice that rednav does not track.
+const (
+	RDB_VERSION               = 11
+	RDB_VERSION_HASH_METADATA = 12
+
+	RDB_TYPE_STRING             = 0
+	RDB_TYPE_LIST               = 1
+	RDB_TYPE_SET                = 2
+	RDB_TYPE_ZSET               = 3
+	RDB_TYPE_HASH               = 4
+	RDB_TYPE_ZSET_2             = 5
+	RDB_TYPE_SET_INTSET         = 11
+	RDB_TYPE_STREAM_LISTPACKS   = 15
+	RDB_TYPE_HASH_LISTPACK      = 16
+	RDB_TYPE_ZSET_LISTPACK      = 17
+	RDB_TYPE_LIST_QUICKLIST_2   = 18
+	RDB_TYPE_STREAM_LISTPACKS_2 = 19
+	RDB_TYPE_SET_LISTPACK       = 20
+	RDB_TYPE_STREAM_LISTPACKS_3 = 21
+	// RDB_TYPE_HASH_METADATA holds hashes with field expirations. It comes
+	// from version 12 (Redis 7.4), version 11 having no way to store them.
+	RDB_TYPE_HASH_METADATA = 24
+
+	RDB_OPCODE_FUNCTION2       = 245
+	RDB_OPCODE_FUNCTION_PRE_GA = 246
+	RDB_OPCODE_MODULE_AUX      = 247
+	RDB_OPCODE_IDLE            = 248
+	RDB_OPCODE_FREQ            = 249
+	RDB_OPCODE_AUX             = 250
+	RDB_OPCODE_RESIZEDB        = 251
+	RDB_OPCODE_EXPIRETIME_MS   = 252
+	RDB_OPCODE_EXPIRETIME      = 253
+	RDB_OPCODE_SELECTDB        = 254
+	RDB_OPCODE_EOF             = 255
+
+	// Lengths take 6, 14, 32 or 64 bits, told apart by the two high bits
+	// of their first byte; 11 there flags a specially encoded string.
+	RDB_6BITLEN  = 0
+	RDB_14BITLEN = 1
+	RDB_32BITLEN = 0x80
+	RDB_64BITLEN = 0x81
+	RDB_ENCVAL   = 3
+
+	RDB_ENC_INT8  = 0
+	RDB_ENC_INT16 = 1
+	RDB_ENC_INT32 = 2
+	RDB_ENC_LZF   = 3
+
+	// Strings are only compressed past this length, like Redis does.
+	RDB_LZF_MIN_LEN = 20
+
+	QUICKLIST_NODE_CONTAINER_PLAIN  = 1
+	QUICKLIST_NODE_CONTAINER_PACKED = 2
+
+	STREAM_ITEM_FLAG_DELETED    = 1
+	STREAM_ITEM_FLAG_SAMEFIELDS = 2
+	// Stream entries are written in listpacks of at most this many, like
+	// Redis's stream-node-max-entries.
+	STREAM_NODE_MAX_ENTRIES = 100
+)
+
+// rdbWriter accumulates an RDB file. hashMetadata records that a
+// RDB_TYPE_HASH_METADATA value was written.
+type rdbWriter struct {
+	buf          []byte
+	hashMetadata bool
+}
+
+func (w *rdbWriter) writeByte(b byte) {
+	w.buf = append(w.buf, b)
+}
+
+func (w *rdbWriter) writeLen(n uint64) {
+	switch {
+	case n < 1<<6:
+		w.buf = append(w.buf, byte(n))
+	case n < 1<<14:
+		w.buf = append(w.buf, RDB_14BITLEN<<6|byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		w.buf = append(w.buf, RDB_32BITLEN)
+		w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(n))
+	default:
+		w.buf = append(w.buf, RDB_64BITLEN)
+		w.buf = binary.BigEndian.AppendUint64(w.buf, n)
+	}
+}
+
+// writeString writes s as an integer when it is a small one in canonical
+// form, compressed when that pays off, or else as is.
+func (w *rdbWriter) writeString(s string) {
+	if len(s) <= 11 {
+		if n, ok := ParseInt(s); ok && n >= math.MinInt32 && n <= math.MaxInt32 {
+			w.writeInt(n)
+			return
+		}
+	}
+	if len(s) > RDB_LZF_MIN_LEN {
+		if compressed := lzfCompress([]byte(s)); compressed != nil {
+			w.buf = append(w.buf, RDB_ENCVAL<<6|RDB_ENC_LZF)
+			w.writeLen(uint64(len(compressed)))
+			w.writeLen(uint64(len(s)))
+			w.buf = append(w.buf, compressed...)
+			return
+		}
+	}
+	w.writeLen(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *rdbWriter) writeInt(n int64) {
+	switch {
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		w.buf = append(w.buf, RDB_ENCVAL<<6|RDB_ENC_INT8, byte(n))
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		w.buf = append(w.buf, RDB_ENCVAL<<6|RDB_ENC_INT16)
+		w.buf = binary.LittleEndian.AppendUint16(w.buf, uint16(n))
+	default:
+		w.buf = append(w.buf, RDB_ENCVAL<<6|RDB_ENC_INT32)
+		w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(n))
+	}
+}
+
+func (w *rdbWriter) writeMillis(ms int64) {
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, uint64(ms))
+}
+
+func (w *rdbWriter) writeDouble(f float64) {
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(f))
+}
+
+// writeStreamID writes id in the 128 bit big endian form streams are
+// keyed by.
+func (w *rdbWriter) writeStreamID(id StreamID) {
+	w.buf = binary.BigEndian.AppendUint64(w.buf, id.Ms)
+	w.buf = binary.BigEndian.AppendUint64(w.buf, id.Seq)
+}
+
+func (w *rdbWriter) writeAux(key string, value string) {
+	w.writeByte(RDB_OPCODE_AUX)
+	w.writeString(key)
+	w.writeString(value)
+}
+
+// rdbSnapshot is the dataset as of a point in time, encoded as an RDB file
+// without holding the mutex. Its lists, sets, hashes, sorted sets and
+// streams are shared with the storage until released, and copied by the
+// storage before it next touches them (see unshare); strings are immutable.
+type rdbSnapshot struct {
+	ms       *MemoryStorage
+	keys     []string
+	items    []Item
+	volatile int
+	now      time.Time
+}
+
+// SnapshotRDB serializes the dataset as an RDB file, holding the mutex only
+// to take a snapshot. Keys whose lifetime is over are left out.
+func (ms *MemoryStorage) SnapshotRDB() ([]byte, error) {
+	s := ms.snapshot()
+	defer s.release()
+	return s.encode()
+}
+
+// snapshot collects the live keys along with their values, marking the
+// values that may be modified in place as shared. Only references are
+// copied, so this is cheap next to encoding the values.
+func (ms *MemoryStorage) snapshot() *rdbSnapshot {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s := &rdbSnapshot{
+		ms:    ms,
+		keys:  make([]string, 0, ms.storage.Len()),
+		items: make([]Item, 0, ms.storage.Len()),
+		now:   time.Now(),
+	}
+	if ms.shared == nil {
+		ms.shared = make(map[interface{}]struct{})
+	}
+	ms.snapshots++
+	ms.storage.Range(func(key string, item Item) bool {
+		if !item.Lifetime.IsZero() && s.now.After(item.Lifetime) {
+			return true
+		}
+		if !item.Lifetime.IsZero() {
+			s.volatile++
+		}
+		if mutable(item.Value) {
+			ms.shared[item.Value] = struct{}{}
+		}
+		s.keys = append(s.keys, key)
+		s.items = append(s.items, item)
+		return true
+	})
+	return s
+}
+
+// release tells the storage it may modify the values of the snapshot
+// again, once no other snapshot reads them.
+func (s *rdbSnapshot) release() {
+	s.ms.mutex.Lock()
+	defer s.ms.mutex.Unlock()
+	s.ms.snapshots--
+	if s.ms.snapshots == 0 {
+		s.ms.shared = nil
+	}
+}
+
+// encode serializes the snapshot. The header announces version 12 if a
+// hash with field expirations was written, 11 otherwise.
+func (s *rdbSnapshot) encode() ([]byte, error) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	w := &rdbWriter{buf: make([]byte, 0, 4096)}
+	w.buf = append(w.buf, fmt.Sprintf("REDIS%04d", RDB_VERSION)...)
+	w.writeAux("redis-ver", VERSION)
+	w.writeAux("redis-bits", strconv.Itoa(strconv.IntSize))
+	w.writeAux("ctime", strconv.FormatInt(s.now.Unix(), 10))
+	w.writeAux("used-mem", strconv.FormatUint(mem.HeapAlloc, 10))
+	w.writeAux("aof-base", "0")
+
+	w.writeByte(RDB_OPCODE_SELECTDB)
+	w.writeLen(0)
+	w.writeByte(RDB_OPCODE_RESIZEDB)
+	w.writeLen(uint64(len(s.keys)))
+	w.writeLen(uint64(s.volatile))
+
+	for i, key := range s.keys {
+		if err := w.writeKey(key, s.items[i], s.now); err != nil {
+			return nil, err
+		}
+	}
+
+	if w.hashMetadata {
+		copy(w.buf[len("REDIS"):], fmt.Sprintf("%04d", RDB_VERSION_HASH_METADATA))
+	}
+	w.writeByte(RDB_OPCODE_EOF)
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, crc64Update(0, w.buf))
+	return w.buf, nil
+}
+
+// writeKey writes a key with its lifetime, type and value.
+func (w *rdbWriter) writeKey(key string, item Item, now time.Time) error {
+	var hashEntries []hashEntry
+	if h, ok := item.Value.(*hashValue); ok {
+		// Fields past their expiration may linger until the hash is
+		// next looked up; they are dropped here, and the key with them
+		// when none is left.
+		hashEntries = make([]hashEntry, 0, h.Len())
+		h.each(func(entry hashEntry) bool {
+			if !entry.expired(now) {
+				hashEntries = append(hashEntries, entry)
+			}
+			return true
+		})
+		if len(hashEntries) == 0 {
+			return nil
+		}
+	}
+
+	if !item.Lifetime.IsZero() {
+		w.writeByte(RDB_OPCODE_EXPIRETIME_MS)
+		w.writeMillis(item.Lifetime.UnixMilli())
+	}
+	switch value := item.Value.(type) {
+	case string:
+		w.writeByte(RDB_TYPE_STRING)
+		w.writeString(key)
+		w.writeString(value)
+	case int64:
+		w.writeByte(RDB_TYPE_STRING)
+		w.writeString(key)
+		w.writeString(strconv.FormatInt(value, 10))
+	case *quicklist:
+		w.writeByte(RDB_TYPE_LIST_QUICKLIST_2)
+		w.writeString(key)
+		w.writeList(value)
+	case *setValue:
+		if value.table == nil {
+			w.writeByte(RDB_TYPE_SET_INTSET)
+			w.writeString(key)
+			w.writeString(string(intsetBytes(value.ints)))
+			break
+		}
+		w.writeByte(RDB_TYPE_SET)
+		w.writeString(key)
+		w.writeLen(uint64(value.Len()))
+		value.each(func(member string) bool {
+			w.writeString(member)
+			return true
+		})
+	case *hashValue:
+		w.writeHash(key, value, hashEntries)
+	case *zsetValue:
+		w.writeByte(RDB_TYPE_ZSET_2)
+		w.writeString(key)
+		w.writeLen(uint64(value.Len()))
+		for x := value.zsl.first(); x != nil; x = x.level[0].forward {
+			w.writeString(x.member)
+			w.writeDouble(x.score)
+		}
+	case *streamValue:
+		w.writeByte(RDB_TYPE_STREAM_LISTPACKS_3)
+		w.writeString(key)
+		w.writeStream(value)
+	default:
+		return fmt.Errorf("can't save the value of %q, of type %T", key, item.Value)
+	}
+	return nil
+}
+
+// writeList writes each quicklist node as a listpack.
+func (w *rdbWriter) writeList(ql *quicklist) {
+	nodes := 0
+	for node := ql.head; node != nil; node = node.next {
+		if len(node.entries) > 0 {
+			nodes++
+		}
+	}
+	w.writeLen(uint64(nodes))
+	for node := ql.head; node != nil; node = node.next {
+		if len(node.entries) == 0 {
+			continue
+		}
+		lp := newListpackWriter()
+		for _, entry := range node.entries {
+			lp.appendString(entry)
+		}
+		w.writeLen(QUICKLIST_NODE_CONTAINER_PACKED)
+		w.writeString(string(lp.bytes()))
+	}
+}
+
+// intsetBytes lays a sorted set of integers out as an intset: the width
+// of its elements, 2, 4 or 8 bytes, their count and the elements, all in
+// little endian.
+func intsetBytes(ints []int64) []byte {
+	width := 2
+	for _, n := range ints {
+		switch {
+		case n < math.MinInt32 || n > math.MaxInt32:
+			width = 8
+		case (n < math.MinInt16 || n > math.MaxInt16) && width < 4:
+			width = 4
+		}
+	}
+	buf := make([]byte, 0, 8+width*len(ints))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(width))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(ints)))
+	for _, n := range ints {
+		switch width {
+		case 2:
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(n))
+		case 4:
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(n))
+		default:
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(n))
+		}
+	}
+	return buf
+}
+
+// writeHash writes the live entries of a hash. Those with expirations
+// are written as a HASH_METADATA value: the earliest expiration, then each
+// field preceded by its expiration relative to it, plus one, or 0 when it
+// has none.
+func (w *rdbWriter) writeHash(key string, h *hashValue, entries []hashEntry) {
+	var minExpire int64 = math.MaxInt64
+	for _, entry := range entries {
+		if !entry.expire.IsZero() {
+			minExpire = min(minExpire, entry.expire.UnixMilli())
+		}
+	}
+	switch {
+	case minExpire != math.MaxInt64:
+		w.writeByte(RDB_TYPE_HASH_METADATA)
+		w.hashMetadata = true
+		w.writeString(key)
+		w.writeMillis(minExpire)
+		w.writeLen(uint64(len(entries)))
+		for _, entry := range entries {
+			ttl := uint64(0)
+			if !entry.expire.IsZero() {
+				ttl = uint64(entry.expire.UnixMilli()-minExpire) + 1
+			}
+			w.writeLen(ttl)
+			w.writeString(entry.field)
+			w.writeString(entry.value)
+		}
+	case h.table == nil:
+		w.writeByte(RDB_TYPE_HASH_LISTPACK)
+		w.writeString(key)
+		lp := newListpackWriter()
+		for _, entry := range entries {
+			lp.appendString(entry.field)
+			lp.appendString(entry.value)
+		}
+		w.writeString(string(lp.bytes()))
+	default:
+		w.writeByte(RDB_TYPE_HASH)
+		w.writeString(key)
+		w.writeLen(uint64(len(entries)))
+		for _, entry := range entries {
+			w.writeString(entry.field)
+			w.writeString(entry.value)
+		}
+	}
+}
+
+// writeStream writes the entries of a stream in listpacks keyed by their
+// first ID, its metadata, and its consumer groups with their pending
+// entries and consumers.
+func (w *rdbWriter) writeStream(s *streamValue) {
+	nodes := (len(s.entries) + STREAM_NODE_MAX_ENTRIES - 1) / STREAM_NODE_MAX_ENTRIES
+	w.writeLen(uint64(nodes))
+	for start := 0; start < len(s.entries); start += STREAM_NODE_MAX_ENTRIES {
+		chunk := s.entries[start:min(start+STREAM_NODE_MAX_ENTRIES, len(s.entries))]
+		master := chunk[0].ID
+		var key rdbWriter
+		key.writeStreamID(master)
+		w.writeString(string(key.buf))
+		w.writeString(string(streamListpack(master, chunk)))
+	}
+
+	w.writeLen(uint64(len(s.entries)))
+	w.writeLen(s.lastID.Ms)
+	w.writeLen(s.lastID.Seq)
+	first := s.firstID()
+	w.writeLen(first.Ms)
+	w.writeLen(first.Seq)
+	w.writeLen(s.maxDeletedID.Ms)
+	w.writeLen(s.maxDeletedID.Seq)
+	w.writeLen(s.entriesAdded)
+
+	names := make([]string, 0, len(s.groups))
+	for name := range s.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w.writeLen(uint64(len(names)))
+	for _, name := range names {
+		g := s.groups[name]
+		w.writeString(name)
+		w.writeLen(g.lastID.Ms)
+		w.writeLen(g.lastID.Seq)
+		w.writeLen(uint64(g.entriesRead))
+
+		owned := make(map[*streamConsumer][]StreamID, len(g.consumers))
+		w.writeLen(uint64(len(g.pel)))
+		for _, nack := range g.pel {
+			w.writeStreamID(nack.id)
+			w.writeMillis(nack.deliveryTime)
+			w.writeLen(uint64(nack.deliveryCount))
+			owned[nack.consumer] = append(owned[nack.consumer], nack.id)
+		}
+
+		consumers := make([]string, 0, len(g.consumers))
+		for consumer := range g.consumers {
+			consumers = append(consumers, consumer)
+		}
+		sort.Strings(consumers)
+		w.writeLen(uint64(len(consumers)))
+		for _, consumer := range consumers {
+			c := g.consumers[consumer]
+			w.writeString(c.name)
+			w.writeMillis(c.seenTime)
+			w.writeMillis(c.activeTime)
+			w.writeLen(uint64(len(owned[c])))
+			for _, id := range owned[c] {
+				w.writeStreamID(id)
+			}
+		}
+	}
+}
+
+// streamListpack lays entries out as a stream listpack node. The node
+// starts with a master entry: the number of entries, of deleted ones, and
+// the field names of the first entry. Each entry follows as its flags, its
+// ID relative to master, its fields, only the values when the names are
+// those of the master entry, and the number of elements it took.
+func streamListpack(master StreamID, entries []StreamEntry) []byte {
+	lp := newListpackWriter()
+	masterFields := make([]string, 0, len(entries[0].Fields)/2)
+	for i := 0; i+1 < len(entries[0].Fields); i += 2 {
+		masterFields = append(masterFields, entries[0].Fields[i])
+	}
+	lp.appendInt(int64(len(entries)))
+	lp.appendInt(0)
+	lp.appendInt(int64(len(masterFields)))
+	for _, field := range masterFields {
+		lp.appendString(field)
+	}
+	lp.appendInt(0)
+
+	for _, entry := range entries {
+		numFields := len(entry.Fields) / 2
+		same := numFields == len(masterFields)
+		for i := 0; same && i < numFields; i++ {
+			same = entry.Fields[2*i] == masterFields[i]
+		}
+		flags := int64(0)
+		if same {
+			flags |= STREAM_ITEM_FLAG_SAMEFIELDS
+		}
+		lp.appendInt(flags)
+		lp.appendInt(int64(entry.ID.Ms - master.Ms))
+		lp.appendInt(int64(entry.ID.Seq - master.Seq))
+		if same {
+			for i := 0; i < numFields; i++ {
+				lp.appendString(entry.Fields[2*i+1])
+			}
+			lp.appendInt(int64(numFields + 3))
+		} else {
+			lp.appendInt(int64(numFields))
+			for _, field := range entry.Fields[:2*numFields] {
+				lp.appendString(field)
+			}
+			lp.appendInt(int64(2*numFields + 4))
+		}
+	}
+	return lp.bytes()
+}
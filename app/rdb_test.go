@@ -0,0 +1,222 @@
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCRC64(t *testing.T) {
+	if got := crc64Update(0, []byte("123456789")); got != 0xe9c6d914c4b8d9ca {
+		t.Errorf("crc64(123456789) = %#x, want 0xe9c6d914c4b8d9ca", got)
+	}
+}
+
+func TestLZF(t *testing.T) {
+	for _, in := range []string{
+		strings.Repeat("a", 1000),
+		strings.Repeat("hello world, ", 50),
+		strings.Repeat("0123456789abcdefghijklmnopqrstuvwxyz", 300),
+	} {
+		compressed := lzfCompress([]byte(in))
+		if compressed == nil {
+			t.Fatalf("%q... did not compress", in[:20])
+		}
+		out, err := lzfDecompress(compressed, len(in))
+		if err != nil || string(out) != in {
+			t.Errorf("round trip of %q... = %v", in[:20], err)
+		}
+	}
+	if compressed := lzfCompress([]byte("abcdefghijklmnopqrstuvwxyz")); compressed != nil {
+		t.Errorf("incompressible input compressed to %d bytes", len(compressed))
+	}
+	if _, err := lzfDecompress([]byte{0x20, 0x00}, 3); err != ErrLZFCorrupted {
+		t.Errorf("reference before the start = %v", err)
+	}
+}
+
+func TestListpack(t *testing.T) {
+	elements := []string{"0", "127", "128", "-1", "4095", "-4096", "4096", "32767", "-32768",
+		"8388607", "-8388608", "2147483647", "-2147483648", "9223372036854775807", "-9223372036854775808",
+		"", "007", "-0", "a string", strings.Repeat("x", 100), strings.Repeat("y", 5000)}
+	lp := newListpackWriter()
+	for _, element := range elements {
+		lp.appendString(element)
+	}
+	got, err := listpackElements(lp.bytes())
+	if err != nil || !reflect.DeepEqual(got, elements) {
+		t.Errorf("listpackElements = %q, %v", got, err)
+	}
+}
+
+// TestLoadRedisRDB loads an empty RDB file written by Redis 7.2.
+func TestLoadRedisRDB(t *testing.T) {
+	rdb, _ := base64.StdEncoding.DecodeString("UkVESVMwMDEx+glyZWRpcy12ZXIFNy4yLjD6CnJlZGlzLWJpdHPAQPoFY3RpbWXCbQi8ZfoIdXNlZC1tZW3CsMQQAPoIYW9mLWJhc2XAAP/wbjv+wP9aog==")
+	ms := NewMemoryStorage()
+	ms.SetString("k", "v", SetOptions{})
+	if err := ms.LoadRDB(rdb); err != nil {
+		t.Fatal(err)
+	}
+	if ms.Exists("k") {
+		t.Error("loading kept a key the file does not hold")
+	}
+
+	rdb[22] ^= 1 // the redis-ver aux field
+	if err := ms.LoadRDB(rdb); err != ErrRDBChecksum {
+		t.Errorf("loading a corrupted file = %v, want ErrRDBChecksum", err)
+	}
+}
+
+func TestRDBRoundTrip(t *testing.T) {
+	ms := NewMemoryStorage()
+	hour := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	ms.SetString("string", "value", SetOptions{})
+	ms.SetString("compressed", strings.Repeat("abc", 100), SetOptions{})
+	ms.SetString("int", "-12345", SetOptions{})
+	ms.SetString("volatile", "v", SetOptions{Lifetime: hour})
+	ms.SetString("expired", "v", SetOptions{Lifetime: time.Now().Add(-time.Second)})
+	ms.IncrBy("counter", 42)
+	var long []string
+	for i := 0; i < 1000; i++ {
+		long = append(long, "element"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+	ms.Push("list", long, false, false)
+	ms.SAdd("intset", []string{"1", "-70000", "3"})
+	ms.SAdd("set", []string{"a", "b", "1"})
+	ms.HSet("hash", []string{"f", "v", "n", "1"}, false)
+	ms.HSet("bighash", []string{"f", strings.Repeat("v", 100)}, false)
+	ms.HSet("volatilehash", []string{"f", "v", "g", "w"}, false)
+	ms.HExpire("volatilehash", hour, 0, []string{"g"})
+	ms.ZAdd("zset", []ScoreMember{{"a", 1.5}, {"b", math.Inf(-1)}, {"c", 3}}, 0)
+
+	for i := 1; i <= 150; i++ {
+		fields := []string{"f", strconv.Itoa(i)}
+		if i%7 == 0 {
+			fields = []string{"g", "x", "h", "y"}
+		}
+		ms.XAdd("stream", StreamAddID{ID: StreamID{Ms: uint64(1000 + i/3), Seq: uint64(i % 3)}}, fields, false, StreamTrim{})
+	}
+	ms.XDel("stream", []StreamID{{Ms: 1001, Seq: 0}})
+	ms.XGroupCreate("stream", "group", "0", false, -1)
+	item, _ := ms.storage.Get("stream")
+	g := item.Value.(*streamValue).groups["group"]
+	alice := g.consumer("alice", true)
+	g.consumer("bob", true)
+	for _, id := range []StreamID{{Ms: 1002, Seq: 1}, {Ms: 1003, Seq: 0}} {
+		g.pel = append(g.pel, &streamNACK{id: id, consumer: alice, deliveryTime: 1234, deliveryCount: 2})
+		alice.pending++
+	}
+
+	rdb, err := ms.SnapshotRDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewMemoryStorage()
+	if err := loaded.LoadRDB(rdb); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Exists("expired") {
+		t.Error("an expired key was saved")
+	}
+	ms.Delete("expired")
+	if got, want := loaded.storage.Len(), ms.storage.Len(); got != want {
+		t.Errorf("loaded %d keys, want %d", got, want)
+	}
+	for _, key := range []string{"string", "compressed", "int", "volatile", "counter"} {
+		want, _, _ := ms.GetString(key)
+		if got, _, _ := loaded.GetString(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if item, _ := loaded.storage.Get("volatile"); !item.Lifetime.Equal(hour) {
+		t.Errorf("volatile expires at %v, want %v", item.Lifetime, hour)
+	}
+	if len(loaded.volatile) != 1 {
+		t.Errorf("%d volatile keys, want 1", len(loaded.volatile))
+	}
+
+	value := func(ms *MemoryStorage, key string) interface{} {
+		item, _ := ms.storage.Get(key)
+		return item.Value
+	}
+	if got := value(loaded, "list").(*quicklist).Values(); !reflect.DeepEqual(got, long) {
+		t.Errorf("list has %d elements, want %d", len(got), len(long))
+	}
+	for _, key := range []string{"intset", "set"} {
+		got, want := value(loaded, key).(*setValue).members(), value(ms, key).(*setValue).members()
+		sort.Strings(got)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if value(loaded, "intset").(*setValue).table != nil {
+		t.Error("intset loaded as a dict")
+	}
+	for _, key := range []string{"hash", "bighash", "volatilehash"} {
+		got, want := value(loaded, key).(*hashValue), value(ms, key).(*hashValue)
+		if !sameHash(got, want) {
+			t.Errorf("%s = %v, want %v", key, got.entries(), want.entries())
+		}
+		if got.volatile != want.volatile {
+			t.Errorf("%s has %d volatile fields, want %d", key, got.volatile, want.volatile)
+		}
+	}
+	var zs []ScoreMember
+	for x := value(loaded, "zset").(*zsetValue).zsl.first(); x != nil; x = x.level[0].forward {
+		zs = append(zs, ScoreMember{x.member, x.score})
+	}
+	if want := []ScoreMember{{"b", math.Inf(-1)}, {"a", 1.5}, {"c", 3}}; !reflect.DeepEqual(zs, want) {
+		t.Errorf("zset = %v, want %v", zs, want)
+	}
+
+	got, want := value(loaded, "stream").(*streamValue), value(ms, "stream").(*streamValue)
+	if !reflect.DeepEqual(got.entries, want.entries) {
+		t.Errorf("stream has %d entries, want %d", len(got.entries), len(want.entries))
+	}
+	if got.lastID != want.lastID || got.maxDeletedID != want.maxDeletedID || got.entriesAdded != want.entriesAdded {
+		t.Errorf("stream metadata = %v %v %d, want %v %v %d", got.lastID, got.maxDeletedID, got.entriesAdded,
+			want.lastID, want.maxDeletedID, want.entriesAdded)
+	}
+	lg := got.groups["group"]
+	if lg == nil || len(lg.consumers) != 2 || len(lg.pel) != 2 || lg.entriesRead != -1 {
+		t.Fatalf("group = %+v", lg)
+	}
+	if nack := lg.pel[1]; nack.id != (StreamID{Ms: 1003}) || nack.consumer != lg.consumers["alice"] ||
+		nack.deliveryTime != 1234 || nack.deliveryCount != 2 || lg.consumers["alice"].pending != 2 {
+		t.Errorf("PEL entry = %+v", nack)
+	}
+}
+
+// sameHash compares hashes regardless of the order of their fields.
+func sameHash(a, b *hashValue) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+	same := true
+	a.each(func(entry hashEntry) bool {
+		other, exists := b.get(entry.field)
+		same = exists && other.value == entry.value && other.expire.Equal(entry.expire)
+		return same
+	})
+	return same
+}
+
+func TestRDBCompressesLongStrings(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.SetString("k", strings.Repeat("abc", 1000), SetOptions{})
+	rdb, err := ms.SnapshotRDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rdb) > 500 || bytes.Contains(rdb, []byte(strings.Repeat("abc", 100))) {
+		t.Errorf("a %d bytes snapshot holds the string uncompressed", len(rdb))
+	}
+}
@@ -0,0 +1,553 @@
+package app
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrRDBFormat    = errors.New("wrong RDB signature or version")
+	ErrRDBTruncated = errors.New("unexpected end of RDB file")
+	ErrRDBChecksum  = errors.New("wrong RDB checksum")
+)
+
+// rdbReader walks an RDB file. The first error is kept and every read
+// after it returns zero values, so callers check err once they are done
+// with a value.
+type rdbReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *rdbReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *rdbReader) read(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data)-r.pos {
+		r.fail(ErrRDBTruncated)
+		return nil
+	}
+	p := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return p
+}
+
+func (r *rdbReader) readByte() byte {
+	if p := r.read(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+// readLen reads a length, or tells which special encoding the string that
+// starts there has.
+func (r *rdbReader) readLen() (uint64, bool) {
+	b := r.readByte()
+	switch b >> 6 {
+	case RDB_6BITLEN:
+		return uint64(b & 0x3f), false
+	case RDB_14BITLEN:
+		return uint64(b&0x3f)<<8 | uint64(r.readByte()), false
+	case RDB_ENCVAL:
+		return uint64(b & 0x3f), true
+	}
+	switch b {
+	case RDB_32BITLEN:
+		if p := r.read(4); p != nil {
+			return uint64(binary.BigEndian.Uint32(p)), false
+		}
+	case RDB_64BITLEN:
+		if p := r.read(8); p != nil {
+			return binary.BigEndian.Uint64(p), false
+		}
+	default:
+		r.fail(fmt.Errorf("unknown RDB length encoding %#x", b))
+	}
+	return 0, false
+}
+
+// readCount reads a length counting items that take at least a byte each,
+// failing when fewer bytes are left.
+func (r *rdbReader) readCount() int {
+	n, encoded := r.readLen()
+	if encoded || n > uint64(len(r.data)-r.pos) {
+		r.fail(ErrRDBTruncated)
+		return 0
+	}
+	return int(n)
+}
+
+func (r *rdbReader) readString() string {
+	n, encoded := r.readLen()
+	if !encoded {
+		if n > uint64(len(r.data)-r.pos) {
+			r.fail(ErrRDBTruncated)
+			return ""
+		}
+		return string(r.read(int(n)))
+	}
+	switch n {
+	case RDB_ENC_INT8:
+		return strconv.Itoa(int(int8(r.readByte())))
+	case RDB_ENC_INT16:
+		if p := r.read(2); p != nil {
+			return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(p))))
+		}
+	case RDB_ENC_INT32:
+		if p := r.read(4); p != nil {
+			return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(p))))
+		}
+	case RDB_ENC_LZF:
+		clen, _ := r.readLen()
+		size, _ := r.readLen()
+		if clen > uint64(len(r.data)-r.pos) || size > math.MaxInt32 {
+			r.fail(ErrRDBTruncated)
+			return ""
+		}
+		compressed := r.read(int(clen))
+		if r.err != nil {
+			return ""
+		}
+		s, err := lzfDecompress(compressed, int(size))
+		if err != nil {
+			r.fail(err)
+			return ""
+		}
+		return string(s)
+	default:
+		r.fail(fmt.Errorf("unknown RDB string encoding %d", n))
+	}
+	return ""
+}
+
+func (r *rdbReader) readMillis() int64 {
+	if p := r.read(8); p != nil {
+		return int64(binary.LittleEndian.Uint64(p))
+	}
+	return 0
+}
+
+func (r *rdbReader) readDouble() float64 {
+	if p := r.read(8); p != nil {
+		return math.Float64frombits(binary.LittleEndian.Uint64(p))
+	}
+	return 0
+}
+
+// readStringDouble reads a score of the old ZSET type: a length, with
+// 253, 254 and 255 standing for NaN and infinities, and the digits.
+func (r *rdbReader) readStringDouble() float64 {
+	switch n := r.readByte(); n {
+	case 253:
+		return math.NaN()
+	case 254:
+		return math.Inf(1)
+	case 255:
+		return math.Inf(-1)
+	default:
+		f, err := strconv.ParseFloat(string(r.read(int(n))), 64)
+		if err != nil {
+			r.fail(err)
+		}
+		return f
+	}
+}
+
+func (r *rdbReader) readStreamID() StreamID {
+	if p := r.read(16); p != nil {
+		return StreamID{Ms: binary.BigEndian.Uint64(p), Seq: binary.BigEndian.Uint64(p[8:])}
+	}
+	return StreamID{}
+}
+
+func (r *rdbReader) readLenID() StreamID {
+	ms, _ := r.readLen()
+	seq, _ := r.readLen()
+	return StreamID{Ms: ms, Seq: seq}
+}
+
+func (r *rdbReader) readListpack() []string {
+	lp := r.readString()
+	if r.err != nil {
+		return nil
+	}
+	elements, err := listpackElements([]byte(lp))
+	if err != nil {
+		r.fail(err)
+	}
+	return elements
+}
+
+// LoadRDB replaces the dataset with the keys of db 0 in an RDB file, as
+// long as the whole file is sound. Keys whose lifetime is over are
+// skipped.
+func (ms *MemoryStorage) LoadRDB(data []byte) error {
+	r := &rdbReader{data: data}
+	header := r.read(9)
+	if r.err != nil || string(header[:5]) != "REDIS" {
+		return ErrRDBFormat
+	}
+	// Version 12 files load too, as long as they only hold the types of
+	// version 11 and hashes with field expirations.
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil || version < 1 || version > RDB_VERSION_HASH_METADATA {
+		return ErrRDBFormat
+	}
+
+	storage := newDict[Item]()
+	now := time.Now()
+	db := uint64(0)
+	var expire int64
+loop:
+	for r.err == nil {
+		switch typ := r.readByte(); typ {
+		case RDB_OPCODE_EXPIRETIME_MS:
+			expire = r.readMillis()
+		case RDB_OPCODE_EXPIRETIME:
+			if p := r.read(4); p != nil {
+				expire = int64(binary.LittleEndian.Uint32(p)) * 1000
+			}
+		case RDB_OPCODE_FREQ:
+			r.readByte()
+		case RDB_OPCODE_IDLE:
+			r.readLen()
+		case RDB_OPCODE_SELECTDB:
+			db, _ = r.readLen()
+		case RDB_OPCODE_RESIZEDB:
+			r.readLen()
+			r.readLen()
+		case RDB_OPCODE_AUX:
+			r.readString()
+			r.readString()
+		case RDB_OPCODE_FUNCTION2:
+			r.readString()
+		case RDB_OPCODE_MODULE_AUX, RDB_OPCODE_FUNCTION_PRE_GA:
+			r.fail(fmt.Errorf("unsupported RDB opcode %d", typ))
+		case RDB_OPCODE_EOF:
+			break loop
+		default:
+			key := r.readString()
+			value := r.readValue(typ)
+			if r.err == nil && db == 0 && (expire == 0 || expire > now.UnixMilli()) {
+				item := Item{Value: value}
+				if expire != 0 {
+					item.Lifetime = time.UnixMilli(expire)
+				}
+				storage.Set(key, item)
+			}
+			expire = 0
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if version >= 5 {
+		// A zero checksum means the writer did not compute one.
+		crc := crc64Update(0, data[:r.pos])
+		sum := r.read(8)
+		if r.err != nil {
+			return r.err
+		}
+		if stored := binary.LittleEndian.Uint64(sum); stored != 0 && stored != crc {
+			return ErrRDBChecksum
+		}
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	for key := range ms.watched {
+		ms.signalModified(key)
+	}
+	ms.storage = storage
+	ms.volatile = nil
+	ms.expires = make(map[string]int)
+	ms.volatileHashes = nil
+	ms.hashPos = make(map[string]int)
+	storage.Range(func(key string, item Item) bool {
+		if !item.Lifetime.IsZero() {
+			ms.expires[key] = len(ms.volatile)
+			ms.volatile = append(ms.volatile, key)
+		}
+		if h, ok := item.Value.(*hashValue); ok && h.volatile > 0 {
+			ms.setVolatileHash(key)
+		}
+		return true
+	})
+	return nil
+}
+
+// readValue reads a value of type typ.
+func (r *rdbReader) readValue(typ byte) interface{} {
+	switch typ {
+	case RDB_TYPE_STRING:
+		return r.readString()
+	case RDB_TYPE_LIST:
+		ql := newQuicklist()
+		for n := r.readCount(); n > 0 && r.err == nil; n-- {
+			ql.PushTail(r.readString())
+		}
+		return ql
+	case RDB_TYPE_LIST_QUICKLIST_2:
+		ql := newQuicklist()
+		for n := r.readCount(); n > 0 && r.err == nil; n-- {
+			container, _ := r.readLen()
+			if container == QUICKLIST_NODE_CONTAINER_PLAIN {
+				ql.PushTail(r.readString())
+				continue
+			}
+			for _, element := range r.readListpack() {
+				ql.PushTail(element)
+			}
+		}
+		return ql
+	case RDB_TYPE_SET, RDB_TYPE_SET_LISTPACK:
+		var members []string
+		if typ == RDB_TYPE_SET_LISTPACK {
+			members = r.readListpack()
+		} else {
+			for n := r.readCount(); n > 0 && r.err == nil; n-- {
+				members = append(members, r.readString())
+			}
+		}
+		s := newSet()
+		for _, member := range members {
+			s.add(member)
+		}
+		return s
+	case RDB_TYPE_SET_INTSET:
+		return r.readIntset()
+	case RDB_TYPE_ZSET, RDB_TYPE_ZSET_2:
+		z := newZSet()
+		for n := r.readCount(); n > 0 && r.err == nil; n-- {
+			member := r.readString()
+			if typ == RDB_TYPE_ZSET {
+				z.add(member, r.readStringDouble())
+			} else {
+				z.add(member, r.readDouble())
+			}
+		}
+		return z
+	case RDB_TYPE_ZSET_LISTPACK:
+		z := newZSet()
+		elements := r.readListpack()
+		for i := 0; i+1 < len(elements); i += 2 {
+			score, err := strconv.ParseFloat(elements[i+1], 64)
+			if err != nil {
+				r.fail(err)
+			}
+			z.add(elements[i], score)
+		}
+		return z
+	case RDB_TYPE_HASH:
+		h := newHash()
+		for n := r.readCount(); n > 0 && r.err == nil; n-- {
+			field := r.readString()
+			h.put(hashEntry{field: field, value: r.readString()})
+		}
+		return h
+	case RDB_TYPE_HASH_LISTPACK:
+		h := newHash()
+		elements := r.readListpack()
+		for i := 0; i+1 < len(elements); i += 2 {
+			h.put(hashEntry{field: elements[i], value: elements[i+1]})
+		}
+		return h
+	case RDB_TYPE_HASH_METADATA:
+		h := newHash()
+		minExpire := r.readMillis()
+		for n := r.readCount(); n > 0 && r.err == nil; n-- {
+			ttl, _ := r.readLen()
+			entry := hashEntry{field: r.readString(), value: r.readString()}
+			if ttl != 0 {
+				entry.expire = time.UnixMilli(minExpire + int64(ttl) - 1)
+			}
+			h.put(entry)
+		}
+		return h
+	case RDB_TYPE_STREAM_LISTPACKS, RDB_TYPE_STREAM_LISTPACKS_2, RDB_TYPE_STREAM_LISTPACKS_3:
+		return r.readStream(typ)
+	}
+	r.fail(fmt.Errorf("unsupported RDB value type %d", typ))
+	return nil
+}
+
+func (r *rdbReader) readIntset() *setValue {
+	blob := []byte(r.readString())
+	if r.err != nil {
+		return nil
+	}
+	if len(blob) < 8 {
+		r.fail(ErrRDBTruncated)
+		return nil
+	}
+	width := int(binary.LittleEndian.Uint32(blob))
+	count := int(binary.LittleEndian.Uint32(blob[4:]))
+	if (width != 2 && width != 4 && width != 8) || len(blob) != 8+width*count {
+		r.fail(errors.New("corrupted intset"))
+		return nil
+	}
+	s := newSet()
+	for i := 0; i < count; i++ {
+		p := blob[8+i*width:]
+		switch width {
+		case 2:
+			s.add(strconv.Itoa(int(int16(binary.LittleEndian.Uint16(p)))))
+		case 4:
+			s.add(strconv.Itoa(int(int32(binary.LittleEndian.Uint32(p)))))
+		default:
+			s.add(strconv.FormatInt(int64(binary.LittleEndian.Uint64(p)), 10))
+		}
+	}
+	return s
+}
+
+// readStream reads a stream in any of the three layouts: the first lacks
+// the deletion and group lag metadata, the first two the active time of
+// consumers.
+func (r *rdbReader) readStream(typ byte) *streamValue {
+	s := newStream()
+	for nodes := r.readCount(); nodes > 0 && r.err == nil; nodes-- {
+		key := r.readString()
+		if len(key) != 16 {
+			r.fail(errors.New("corrupted stream node key"))
+			return nil
+		}
+		master := StreamID{Ms: binary.BigEndian.Uint64([]byte(key)), Seq: binary.BigEndian.Uint64([]byte(key[8:]))}
+		entries, err := streamListpackEntries(master, r.readListpack())
+		if err != nil {
+			r.fail(err)
+			return nil
+		}
+		s.entries = append(s.entries, entries...)
+	}
+
+	r.readLen()
+	s.lastID = r.readLenID()
+	if typ >= RDB_TYPE_STREAM_LISTPACKS_2 {
+		r.readLenID()
+		s.maxDeletedID = r.readLenID()
+		s.entriesAdded, _ = r.readLen()
+	} else {
+		s.entriesAdded = uint64(len(s.entries))
+	}
+
+	for groups := r.readCount(); groups > 0 && r.err == nil; groups-- {
+		name := r.readString()
+		lastID := r.readLenID()
+		entriesRead := int64(-1)
+		if typ >= RDB_TYPE_STREAM_LISTPACKS_2 {
+			n, _ := r.readLen()
+			entriesRead = int64(n)
+		}
+		g := newStreamGroup(lastID, entriesRead)
+		for n := r.readCount(); n > 0 && r.err == nil; n-- {
+			nack := &streamNACK{id: r.readStreamID(), deliveryTime: r.readMillis()}
+			count, _ := r.readLen()
+			nack.deliveryCount = int64(count)
+			g.pel = append(g.pel, nack)
+		}
+		for n := r.readCount(); n > 0 && r.err == nil; n-- {
+			c := &streamConsumer{name: r.readString(), seenTime: r.readMillis()}
+			c.activeTime = c.seenTime
+			if typ >= RDB_TYPE_STREAM_LISTPACKS_3 {
+				c.activeTime = r.readMillis()
+			}
+			for owned := r.readCount(); owned > 0 && r.err == nil; owned-- {
+				id := r.readStreamID()
+				i := g.pelSearch(id)
+				if i == len(g.pel) || g.pel[i].id != id || g.pel[i].consumer != nil {
+					r.fail(errors.New("corrupted stream consumer PEL"))
+					return nil
+				}
+				g.pel[i].consumer = c
+				c.pending++
+			}
+			g.consumers[c.name] = c
+		}
+		for _, nack := range g.pel {
+			if nack.consumer == nil {
+				r.fail(errors.New("stream PEL entry without consumer"))
+				return nil
+			}
+		}
+		s.groups[name] = g
+	}
+	return s
+}
+
+// streamListpackEntries decodes the entries of a stream listpack node
+// whose master entry has ID master, leaving deleted ones out.
+func streamListpackEntries(master StreamID, elements []string) ([]StreamEntry, error) {
+	errCorrupted := errors.New("corrupted stream listpack")
+	i := 0
+	next := func() (int64, error) {
+		if i >= len(elements) {
+			return 0, errCorrupted
+		}
+		n, err := strconv.ParseInt(elements[i], 10, 64)
+		i++
+		return n, err
+	}
+	count, err := next()
+	if err != nil {
+		return nil, errCorrupted
+	}
+	deleted, err := next()
+	if err != nil {
+		return nil, errCorrupted
+	}
+	numMasterFields, err := next()
+	if err != nil || numMasterFields < 0 || int(numMasterFields) > len(elements)-i-1 {
+		return nil, errCorrupted
+	}
+	masterFields := elements[i : i+int(numMasterFields)]
+	i += int(numMasterFields) + 1
+
+	var entries []StreamEntry
+	for k := int64(0); k < count+deleted; k++ {
+		var header [3]int64
+		for j := range header {
+			if header[j], err = next(); err != nil {
+				return nil, errCorrupted
+			}
+		}
+		flags := header[0]
+		id := StreamID{Ms: master.Ms + uint64(header[1]), Seq: master.Seq + uint64(header[2])}
+		var fields []string
+		if flags&STREAM_ITEM_FLAG_SAMEFIELDS != 0 {
+			if len(masterFields) > len(elements)-i {
+				return nil, errCorrupted
+			}
+			fields = make([]string, 0, 2*len(masterFields))
+			for _, field := range masterFields {
+				fields = append(fields, field, elements[i])
+				i++
+			}
+		} else {
+			n, err := next()
+			if err != nil || n < 0 || int(2*n) > len(elements)-i {
+				return nil, errCorrupted
+			}
+			fields = append([]string(nil), elements[i:i+int(2*n)]...)
+			i += int(2 * n)
+		}
+		if _, err := next(); err != nil {
+			return nil, errCorrupted
+		}
+		if flags&STREAM_ITEM_FLAG_DELETED == 0 {
+			entries = append(entries, StreamEntry{ID: id, Fields: fields})
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,513 @@
+package app
+
+import (
+	"math/rand"
+	"rednav/utils"
+	"sort"
+	"strconv"
+)
+
+// A set whose members are all integers is kept as a sorted intset while it
+// has at most SET_MAX_INTSET_ENTRIES members, like Redis's
+// set-max-intset-entries.
+const SET_MAX_INTSET_ENTRIES = 512
+
+// Set algebra operations.
+const (
+	SET_OP_UNION = iota
+	SET_OP_INTER
+	SET_OP_DIFF
+)
+
+// setOpEvents names the keyspace event of storing each operation.
+var setOpEvents = [...]string{
+	SET_OP_UNION: "sunionstore",
+	SET_OP_INTER: "sinterstore",
+	SET_OP_DIFF:  "sdiffstore",
+}
+
+// setValue is the set value. It starts as an intset, a sorted slice of
+// integers searched by bisection, and is converted to a dict for good once
+// a member is not an integer or the intset grows too large.
+type setValue struct {
+	ints  []int64
+	table *dict[struct{}]
+}
+
+func newSet() *setValue {
+	return &setValue{}
+}
+
+func (s *setValue) Len() int {
+	if s.table != nil {
+		return s.table.Len()
+	}
+	return len(s.ints)
+}
+
+// search returns the position of n in the intset, or where it would be
+// inserted, and whether it is present.
+func (s *setValue) search(n int64) (int, bool) {
+	i := sort.Search(len(s.ints), func(i int) bool { return s.ints[i] >= n })
+	return i, i < len(s.ints) && s.ints[i] == n
+}
+
+func (s *setValue) has(member string) bool {
+	if s.table != nil {
+		_, exists := s.table.Get(member)
+		return exists
+	}
+	n, ok := ParseInt(member)
+	if !ok {
+		return false
+	}
+	_, exists := s.search(n)
+	return exists
+}
+
+// add inserts member and reports whether it was added.
+func (s *setValue) add(member string) bool {
+	if s.table == nil {
+		n, ok := ParseInt(member)
+		if ok {
+			i, exists := s.search(n)
+			if exists {
+				return false
+			}
+			if len(s.ints) < SET_MAX_INTSET_ENTRIES {
+				s.ints = append(s.ints, 0)
+				copy(s.ints[i+1:], s.ints[i:])
+				s.ints[i] = n
+				return true
+			}
+		}
+		s.convert()
+	}
+	return s.table.Set(member, struct{}{})
+}
+
+// remove deletes member and reports whether it was present.
+func (s *setValue) remove(member string) bool {
+	if s.table != nil {
+		return s.table.Delete(member)
+	}
+	n, ok := ParseInt(member)
+	if !ok {
+		return false
+	}
+	i, exists := s.search(n)
+	if exists {
+		s.ints = append(s.ints[:i], s.ints[i+1:]...)
+	}
+	return exists
+}
+
+func (s *setValue) convert() {
+	s.table = newDict[struct{}]()
+	for _, n := range s.ints {
+		s.table.Set(strconv.FormatInt(n, 10), struct{}{})
+	}
+	s.ints = nil
+}
+
+// each calls fn for every member until it returns false.
+func (s *setValue) each(fn func(member string) bool) {
+	if s.table != nil {
+		s.table.Range(func(member string, _ struct{}) bool {
+			return fn(member)
+		})
+		return
+	}
+	for _, n := range s.ints {
+		if !fn(strconv.FormatInt(n, 10)) {
+			return
+		}
+	}
+}
+
+func (s *setValue) members() []string {
+	members := make([]string, 0, s.Len())
+	s.each(func(member string) bool {
+		members = append(members, member)
+		return true
+	})
+	return members
+}
+
+func (s *setValue) copy() *setValue {
+	if s.table == nil {
+		return &setValue{ints: append([]int64(nil), s.ints...)}
+	}
+	dup := &setValue{table: newDict[struct{}]()}
+	s.each(func(member string) bool {
+		dup.table.Set(member, struct{}{})
+		return true
+	})
+	return dup
+}
+
+// sample returns count random members: distinct ones when count is
+// positive, possibly repeated ones when it is negative.
+func (s *setValue) sample(count int64) []string {
+	members := s.members()
+	switch {
+	case count < 0:
+		picked := make([]string, -count)
+		for i := range picked {
+			picked[i] = members[rand.Intn(len(members))]
+		}
+		return picked
+	case count >= int64(len(members)):
+		return members
+	default:
+		for i := 0; i < int(count); i++ {
+			j := i + rand.Intn(len(members)-i)
+			members[i], members[j] = members[j], members[i]
+		}
+		return members[:count]
+	}
+}
+
+// lookupSet returns the set stored at key. The caller must hold the mutex.
+func (ms *MemoryStorage) lookupSet(key string) (*setValue, error) {
+	item, exists := ms.lookup(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := item.Value.(*setValue)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return s, nil
+}
+
+// SAdd adds members to the set at key and returns how many were added.
+func (ms *MemoryStorage) SAdd(key string, members []string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupSet(key)
+	if err != nil {
+		return 0, err
+	}
+	if s == nil {
+		s = newSet()
+		ms.set(key, Item{Value: s})
+	}
+	added := 0
+	for _, member := range members {
+		if s.add(member) {
+			added++
+		}
+	}
+	if added > 0 {
+		ms.signalModified(key)
+		ms.notify(NOTIFY_SET, "sadd", key)
+	}
+	return added, nil
+}
+
+// SRem removes members from the set at key, deleting the key once it is
+// empty, and returns how many were removed.
+func (ms *MemoryStorage) SRem(key string, members []string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupSet(key)
+	if err != nil || s == nil {
+		return 0, err
+	}
+	removed := 0
+	for _, member := range members {
+		if s.remove(member) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		ms.notify(NOTIFY_SET, "srem", key)
+	}
+	if s.Len() == 0 {
+		ms.remove(key)
+		ms.notify(NOTIFY_GENERIC, "del", key)
+	} else if removed > 0 {
+		ms.signalModified(key)
+	}
+	return removed, nil
+}
+
+// SCard returns the number of members of the set at key.
+func (ms *MemoryStorage) SCard(key string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupSet(key)
+	if s == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || s == nil {
+		return 0, err
+	}
+	return s.Len(), nil
+}
+
+// SMIsMember reports for each member whether it belongs to the set at key.
+func (ms *MemoryStorage) SMIsMember(key string, members []string) ([]bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupSet(key)
+	if s == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	found := make([]bool, len(members))
+	if s != nil {
+		for i, member := range members {
+			found[i] = s.has(member)
+		}
+	}
+	return found, nil
+}
+
+// SMembers returns the members of the set at key.
+func (ms *MemoryStorage) SMembers(key string) ([]string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupSet(key)
+	if s == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || s == nil {
+		return nil, err
+	}
+	return s.members(), nil
+}
+
+// SPop removes and returns up to count random members of the set at key.
+func (ms *MemoryStorage) SPop(key string, count int64) ([]string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupSet(key)
+	if err != nil || s == nil || count == 0 {
+		return nil, err
+	}
+	popped := s.sample(count)
+	for _, member := range popped {
+		s.remove(member)
+	}
+	if len(popped) > 0 {
+		ms.notify(NOTIFY_SET, "spop", key)
+	}
+	if s.Len() == 0 {
+		ms.remove(key)
+		ms.notify(NOTIFY_GENERIC, "del", key)
+	} else if len(popped) > 0 {
+		ms.signalModified(key)
+	}
+	return popped, nil
+}
+
+// SRandMember returns random members of the set at key, as described by
+// HRandField.
+func (ms *MemoryStorage) SRandMember(key string, count int64) ([]string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupSet(key)
+	if s == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || s == nil || count == 0 {
+		return nil, err
+	}
+	return s.sample(count), nil
+}
+
+// SMove moves member from the set at src to the set at dst and reports
+// whether it was moved.
+func (ms *MemoryStorage) SMove(src string, dst string, member string) (bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	from, err := ms.lookupSet(src)
+	if err != nil {
+		return false, err
+	}
+	to, err := ms.lookupSet(dst)
+	if err != nil {
+		return false, err
+	}
+	if from == nil || !from.has(member) {
+		return false, nil
+	}
+	if src == dst {
+		return true, nil
+	}
+
+	from.remove(member)
+	ms.notify(NOTIFY_SET, "srem", src)
+	if from.Len() == 0 {
+		ms.remove(src)
+		ms.notify(NOTIFY_GENERIC, "del", src)
+	} else {
+		ms.signalModified(src)
+	}
+	if to == nil {
+		to = newSet()
+		ms.set(dst, Item{Value: to})
+	}
+	if to.add(member) {
+		ms.notify(NOTIFY_SET, "sadd", dst)
+	}
+	ms.signalModified(dst)
+	return true, nil
+}
+
+// SScan incrementally iterates the set at key, returning the next cursor
+// and the matching members. An intset is returned whole.
+func (ms *MemoryStorage) SScan(key string, cursor uint64, count int, pattern string) (uint64, []string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupSet(key)
+	if s == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || s == nil {
+		return 0, nil, err
+	}
+
+	var visited []string
+	if s.table == nil {
+		visited, cursor = s.members(), 0
+	} else {
+		for maxIterations := count * 10; ; maxIterations-- {
+			cursor = s.table.Scan(cursor, func(member string, _ struct{}) {
+				visited = append(visited, member)
+			})
+			if cursor == 0 || maxIterations <= 1 || len(visited) >= count {
+				break
+			}
+		}
+	}
+
+	members := visited[:0]
+	for _, member := range visited {
+		if pattern == "" || pattern == "*" || utils.StringMatch(pattern, member, false) {
+			members = append(members, member)
+		}
+	}
+	return cursor, members, nil
+}
+
+// setOp computes the union, intersection or difference of the sets at
+// keys, missing keys counting as empty sets. The caller must hold the
+// mutex.
+func (ms *MemoryStorage) setOp(op int, keys []string) (*setValue, error) {
+	sets := make([]*setValue, len(keys))
+	for i, key := range keys {
+		s, err := ms.lookupSet(key)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			s = newSet()
+		}
+		sets[i] = s
+	}
+
+	result := newSet()
+	switch op {
+	case SET_OP_UNION:
+		for _, s := range sets {
+			s.each(func(member string) bool {
+				result.add(member)
+				return true
+			})
+		}
+	case SET_OP_INTER:
+		// Probe the other sets with the members of the smallest one.
+		sort.SliceStable(sets, func(i, j int) bool { return sets[i].Len() < sets[j].Len() })
+		sets[0].each(func(member string) bool {
+			for _, other := range sets[1:] {
+				if !other.has(member) {
+					return true
+				}
+			}
+			result.add(member)
+			return true
+		})
+	case SET_OP_DIFF:
+		sets[0].each(func(member string) bool {
+			for _, other := range sets[1:] {
+				if other.has(member) {
+					return true
+				}
+			}
+			result.add(member)
+			return true
+		})
+	}
+	return result, nil
+}
+
+// SetOp returns the members of the union, intersection or difference of
+// the sets at keys.
+func (ms *MemoryStorage) SetOp(op int, keys []string) ([]string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	result, err := ms.setOp(op, keys)
+	if err != nil {
+		return nil, err
+	}
+	return result.members(), nil
+}
+
+// SetOpStore stores the union, intersection or difference of the sets at
+// keys in dst, deleting dst when it is empty, and returns its cardinality.
+func (ms *MemoryStorage) SetOpStore(op int, dst string, keys []string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	result, err := ms.setOp(op, keys)
+	if err != nil {
+		return 0, err
+	}
+	if result.Len() == 0 {
+		if ms.remove(dst) {
+			ms.notify(NOTIFY_GENERIC, "del", dst)
+		}
+	} else {
+		ms.set(dst, Item{Value: result})
+		ms.notify(NOTIFY_SET, setOpEvents[op], dst)
+	}
+	return result.Len(), nil
+}
+
+// SInterCard returns the cardinality of the intersection of the sets at
+// keys, stopping at limit when it is not zero.
+func (ms *MemoryStorage) SInterCard(keys []string, limit int) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	sets := make([]*setValue, len(keys))
+	for i, key := range keys {
+		s, err := ms.lookupSet(key)
+		if s == nil && err == nil {
+			ms.keyMiss(key)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if s == nil {
+			return 0, nil
+		}
+		sets[i] = s
+	}
+
+	sort.SliceStable(sets, func(i, j int) bool { return sets[i].Len() < sets[j].Len() })
+	count := 0
+	sets[0].each(func(member string) bool {
+		for _, other := range sets[1:] {
+			if !other.has(member) {
+				return true
+			}
+		}
+		count++
+		return limit == 0 || count < limit
+	})
+	return count, nil
+}
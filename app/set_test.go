@@ -0,0 +1,71 @@
+package app
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestSetIntsetEncoding(t *testing.T) {
+	s := newSet()
+	for _, member := range []string{"5", "-3", "12", "5", "0"} {
+		s.add(member)
+	}
+	if s.table != nil {
+		t.Fatal("integer set converted to a dict")
+	}
+	if want := []int64{-3, 0, 5, 12}; !reflect.DeepEqual(s.ints, want) {
+		t.Fatalf("intset = %v, want %v", s.ints, want)
+	}
+	// Non canonical integers are strings and force the conversion.
+	if s.has("05") {
+		t.Error("05 found in the intset")
+	}
+	s.add("05")
+	if s.table == nil {
+		t.Fatal("set with a non integer member still an intset")
+	}
+	members := s.members()
+	sort.Strings(members)
+	if want := []string{"-3", "0", "05", "12", "5"}; !reflect.DeepEqual(members, want) {
+		t.Errorf("members = %v, want %v", members, want)
+	}
+
+	large := newSet()
+	for i := 0; i <= SET_MAX_INTSET_ENTRIES; i++ {
+		large.add(strconv.Itoa(i))
+	}
+	if large.table == nil || large.Len() != SET_MAX_INTSET_ENTRIES+1 {
+		t.Errorf("intset past the entries limit: converted %v, %d members", large.table != nil, large.Len())
+	}
+}
+
+func TestSetOps(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.SAdd("a", []string{"1", "2", "3", "x"})
+	ms.SAdd("b", []string{"2", "3", "y"})
+	cases := []struct {
+		op   int
+		keys []string
+		want []string
+	}{
+		{SET_OP_INTER, []string{"a", "b"}, []string{"2", "3"}},
+		{SET_OP_UNION, []string{"a", "b"}, []string{"1", "2", "3", "x", "y"}},
+		{SET_OP_DIFF, []string{"a", "b"}, []string{"1", "x"}},
+		{SET_OP_INTER, []string{"a", "missing"}, []string{}},
+	}
+	for _, c := range cases {
+		got, err := ms.SetOp(c.op, c.keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("SetOp(%d, %v) = %v, want %v", c.op, c.keys, got, c.want)
+		}
+	}
+	if n, _ := ms.SInterCard([]string{"a", "b"}, 1); n != 1 {
+		t.Errorf("SInterCard with LIMIT 1 = %d", n)
+	}
+}
@@ -0,0 +1,246 @@
+package app
+
+import "math/rand"
+
+const (
+	ZSKIPLIST_MAXLEVEL = 32
+	ZSKIPLIST_P        = 0.25
+)
+
+type zskiplistLevel struct {
+	forward *zskiplistNode
+	// span is the number of nodes forward skips over, used to compute ranks.
+	span int
+}
+
+type zskiplistNode struct {
+	member   string
+	score    float64
+	backward *zskiplistNode
+	level    []zskiplistLevel
+}
+
+// zskiplist orders the members of a sorted set by score, then member, as
+// Redis's zskiplist does. Each forward link records how many nodes it
+// spans so ranks are computed in O(log n).
+type zskiplist struct {
+	header, tail *zskiplistNode
+	length       int
+	level        int
+}
+
+func newZskiplist() *zskiplist {
+	return &zskiplist{
+		header: &zskiplistNode{level: make([]zskiplistLevel, ZSKIPLIST_MAXLEVEL)},
+		level:  1,
+	}
+}
+
+func zslRandomLevel() int {
+	level := 1
+	for level < ZSKIPLIST_MAXLEVEL && rand.Float64() < ZSKIPLIST_P {
+		level++
+	}
+	return level
+}
+
+// before reports whether node sorts before score and member.
+func (n *zskiplistNode) before(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// insert adds a member that is not in the list yet.
+func (zsl *zskiplist) insert(score float64, member string) *zskiplistNode {
+	var update [ZSKIPLIST_MAXLEVEL]*zskiplistNode
+	var rank [ZSKIPLIST_MAXLEVEL]int
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i < zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := zslRandomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+	x = &zskiplistNode{member: member, score: score, level: make([]zskiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length++
+	return x
+}
+
+func (zsl *zskiplist) deleteNode(x *zskiplistNode, update *[ZSKIPLIST_MAXLEVEL]*zskiplistNode) {
+	for i := 0; i < zsl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+}
+
+// delete removes the node with the given score and member, reporting
+// whether it was found.
+func (zsl *zskiplist) delete(score float64, member string) bool {
+	var update [ZSKIPLIST_MAXLEVEL]*zskiplistNode
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	x = x.level[0].forward
+	if x != nil && x.score == score && x.member == member {
+		zsl.deleteNode(x, &update)
+		return true
+	}
+	return false
+}
+
+// rank returns the 1 based rank of the node with the given score and
+// member, or 0 if it is not in the list.
+func (zsl *zskiplist) rank(score float64, member string) int {
+	rank := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && (x.level[i].forward.before(score, member) ||
+			(x.level[i].forward.score == score && x.level[i].forward.member == member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != zsl.header && x.member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// byRank returns the node at the 1 based rank.
+func (zsl *zskiplist) byRank(rank int) *zskiplistNode {
+	traversed := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+// first returns the first node, or nil for an empty list.
+func (zsl *zskiplist) first() *zskiplistNode {
+	return zsl.header.level[0].forward
+}
+
+// firstInRange returns the first node within r, or nil if there is none.
+func (zsl *zskiplist) firstInRange(r ScoreRange) *zskiplistNode {
+	if !r.valid() || zsl.tail == nil || !r.gteMin(zsl.tail.score) || !r.lteMax(zsl.first().score) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.gteMin(x.level[i].forward.score) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if !r.lteMax(x.score) {
+		return nil
+	}
+	return x
+}
+
+// lastInRange returns the last node within r, or nil if there is none.
+func (zsl *zskiplist) lastInRange(r ScoreRange) *zskiplistNode {
+	if !r.valid() || zsl.tail == nil || !r.gteMin(zsl.tail.score) || !r.lteMax(zsl.first().score) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && r.lteMax(x.level[i].forward.score) {
+			x = x.level[i].forward
+		}
+	}
+	if !r.gteMin(x.score) {
+		return nil
+	}
+	return x
+}
+
+// firstInLexRange returns the first node within r, or nil if there is none.
+func (zsl *zskiplist) firstInLexRange(r LexRange) *zskiplistNode {
+	if !r.valid() || zsl.tail == nil || !r.gteMin(zsl.tail.member) || !r.lteMax(zsl.first().member) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.gteMin(x.level[i].forward.member) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if !r.lteMax(x.member) {
+		return nil
+	}
+	return x
+}
+
+// lastInLexRange returns the last node within r, or nil if there is none.
+func (zsl *zskiplist) lastInLexRange(r LexRange) *zskiplistNode {
+	if !r.valid() || zsl.tail == nil || !r.gteMin(zsl.tail.member) || !r.lteMax(zsl.first().member) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && r.lteMax(x.level[i].forward.member) {
+			x = x.level[i].forward
+		}
+	}
+	if !r.gteMin(x.member) {
+		return nil
+	}
+	return x
+}
@@ -0,0 +1,547 @@
+package app
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrStreamID         = errors.New("ERR Invalid stream ID specified as stream command argument")
+	ErrStreamIDTooSmall = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	ErrStreamIDZero     = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+	ErrStreamExhausted  = errors.New("ERR The stream has exhausted the last possible ID, unable to add more items")
+)
+
+// Approximate trimming evicts at most this many entries unless told
+// otherwise with LIMIT, like Redis with its default node size.
+const STREAM_TRIM_DEFAULT_LIMIT = 10000
+
+// Trimming strategies of StreamTrim.
+const (
+	STREAM_TRIM_NONE = iota
+	STREAM_TRIM_MAXLEN
+	STREAM_TRIM_MINID
+)
+
+// StreamID identifies a stream entry: the milliseconds time it was added
+// at and a sequence number among the entries of that millisecond.
+type StreamID struct {
+	Ms, Seq uint64
+}
+
+var maxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id StreamID) IsZero() bool {
+	return id.Ms == 0 && id.Seq == 0
+}
+
+// Compare returns -1, 0 or 1 as id sorts before, equal to or after other.
+func (id StreamID) Compare(other StreamID) int {
+	switch {
+	case id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq):
+		return -1
+	case id == other:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// Next returns the ID right after id, failing for the largest ID.
+func (id StreamID) Next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{Ms: id.Ms + 1}, true
+	default:
+		return id, false
+	}
+}
+
+// Prev returns the ID right before id, failing for 0-0.
+func (id StreamID) Prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	default:
+		return id, false
+	}
+}
+
+// ParseStreamID parses an ID in the "ms-seq" form, or "ms" alone whose
+// sequence is then seq. "-" and "+" stand for the smallest and largest IDs.
+func ParseStreamID(s string, seq uint64) (StreamID, bool) {
+	switch s {
+	case "-":
+		return StreamID{}, true
+	case "+":
+		return maxStreamID, true
+	}
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, false
+	}
+	if hasSeq {
+		if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+			return StreamID{}, false
+		}
+	}
+	return StreamID{Ms: ms, Seq: seq}, true
+}
+
+// StreamAddID is the ID requested by XADD: "*" generates the whole ID and
+// "ms-*" only its sequence number.
+type StreamAddID struct {
+	ID              StreamID
+	AutoMs, AutoSeq bool
+}
+
+// ParseStreamAddID parses the ID argument of XADD.
+func ParseStreamAddID(s string) (StreamAddID, bool) {
+	if s == "*" {
+		return StreamAddID{AutoMs: true, AutoSeq: true}, true
+	}
+	if msPart, found := strings.CutSuffix(s, "-*"); found {
+		ms, err := strconv.ParseUint(msPart, 10, 64)
+		return StreamAddID{ID: StreamID{Ms: ms}, AutoSeq: true}, err == nil
+	}
+	if s == "-" || s == "+" {
+		return StreamAddID{}, false
+	}
+	id, ok := ParseStreamID(s, 0)
+	return StreamAddID{ID: id}, ok
+}
+
+// StreamTrim describes how XADD and XTRIM evict old entries: down to MaxLen
+// entries or those from MinID on. Approximate trimming evicts at most Limit
+// entries.
+type StreamTrim struct {
+	Strategy int
+	MaxLen   int64
+	MinID    StreamID
+	Approx   bool
+	Limit    int64
+}
+
+// StreamEntry is a stream entry with its field value pairs flattened. The
+// fields of an entry deleted while pending in a consumer group are nil.
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// streamValue is the stream value: its entries ordered by ID along with the
+// metadata Redis keeps to track deletions and consumer group lag.
+type streamValue struct {
+	entries      []StreamEntry
+	lastID       StreamID
+	maxDeletedID StreamID
+	entriesAdded uint64
+	groups       map[string]*streamGroup
+}
+
+func newStream() *streamValue {
+	return &streamValue{groups: make(map[string]*streamGroup)}
+}
+
+func (s *streamValue) Len() int {
+	return len(s.entries)
+}
+
+// firstID returns the ID of the first entry, 0-0 for an empty stream.
+func (s *streamValue) firstID() StreamID {
+	if len(s.entries) == 0 {
+		return StreamID{}
+	}
+	return s.entries[0].ID
+}
+
+// search returns the position of the first entry whose ID is id or larger.
+func (s *streamValue) search(id StreamID) int {
+	return sort.Search(len(s.entries), func(i int) bool {
+		return s.entries[i].ID.Compare(id) >= 0
+	})
+}
+
+func (s *streamValue) lookupEntry(id StreamID) (StreamEntry, bool) {
+	i := s.search(id)
+	if i < len(s.entries) && s.entries[i].ID == id {
+		return s.entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// after reports whether the stream holds an entry with an ID above id.
+func (s *streamValue) after(id StreamID) bool {
+	return len(s.entries) > 0 && s.lastEntryID().Compare(id) > 0
+}
+
+func (s *streamValue) lastEntryID() StreamID {
+	return s.entries[len(s.entries)-1].ID
+}
+
+// nextID returns the ID XADD assigns for requested.
+func (s *streamValue) nextID(requested StreamAddID) (StreamID, error) {
+	switch {
+	case requested.AutoMs:
+		ms := uint64(time.Now().UnixMilli())
+		if ms > s.lastID.Ms {
+			return StreamID{Ms: ms}, nil
+		}
+		id, ok := s.lastID.Next()
+		if !ok {
+			return id, ErrStreamExhausted
+		}
+		return id, nil
+	case requested.AutoSeq:
+		if requested.ID.Ms > s.lastID.Ms {
+			return requested.ID, nil
+		}
+		if requested.ID.Ms < s.lastID.Ms || s.lastID.Seq == math.MaxUint64 {
+			return requested.ID, ErrStreamIDTooSmall
+		}
+		return StreamID{Ms: s.lastID.Ms, Seq: s.lastID.Seq + 1}, nil
+	default:
+		if requested.ID.Compare(s.lastID) <= 0 {
+			return requested.ID, ErrStreamIDTooSmall
+		}
+		return requested.ID, nil
+	}
+}
+
+// rangeOf returns up to count entries between start and end inclusive,
+// from end down when rev is set. A count of zero means no limit.
+func (s *streamValue) rangeOf(start StreamID, end StreamID, count int, rev bool) []StreamEntry {
+	if start.Compare(end) > 0 {
+		return nil
+	}
+	lo, hi := s.search(start), len(s.entries)
+	if end != maxStreamID {
+		if next, ok := end.Next(); ok {
+			hi = s.search(next)
+		}
+	}
+	if lo >= hi {
+		return nil
+	}
+	n := hi - lo
+	if count > 0 && count < n {
+		n = count
+	}
+	entries := make([]StreamEntry, n)
+	if rev {
+		for i := range entries {
+			entries[i] = s.entries[hi-1-i]
+		}
+	} else {
+		copy(entries, s.entries[lo:lo+n])
+	}
+	return entries
+}
+
+// delete removes the entry with the given ID and reports whether it existed.
+func (s *streamValue) delete(id StreamID) bool {
+	i := s.search(id)
+	if i >= len(s.entries) || s.entries[i].ID != id {
+		return false
+	}
+	s.entries = append(s.entries[:i], s.entries[i+1:]...)
+	if id.Compare(s.maxDeletedID) > 0 {
+		s.maxDeletedID = id
+	}
+	return true
+}
+
+// trim evicts the oldest entries as told by t and returns how many went.
+func (s *streamValue) trim(t StreamTrim) int {
+	n := 0
+	switch t.Strategy {
+	case STREAM_TRIM_MAXLEN:
+		if excess := int64(len(s.entries)) - t.MaxLen; excess > 0 {
+			n = int(excess)
+		}
+	case STREAM_TRIM_MINID:
+		n = s.search(t.MinID)
+	}
+	if t.Approx && t.Limit > 0 && int64(n) > t.Limit {
+		n = int(t.Limit)
+	}
+	if n > 0 {
+		s.entries = append([]StreamEntry(nil), s.entries[n:]...)
+	}
+	return n
+}
+
+// hasTombstones reports whether entries were deleted from start on.
+func (s *streamValue) hasTombstones(start StreamID) bool {
+	if len(s.entries) == 0 || s.maxDeletedID.IsZero() {
+		return false
+	}
+	return start.Compare(s.maxDeletedID) <= 0
+}
+
+// estimateEntriesRead returns the number of entries added to the stream up
+// to id, or -1 when deletions make it impossible to tell. Consumer groups
+// use it to report their lag.
+func (s *streamValue) estimateEntriesRead(id StreamID) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+	if len(s.entries) == 0 && id.Compare(s.lastID) <= 0 {
+		return int64(s.entriesAdded)
+	}
+	switch cmp := id.Compare(s.lastID); {
+	case cmp == 0:
+		return int64(s.entriesAdded)
+	case cmp > 0:
+		return -1
+	}
+	first := s.firstID()
+	if s.maxDeletedID.IsZero() || s.maxDeletedID.Compare(first) < 0 {
+		switch cmp := id.Compare(first); {
+		case cmp < 0:
+			return int64(s.entriesAdded) - int64(len(s.entries))
+		case cmp == 0:
+			return int64(s.entriesAdded) - int64(len(s.entries)) + 1
+		}
+	}
+	return -1
+}
+
+func (s *streamValue) copy() *streamValue {
+	dup := &streamValue{
+		entries:      append([]StreamEntry(nil), s.entries...),
+		lastID:       s.lastID,
+		maxDeletedID: s.maxDeletedID,
+		entriesAdded: s.entriesAdded,
+		groups:       make(map[string]*streamGroup, len(s.groups)),
+	}
+	for name, g := range s.groups {
+		dup.groups[name] = g.copy()
+	}
+	return dup
+}
+
+// lookupStream returns the stream stored at key. The caller must hold the
+// mutex.
+func (ms *MemoryStorage) lookupStream(key string) (*streamValue, error) {
+	item, exists := ms.lookup(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := item.Value.(*streamValue)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return s, nil
+}
+
+// XAdd appends an entry to the stream at key, creating it unless noMkStream
+// is set, then trims it as told by t. It returns the ID of the new entry
+// and false when the stream did not exist and was not created.
+func (ms *MemoryStorage) XAdd(key string, requested StreamAddID, fields []string, noMkStream bool, t StreamTrim) (StreamID, bool, error) {
+	if !requested.AutoMs && !requested.AutoSeq && requested.ID.IsZero() {
+		return StreamID{}, false, ErrStreamIDZero
+	}
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupStream(key)
+	if err != nil {
+		return StreamID{}, false, err
+	}
+	if s == nil && noMkStream {
+		return StreamID{}, false, nil
+	}
+	current := s
+	if current == nil {
+		current = newStream()
+	}
+	id, err := current.nextID(requested)
+	if err != nil {
+		return StreamID{}, false, err
+	}
+	if s == nil {
+		s = current
+		ms.set(key, Item{Value: s})
+	}
+
+	s.entries = append(s.entries, StreamEntry{ID: id, Fields: fields})
+	s.lastID = id
+	s.entriesAdded++
+	trimmed := s.trim(t)
+	ms.signalModified(key)
+	ms.signalReady(key)
+	ms.notify(NOTIFY_STREAM, "xadd", key)
+	if trimmed > 0 {
+		ms.notify(NOTIFY_STREAM, "xtrim", key)
+	}
+	return id, true, nil
+}
+
+// XLen returns the number of entries of the stream at key.
+func (ms *MemoryStorage) XLen(key string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupStream(key)
+	if s == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || s == nil {
+		return 0, err
+	}
+	return s.Len(), nil
+}
+
+// XRange returns up to count entries of the stream at key between start and
+// end inclusive, from end down when rev is set. A count of zero means no
+// limit.
+func (ms *MemoryStorage) XRange(key string, start StreamID, end StreamID, count int, rev bool) ([]StreamEntry, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupStream(key)
+	if s == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || s == nil {
+		return nil, err
+	}
+	return s.rangeOf(start, end, count, rev), nil
+}
+
+// XDel deletes entries from the stream at key and returns how many existed.
+func (ms *MemoryStorage) XDel(key string, ids []StreamID) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupStream(key)
+	if err != nil || s == nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, id := range ids {
+		if s.delete(id) {
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		ms.signalModified(key)
+		ms.notify(NOTIFY_STREAM, "xdel", key)
+	}
+	return deleted, nil
+}
+
+// XTrim evicts old entries of the stream at key as told by t and returns
+// how many were evicted.
+func (ms *MemoryStorage) XTrim(key string, t StreamTrim) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	s, err := ms.lookupStream(key)
+	if err != nil || s == nil {
+		return 0, err
+	}
+	evicted := s.trim(t)
+	if evicted > 0 {
+		ms.signalModified(key)
+		ms.notify(NOTIFY_STREAM, "xtrim", key)
+	}
+	return evicted, nil
+}
+
+// StreamRead holds the entries XREAD or XREADGROUP read from a stream.
+type StreamRead struct {
+	Key     string
+	Entries []StreamEntry
+}
+
+// streamReadable reports whether the stream at key has entries to hand to
+// req, which reads it from the position at index i of req.IDs. The caller
+// must hold the mutex.
+func (ms *MemoryStorage) streamReadable(req BlockRequest, i int) (bool, error) {
+	s, err := ms.lookupStream(req.Keys[i])
+	if err != nil || s == nil {
+		return false, err
+	}
+	if req.Group == "" {
+		after, _ := ParseStreamID(req.IDs[i], 0)
+		return s.after(after), nil
+	}
+	g, exists := s.groups[req.Group]
+	if !exists {
+		return false, ErrNoGroup
+	}
+	if req.IDs[i] != ">" {
+		return true, nil
+	}
+	return s.after(g.lastID), nil
+}
+
+// streamRead reads the stream at index i of req.Keys for req. The caller
+// must hold the mutex.
+func (ms *MemoryStorage) streamRead(req BlockRequest, i int) []StreamEntry {
+	s, _ := ms.lookupStream(req.Keys[i])
+	if s == nil {
+		return nil
+	}
+	if req.Group == "" {
+		after, _ := ParseStreamID(req.IDs[i], 0)
+		start, ok := after.Next()
+		if !ok {
+			return nil
+		}
+		return s.rangeOf(start, maxStreamID, req.Count, false)
+	}
+	g := s.groups[req.Group]
+	c := ms.createConsumer(req.Keys[i], g, req.Consumer)
+	if req.IDs[i] != ">" {
+		after, _ := ParseStreamID(req.IDs[i], 0)
+		return g.history(s, c, after, req.Count)
+	}
+	return g.deliver(s, c, req.Count, req.NoAck)
+}
+
+// streamReadAll performs the XREAD or XREADGROUP described by req on every
+// stream that can serve it, after resolving "$" to the last ID of each
+// stream. Reading the history of a consumer always returns, even empty.
+// On failure it returns the key at fault. The caller must hold the mutex.
+func (ms *MemoryStorage) streamReadAll(req *BlockRequest) ([]StreamRead, string, error) {
+	for i, key := range req.Keys {
+		s, err := ms.lookupStream(key)
+		if err != nil {
+			return nil, key, err
+		}
+		if req.Group != "" && (s == nil || s.groups[req.Group] == nil) {
+			return nil, key, ErrNoGroup
+		}
+		if req.IDs[i] == "$" {
+			last := StreamID{}
+			if s != nil {
+				last = s.lastID
+			}
+			req.IDs[i] = last.String()
+		}
+	}
+
+	var streams []StreamRead
+	for i, key := range req.Keys {
+		ok, _ := ms.streamReadable(*req, i)
+		if !ok {
+			continue
+		}
+		entries := ms.streamRead(*req, i)
+		if len(entries) > 0 || (req.Group != "" && req.IDs[i] != ">") {
+			streams = append(streams, StreamRead{Key: key, Entries: entries})
+		}
+	}
+	return streams, "", nil
+}
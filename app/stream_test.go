@@ -0,0 +1,124 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStreamIDsAndTrim(t *testing.T) {
+	ms := NewMemoryStorage()
+	add := func(id string) (StreamID, error) {
+		requested, ok := ParseStreamAddID(id)
+		if !ok {
+			t.Fatalf("ParseStreamAddID(%q) failed", id)
+		}
+		id2, _, err := ms.XAdd("s", requested, []string{"f", "v"}, false, StreamTrim{})
+		return id2, err
+	}
+
+	for _, tt := range []struct {
+		id   string
+		want StreamID
+		err  error
+	}{
+		{"0-0", StreamID{}, ErrStreamIDZero},
+		{"5-1", StreamID{Ms: 5, Seq: 1}, nil},
+		{"5-*", StreamID{Ms: 5, Seq: 2}, nil},
+		{"5-2", StreamID{}, ErrStreamIDTooSmall},
+		{"4-*", StreamID{}, ErrStreamIDTooSmall},
+		{"7-*", StreamID{Ms: 7}, nil},
+		{"8", StreamID{Ms: 8}, nil},
+	} {
+		id, err := add(tt.id)
+		if err != tt.err || (err == nil && id != tt.want) {
+			t.Errorf("XADD %s = %v, %v, want %v, %v", tt.id, id, err, tt.want, tt.err)
+		}
+	}
+	if id, _ := add("*"); id.Compare(StreamID{Ms: 8}) <= 0 {
+		t.Errorf("generated ID %v not above 8-0", id)
+	}
+
+	ids := func() []StreamID {
+		entries, _ := ms.XRange("s", StreamID{}, maxStreamID, 0, false)
+		var ids []StreamID
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		return ids
+	}
+	if n, _ := ms.XTrim("s", StreamTrim{Strategy: STREAM_TRIM_MINID, MinID: StreamID{Ms: 7}}); n != 2 {
+		t.Errorf("MINID trimmed %d entries, want 2", n)
+	}
+	if n, _ := ms.XTrim("s", StreamTrim{Strategy: STREAM_TRIM_MAXLEN, MaxLen: 0, Approx: true, Limit: 1}); n != 1 {
+		t.Errorf("approximate MAXLEN with LIMIT 1 trimmed %d entries", n)
+	}
+	if got := ids(); len(got) != 2 || got[0] != (StreamID{Ms: 8}) {
+		t.Errorf("entries left = %v", got)
+	}
+	if n, _ := ms.XDel("s", []StreamID{{Ms: 8}, {Ms: 9}}); n != 1 {
+		t.Errorf("XDEL removed %d entries, want 1", n)
+	}
+	info, _, _ := ms.XInfoStream("s")
+	if info.MaxDeletedID != (StreamID{Ms: 8}) || info.EntriesAdded != 5 || info.Length != 1 {
+		t.Errorf("XINFO STREAM = %+v", info)
+	}
+}
+
+func TestStreamGroupPEL(t *testing.T) {
+	ms := NewMemoryStorage()
+	for _, id := range []string{"1-1", "2-1", "3-1"} {
+		requested, _ := ParseStreamAddID(id)
+		ms.XAdd("s", requested, []string{"f", id}, false, StreamTrim{})
+	}
+	if err := ms.XGroupCreate("s", "g", "0", false, -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.XGroupCreate("s", "g", "$", false, -1); err != ErrBusyGroup {
+		t.Errorf("duplicate group created: %v", err)
+	}
+	read := func(consumer string, id string) []StreamID {
+		req := BlockRequest{Keys: []string{"s"}, IDs: []string{id}, Count: 2, Stream: true, Group: "g", Consumer: consumer}
+		result, _ := ms.BlockOn(req, false)
+		if result == nil {
+			return nil
+		}
+		var ids []StreamID
+		for _, entry := range result.Streams[0].Entries {
+			ids = append(ids, entry.ID)
+		}
+		return ids
+	}
+
+	if got := read("alice", ">"); !reflect.DeepEqual(got, []StreamID{{1, 1}, {2, 1}}) {
+		t.Fatalf("alice read %v", got)
+	}
+	if got := read("bob", ">"); !reflect.DeepEqual(got, []StreamID{{3, 1}}) {
+		t.Fatalf("bob read %v", got)
+	}
+	if got := read("alice", "0"); !reflect.DeepEqual(got, []StreamID{{1, 1}, {2, 1}}) {
+		t.Errorf("alice history = %v", got)
+	}
+	if n, _ := ms.XAck("s", "g", []StreamID{{1, 1}, {1, 1}, {9, 9}}); n != 1 {
+		t.Errorf("XACK acknowledged %d entries, want 1", n)
+	}
+
+	// Deleting an entry still pending leaves a dangling PEL entry, which
+	// XCLAIM drops rather than claims.
+	ms.XDel("s", []StreamID{{2, 1}})
+	claimed, deleted, err := ms.XClaim("s", "g", "bob", []StreamID{{2, 1}, {3, 1}}, StreamClaim{RetryCount: -1})
+	if err != nil || len(claimed) != 1 || claimed[0].ID != (StreamID{3, 1}) || !reflect.DeepEqual(deleted, []StreamID{{2, 1}}) {
+		t.Errorf("XCLAIM = %v, %v, %v", claimed, deleted, err)
+	}
+	summary, _ := ms.XPendingSummary("s", "g")
+	if summary.Count != 1 || summary.First != (StreamID{3, 1}) || len(summary.Consumers) != 1 || summary.Consumers[0].Name != "bob" {
+		t.Errorf("XPENDING = %+v", summary)
+	}
+	pending, _ := ms.XPending("s", "g", StreamID{}, maxStreamID, 10, "", 0)
+	if len(pending) != 1 || pending[0].DeliveryCount != 2 {
+		t.Errorf("pending entries = %+v", pending)
+	}
+
+	if _, err := ms.XPendingSummary("s", "nope"); err != ErrNoGroup {
+		t.Errorf("missing group: %v", err)
+	}
+}
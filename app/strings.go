@@ -0,0 +1,405 @@
+package app
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// SetOptions are the conditions and lifetime handling of SET.
+type SetOptions struct {
+	NX      bool
+	XX      bool
+	Get     bool
+	KeepTTL bool
+	// Lifetime is the new expiration; the zero time means none.
+	Lifetime time.Time
+}
+
+// stringValue returns the string held by item. Counters are stored as
+// int64 and rendered in decimal; any other type is a WRONGTYPE error.
+func stringValue(item Item) (string, error) {
+	switch value := item.Value.(type) {
+	case string:
+		return value, nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	default:
+		return "", ErrWrongType
+	}
+}
+
+// GetString returns the string stored at key and whether it exists.
+func (ms *MemoryStorage) GetString(key string) (string, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	if !exists {
+		ms.keyMiss(key)
+		return "", false, nil
+	}
+	value, err := stringValue(item)
+	return value, err == nil, err
+}
+
+// SetString stores value at key subject to opts. It returns the previous
+// string value and whether there was one (only inspected when opts.Get is
+// set, in which case a non string value is a WRONGTYPE error), and whether
+// the value was stored.
+func (ms *MemoryStorage) SetString(key string, value string, opts SetOptions) (string, bool, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+
+	var old string
+	if opts.Get && exists {
+		var err error
+		if old, err = stringValue(item); err != nil {
+			return "", false, false, err
+		}
+	}
+	if (opts.NX && exists) || (opts.XX && !exists) {
+		return old, exists, false, nil
+	}
+
+	lifetime := opts.Lifetime
+	if opts.KeepTTL && exists {
+		lifetime = item.Lifetime
+	}
+	ms.set(key, Item{Value: value, Lifetime: lifetime})
+	ms.notify(NOTIFY_STRING, "set", key)
+	if !opts.Lifetime.IsZero() {
+		ms.notify(NOTIFY_GENERIC, "expire", key)
+	}
+	return old, exists, true, nil
+}
+
+// GetDel returns the string stored at key and deletes the key.
+func (ms *MemoryStorage) GetDel(key string) (string, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	if !exists {
+		return "", false, nil
+	}
+	value, err := stringValue(item)
+	if err != nil {
+		return "", false, err
+	}
+	ms.remove(key)
+	ms.notify(NOTIFY_GENERIC, "del", key)
+	return value, true, nil
+}
+
+// GetEx returns the string stored at key and, when change is set, replaces
+// its lifetime (the zero time persists the key, a past time deletes it). It
+// also reports whether the key was deleted.
+func (ms *MemoryStorage) GetEx(key string, lifetime time.Time, change bool) (string, bool, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	if !exists {
+		return "", false, false, nil
+	}
+	value, err := stringValue(item)
+	if err != nil {
+		return "", false, false, err
+	}
+	if !change {
+		return value, true, false, nil
+	}
+	if !lifetime.IsZero() && !lifetime.After(time.Now()) {
+		ms.remove(key)
+		ms.notify(NOTIFY_GENERIC, "del", key)
+		return value, true, true, nil
+	}
+	persisted := lifetime.IsZero() && !item.Lifetime.IsZero()
+	item.Lifetime = lifetime
+	ms.set(key, item)
+	if persisted {
+		ms.notify(NOTIFY_GENERIC, "persist", key)
+	} else if !lifetime.IsZero() {
+		ms.notify(NOTIFY_GENERIC, "expire", key)
+	}
+	return value, true, false, nil
+}
+
+var (
+	ErrOverflow      = errors.New("ERR increment or decrement would overflow")
+	ErrNotFloat      = errors.New("ERR value is not a valid float")
+	ErrNaNOrInfinity = errors.New("ERR increment would produce NaN or Infinity")
+)
+
+// ParseInt parses a string the way Redis does for integer values: an
+// optional minus sign and digits without leading zeros, fitting in 64 bits.
+func ParseInt(s string) (int64, bool) {
+	if len(s) == 0 || len(s) > 20 {
+		return 0, false
+	}
+	digits := s
+	if digits[0] == '-' {
+		digits = digits[1:]
+	}
+	if len(digits) == 0 || digits[0] < '0' || digits[0] > '9' || (digits[0] == '0' && len(s) > 1) {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+// ParseFloat parses a finite floating point value.
+func ParseFloat(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// FormatFloat renders a float the way INCRBYFLOAT stores it: the shortest
+// representation that round trips, never in exponent notation.
+func FormatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// integerValue returns the integer held by item, stored either as a counter
+// or as a string in integer form.
+func integerValue(item Item) (int64, error) {
+	switch value := item.Value.(type) {
+	case int64:
+		return value, nil
+	case string:
+		n, ok := ParseInt(value)
+		if !ok {
+			return 0, ErrNotInteger
+		}
+		return n, nil
+	default:
+		return 0, ErrWrongType
+	}
+}
+
+// IncrBy adds delta to the integer stored at key, creating it at 0, and
+// returns the new value. Counters are kept as int64 rather than strings; the
+// key keeps its lifetime.
+func (ms *MemoryStorage) IncrBy(key string, delta int64) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	var current int64
+	if exists {
+		var err error
+		if current, err = integerValue(item); err != nil {
+			return 0, err
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+	item.Value = current + delta
+	ms.set(key, item)
+	ms.notify(NOTIFY_STRING, "incrby", key)
+	return current + delta, nil
+}
+
+// IncrByFloat adds delta to the number stored at key, creating it at 0, and
+// returns the new value as stored.
+func (ms *MemoryStorage) IncrByFloat(key string, delta float64) (string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	var current float64
+	if exists {
+		value, err := stringValue(item)
+		if err != nil {
+			return "", err
+		}
+		var ok bool
+		if current, ok = ParseFloat(value); !ok {
+			return "", ErrNotFloat
+		}
+	}
+	result := current + delta
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return "", ErrNaNOrInfinity
+	}
+	item.Value = FormatFloat(result)
+	ms.set(key, item)
+	ms.notify(NOTIFY_STRING, "incrbyfloat", key)
+	return item.Value.(string), nil
+}
+
+// MAX_STRING_SIZE is the largest string APPEND and SETRANGE may build.
+const MAX_STRING_SIZE = 512 * 1024 * 1024
+
+var ErrStringTooLong = errors.New("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+
+// Append appends value to the string stored at key, creating it if needed,
+// and returns the new length.
+func (ms *MemoryStorage) Append(key string, value string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	var current string
+	if exists {
+		var err error
+		if current, err = stringValue(item); err != nil {
+			return 0, err
+		}
+	}
+	if len(current)+len(value) > MAX_STRING_SIZE {
+		return 0, ErrStringTooLong
+	}
+	item.Value = current + value
+	ms.set(key, item)
+	ms.notify(NOTIFY_STRING, "append", key)
+	return len(current) + len(value), nil
+}
+
+// StrLen returns the length in bytes of the string stored at key.
+func (ms *MemoryStorage) StrLen(key string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	if !exists {
+		ms.keyMiss(key)
+		return 0, nil
+	}
+	value, err := stringValue(item)
+	return len(value), err
+}
+
+// GetRange returns the bytes of the string stored at key between start and
+// end inclusive. Negative offsets count from the end of the string.
+func (ms *MemoryStorage) GetRange(key string, start int64, end int64) (string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	if !exists {
+		ms.keyMiss(key)
+		return "", nil
+	}
+	value, err := stringValue(item)
+	if err != nil {
+		return "", err
+	}
+
+	size := int64(len(value))
+	if start < 0 && end < 0 && start > end {
+		return "", nil
+	}
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if size == 0 || start > end {
+		return "", nil
+	}
+	return value[start : end+1], nil
+}
+
+// SetRange overwrites the string stored at key from offset on with value,
+// padding it with zero bytes when it is shorter than offset, and returns the
+// new length. An empty value never creates the key.
+func (ms *MemoryStorage) SetRange(key string, offset int, value string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	item, exists := ms.lookup(key)
+	var current string
+	if exists {
+		var err error
+		if current, err = stringValue(item); err != nil {
+			return 0, err
+		}
+	}
+	if len(value) == 0 {
+		return len(current), nil
+	}
+	if offset+len(value) > MAX_STRING_SIZE {
+		return 0, ErrStringTooLong
+	}
+
+	size := len(current)
+	if offset+len(value) > size {
+		size = offset + len(value)
+	}
+	buf := make([]byte, size)
+	copy(buf, current)
+	copy(buf[offset:], value)
+	item.Value = string(buf)
+	ms.set(key, item)
+	ms.notify(NOTIFY_STRING, "setrange", key)
+	return size, nil
+}
+
+// MGet returns the strings stored at keys. Missing keys and keys holding
+// another type are reported as absent.
+func (ms *MemoryStorage) MGet(keys []string) ([]string, []bool) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	values := make([]string, len(keys))
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		item, exists := ms.lookup(key)
+		if !exists {
+			ms.keyMiss(key)
+			continue
+		}
+		value, err := stringValue(item)
+		values[i], found[i] = value, err == nil
+	}
+	return values, found
+}
+
+// MSet stores every key value pair of pairs at once, discarding lifetimes.
+// With nx set nothing is stored if any of the keys exists. It reports
+// whether the values were stored.
+func (ms *MemoryStorage) MSet(pairs []string, nx bool) bool {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if nx {
+		for i := 0; i < len(pairs); i += 2 {
+			if _, exists := ms.lookup(pairs[i]); exists {
+				return false
+			}
+		}
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		ms.set(pairs[i], Item{Value: pairs[i+1]})
+		ms.notify(NOTIFY_STRING, "set", pairs[i])
+	}
+	return true
+}
+
+// GetStringPair returns the strings stored at two keys for LCS, missing
+// keys reading as empty strings.
+func (ms *MemoryStorage) GetStringPair(key1 string, key2 string) (string, string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	var values [2]string
+	for i, key := range []string{key1, key2} {
+		item, exists := ms.lookup(key)
+		if !exists {
+			ms.keyMiss(key)
+			continue
+		}
+		value, err := stringValue(item)
+		if err != nil {
+			return "", "", ErrLCSWrongType
+		}
+		values[i] = value
+	}
+	return values[0], values[1], nil
+}
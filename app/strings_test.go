@@ -0,0 +1,60 @@
+package app
+
+import (
+	"math"
+	"testing"
+)
+
+func TestIncrBy(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.Save("n", "41", nil)
+	if n, err := ms.IncrBy("n", 1); err != nil || n != 42 {
+		t.Fatalf("IncrBy = %d, %v, want 42", n, err)
+	}
+	if value, _, _ := ms.GetString("n"); value != "42" {
+		t.Errorf("GetString after IncrBy = %q, want \"42\"", value)
+	}
+
+	ms.Save("max", "9223372036854775807", nil)
+	if _, err := ms.IncrBy("max", 1); err != ErrOverflow {
+		t.Errorf("IncrBy past MaxInt64 err = %v, want ErrOverflow", err)
+	}
+	for _, value := range []string{"abc", "012", "+1", " 1", "1.5", ""} {
+		ms.Save("bad", value, nil)
+		if _, err := ms.IncrBy("bad", 1); err != ErrNotInteger {
+			t.Errorf("IncrBy on %q err = %v, want ErrNotInteger", value, err)
+		}
+	}
+}
+
+func TestIncrByFloat(t *testing.T) {
+	ms := NewMemoryStorage()
+	cases := []struct {
+		start string
+		delta float64
+		want  string
+	}{
+		{"10.50", 0.1, "10.6"},
+		{"5.0e3", 2.0e2, "5200"},
+		{"-1", 0.25, "-0.75"},
+		{"1e21", 0, "1000000000000000000000"},
+	}
+	for _, c := range cases {
+		ms.Save("f", c.start, nil)
+		if got, err := ms.IncrByFloat("f", c.delta); err != nil || got != c.want {
+			t.Errorf("IncrByFloat(%q, %v) = %q, %v, want %q", c.start, c.delta, got, err, c.want)
+		}
+	}
+
+	ms.Save("f", "1", nil)
+	if _, err := ms.IncrByFloat("f", math.MaxFloat64); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.IncrByFloat("f", math.MaxFloat64); err != ErrNaNOrInfinity {
+		t.Errorf("IncrByFloat to infinity err = %v, want ErrNaNOrInfinity", err)
+	}
+	ms.Save("s", "abc", nil)
+	if _, err := ms.IncrByFloat("s", 1); err != ErrNotFloat {
+		t.Errorf("IncrByFloat on \"abc\" err = %v, want ErrNotFloat", err)
+	}
+}
@@ -1,10 +1,11 @@
 package app
 
 import (
-	"encoding/base64"
 	"fmt"
 	"net"
 	"rednav/utils"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -19,6 +20,8 @@ type Vault struct {
 	alreadyConnectedMaster bool
 	MasterConn             net.Conn
 	mutex                  sync.Mutex
+	quit                   chan struct{}
+	persistence            persistence
 }
 
 const (
@@ -33,16 +36,21 @@ const (
 	INFO           = "info"
 	LISTENING_PORT = "listening-port"
 	SET            = "set"
-	XADD           = "xadd"
 	REPLICA        = "replica"
 	PING           = "ping"
 	PX             = "px"
 	PSYNC          = "PSYNC"
 	REPLICATION    = "replication"
+	PERSISTENCE    = "persistence"
+	STATS          = "stats"
+	KEYSPACE       = "keyspace"
 	RELPCONF       = "REPLCONF"
 
 	OK = "+OK\r\n"
 
+	SERVER_NAME = "rednav"
+	VERSION     = "7.2.0"
+
 	LEN_CAPABILITY     = 2
 	LEN_CONFIG         = 1
 	LEN_ECHO           = 2
@@ -56,7 +64,6 @@ const (
 	LEN_PX             = 2
 	LEN_PSYNC          = 3
 	LEN_GETACK         = 2
-	LEN_XADD           = 2
 )
 
 func NewVault(c *Config) *Vault {
@@ -65,6 +72,7 @@ func NewVault(c *Config) *Vault {
 		ReplicaPresent:         false,
 		alreadyConnectedMaster: false,
 		config:                 c,
+		quit:                   make(chan struct{}),
 	}
 	if c.Master_host == "" && c.Master_port == 0 {
 		v.role = MASTER
@@ -77,26 +85,15 @@ func NewVault(c *Config) *Vault {
 	if v.role == REPLICA {
 		v.MasterConn = v.OpenConnectionToMaster()
 	}
+	v.memory.SetNotifyKeyspaceEvents(c.NotifyKeyspaceEvents)
+	v.persistence.dir = c.Dir
+	v.persistence.dbfilename = c.DBFilename
+	v.persistence.lastSave = time.Now()
+	v.persistence.lastBgsaveOK = true
+	v.memory.SetReplica(v.role == REPLICA)
 	return v
 }
 
-func (v *Vault) SetXAdd(setVals []map[string][]string, data map[string][]interface{}) string {
-	v.mutex.Lock()
-	defer v.mutex.Unlock()
-	var lifetime *time.Time
-	for i, item := range setVals {
-		for key, value := range item {
-			if px, exists := data["px"]; exists {
-				ms := int(px[i].(float64))
-				t := time.Now().Add(time.Duration(ms) * time.Millisecond)
-				lifetime = &t
-			}
-			v.memory.Save(key, value, lifetime)
-		}
-	}
-	return OK
-}
-
 func (v *Vault) SetMemory(key string, value string, expiration *time.Time) {
 	v.mutex.Lock()
 	defer v.mutex.Unlock()
@@ -107,25 +104,514 @@ func (v *Vault) GetMemory(key string) interface{} {
 	return v.memory.Get(key)
 }
 
+func (v *Vault) GetString(key string) (string, bool, error) {
+	return v.memory.GetString(key)
+}
+
+func (v *Vault) SetString(key string, value string, opts SetOptions) (string, bool, bool, error) {
+	return v.memory.SetString(key, value, opts)
+}
+
+func (v *Vault) GetDel(key string) (string, bool, error) {
+	return v.memory.GetDel(key)
+}
+
+func (v *Vault) GetEx(key string, lifetime time.Time, change bool) (string, bool, bool, error) {
+	return v.memory.GetEx(key, lifetime, change)
+}
+
+func (v *Vault) IncrBy(key string, delta int64) (int64, error) {
+	return v.memory.IncrBy(key, delta)
+}
+
+func (v *Vault) IncrByFloat(key string, delta float64) (string, error) {
+	return v.memory.IncrByFloat(key, delta)
+}
+
+func (v *Vault) Append(key string, value string) (int, error) {
+	return v.memory.Append(key, value)
+}
+
+func (v *Vault) StrLen(key string) (int, error) {
+	return v.memory.StrLen(key)
+}
+
+func (v *Vault) GetRange(key string, start int64, end int64) (string, error) {
+	return v.memory.GetRange(key, start, end)
+}
+
+func (v *Vault) SetRange(key string, offset int, value string) (int, error) {
+	return v.memory.SetRange(key, offset, value)
+}
+
+func (v *Vault) MGet(keys []string) ([]string, []bool) {
+	return v.memory.MGet(keys)
+}
+
+func (v *Vault) MSet(pairs []string, nx bool) bool {
+	return v.memory.MSet(pairs, nx)
+}
+
+func (v *Vault) GetStringPair(key1 string, key2 string) (string, string, error) {
+	return v.memory.GetStringPair(key1, key2)
+}
+
+func (v *Vault) Push(key string, values []string, head bool, xx bool) (int, error) {
+	return v.memory.Push(key, values, head, xx)
+}
+
+func (v *Vault) Pop(key string, count int, head bool) ([]string, bool, error) {
+	return v.memory.Pop(key, count, head)
+}
+
+func (v *Vault) LLen(key string) (int, error) {
+	return v.memory.LLen(key)
+}
+
+func (v *Vault) LRange(key string, start int64, stop int64) ([]string, error) {
+	return v.memory.LRange(key, start, stop)
+}
+
+func (v *Vault) LIndex(key string, index int64) (string, bool, error) {
+	return v.memory.LIndex(key, index)
+}
+
+func (v *Vault) LPos(key string, element string, rank int64, count int64, maxlen int64) ([]int, error) {
+	return v.memory.LPos(key, element, rank, count, maxlen)
+}
+
+func (v *Vault) LSet(key string, index int64, value string) error {
+	return v.memory.LSet(key, index, value)
+}
+
+func (v *Vault) LInsert(key string, before bool, pivot string, value string) (int, error) {
+	return v.memory.LInsert(key, before, pivot, value)
+}
+
+func (v *Vault) LRem(key string, count int64, value string) (int, error) {
+	return v.memory.LRem(key, count, value)
+}
+
+func (v *Vault) LTrim(key string, start int64, stop int64) error {
+	return v.memory.LTrim(key, start, stop)
+}
+
+func (v *Vault) LMove(src string, dst string, fromHead bool, toHead bool) (string, bool, error) {
+	return v.memory.LMove(src, dst, fromHead, toHead)
+}
+
+func (v *Vault) BlockOn(req BlockRequest, wait bool) (*BlockResult, *Waiter) {
+	return v.memory.BlockOn(req, wait)
+}
+
+func (v *Vault) Unblock(w *Waiter) *BlockResult {
+	return v.memory.Unblock(w)
+}
+
+func (v *Vault) ServeBlocked() [][]string {
+	return v.memory.ServeBlocked()
+}
+
+func (v *Vault) HSet(key string, pairs []string, nx bool) (int, error) {
+	return v.memory.HSet(key, pairs, nx)
+}
+
+func (v *Vault) HGet(key string, field string) (string, bool, error) {
+	return v.memory.HGet(key, field)
+}
+
+func (v *Vault) HMGet(key string, fields []string) ([]string, []bool, error) {
+	return v.memory.HMGet(key, fields)
+}
+
+func (v *Vault) HDel(key string, fields []string) (int, error) {
+	return v.memory.HDel(key, fields)
+}
+
+func (v *Vault) HLen(key string) (int, error) {
+	return v.memory.HLen(key)
+}
+
+func (v *Vault) HGetAll(key string) ([]string, []string, error) {
+	return v.memory.HGetAll(key)
+}
+
+func (v *Vault) HIncrBy(key string, field string, delta int64) (int64, error) {
+	return v.memory.HIncrBy(key, field, delta)
+}
+
+func (v *Vault) HIncrByFloat(key string, field string, delta float64) (string, error) {
+	return v.memory.HIncrByFloat(key, field, delta)
+}
+
+func (v *Vault) HRandField(key string, count int64) ([]string, []string, error) {
+	return v.memory.HRandField(key, count)
+}
+
+func (v *Vault) HScan(key string, cursor uint64, count int, pattern string) (uint64, []string, []string, error) {
+	return v.memory.HScan(key, cursor, count, pattern)
+}
+
+func (v *Vault) HExpire(key string, at time.Time, flags int, fields []string) ([]int, error) {
+	return v.memory.HExpire(key, at, flags, fields)
+}
+
+func (v *Vault) HPersist(key string, fields []string) ([]int, error) {
+	return v.memory.HPersist(key, fields)
+}
+
+func (v *Vault) HLifetimes(key string, fields []string) ([]time.Time, []bool, error) {
+	return v.memory.HLifetimes(key, fields)
+}
+
+func (v *Vault) SAdd(key string, members []string) (int, error) {
+	return v.memory.SAdd(key, members)
+}
+
+func (v *Vault) SRem(key string, members []string) (int, error) {
+	return v.memory.SRem(key, members)
+}
+
+func (v *Vault) SCard(key string) (int, error) {
+	return v.memory.SCard(key)
+}
+
+func (v *Vault) SMIsMember(key string, members []string) ([]bool, error) {
+	return v.memory.SMIsMember(key, members)
+}
+
+func (v *Vault) SMembers(key string) ([]string, error) {
+	return v.memory.SMembers(key)
+}
+
+func (v *Vault) SPop(key string, count int64) ([]string, error) {
+	return v.memory.SPop(key, count)
+}
+
+func (v *Vault) SRandMember(key string, count int64) ([]string, error) {
+	return v.memory.SRandMember(key, count)
+}
+
+func (v *Vault) SMove(src string, dst string, member string) (bool, error) {
+	return v.memory.SMove(src, dst, member)
+}
+
+func (v *Vault) SScan(key string, cursor uint64, count int, pattern string) (uint64, []string, error) {
+	return v.memory.SScan(key, cursor, count, pattern)
+}
+
+func (v *Vault) SetOp(op int, keys []string) ([]string, error) {
+	return v.memory.SetOp(op, keys)
+}
+
+func (v *Vault) SetOpStore(op int, dst string, keys []string) (int, error) {
+	return v.memory.SetOpStore(op, dst, keys)
+}
+
+func (v *Vault) SInterCard(keys []string, limit int) (int, error) {
+	return v.memory.SInterCard(keys, limit)
+}
+
+func (v *Vault) ZAdd(key string, pairs []ScoreMember, flags int) (int, float64, bool, error) {
+	return v.memory.ZAdd(key, pairs, flags)
+}
+
+func (v *Vault) ZScore(key string, member string) (float64, bool, error) {
+	return v.memory.ZScore(key, member)
+}
+
+func (v *Vault) ZMScore(key string, members []string) ([]float64, []bool, error) {
+	return v.memory.ZMScore(key, members)
+}
+
+func (v *Vault) ZCard(key string) (int, error) {
+	return v.memory.ZCard(key)
+}
+
+func (v *Vault) ZRank(key string, member string, rev bool) (int, float64, bool, error) {
+	return v.memory.ZRank(key, member, rev)
+}
+
+func (v *Vault) ZRange(key string, spec ZRangeSpec) ([]ScoreMember, error) {
+	return v.memory.ZRange(key, spec)
+}
+
+func (v *Vault) ZRangeStore(dst string, src string, spec ZRangeSpec) (int, error) {
+	return v.memory.ZRangeStore(dst, src, spec)
+}
+
+func (v *Vault) ZRem(key string, members []string) (int, error) {
+	return v.memory.ZRem(key, members)
+}
+
+func (v *Vault) ZRemRange(key string, spec ZRangeSpec) (int, error) {
+	return v.memory.ZRemRange(key, spec)
+}
+
+func (v *Vault) ZCount(key string, r ScoreRange) (int, error) {
+	return v.memory.ZCount(key, r)
+}
+
+func (v *Vault) ZLexCount(key string, r LexRange) (int, error) {
+	return v.memory.ZLexCount(key, r)
+}
+
+func (v *Vault) ZPop(key string, count int, max bool) ([]ScoreMember, error) {
+	return v.memory.ZPop(key, count, max)
+}
+
+func (v *Vault) ZScan(key string, cursor uint64, count int, pattern string) (uint64, []ScoreMember, error) {
+	return v.memory.ZScan(key, cursor, count, pattern)
+}
+
+func (v *Vault) ZSetOp(op int, keys []string, weights []float64, aggregate int) ([]ScoreMember, error) {
+	return v.memory.ZSetOp(op, keys, weights, aggregate)
+}
+
+func (v *Vault) ZSetOpStore(op int, dst string, keys []string, weights []float64, aggregate int) (int, error) {
+	return v.memory.ZSetOpStore(op, dst, keys, weights, aggregate)
+}
+
+func (v *Vault) XAdd(key string, id StreamAddID, fields []string, noMkStream bool, t StreamTrim) (StreamID, bool, error) {
+	return v.memory.XAdd(key, id, fields, noMkStream, t)
+}
+
+func (v *Vault) XLen(key string) (int, error) {
+	return v.memory.XLen(key)
+}
+
+func (v *Vault) XRange(key string, start StreamID, end StreamID, count int, rev bool) ([]StreamEntry, error) {
+	return v.memory.XRange(key, start, end, count, rev)
+}
+
+func (v *Vault) XDel(key string, ids []StreamID) (int, error) {
+	return v.memory.XDel(key, ids)
+}
+
+func (v *Vault) XTrim(key string, t StreamTrim) (int, error) {
+	return v.memory.XTrim(key, t)
+}
+
+func (v *Vault) XGroupCreate(key string, group string, id string, mkStream bool, entriesRead int64) error {
+	return v.memory.XGroupCreate(key, group, id, mkStream, entriesRead)
+}
+
+func (v *Vault) XGroupSetID(key string, group string, id string, entriesRead int64) error {
+	return v.memory.XGroupSetID(key, group, id, entriesRead)
+}
+
+func (v *Vault) XGroupDestroy(key string, group string) (bool, error) {
+	return v.memory.XGroupDestroy(key, group)
+}
+
+func (v *Vault) XGroupCreateConsumer(key string, group string, consumer string) (bool, error) {
+	return v.memory.XGroupCreateConsumer(key, group, consumer)
+}
+
+func (v *Vault) XGroupDelConsumer(key string, group string, consumer string) (int, error) {
+	return v.memory.XGroupDelConsumer(key, group, consumer)
+}
+
+func (v *Vault) XAck(key string, group string, ids []StreamID) (int, error) {
+	return v.memory.XAck(key, group, ids)
+}
+
+func (v *Vault) XPendingSummary(key string, group string) (StreamPendingSummary, error) {
+	return v.memory.XPendingSummary(key, group)
+}
+
+func (v *Vault) XPending(key string, group string, start StreamID, end StreamID, count int, consumer string, minIdle int64) ([]StreamPending, error) {
+	return v.memory.XPending(key, group, start, end, count, consumer, minIdle)
+}
+
+func (v *Vault) XClaim(key string, group string, consumer string, ids []StreamID, opts StreamClaim) ([]StreamEntry, []StreamID, error) {
+	return v.memory.XClaim(key, group, consumer, ids, opts)
+}
+
+func (v *Vault) XAutoClaim(key string, group string, consumer string, minIdle int64, start StreamID, count int, justID bool) (StreamID, []StreamEntry, []StreamID, error) {
+	return v.memory.XAutoClaim(key, group, consumer, minIdle, start, count, justID)
+}
+
+func (v *Vault) XInfoStream(key string) (StreamInfo, bool, error) {
+	return v.memory.XInfoStream(key)
+}
+
+func (v *Vault) XInfoGroups(key string) ([]StreamGroupInfo, bool, error) {
+	return v.memory.XInfoGroups(key)
+}
+
+func (v *Vault) XInfoConsumers(key string, group string) ([]StreamConsumerInfo, error) {
+	return v.memory.XInfoConsumers(key, group)
+}
+
+func (v *Vault) SetBit(key string, offset uint64, bit int) (int, error) {
+	return v.memory.SetBit(key, offset, bit)
+}
+
+func (v *Vault) GetBit(key string, offset uint64) (int, error) {
+	return v.memory.GetBit(key, offset)
+}
+
+func (v *Vault) BitCount(key string, r *BitRange) (int64, error) {
+	return v.memory.BitCount(key, r)
+}
+
+func (v *Vault) BitPos(key string, bit int, r *BitRange) (int64, error) {
+	return v.memory.BitPos(key, bit, r)
+}
+
+func (v *Vault) BitOp(op int, dst string, keys []string) (int, error) {
+	return v.memory.BitOp(op, dst, keys)
+}
+
+func (v *Vault) BitField(key string, ops []BitFieldOp) ([]BitFieldResult, error) {
+	return v.memory.BitField(key, ops)
+}
+
+func (v *Vault) PFAdd(key string, elements []string) (bool, error) {
+	return v.memory.PFAdd(key, elements)
+}
+
+func (v *Vault) PFCount(keys []string) (uint64, error) {
+	return v.memory.PFCount(keys)
+}
+
+func (v *Vault) PFMerge(dst string, keys []string) error {
+	return v.memory.PFMerge(dst, keys)
+}
+
+func (v *Vault) GeoSearch(key string, spec GeoSearchSpec) ([]GeoPoint, error) {
+	return v.memory.GeoSearch(key, spec)
+}
+
+func (v *Vault) GeoSearchStore(dst string, src string, spec GeoSearchSpec, storeDist bool) (int, error) {
+	return v.memory.GeoSearchStore(dst, src, spec, storeDist)
+}
+
+func (v *Vault) Watch(w *Watch, keys []string) {
+	v.memory.Watch(w, keys)
+}
+
+func (v *Vault) Unwatch(w *Watch) {
+	v.memory.Unwatch(w)
+}
+
+func (v *Vault) WatchDirty(w *Watch) bool {
+	return v.memory.WatchDirty(w)
+}
+
+func (v *Vault) SetKeyspaceNotifier(publish func(channel string, message string)) {
+	v.memory.SetKeyspaceNotifier(publish)
+}
+
 func (v *Vault) GetType(key string) string {
 	return v.memory.GetType(key)
 }
 
+func (v *Vault) Delete(keys []string) int {
+	return v.memory.DeleteKeys(keys)
+}
+
+func (v *Vault) Unlink(keys []string) int {
+	return v.memory.Unlink(keys)
+}
+
+func (v *Vault) CountExisting(keys []string) int {
+	return v.memory.CountExisting(keys)
+}
+
+func (v *Vault) Rename(src string, dst string, nx bool) (int, error) {
+	return v.memory.Rename(src, dst, nx)
+}
+
+func (v *Vault) KeysMatching(pattern string) []string {
+	return v.memory.KeysMatching(pattern)
+}
+
+func (v *Vault) Scan(cursor uint64, count int, pattern string, typ string) (uint64, []string) {
+	return v.memory.Scan(cursor, count, pattern, typ)
+}
+
+func (v *Vault) Copy(src string, dst string, replace bool) (int, error) {
+	return v.memory.Copy(src, dst, replace)
+}
+
+func (v *Vault) Expire(key string, at time.Time, flags int) (int, bool) {
+	return v.memory.Expire(key, at, flags)
+}
+
+func (v *Vault) GetLifetime(key string) (time.Time, bool) {
+	return v.memory.GetLifetime(key)
+}
+
+func (v *Vault) Persist(key string) int {
+	return v.memory.Persist(key)
+}
+
 func (v *Vault) GetConfig() *Config {
 	return v.config
 }
 
-func (v *Vault) GetInfo() string {
-	if v.IsMaster() {
-		return fmt.Sprintf("role:%s\n", v.role)
-	} else {
-		return fmt.Sprintf("role:%s\nmain_replid:%s\nmain_repl_offset:%d\n", v.role, v.MainReplicaID, v.MainReplicaOffset)
+// GetInfo renders the INFO sections; an empty section means all of them.
+func (v *Vault) GetInfo(section string) string {
+	all := section == "" || section == "all" || section == "default" || section == "everything"
+	var sections []string
+
+	if all || section == REPLICATION {
+		if v.IsMaster() {
+			sections = append(sections, fmt.Sprintf("# Replication\r\nrole:%s\r\n", v.role))
+		} else {
+			sections = append(sections, fmt.Sprintf("# Replication\r\nrole:%s\r\nmain_replid:%s\r\nmain_repl_offset:%d\r\n", v.role, v.MainReplicaID, v.MainReplicaOffset))
+		}
+	}
+
+	if all || section == PERSISTENCE {
+		sections = append(sections, v.persistenceInfo())
+	}
+
+	if all || section == STATS {
+		stats := v.memory.ExpireStats()
+		lazyfree := v.memory.LazyFreeStats()
+		sections = append(sections, fmt.Sprintf("# Stats\r\nexpired_keys:%d\r\nexpired_stale_perc:%.2f\r\nexpired_time_cap_reached_count:%d\r\nexpire_cycle_cpu_milliseconds:%d\r\nlazyfree_pending_objects:%d\r\nlazyfreed_objects:%d\r\n",
+			stats.ExpiredKeys, stats.ExpiredStalePerc*100, stats.ExpiredTimeCapReached, stats.ExpireCycleCPUMillis, lazyfree.Pending, lazyfree.Freed))
+	}
+
+	if all || section == KEYSPACE {
+		keyspace := "# Keyspace\r\n"
+		if keys, expires, avgTTL := v.memory.KeyspaceStats(); keys > 0 {
+			keyspace += fmt.Sprintf("db0:keys=%d,expires=%d,avg_ttl=%d\r\n", keys, expires, avgTTL)
+		}
+		sections = append(sections, keyspace)
 	}
 
+	return strings.Join(sections, "\r\n")
+}
+
+// StartActiveExpiry starts reclaiming expired keys in the background,
+// holding exclusive during each cycle. Only masters do: replicas wait for
+// the deletions their master propagates.
+func (v *Vault) StartActiveExpiry(exclusive sync.Locker) {
+	go v.memory.ActiveExpireLoop(v.quit, exclusive)
+}
+
+// SetExpiryPropagator sets the function the deletions done by expiry are
+// propagated with.
+func (v *Vault) SetExpiryPropagator(propagate func(command []string)) {
+	v.memory.SetExpiryPropagator(propagate)
+}
+
+// SetMasterLink tells whether the commands run next come from the master.
+func (v *Vault) SetMasterLink(applying bool) {
+	v.memory.SetMasterLink(applying)
+}
+
+// Close stops the background jobs of the vault.
+func (v *Vault) Close() {
+	close(v.quit)
 }
 
 func (v *Vault) OpenConnectionToMaster() net.Conn {
-	address := fmt.Sprintf("%s:%d", v.config.Master_host, v.config.Master_port)
+	address := net.JoinHostPort(v.config.Master_host, strconv.Itoa(v.config.Master_port))
 	conn, err := net.Dial("tcp", address)
 	if err != nil {
 		panic(err)
@@ -148,7 +634,7 @@ func (v *Vault) DoHandshake(conn net.Conn) {
 	}
 	fmt.Printf("Received: %s\n", string(buf[:n]))
 	time.Sleep(100 * time.Millisecond)
-	conn.Write([]byte(fmt.Sprintf("*4\r\n$8\r\nREPLCONF\r\n$7\r\nLISTENING-PORT\r\n$%d\r\n%s\r\n", len(address), address)))
+	conn.Write([]byte(fmt.Sprintf("*3\r\n$8\r\nREPLCONF\r\n$14\r\nlistening-port\r\n$%d\r\n%s\r\n", len(address), address)))
 	buf = make([]byte, 4096)
 	n, err = conn.Read(buf)
 	if err != nil {
@@ -164,22 +650,17 @@ func (v *Vault) DoHandshake(conn net.Conn) {
 	}
 	fmt.Printf("Received: %s\n", string(buf[:n]))
 	time.Sleep(100 * time.Millisecond)
+	// The FULLRESYNC reply and the RDB file that follows it are read off
+	// the master link along with the propagated commands.
 	conn.Write([]byte("*3\r\n$5\r\nPSYNC\r\n$1\r\n?\r\n$2\r\n-1\r\n"))
-	buf = make([]byte, 4096)
-	n, err = conn.Read(buf)
-	if err != nil {
-		fmt.Println("Failed to read from master")
-	}
-
-	fmt.Printf("Received: %s\n", string(buf[:n]))
-	// Return the connection which will be used further
 }
 
-func (v *Vault) RDBParsed() string {
-	rdb, _ := base64.StdEncoding.DecodeString("UkVESVMwMDEx+glyZWRpcy12ZXIFNy4yLjD6CnJlZGlzLWJpdHPAQPoFY3RpbWXCbQi8ZfoIdXNlZC1tZW3CsMQQAPoIYW9mLWJhc2XAAP/wbjv+wP9aog==")
-	length := len(rdb)
-	parsed := fmt.Sprintf("$%d\r\n%s\r\n", length, rdb)
-	return parsed
+// Role returns the replication role reported to clients.
+func (v *Vault) Role() string {
+	if v.IsMaster() {
+		return MASTER
+	}
+	return REPLICA
 }
 
 func (v *Vault) IsMaster() bool {
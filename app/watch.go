@@ -0,0 +1,68 @@
+package app
+
+// Watch holds the keys a client WATCHes for its next transaction. It turns
+// dirty as soon as one of them is modified, deleted or expires, which makes
+// the transaction fail.
+type Watch struct {
+	keys  []string
+	dirty bool
+}
+
+// signalModified marks dirty the watches on key. Every change to the value
+// or the lifetime of a key must be signaled, which set and remove do; code
+// modifying a value in place calls it directly. The caller must hold the
+// mutex.
+func (ms *MemoryStorage) signalModified(key string) {
+	for _, w := range ms.watched[key] {
+		w.dirty = true
+	}
+}
+
+// Watch adds keys to those w watches. Keys already past their lifetime are
+// deleted first, so that their expiry does not count as a modification.
+func (ms *MemoryStorage) Watch(w *Watch, keys []string) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	for _, key := range keys {
+		ms.lookup(key)
+		if keyIndex(w.keys, key) >= 0 {
+			continue
+		}
+		w.keys = append(w.keys, key)
+		ms.watched[key] = append(ms.watched[key], w)
+	}
+}
+
+// Unwatch forgets every key w watches and clears its dirty state.
+func (ms *MemoryStorage) Unwatch(w *Watch) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	for _, key := range w.keys {
+		watchers := ms.watched[key]
+		for i, other := range watchers {
+			if other == w {
+				watchers = append(watchers[:i], watchers[i+1:]...)
+				break
+			}
+		}
+		if len(watchers) == 0 {
+			delete(ms.watched, key)
+		} else {
+			ms.watched[key] = watchers
+		}
+	}
+	w.keys = nil
+	w.dirty = false
+}
+
+// WatchDirty reports whether a key w watches was modified since it was
+// watched. A key whose lifetime ended in the meantime counts as modified
+// even if nothing deleted it yet.
+func (ms *MemoryStorage) WatchDirty(w *Watch) bool {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	for _, key := range w.keys {
+		ms.lookup(key)
+	}
+	return w.dirty
+}
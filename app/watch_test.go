@@ -0,0 +1,58 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchDirty(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.SetString("s", "v", SetOptions{})
+	ms.SAdd("set", []string{"a"})
+
+	for _, tt := range []struct {
+		name   string
+		key    string
+		modify func()
+		dirty  bool
+	}{
+		{"read", "s", func() { ms.GetString("s") }, false},
+		{"overwrite", "s", func() { ms.SetString("s", "w", SetOptions{}) }, true},
+		{"in place", "set", func() { ms.SAdd("set", []string{"b"}) }, true},
+		{"no-op", "set", func() { ms.SAdd("set", []string{"b"}) }, false},
+		{"other key", "s", func() { ms.SAdd("set", []string{"c"}) }, false},
+		{"create", "missing", func() { ms.Push("missing", []string{"x"}, true, false) }, true},
+		{"delete", "missing", func() { ms.Delete("missing") }, true},
+		{"flush", "s", ms.Flush, true},
+	} {
+		var w Watch
+		ms.Watch(&w, []string{tt.key})
+		tt.modify()
+		if dirty := ms.WatchDirty(&w); dirty != tt.dirty {
+			t.Errorf("%s: dirty = %v, want %v", tt.name, dirty, tt.dirty)
+		}
+		ms.Unwatch(&w)
+	}
+	if len(ms.watched) != 0 {
+		t.Errorf("watches left behind: %v", ms.watched)
+	}
+}
+
+func TestWatchExpiry(t *testing.T) {
+	ms := NewMemoryStorage()
+	past := time.Now().Add(-time.Second)
+	soon := time.Now().Add(20 * time.Millisecond)
+	ms.Save("old", "v", &past)
+	ms.Save("soon", "v", &soon)
+
+	var w Watch
+	ms.Watch(&w, []string{"old"})
+	if ms.WatchDirty(&w) {
+		t.Errorf("a key expired before WATCH made the watch dirty")
+	}
+	ms.Watch(&w, []string{"soon"})
+	time.Sleep(30 * time.Millisecond)
+	if !ms.WatchDirty(&w) {
+		t.Errorf("a watched key expiring did not make the watch dirty")
+	}
+}
@@ -0,0 +1,844 @@
+package app
+
+import (
+	"errors"
+	"math"
+	"rednav/utils"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrMinMaxNotFloat = errors.New("ERR min or max is not a float")
+	ErrLexRange       = errors.New("ERR min or max not valid string range item")
+	ErrScoreNaN       = errors.New("ERR resulting score is not a number (NaN)")
+	ErrWeightNotFloat = errors.New("ERR weight value is not a float")
+)
+
+// Options of ZAdd, matching those of ZADD.
+const (
+	ZADD_NX = 1 << iota
+	ZADD_XX
+	ZADD_GT
+	ZADD_LT
+	ZADD_CH
+	ZADD_INCR
+)
+
+// How ZRange selects members.
+const (
+	ZRANGE_RANK = iota
+	ZRANGE_SCORE
+	ZRANGE_LEX
+)
+
+// zremRangeEvents names the keyspace event of removing members selected
+// each way.
+var zremRangeEvents = [...]string{
+	ZRANGE_RANK:  "zremrangebyrank",
+	ZRANGE_SCORE: "zremrangebyscore",
+	ZRANGE_LEX:   "zremrangebylex",
+}
+
+// How ZSetOp combines the scores of a member found in several inputs.
+const (
+	ZAGGREGATE_SUM = iota
+	ZAGGREGATE_MIN
+	ZAGGREGATE_MAX
+)
+
+// ScoreMember is a sorted set member along with its score.
+type ScoreMember struct {
+	Member string
+	Score  float64
+}
+
+// ScoreRange is a range of scores, each end being inclusive unless marked
+// exclusive.
+type ScoreRange struct {
+	Min, Max     float64
+	MinEx, MaxEx bool
+}
+
+func (r ScoreRange) valid() bool {
+	return r.Min < r.Max || (r.Min == r.Max && !r.MinEx && !r.MaxEx)
+}
+
+func (r ScoreRange) gteMin(score float64) bool {
+	if r.MinEx {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+func (r ScoreRange) lteMax(score float64) bool {
+	if r.MaxEx {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+// ParseScore parses a score, which unlike ParseFloat may be infinite when
+// spelled inf, +inf or -inf. Numbers too large for a double are rejected
+// rather than rounded to infinity.
+func ParseScore(s string) (float64, bool) {
+	switch strings.ToLower(s) {
+	case "inf", "+inf":
+		return math.Inf(1), true
+	case "-inf":
+		return math.Inf(-1), true
+	}
+	return ParseFloat(s)
+}
+
+func parseScoreBound(s string) (float64, bool, bool) {
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+	f, ok := ParseScore(s)
+	return f, exclusive, ok
+}
+
+// ParseScoreRange parses the min and max of ZRANGEBYSCORE and friends, where
+// a leading "(" makes an end exclusive.
+func ParseScoreRange(min string, max string) (ScoreRange, error) {
+	var r ScoreRange
+	var okMin, okMax bool
+	r.Min, r.MinEx, okMin = parseScoreBound(min)
+	r.Max, r.MaxEx, okMax = parseScoreBound(max)
+	if !okMin || !okMax {
+		return r, ErrMinMaxNotFloat
+	}
+	return r, nil
+}
+
+// lexBound is an end of a LexRange. inf is -1 for "-" and 1 for "+", which
+// sort before and after every member.
+type lexBound struct {
+	value     string
+	exclusive bool
+	inf       int
+}
+
+// LexRange is a range of members of a sorted set whose scores are all the
+// same.
+type LexRange struct {
+	Min, Max lexBound
+}
+
+func parseLexBound(s string) (lexBound, bool) {
+	switch {
+	case s == "-":
+		return lexBound{inf: -1}, true
+	case s == "+":
+		return lexBound{inf: 1}, true
+	case strings.HasPrefix(s, "["):
+		return lexBound{value: s[1:]}, true
+	case strings.HasPrefix(s, "("):
+		return lexBound{value: s[1:], exclusive: true}, true
+	default:
+		return lexBound{}, false
+	}
+}
+
+// ParseLexRange parses the min and max of ZRANGEBYLEX and friends: "-" and
+// "+" for the infinities, or a member prefixed with "[" or "(" for an
+// inclusive or exclusive end.
+func ParseLexRange(min string, max string) (LexRange, error) {
+	lo, okMin := parseLexBound(min)
+	hi, okMax := parseLexBound(max)
+	if !okMin || !okMax {
+		return LexRange{}, ErrLexRange
+	}
+	return LexRange{Min: lo, Max: hi}, nil
+}
+
+func compareLexBounds(a lexBound, b lexBound) int {
+	if a.inf != 0 || b.inf != 0 {
+		return a.inf - b.inf
+	}
+	return strings.Compare(a.value, b.value)
+}
+
+func (r LexRange) valid() bool {
+	cmp := compareLexBounds(r.Min, r.Max)
+	return cmp < 0 || (cmp == 0 && !r.Min.exclusive && !r.Max.exclusive)
+}
+
+func (r LexRange) gteMin(member string) bool {
+	switch {
+	case r.Min.inf != 0:
+		return r.Min.inf < 0
+	case r.Min.exclusive:
+		return member > r.Min.value
+	default:
+		return member >= r.Min.value
+	}
+}
+
+func (r LexRange) lteMax(member string) bool {
+	switch {
+	case r.Max.inf != 0:
+		return r.Max.inf > 0
+	case r.Max.exclusive:
+		return member < r.Max.value
+	default:
+		return member <= r.Max.value
+	}
+}
+
+// ZRangeSpec selects members of a sorted set: by rank between Start and
+// Stop, by score within Score or by member within Lex. Rev walks from the
+// highest ranked member down. Score and Lex selections skip Offset members
+// and return at most Count of them, all of them when Count is negative.
+type ZRangeSpec struct {
+	By          int
+	Rev         bool
+	Start, Stop int64
+	Score       ScoreRange
+	Lex         LexRange
+	Offset      int64
+	Count       int64
+}
+
+// zsetValue is the sorted set value. The dict maps members to their score
+// for O(1) lookups while the skiplist keeps them ordered.
+type zsetValue struct {
+	table *dict[float64]
+	zsl   *zskiplist
+}
+
+func newZSet() *zsetValue {
+	return &zsetValue{table: newDict[float64](), zsl: newZskiplist()}
+}
+
+func (z *zsetValue) Len() int {
+	return z.zsl.length
+}
+
+func (z *zsetValue) score(member string) (float64, bool) {
+	return z.table.Get(member)
+}
+
+// add sets the score of member, inserting it if needed.
+func (z *zsetValue) add(member string, score float64) {
+	if current, exists := z.table.Get(member); exists {
+		if current == score {
+			return
+		}
+		z.zsl.delete(current, member)
+	}
+	z.table.Set(member, score)
+	z.zsl.insert(score, member)
+}
+
+// remove deletes member and reports whether it was present.
+func (z *zsetValue) remove(member string) bool {
+	score, exists := z.table.Get(member)
+	if !exists {
+		return false
+	}
+	z.table.Delete(member)
+	z.zsl.delete(score, member)
+	return true
+}
+
+func (z *zsetValue) copy() *zsetValue {
+	dup := newZSet()
+	for x := z.zsl.first(); x != nil; x = x.level[0].forward {
+		dup.add(x.member, x.score)
+	}
+	return dup
+}
+
+// rank returns the 0 based rank of member, counted from the highest score
+// when rev is set, its score and whether it was found.
+func (z *zsetValue) rank(member string, rev bool) (int, float64, bool) {
+	score, exists := z.table.Get(member)
+	if !exists {
+		return 0, 0, false
+	}
+	rank := z.zsl.rank(score, member)
+	if rev {
+		return z.Len() - rank, score, true
+	}
+	return rank - 1, score, true
+}
+
+// rangeOf returns the members selected by spec.
+func (z *zsetValue) rangeOf(spec ZRangeSpec) []ScoreMember {
+	var x *zskiplistNode
+	var inRange func(x *zskiplistNode) bool
+	limit := int64(-1)
+	switch spec.By {
+	case ZRANGE_RANK:
+		start, stop, ok := listRange(spec.Start, spec.Stop, z.Len())
+		if !ok {
+			return nil
+		}
+		if spec.Rev {
+			x = z.zsl.byRank(z.Len() - start)
+		} else {
+			x = z.zsl.byRank(start + 1)
+		}
+		limit = int64(stop - start + 1)
+		inRange = func(*zskiplistNode) bool { return true }
+	case ZRANGE_SCORE:
+		if spec.Rev {
+			x = z.zsl.lastInRange(spec.Score)
+			inRange = func(x *zskiplistNode) bool { return spec.Score.gteMin(x.score) }
+		} else {
+			x = z.zsl.firstInRange(spec.Score)
+			inRange = func(x *zskiplistNode) bool { return spec.Score.lteMax(x.score) }
+		}
+	case ZRANGE_LEX:
+		if spec.Rev {
+			x = z.zsl.lastInLexRange(spec.Lex)
+			inRange = func(x *zskiplistNode) bool { return spec.Lex.gteMin(x.member) }
+		} else {
+			x = z.zsl.firstInLexRange(spec.Lex)
+			inRange = func(x *zskiplistNode) bool { return spec.Lex.lteMax(x.member) }
+		}
+	}
+	if spec.By != ZRANGE_RANK {
+		if spec.Offset < 0 {
+			return nil
+		}
+		limit = spec.Count
+	}
+
+	next := func(x *zskiplistNode) *zskiplistNode {
+		if spec.Rev {
+			return x.backward
+		}
+		return x.level[0].forward
+	}
+	if spec.By != ZRANGE_RANK {
+		for skip := spec.Offset; x != nil && skip > 0 && inRange(x); skip-- {
+			x = next(x)
+		}
+	}
+	var result []ScoreMember
+	for ; x != nil && limit != 0 && inRange(x); x = next(x) {
+		result = append(result, ScoreMember{Member: x.member, Score: x.score})
+		limit--
+	}
+	return result
+}
+
+// pop removes up to count members from the lowest scores, or the highest
+// ones when max is set.
+func (z *zsetValue) pop(count int, max bool) []ScoreMember {
+	var popped []ScoreMember
+	for len(popped) < count && z.Len() > 0 {
+		x := z.zsl.first()
+		if max {
+			x = z.zsl.tail
+		}
+		popped = append(popped, ScoreMember{Member: x.member, Score: x.score})
+		z.remove(x.member)
+	}
+	return popped
+}
+
+// lookupZSet returns the sorted set stored at key. The caller must hold the
+// mutex.
+func (ms *MemoryStorage) lookupZSet(key string) (*zsetValue, error) {
+	item, exists := ms.lookup(key)
+	if !exists {
+		return nil, nil
+	}
+	z, ok := item.Value.(*zsetValue)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return z, nil
+}
+
+// ZAdd adds or updates the members of the sorted set at key as told by the
+// ZADD_* flags. It returns the number of members added, plus those whose
+// score changed with ZADD_CH. With ZADD_INCR the single pair is an
+// increment and the new score is returned, unless a condition prevented the
+// update which is reported by the false boolean.
+func (ms *MemoryStorage) ZAdd(key string, pairs []ScoreMember, flags int) (int, float64, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	z, err := ms.lookupZSet(key)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	added, changed := 0, 0
+	var score float64
+	performed := false
+	for _, pair := range pairs {
+		current, exists := 0.0, false
+		if z != nil {
+			current, exists = z.score(pair.Member)
+		}
+		if exists {
+			if flags&ZADD_NX != 0 {
+				continue
+			}
+			next := pair.Score
+			if flags&ZADD_INCR != 0 {
+				next += current
+				if math.IsNaN(next) {
+					return 0, 0, false, ErrScoreNaN
+				}
+			}
+			if (flags&ZADD_LT != 0 && next >= current) || (flags&ZADD_GT != 0 && next <= current) {
+				continue
+			}
+			score, performed = next, true
+			if next != current {
+				z.add(pair.Member, next)
+				changed++
+			}
+			continue
+		}
+		if flags&ZADD_XX != 0 {
+			continue
+		}
+		if z == nil {
+			z = newZSet()
+			ms.set(key, Item{Value: z})
+		}
+		z.add(pair.Member, pair.Score)
+		score, performed = pair.Score, true
+		added++
+	}
+	if added > 0 || changed > 0 {
+		ms.signalModified(key)
+		if flags&ZADD_INCR != 0 {
+			ms.notify(NOTIFY_ZSET, "zincr", key)
+		} else {
+			ms.notify(NOTIFY_ZSET, "zadd", key)
+		}
+	}
+	if flags&ZADD_CH != 0 {
+		added += changed
+	}
+	return added, score, performed, nil
+}
+
+// ZScore returns the score of member in the sorted set at key.
+func (ms *MemoryStorage) ZScore(key string, member string) (float64, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	z, err := ms.lookupZSet(key)
+	if z == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || z == nil {
+		return 0, false, err
+	}
+	score, exists := z.score(member)
+	return score, exists, nil
+}
+
+// ZMScore returns the scores of members in the sorted set at key, and for
+// each whether it was found.
+func (ms *MemoryStorage) ZMScore(key string, members []string) ([]float64, []bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	z, err := ms.lookupZSet(key)
+	if z == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	scores := make([]float64, len(members))
+	found := make([]bool, len(members))
+	if z != nil {
+		for i, member := range members {
+			scores[i], found[i] = z.score(member)
+		}
+	}
+	return scores, found, nil
+}
+
+// ZCard returns the number of members of the sorted set at key.
+func (ms *MemoryStorage) ZCard(key string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	z, err := ms.lookupZSet(key)
+	if z == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || z == nil {
+		return 0, err
+	}
+	return z.Len(), nil
+}
+
+// ZRank returns the 0 based rank of member in the sorted set at key, from
+// the highest score when rev is set, along with its score.
+func (ms *MemoryStorage) ZRank(key string, member string, rev bool) (int, float64, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	z, err := ms.lookupZSet(key)
+	if z == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || z == nil {
+		return 0, 0, false, err
+	}
+	rank, score, found := z.rank(member, rev)
+	return rank, score, found, nil
+}
+
+// ZRange returns the members of the sorted set at key selected by spec.
+func (ms *MemoryStorage) ZRange(key string, spec ZRangeSpec) ([]ScoreMember, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	z, err := ms.lookupZSet(key)
+	if z == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || z == nil {
+		return nil, err
+	}
+	return z.rangeOf(spec), nil
+}
+
+// ZRangeStore stores the members of the sorted set at src selected by spec
+// in dst, deleting dst when there are none, and returns how many there are.
+func (ms *MemoryStorage) ZRangeStore(dst string, src string, spec ZRangeSpec) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	z, err := ms.lookupZSet(src)
+	if z == nil && err == nil {
+		ms.keyMiss(src)
+	}
+	if err != nil {
+		return 0, err
+	}
+	var members []ScoreMember
+	if z != nil {
+		members = z.rangeOf(spec)
+	}
+	result := newZSet()
+	for _, m := range members {
+		result.add(m.Member, m.Score)
+	}
+	ms.storeZSet(dst, result, "zrangestore")
+	return result.Len(), nil
+}
+
+// storeZSet stores z at key, deleting key instead when z is empty, and
+// publishes event. The caller must hold the mutex.
+func (ms *MemoryStorage) storeZSet(key string, z *zsetValue, event string) {
+	if z.Len() == 0 {
+		if ms.remove(key) {
+			ms.notify(NOTIFY_GENERIC, "del", key)
+		}
+	} else {
+		ms.set(key, Item{Value: z})
+		ms.notify(NOTIFY_ZSET, event, key)
+	}
+}
+
+// ZRem removes members from the sorted set at key, deleting the key once it
+// is empty, and returns how many were removed.
+func (ms *MemoryStorage) ZRem(key string, members []string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	z, err := ms.lookupZSet(key)
+	if err != nil || z == nil {
+		return 0, err
+	}
+	removed := 0
+	for _, member := range members {
+		if z.remove(member) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		ms.notify(NOTIFY_ZSET, "zrem", key)
+	}
+	if z.Len() == 0 {
+		ms.remove(key)
+		ms.notify(NOTIFY_GENERIC, "del", key)
+	} else if removed > 0 {
+		ms.signalModified(key)
+	}
+	return removed, nil
+}
+
+// ZRemRange removes the members of the sorted set at key selected by spec
+// and returns how many were removed.
+func (ms *MemoryStorage) ZRemRange(key string, spec ZRangeSpec) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	z, err := ms.lookupZSet(key)
+	if err != nil || z == nil {
+		return 0, err
+	}
+	spec.Count = -1
+	members := z.rangeOf(spec)
+	for _, m := range members {
+		z.remove(m.Member)
+	}
+	if len(members) > 0 {
+		ms.notify(NOTIFY_ZSET, zremRangeEvents[spec.By], key)
+	}
+	if z.Len() == 0 {
+		ms.remove(key)
+		ms.notify(NOTIFY_GENERIC, "del", key)
+	} else if len(members) > 0 {
+		ms.signalModified(key)
+	}
+	return len(members), nil
+}
+
+// ZCount returns the number of members of the sorted set at key whose score
+// is within r.
+func (ms *MemoryStorage) ZCount(key string, r ScoreRange) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	z, err := ms.lookupZSet(key)
+	if z == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || z == nil {
+		return 0, err
+	}
+	first := z.zsl.firstInRange(r)
+	if first == nil {
+		return 0, nil
+	}
+	last := z.zsl.lastInRange(r)
+	return z.zsl.rank(last.score, last.member) - z.zsl.rank(first.score, first.member) + 1, nil
+}
+
+// ZLexCount returns the number of members of the sorted set at key within r.
+func (ms *MemoryStorage) ZLexCount(key string, r LexRange) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	z, err := ms.lookupZSet(key)
+	if z == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || z == nil {
+		return 0, err
+	}
+	first := z.zsl.firstInLexRange(r)
+	if first == nil {
+		return 0, nil
+	}
+	last := z.zsl.lastInLexRange(r)
+	return z.zsl.rank(last.score, last.member) - z.zsl.rank(first.score, first.member) + 1, nil
+}
+
+// zpop removes up to count members with the lowest scores, or the highest
+// with max, from the sorted set at key. The caller must hold the mutex.
+func (ms *MemoryStorage) zpop(key string, count int, max bool) ([]ScoreMember, error) {
+	z, err := ms.lookupZSet(key)
+	if err != nil || z == nil {
+		return nil, err
+	}
+	popped := z.pop(count, max)
+	if len(popped) > 0 {
+		if max {
+			ms.notify(NOTIFY_ZSET, "zpopmax", key)
+		} else {
+			ms.notify(NOTIFY_ZSET, "zpopmin", key)
+		}
+	}
+	if z.Len() == 0 {
+		ms.remove(key)
+		ms.notify(NOTIFY_GENERIC, "del", key)
+	} else if len(popped) > 0 {
+		ms.signalModified(key)
+	}
+	return popped, nil
+}
+
+// ZPop removes and returns up to count members with the lowest scores, or
+// the highest with max, from the sorted set at key.
+func (ms *MemoryStorage) ZPop(key string, count int, max bool) ([]ScoreMember, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return ms.zpop(key, count, max)
+}
+
+// ZScan incrementally iterates the sorted set at key, returning the next
+// cursor and the matching members with their scores.
+func (ms *MemoryStorage) ZScan(key string, cursor uint64, count int, pattern string) (uint64, []ScoreMember, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	z, err := ms.lookupZSet(key)
+	if z == nil && err == nil {
+		ms.keyMiss(key)
+	}
+	if err != nil || z == nil {
+		return 0, nil, err
+	}
+
+	var members []ScoreMember
+	visited := 0
+	for maxIterations := count * 10; ; maxIterations-- {
+		cursor = z.table.Scan(cursor, func(member string, score float64) {
+			visited++
+			if pattern == "" || pattern == "*" || utils.StringMatch(pattern, member, false) {
+				members = append(members, ScoreMember{Member: member, Score: score})
+			}
+		})
+		if cursor == 0 || maxIterations <= 1 || visited >= count {
+			break
+		}
+	}
+	return cursor, members, nil
+}
+
+// zsetSource is an input of ZSetOp: a sorted set, or a plain set whose
+// members all score 1.
+type zsetSource struct {
+	zset *zsetValue
+	set  *setValue
+}
+
+func (s zsetSource) Len() int {
+	switch {
+	case s.zset != nil:
+		return s.zset.Len()
+	case s.set != nil:
+		return s.set.Len()
+	default:
+		return 0
+	}
+}
+
+func (s zsetSource) score(member string) (float64, bool) {
+	switch {
+	case s.zset != nil:
+		return s.zset.score(member)
+	case s.set != nil:
+		return 1, s.set.has(member)
+	default:
+		return 0, false
+	}
+}
+
+func (s zsetSource) each(fn func(member string, score float64)) {
+	switch {
+	case s.zset != nil:
+		for x := s.zset.zsl.first(); x != nil; x = x.level[0].forward {
+			fn(x.member, x.score)
+		}
+	case s.set != nil:
+		s.set.each(func(member string) bool {
+			fn(member, 1)
+			return true
+		})
+	}
+}
+
+func aggregateScores(aggregate int, a float64, b float64) float64 {
+	switch aggregate {
+	case ZAGGREGATE_MIN:
+		return math.Min(a, b)
+	case ZAGGREGATE_MAX:
+		return math.Max(a, b)
+	default:
+		// inf + -inf counts as 0, as in Redis.
+		if sum := a + b; !math.IsNaN(sum) {
+			return sum
+		}
+		return 0
+	}
+}
+
+// zsetOp computes the union or intersection of the sorted sets or sets at
+// keys, multiplying their scores by weights and combining them with
+// aggregate. The caller must hold the mutex.
+func (ms *MemoryStorage) zsetOp(op int, keys []string, weights []float64, aggregate int) (*zsetValue, error) {
+	sources := make([]zsetSource, len(keys))
+	for i, key := range keys {
+		item, exists := ms.lookup(key)
+		if !exists {
+			continue
+		}
+		switch value := item.Value.(type) {
+		case *zsetValue:
+			sources[i].zset = value
+		case *setValue:
+			sources[i].set = value
+		default:
+			return nil, ErrWrongType
+		}
+	}
+	weight := func(i int, score float64) float64 {
+		if weights != nil {
+			score *= weights[i]
+		}
+		if math.IsNaN(score) {
+			return 0
+		}
+		return score
+	}
+
+	result := newZSet()
+	switch op {
+	case SET_OP_UNION:
+		for i, source := range sources {
+			source.each(func(member string, score float64) {
+				score = weight(i, score)
+				if current, exists := result.score(member); exists {
+					score = aggregateScores(aggregate, current, score)
+				}
+				result.add(member, score)
+			})
+		}
+	case SET_OP_INTER:
+		order := make([]int, len(sources))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool { return sources[order[a]].Len() < sources[order[b]].Len() })
+		sources[order[0]].each(func(member string, score float64) {
+			score = weight(order[0], score)
+			for _, i := range order[1:] {
+				other, exists := sources[i].score(member)
+				if !exists {
+					return
+				}
+				score = aggregateScores(aggregate, score, weight(i, other))
+			}
+			result.add(member, score)
+		})
+	}
+	return result, nil
+}
+
+// ZSetOp returns the union or intersection of the sorted sets at keys, as
+// described by zsetOp, ordered by score.
+func (ms *MemoryStorage) ZSetOp(op int, keys []string, weights []float64, aggregate int) ([]ScoreMember, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	result, err := ms.zsetOp(op, keys, weights, aggregate)
+	if err != nil {
+		return nil, err
+	}
+	return result.rangeOf(ZRangeSpec{By: ZRANGE_RANK, Start: 0, Stop: -1}), nil
+}
+
+// ZSetOpStore stores the union or intersection of the sorted sets at keys in
+// dst, deleting dst when it is empty, and returns its cardinality.
+func (ms *MemoryStorage) ZSetOpStore(op int, dst string, keys []string, weights []float64, aggregate int) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	result, err := ms.zsetOp(op, keys, weights, aggregate)
+	if err != nil {
+		return 0, err
+	}
+	event := "zunionstore"
+	if op == SET_OP_INTER {
+		event = "zinterstore"
+	}
+	ms.storeZSet(dst, result, event)
+	return result.Len(), nil
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestSkiplistRanks(t *testing.T) {
+	z := newZSet()
+	var want []ScoreMember
+	for i := 0; i < 500; i++ {
+		m := ScoreMember{Member: "m" + strconv.Itoa(i), Score: float64(rand.Intn(50))}
+		z.add(m.Member, m.Score)
+		want = append(want, m)
+	}
+	// Rescore and remove some members to exercise span maintenance.
+	for i := 0; i < 500; i += 7 {
+		want[i].Score = float64(rand.Intn(50))
+		z.add(want[i].Member, want[i].Score)
+	}
+	for i := 0; i < 500; i += 11 {
+		z.remove(want[i].Member)
+	}
+	kept := want[:0]
+	for i, m := range want {
+		if i%11 != 0 {
+			kept = append(kept, m)
+		}
+	}
+	want = kept
+	sort.Slice(want, func(i, j int) bool {
+		return want[i].Score < want[j].Score || (want[i].Score == want[j].Score && want[i].Member < want[j].Member)
+	})
+
+	if got := z.rangeOf(ZRangeSpec{By: ZRANGE_RANK, Start: 0, Stop: -1}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("members out of order")
+	}
+	for i, m := range want {
+		if rank, _, _ := z.rank(m.Member, false); rank != i {
+			t.Fatalf("rank of %s = %d, want %d", m.Member, rank, i)
+		}
+		if rank, _, _ := z.rank(m.Member, true); rank != len(want)-1-i {
+			t.Fatalf("reverse rank of %s = %d, want %d", m.Member, rank, len(want)-1-i)
+		}
+		if x := z.zsl.byRank(i + 1); x.member != m.Member {
+			t.Fatalf("byRank(%d) = %s, want %s", i+1, x.member, m.Member)
+		}
+	}
+	for x := z.zsl.tail; x != nil && x.backward != nil; x = x.backward {
+		if !x.backward.before(x.score, x.member) {
+			t.Fatalf("backward links out of order at %s", x.member)
+		}
+	}
+}
+
+func TestZSetRanges(t *testing.T) {
+	z := newZSet()
+	for i, member := range []string{"a", "b", "c", "d", "e"} {
+		z.add(member, float64(i+1))
+	}
+	members := func(spec ZRangeSpec) []string {
+		var names []string
+		for _, m := range z.rangeOf(spec) {
+			names = append(names, m.Member)
+		}
+		return names
+	}
+	score := func(min, max string) ScoreRange {
+		r, err := ParseScoreRange(min, max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	lex := func(min, max string) LexRange {
+		r, err := ParseLexRange(min, max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	tests := []struct {
+		spec ZRangeSpec
+		want []string
+	}{
+		{ZRangeSpec{By: ZRANGE_RANK, Start: 1, Stop: -2}, []string{"b", "c", "d"}},
+		{ZRangeSpec{By: ZRANGE_RANK, Start: 0, Stop: 1, Rev: true}, []string{"e", "d"}},
+		{ZRangeSpec{By: ZRANGE_RANK, Start: 5, Stop: 10}, nil},
+		{ZRangeSpec{By: ZRANGE_SCORE, Score: score("(1", "3"), Count: -1}, []string{"b", "c"}},
+		{ZRangeSpec{By: ZRANGE_SCORE, Score: score("-inf", "+inf"), Offset: 1, Count: 2}, []string{"b", "c"}},
+		{ZRangeSpec{By: ZRANGE_SCORE, Score: score("2", "(5"), Rev: true, Count: -1}, []string{"d", "c", "b"}},
+		{ZRangeSpec{By: ZRANGE_SCORE, Score: score("(3", "(3"), Count: -1}, nil},
+		{ZRangeSpec{By: ZRANGE_LEX, Lex: lex("[b", "(d"), Count: -1}, []string{"b", "c"}},
+		{ZRangeSpec{By: ZRANGE_LEX, Lex: lex("-", "+"), Rev: true, Offset: 3, Count: -1}, []string{"b", "a"}},
+		{ZRangeSpec{By: ZRANGE_LEX, Lex: lex("+", "-"), Count: -1}, nil},
+	}
+	for _, tt := range tests {
+		if got := members(tt.spec); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("rangeOf(%+v) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+
+	if _, err := ParseScoreRange("nan", "1"); err != ErrMinMaxNotFloat {
+		t.Errorf("nan score bound accepted: %v", err)
+	}
+	if _, err := ParseLexRange("a", "+"); err != ErrLexRange {
+		t.Errorf("lex bound without prefix accepted: %v", err)
+	}
+}
+
+func TestParseScore(t *testing.T) {
+	for s, want := range map[string]float64{"1.5": 1.5, "-3": -3, "inf": math.Inf(1), "+Inf": math.Inf(1), "-INF": math.Inf(-1)} {
+		if got, ok := ParseScore(s); !ok || got != want {
+			t.Errorf("ParseScore(%q) = %v, %v, want %v", s, got, ok, want)
+		}
+	}
+	for _, s := range []string{"1e400", "-1e400", "infinity", "nan", "", "1x"} {
+		if got, ok := ParseScore(s); ok {
+			t.Errorf("ParseScore(%q) = %v, want an error", s, got)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package commands
+
+// arities holds the number of arguments of each command, counting the
+// command name, as Redis declares it: a negative arity -n means at least n.
+var arities = map[string]int{
+	"PING":     -1,
+	"ECHO":     2,
+	"SET":      -3,
+	"GET":      2,
+	"INFO":     -1,
+	"REPLCONF": -1,
+	"PSYNC":    -3,
+	"HELLO":    -1,
+	"AUTH":     -2,
+
+	"EXPIRE":      -3,
+	"PEXPIRE":     -3,
+	"EXPIREAT":    -3,
+	"PEXPIREAT":   -3,
+	"TTL":         2,
+	"PTTL":        2,
+	"EXPIRETIME":  2,
+	"PEXPIRETIME": 2,
+	"PERSIST":     2,
+
+	"SETNX":  3,
+	"SETEX":  4,
+	"PSETEX": 4,
+	"GETSET": 3,
+	"GETDEL": 2,
+	"GETEX":  -2,
+
+	"DEL":      -2,
+	"UNLINK":   -2,
+	"EXISTS":   -2,
+	"TYPE":     2,
+	"RENAME":   3,
+	"RENAMENX": 3,
+	"COPY":     -3,
+	"TOUCH":    -2,
+
+	"KEYS": 2,
+	"SCAN": -2,
+
+	"INCR":        2,
+	"DECR":        2,
+	"INCRBY":      3,
+	"DECRBY":      3,
+	"INCRBYFLOAT": 3,
+
+	"APPEND":   3,
+	"STRLEN":   2,
+	"GETRANGE": 4,
+	"SUBSTR":   4,
+	"SETRANGE": 4,
+	"MGET":     -2,
+	"MSET":     -3,
+	"MSETNX":   -3,
+	"LCS":      -3,
+
+	"SETBIT":      4,
+	"GETBIT":      3,
+	"BITCOUNT":    -2,
+	"BITPOS":      -3,
+	"BITOP":       -4,
+	"BITFIELD":    -2,
+	"BITFIELD_RO": -2,
+
+	"PFADD":   -2,
+	"PFCOUNT": -2,
+	"PFMERGE": -2,
+
+	"LPUSH":     -3,
+	"RPUSH":     -3,
+	"LPUSHX":    -3,
+	"RPUSHX":    -3,
+	"LPOP":      -2,
+	"RPOP":      -2,
+	"LLEN":      2,
+	"LRANGE":    4,
+	"LINDEX":    3,
+	"LPOS":      -3,
+	"LSET":      4,
+	"LINSERT":   5,
+	"LREM":      4,
+	"LTRIM":     4,
+	"LMOVE":     5,
+	"RPOPLPUSH": 3,
+	"LMPOP":     -4,
+
+	"BLPOP":      -3,
+	"BRPOP":      -3,
+	"BLMOVE":     6,
+	"BRPOPLPUSH": 4,
+	"BLMPOP":     -5,
+
+	"HSET":         -4,
+	"HMSET":        -4,
+	"HSETNX":       4,
+	"HGET":         3,
+	"HMGET":        -3,
+	"HDEL":         -3,
+	"HLEN":         2,
+	"HEXISTS":      3,
+	"HSTRLEN":      3,
+	"HGETALL":      2,
+	"HKEYS":        2,
+	"HVALS":        2,
+	"HINCRBY":      4,
+	"HINCRBYFLOAT": 4,
+	"HRANDFIELD":   -2,
+	"HSCAN":        -3,
+	"HEXPIRE":      -6,
+	"HPEXPIRE":     -6,
+	"HEXPIREAT":    -6,
+	"HPEXPIREAT":   -6,
+	"HPERSIST":     -5,
+	"HTTL":         -5,
+	"HPTTL":        -5,
+	"HEXPIRETIME":  -5,
+	"HPEXPIRETIME": -5,
+
+	"SADD":        -3,
+	"SREM":        -3,
+	"SCARD":       2,
+	"SISMEMBER":   3,
+	"SMISMEMBER":  -3,
+	"SMEMBERS":    2,
+	"SPOP":        -2,
+	"SRANDMEMBER": -2,
+	"SMOVE":       4,
+	"SSCAN":       -3,
+	"SINTER":      -2,
+	"SUNION":      -2,
+	"SDIFF":       -2,
+	"SINTERSTORE": -3,
+	"SUNIONSTORE": -3,
+	"SDIFFSTORE":  -3,
+	"SINTERCARD":  -3,
+
+	"ZADD":             -4,
+	"ZINCRBY":          4,
+	"ZCARD":            2,
+	"ZSCORE":           3,
+	"ZMSCORE":          -3,
+	"ZRANK":            -3,
+	"ZREVRANK":         -3,
+	"ZRANGE":           -4,
+	"ZREVRANGE":        -4,
+	"ZRANGEBYSCORE":    -4,
+	"ZREVRANGEBYSCORE": -4,
+	"ZRANGEBYLEX":      -4,
+	"ZREVRANGEBYLEX":   -4,
+	"ZRANGESTORE":      -5,
+	"ZREM":             -3,
+	"ZREMRANGEBYRANK":  4,
+	"ZREMRANGEBYSCORE": 4,
+	"ZREMRANGEBYLEX":   4,
+	"ZCOUNT":           4,
+	"ZLEXCOUNT":        4,
+	"ZPOPMIN":          -2,
+	"ZPOPMAX":          -2,
+	"BZPOPMIN":         -3,
+	"BZPOPMAX":         -3,
+	"ZUNION":           -3,
+	"ZINTER":           -3,
+	"ZUNIONSTORE":      -4,
+	"ZINTERSTORE":      -4,
+	"ZSCAN":            -3,
+
+	"GEOADD":         -5,
+	"GEODIST":        -4,
+	"GEOPOS":         -2,
+	"GEOHASH":        -2,
+	"GEOSEARCH":      -7,
+	"GEOSEARCHSTORE": -8,
+
+	"XADD":       -5,
+	"XLEN":       2,
+	"XRANGE":     -4,
+	"XREVRANGE":  -4,
+	"XDEL":       -3,
+	"XTRIM":      -4,
+	"XREAD":      -4,
+	"XREADGROUP": -7,
+	"XGROUP":     -2,
+	"XACK":       -4,
+	"XPENDING":   -3,
+	"XCLAIM":     -6,
+	"XAUTOCLAIM": -6,
+	"XINFO":      -2,
+
+	"MULTI":   1,
+	"EXEC":    1,
+	"DISCARD": 1,
+	"WATCH":   -2,
+	"UNWATCH": 1,
+
+	"SUBSCRIBE":    -2,
+	"UNSUBSCRIBE":  -1,
+	"PSUBSCRIBE":   -2,
+	"PUNSUBSCRIBE": -1,
+	"PUBLISH":      3,
+	"PUBSUB":       -2,
+	"SSUBSCRIBE":   -2,
+	"SUNSUBSCRIBE": -1,
+	"SPUBLISH":     3,
+
+	"CONFIG": -2,
+
+	"SAVE":     1,
+	"BGSAVE":   -1,
+	"LASTSAVE": 1,
+}
+
+// ArityOK reports whether argc arguments, counting the command name, suit
+// the arity of the named command. Commands without a declared arity accept
+// any number.
+func ArityOK(name string, argc int) bool {
+	arity, known := arities[name]
+	if !known {
+		return true
+	}
+	if arity < 0 {
+		return argc >= -arity
+	}
+	return argc == arity
+}
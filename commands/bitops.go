@@ -0,0 +1,250 @@
+package commands
+
+import (
+	"rednav/app"
+	"rednav/interfaces"
+	"strings"
+)
+
+// SetBit sets or clears a bit of a string: SETBIT key offset value
+func SetBit(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("setbit")
+	}
+	offset, err := app.ParseBitOffset(args[1].Bulk, 0)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if args[2].Bulk != "0" && args[2].Bulk != "1" {
+		return ErrorReply(app.ErrBitValue)
+	}
+	old, err := v.SetBit(args[0].Bulk, offset, int(args[2].Bulk[0]-'0'))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(old))
+}
+
+// GetBit returns a bit of a string: GETBIT key offset
+func GetBit(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("getbit")
+	}
+	offset, err := app.ParseBitOffset(args[1].Bulk, 0)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	bit, err := v.GetBit(args[0].Bulk, offset)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(bit))
+}
+
+// parseBitRange parses the optional start [end [BYTE|BIT]] of BITCOUNT and
+// BITPOS, returning nil when args is empty.
+func parseBitRange(args []Command, endRequired bool) (*app.BitRange, *Command) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if len(args) > 3 || (endRequired && len(args) == 1) {
+		reply := ErrorReply(app.ErrSyntax)
+		return nil, &reply
+	}
+	r := &app.BitRange{End: -1}
+	var ok bool
+	if r.Start, ok = app.ParseInt(args[0].Bulk); !ok {
+		reply := ErrorReply(app.ErrNotInteger)
+		return nil, &reply
+	}
+	if len(args) > 1 {
+		if r.End, ok = app.ParseInt(args[1].Bulk); !ok {
+			reply := ErrorReply(app.ErrNotInteger)
+			return nil, &reply
+		}
+		r.EndGiven = true
+	}
+	if len(args) > 2 {
+		switch strings.ToUpper(args[2].Bulk) {
+		case "BYTE":
+		case "BIT":
+			r.Bit = true
+		default:
+			reply := ErrorReply(app.ErrSyntax)
+			return nil, &reply
+		}
+	}
+	return r, nil
+}
+
+// BitCount counts the set bits of a string:
+// BITCOUNT key [start end [BYTE|BIT]]
+func BitCount(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("bitcount")
+	}
+	r, reply := parseBitRange(args[1:], true)
+	if reply != nil {
+		return *reply
+	}
+	n, err := v.BitCount(args[0].Bulk, r)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(n)
+}
+
+// BitPos finds the first bit of a string set or cleared:
+// BITPOS key bit [start [end [BYTE|BIT]]]
+func BitPos(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("bitpos")
+	}
+	if args[1].Bulk != "0" && args[1].Bulk != "1" {
+		if _, ok := app.ParseInt(args[1].Bulk); !ok {
+			return ErrorReply(app.ErrNotInteger)
+		}
+		return Error("ERR The bit argument must be 1 or 0.")
+	}
+	r, reply := parseBitRange(args[2:], false)
+	if reply != nil {
+		return *reply
+	}
+	pos, err := v.BitPos(args[0].Bulk, int(args[1].Bulk[0]-'0'), r)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(pos)
+}
+
+// BitOp stores the bitwise operation of strings:
+// BITOP AND|OR|XOR|NOT destkey key [key ...]
+func BitOp(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 3 {
+		return WrongArgs("bitop")
+	}
+	var op int
+	switch strings.ToUpper(args[0].Bulk) {
+	case "AND":
+		op = app.BITOP_AND
+	case "OR":
+		op = app.BITOP_OR
+	case "XOR":
+		op = app.BITOP_XOR
+	case "NOT":
+		op = app.BITOP_NOT
+		if len(args) != 3 {
+			return Error("ERR BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return ErrorReply(app.ErrSyntax)
+	}
+	n, err := v.BitOp(op, args[1].Bulk, bulks(args[2:]))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
+
+// parseBitField parses the subcommands of BITFIELD and reports whether any
+// of them writes.
+func parseBitField(args []Command, readOnly bool) ([]app.BitFieldOp, bool, *Command) {
+	fail := func(reply Command) ([]app.BitFieldOp, bool, *Command) {
+		return nil, false, &reply
+	}
+	var ops []app.BitFieldOp
+	write := false
+	overflow := app.BITFIELD_WRAP
+	for i := 0; i < len(args); i++ {
+		sub := strings.ToUpper(args[i].Bulk)
+		if sub == "OVERFLOW" && i+1 < len(args) {
+			switch strings.ToUpper(args[i+1].Bulk) {
+			case "WRAP":
+				overflow = app.BITFIELD_WRAP
+			case "SAT":
+				overflow = app.BITFIELD_SAT
+			case "FAIL":
+				overflow = app.BITFIELD_FAIL
+			default:
+				return fail(Error("ERR Invalid OVERFLOW type specified"))
+			}
+			i++
+			continue
+		}
+
+		op := app.BitFieldOp{Overflow: overflow}
+		switch {
+		case sub == "GET" && i+2 < len(args):
+			op.Kind = app.BITFIELD_GET
+		case sub == "SET" && i+3 < len(args):
+			op.Kind = app.BITFIELD_SET
+		case sub == "INCRBY" && i+3 < len(args):
+			op.Kind = app.BITFIELD_INCRBY
+		default:
+			return fail(ErrorReply(app.ErrSyntax))
+		}
+		var err error
+		if op.Type, err = app.ParseBitFieldType(args[i+1].Bulk); err != nil {
+			return fail(ErrorReply(err))
+		}
+		if op.Offset, err = app.ParseBitOffset(args[i+2].Bulk, op.Type.Bits); err != nil {
+			return fail(ErrorReply(err))
+		}
+		if op.Offset+uint64(op.Type.Bits)-1 > app.MAX_BIT_OFFSET {
+			return fail(ErrorReply(app.ErrBitOffset))
+		}
+		i += 2
+		if op.Kind != app.BITFIELD_GET {
+			if readOnly {
+				return fail(Error("ERR BITFIELD_RO only supports the GET subcommand"))
+			}
+			var ok bool
+			if op.Value, ok = app.ParseInt(args[i+1].Bulk); !ok {
+				return fail(ErrorReply(app.ErrNotInteger))
+			}
+			write = true
+			i++
+		}
+		ops = append(ops, op)
+	}
+	return ops, write, nil
+}
+
+// BitField reads and writes integers of arbitrary width within a string:
+// BITFIELD key [GET type offset] [SET type offset value]
+// [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL] ...
+func BitField(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return bitfieldGeneric(v, args, actions, "bitfield", false)
+}
+
+// BitFieldRO is the read only variant of BITFIELD:
+// BITFIELD_RO key [GET type offset ...]
+func BitFieldRO(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return bitfieldGeneric(v, args, actions, "bitfield_ro", true)
+}
+
+func bitfieldGeneric(v *app.Vault, args []Command, actions interfaces.ServerActions, name string, readOnly bool) Command {
+	if len(args) < 1 {
+		return WrongArgs(name)
+	}
+	ops, write, reply := parseBitField(args[1:], readOnly)
+	if reply != nil {
+		return *reply
+	}
+	results, err := v.BitField(args[0].Bulk, ops)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !write {
+		actions.PropagateAs()
+	}
+	replies := make([]Command, len(results))
+	for i, result := range results {
+		if result.Failed {
+			replies[i] = Null()
+		} else {
+			replies[i] = Integer(result.Value)
+		}
+	}
+	return Array(replies...)
+}
@@ -0,0 +1,227 @@
+package commands
+
+import (
+	"math"
+	"rednav/app"
+	"rednav/interfaces"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BLPop pops the head of the first non-empty list, blocking until one is
+// available: BLPOP key [key ...] timeout
+func BLPop(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return blpopGeneric(v, args, actions, "blpop", true)
+}
+
+// BRPop pops the tail of the first non-empty list, blocking until one is
+// available: BRPOP key [key ...] timeout
+func BRPop(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return blpopGeneric(v, args, actions, "brpop", false)
+}
+
+func blpopGeneric(v *app.Vault, args []Command, actions interfaces.ServerActions, name string, head bool) Command {
+	if len(args) < 2 {
+		return WrongArgs(name)
+	}
+	timeout, reply := parseTimeout(args[len(args)-1].Bulk)
+	if reply != nil {
+		return *reply
+	}
+	req := app.BlockRequest{
+		Keys:  bulks(args[:len(args)-1]),
+		Head:  head,
+		Count: 1,
+		Propagate: func(key string, values []string) []string {
+			return []string{popCommand(head), key}
+		},
+	}
+	result := blockGeneric(v, req, true, timeout, actions)
+	switch {
+	case result == nil:
+		return NullArray()
+	case result.Err != nil:
+		return ErrorReply(result.Err)
+	default:
+		return BulkList([]string{result.Key, result.Values[0]})
+	}
+}
+
+// BLMove moves an element between lists, blocking until the source holds
+// one: BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func BLMove(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 5 {
+		return WrongArgs("blmove")
+	}
+	fromHead, ok := parseListEnd(args[2].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrSyntax)
+	}
+	toHead, ok := parseListEnd(args[3].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrSyntax)
+	}
+	timeout, reply := parseTimeout(args[4].Bulk)
+	if reply != nil {
+		return *reply
+	}
+	return blmoveGeneric(v, args[0].Bulk, args[1].Bulk, fromHead, toHead, timeout, actions)
+}
+
+// BRPopLPush moves the tail of a list to the head of another, blocking until
+// the source holds an element: BRPOPLPUSH source destination timeout
+func BRPopLPush(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("brpoplpush")
+	}
+	timeout, reply := parseTimeout(args[2].Bulk)
+	if reply != nil {
+		return *reply
+	}
+	return blmoveGeneric(v, args[0].Bulk, args[1].Bulk, false, true, timeout, actions)
+}
+
+func blmoveGeneric(v *app.Vault, src string, dst string, fromHead bool, toHead bool, timeout time.Duration, actions interfaces.ServerActions) Command {
+	req := app.BlockRequest{
+		Keys:   []string{src},
+		Head:   fromHead,
+		Count:  1,
+		Move:   true,
+		Dst:    dst,
+		ToHead: toHead,
+		Propagate: func(key string, values []string) []string {
+			return []string{"LMOVE", src, dst, listEnd(fromHead), listEnd(toHead)}
+		},
+	}
+	result := blockGeneric(v, req, true, timeout, actions)
+	switch {
+	case result == nil:
+		return Null()
+	case result.Err != nil:
+		return ErrorReply(result.Err)
+	default:
+		return BulkString(result.Values[0])
+	}
+}
+
+// LMPop pops elements from the first non-empty list:
+// LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func LMPop(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return lmpopGeneric(v, args, actions, "lmpop", 0, false)
+}
+
+// BLMPop pops elements from the first non-empty list, blocking until one is
+// available: BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func BLMPop(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("blmpop")
+	}
+	timeout, reply := parseTimeout(args[0].Bulk)
+	if reply != nil {
+		return *reply
+	}
+	return lmpopGeneric(v, args[1:], actions, "blmpop", timeout, true)
+}
+
+func lmpopGeneric(v *app.Vault, args []Command, actions interfaces.ServerActions, name string, timeout time.Duration, block bool) Command {
+	if len(args) < 3 {
+		return WrongArgs(name)
+	}
+	numKeys, ok := app.ParseInt(args[0].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	if numKeys <= 0 {
+		return Error("ERR numkeys should be greater than 0")
+	}
+	if numKeys > int64(len(args)-2) {
+		return ErrorReply(app.ErrSyntax)
+	}
+	keys := bulks(args[1 : 1+numKeys])
+	head, ok := parseListEnd(args[1+numKeys].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrSyntax)
+	}
+	count := int64(1)
+	rest := args[2+numKeys:]
+	switch {
+	case len(rest) == 0:
+	case len(rest) == 2 && strings.ToUpper(rest[0].Bulk) == "COUNT":
+		if count, ok = app.ParseInt(rest[1].Bulk); !ok || count <= 0 {
+			return Error("ERR count should be greater than 0")
+		}
+	default:
+		return ErrorReply(app.ErrSyntax)
+	}
+	if count > math.MaxInt32 {
+		count = math.MaxInt32
+	}
+
+	req := app.BlockRequest{
+		Keys:  keys,
+		Head:  head,
+		Count: int(count),
+		Propagate: func(key string, values []string) []string {
+			return []string{popCommand(head), key, strconv.Itoa(len(values))}
+		},
+	}
+	result := blockGeneric(v, req, block, timeout, actions)
+	switch {
+	case result == nil:
+		return NullArray()
+	case result.Err != nil:
+		return ErrorReply(result.Err)
+	default:
+		return Array(BulkString(result.Key), BulkList(result.Values))
+	}
+}
+
+// blockGeneric performs req, parking the client until it can be served or
+// the timeout elapses when block is set and the connection allows it, and
+// returns nil if nothing was popped. A request served right away is
+// propagated in its non blocking form; one served while parked was
+// propagated by the client that pushed.
+func blockGeneric(v *app.Vault, req app.BlockRequest, block bool, timeout time.Duration, actions interfaces.ServerActions) *app.BlockResult {
+	result, waiter := v.BlockOn(req, block && actions.CanBlock())
+	if waiter != nil {
+		actions.Block(waiter.Ready(), timeout)
+		result = v.Unblock(waiter)
+		actions.PropagateAs()
+		return result
+	}
+	if result == nil || result.Err != nil || req.Propagate == nil {
+		actions.PropagateAs()
+		return result
+	}
+	actions.PropagateAs(req.Propagate(result.Key, result.Values)...)
+	return result
+}
+
+// parseTimeout parses the timeout of a blocking command, in seconds.
+func parseTimeout(arg string) (time.Duration, *Command) {
+	seconds, ok := app.ParseFloat(arg)
+	if !ok || seconds*1000 > math.MaxInt64/float64(time.Millisecond) {
+		reply := Error("ERR timeout is not a float or out of range")
+		return 0, &reply
+	}
+	if seconds < 0 {
+		reply := Error("ERR timeout is negative")
+		return 0, &reply
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func popCommand(head bool) string {
+	if head {
+		return "LPOP"
+	}
+	return "RPOP"
+}
+
+func listEnd(head bool) string {
+	if head {
+		return "LEFT"
+	}
+	return "RIGHT"
+}
@@ -5,13 +5,17 @@ import (
 	"rednav/interfaces"
 )
 
+// Command is both a parsed request argument (Typ "bulk") and a reply built
+// by a handler; see resp.go for the reply types.
 type Command struct {
-	Typ  string
-	Str  string
-	Bulk string
-	List []string
-	Err  string
-	Arr  []Command
+	Typ    string
+	Str    string
+	Bulk   string
+	Num    int64
+	Double float64
+	List   []string
+	Err    string
+	Arr    []Command
 }
 
 var Handlers = map[string]func(*app.Vault, []Command, interfaces.ServerActions) Command{
@@ -22,4 +26,202 @@ var Handlers = map[string]func(*app.Vault, []Command, interfaces.ServerActions)
 	"INFO":     Info,
 	"REPLCONF": ReplConf,
 	"PSYNC":    PSync,
+	"HELLO":    Hello,
+	"AUTH":     Auth,
+
+	"WATCH":   Watch,
+	"UNWATCH": Unwatch,
+
+	"SUBSCRIBE":    Subscribe,
+	"UNSUBSCRIBE":  Unsubscribe,
+	"PSUBSCRIBE":   PSubscribe,
+	"PUNSUBSCRIBE": PUnsubscribe,
+	"PUBLISH":      Publish,
+	"PUBSUB":       PubSub,
+	"SSUBSCRIBE":   SSubscribe,
+	"SUNSUBSCRIBE": SUnsubscribe,
+	"SPUBLISH":     SPublish,
+
+	"CONFIG": Config,
+
+	"SAVE":     Save,
+	"BGSAVE":   BgSave,
+	"LASTSAVE": LastSave,
+
+	"EXPIRE":      Expire,
+	"PEXPIRE":     PExpire,
+	"EXPIREAT":    ExpireAt,
+	"PEXPIREAT":   PExpireAt,
+	"TTL":         TTL,
+	"PTTL":        PTTL,
+	"EXPIRETIME":  ExpireTime,
+	"PEXPIRETIME": PExpireTime,
+	"PERSIST":     Persist,
+
+	"SETNX":  SetNX,
+	"SETEX":  SetEx,
+	"PSETEX": PSetEx,
+	"GETSET": GetSet,
+	"GETDEL": GetDel,
+	"GETEX":  GetEx,
+
+	"DEL":      Del,
+	"UNLINK":   Unlink,
+	"EXISTS":   Exists,
+	"TYPE":     Type,
+	"RENAME":   Rename,
+	"RENAMENX": RenameNX,
+	"COPY":     Copy,
+	"TOUCH":    Touch,
+
+	"KEYS": Keys,
+	"SCAN": Scan,
+
+	"INCR":        Incr,
+	"DECR":        Decr,
+	"INCRBY":      IncrBy,
+	"DECRBY":      DecrBy,
+	"INCRBYFLOAT": IncrByFloat,
+
+	"APPEND":   Append,
+	"STRLEN":   StrLen,
+	"GETRANGE": GetRange,
+	"SUBSTR":   GetRange,
+	"SETRANGE": SetRange,
+	"MGET":     MGet,
+	"MSET":     MSet,
+	"MSETNX":   MSetNX,
+	"LCS":      LCS,
+
+	"SETBIT":      SetBit,
+	"GETBIT":      GetBit,
+	"BITCOUNT":    BitCount,
+	"BITPOS":      BitPos,
+	"BITOP":       BitOp,
+	"BITFIELD":    BitField,
+	"BITFIELD_RO": BitFieldRO,
+
+	"PFADD":   PFAdd,
+	"PFCOUNT": PFCount,
+	"PFMERGE": PFMerge,
+
+	"LPUSH":     LPush,
+	"RPUSH":     RPush,
+	"LPUSHX":    LPushX,
+	"RPUSHX":    RPushX,
+	"LPOP":      LPop,
+	"RPOP":      RPop,
+	"LLEN":      LLen,
+	"LRANGE":    LRange,
+	"LINDEX":    LIndex,
+	"LPOS":      LPos,
+	"LSET":      LSet,
+	"LINSERT":   LInsert,
+	"LREM":      LRem,
+	"LTRIM":     LTrim,
+	"LMOVE":     LMove,
+	"RPOPLPUSH": RPopLPush,
+	"LMPOP":     LMPop,
+
+	"BLPOP":      BLPop,
+	"BRPOP":      BRPop,
+	"BLMOVE":     BLMove,
+	"BRPOPLPUSH": BRPopLPush,
+	"BLMPOP":     BLMPop,
+
+	"HSET":         HSet,
+	"HMSET":        HMSet,
+	"HSETNX":       HSetNX,
+	"HGET":         HGet,
+	"HMGET":        HMGet,
+	"HDEL":         HDel,
+	"HLEN":         HLen,
+	"HEXISTS":      HExists,
+	"HSTRLEN":      HStrLen,
+	"HGETALL":      HGetAll,
+	"HKEYS":        HKeys,
+	"HVALS":        HVals,
+	"HINCRBY":      HIncrBy,
+	"HINCRBYFLOAT": HIncrByFloat,
+	"HRANDFIELD":   HRandField,
+	"HSCAN":        HScan,
+	"HEXPIRE":      HExpire,
+	"HPEXPIRE":     HPExpire,
+	"HEXPIREAT":    HExpireAt,
+	"HPEXPIREAT":   HPExpireAt,
+	"HPERSIST":     HPersist,
+	"HTTL":         HTTL,
+	"HPTTL":        HPTTL,
+	"HEXPIRETIME":  HExpireTime,
+	"HPEXPIRETIME": HPExpireTime,
+
+	"SADD":        SAdd,
+	"SREM":        SRem,
+	"SCARD":       SCard,
+	"SISMEMBER":   SIsMember,
+	"SMISMEMBER":  SMIsMember,
+	"SMEMBERS":    SMembers,
+	"SPOP":        SPop,
+	"SRANDMEMBER": SRandMember,
+	"SMOVE":       SMove,
+	"SSCAN":       SScan,
+	"SINTER":      SInter,
+	"SUNION":      SUnion,
+	"SDIFF":       SDiff,
+	"SINTERSTORE": SInterStore,
+	"SUNIONSTORE": SUnionStore,
+	"SDIFFSTORE":  SDiffStore,
+	"SINTERCARD":  SInterCard,
+
+	"ZADD":             ZAdd,
+	"ZINCRBY":          ZIncrBy,
+	"ZCARD":            ZCard,
+	"ZSCORE":           ZScore,
+	"ZMSCORE":          ZMScore,
+	"ZRANK":            ZRank,
+	"ZREVRANK":         ZRevRank,
+	"ZRANGE":           ZRange,
+	"ZREVRANGE":        ZRevRange,
+	"ZRANGEBYSCORE":    ZRangeByScore,
+	"ZREVRANGEBYSCORE": ZRevRangeByScore,
+	"ZRANGEBYLEX":      ZRangeByLex,
+	"ZREVRANGEBYLEX":   ZRevRangeByLex,
+	"ZRANGESTORE":      ZRangeStore,
+	"ZREM":             ZRem,
+	"ZREMRANGEBYRANK":  ZRemRangeByRank,
+	"ZREMRANGEBYSCORE": ZRemRangeByScore,
+	"ZREMRANGEBYLEX":   ZRemRangeByLex,
+	"ZCOUNT":           ZCount,
+	"ZLEXCOUNT":        ZLexCount,
+	"ZPOPMIN":          ZPopMin,
+	"ZPOPMAX":          ZPopMax,
+	"BZPOPMIN":         BZPopMin,
+	"BZPOPMAX":         BZPopMax,
+	"ZUNION":           ZUnion,
+	"ZINTER":           ZInter,
+	"ZUNIONSTORE":      ZUnionStore,
+	"ZINTERSTORE":      ZInterStore,
+	"ZSCAN":            ZScan,
+
+	"GEOADD":         GeoAdd,
+	"GEODIST":        GeoDist,
+	"GEOPOS":         GeoPos,
+	"GEOHASH":        GeoHash,
+	"GEOSEARCH":      GeoSearch,
+	"GEOSEARCHSTORE": GeoSearchStore,
+
+	"XADD":       XAdd,
+	"XLEN":       XLen,
+	"XRANGE":     XRange,
+	"XREVRANGE":  XRevRange,
+	"XDEL":       XDel,
+	"XTRIM":      XTrim,
+	"XREAD":      XRead,
+	"XREADGROUP": XReadGroup,
+	"XGROUP":     XGroup,
+	"XACK":       XAck,
+	"XPENDING":   XPending,
+	"XCLAIM":     XClaim,
+	"XAUTOCLAIM": XAutoClaim,
+	"XINFO":      XInfo,
 }
@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"rednav/app"
+	"rednav/interfaces"
+	"strings"
+)
+
+// Config reads and changes server parameters:
+// CONFIG GET parameter [parameter ...] | SET parameter value [parameter value ...]
+func Config(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("config")
+	}
+	switch sub := strings.ToUpper(args[0].Bulk); {
+	case sub == "GET" && len(args) >= 2:
+		seen := make(map[string]bool)
+		var pairs []Command
+		for _, pattern := range args[1:] {
+			names, values := v.ConfigGet(strings.ToLower(pattern.Bulk))
+			for i, name := range names {
+				if !seen[name] {
+					seen[name] = true
+					pairs = append(pairs, BulkString(name), BulkString(values[i]))
+				}
+			}
+		}
+		return Map(pairs...)
+	case sub == "SET" && len(args) >= 3 && len(args)%2 == 1:
+		for i := 1; i < len(args); i += 2 {
+			name := strings.ToLower(args[i].Bulk)
+			exists, err := v.ConfigSet(name, args[i+1].Bulk)
+			if !exists {
+				return Errorf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", args[i].Bulk)
+			}
+			if err != nil {
+				return Errorf("ERR CONFIG SET failed (possibly related to argument '%s') - %s", name, err)
+			}
+		}
+		return OK()
+	case sub == "GET" || sub == "SET":
+		return WrongArgs("config|" + strings.ToLower(sub))
+	default:
+		return Errorf("ERR unknown subcommand '%s'. Try CONFIG HELP.", args[0].Bulk)
+	}
+}
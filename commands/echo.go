@@ -6,8 +6,8 @@ import (
 )
 
 func Echo(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
-	if len(args) == 0 {
-		return Command{Typ: "string", Str: ""}
+	if len(args) != 1 {
+		return WrongArgs("echo")
 	}
-	return Command{Typ: "string", Str: args[0].Bulk}
+	return BulkString(args[0].Bulk)
 }
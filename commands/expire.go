@@ -0,0 +1,163 @@
+package commands
+
+import (
+	"math"
+	"rednav/app"
+	"rednav/interfaces"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expire sets a key's time to live in seconds: EXPIRE key seconds [NX|XX|GT|LT]
+func Expire(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return expireGeneric(v, args, actions, "expire", time.Second, false)
+}
+
+// PExpire sets a key's time to live in milliseconds.
+func PExpire(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return expireGeneric(v, args, actions, "pexpire", time.Millisecond, false)
+}
+
+// ExpireAt sets a key's expiration as a unix time in seconds.
+func ExpireAt(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return expireGeneric(v, args, actions, "expireat", time.Second, true)
+}
+
+// PExpireAt sets a key's expiration as a unix time in milliseconds.
+func PExpireAt(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return expireGeneric(v, args, actions, "pexpireat", time.Millisecond, true)
+}
+
+// expireGeneric implements the EXPIRE family. Whatever the form used, the
+// change is propagated as PEXPIREAT so replicas compute the same deadline.
+func expireGeneric(v *app.Vault, args []Command, actions interfaces.ServerActions, name string, unit time.Duration, absolute bool) Command {
+	if len(args) < 2 {
+		return WrongArgs(name)
+	}
+	key := args[0].Bulk
+	when, err := strconv.ParseInt(args[1].Bulk, 10, 64)
+	if err != nil {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	flags, reply := parseExpireFlags(args[2:])
+	if reply != nil {
+		return *reply
+	}
+
+	invalid := Errorf("ERR invalid expire time in '%s' command", name)
+	if unit == time.Second {
+		if when > math.MaxInt64/1000 || when < math.MinInt64/1000 {
+			return invalid
+		}
+		when *= 1000
+	}
+	if !absolute {
+		now := time.Now().UnixMilli()
+		if when > math.MaxInt64-now {
+			return invalid
+		}
+		when += now
+	}
+
+	changed, deleted := v.Expire(key, time.UnixMilli(when), flags)
+	switch {
+	case changed == 0:
+		actions.PropagateAs()
+	case deleted:
+		actions.PropagateAs("DEL", key)
+	default:
+		actions.PropagateAs("PEXPIREAT", key, strconv.FormatInt(when, 10))
+	}
+	return Integer(int64(changed))
+}
+
+func parseExpireFlags(args []Command) (int, *Command) {
+	flags := 0
+	for _, arg := range args {
+		switch strings.ToUpper(arg.Bulk) {
+		case "NX":
+			flags |= app.EXPIRE_NX
+		case "XX":
+			flags |= app.EXPIRE_XX
+		case "GT":
+			flags |= app.EXPIRE_GT
+		case "LT":
+			flags |= app.EXPIRE_LT
+		default:
+			reply := Errorf("ERR Unsupported option %s", arg.Bulk)
+			return 0, &reply
+		}
+	}
+	if flags&app.EXPIRE_NX != 0 && flags&(app.EXPIRE_XX|app.EXPIRE_GT|app.EXPIRE_LT) != 0 {
+		reply := Error("ERR NX and XX, GT or LT options at the same time are not compatible")
+		return 0, &reply
+	}
+	if flags&app.EXPIRE_GT != 0 && flags&app.EXPIRE_LT != 0 {
+		reply := Error("ERR GT and LT options at the same time are not compatible")
+		return 0, &reply
+	}
+	return flags, nil
+}
+
+// TTL returns the remaining time to live of a key in seconds.
+func TTL(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return ttlGeneric(v, args, "ttl", false, false)
+}
+
+// PTTL returns the remaining time to live of a key in milliseconds.
+func PTTL(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return ttlGeneric(v, args, "pttl", true, false)
+}
+
+// ExpireTime returns the unix time in seconds at which a key expires.
+func ExpireTime(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return ttlGeneric(v, args, "expiretime", false, true)
+}
+
+// PExpireTime returns the unix time in milliseconds at which a key expires.
+func PExpireTime(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return ttlGeneric(v, args, "pexpiretime", true, true)
+}
+
+// ttlGeneric replies -2 for a missing key and -1 for a key without
+// lifetime, otherwise the remaining or absolute time in the requested unit.
+func ttlGeneric(v *app.Vault, args []Command, name string, millis bool, absolute bool) Command {
+	if len(args) != 1 {
+		return WrongArgs(name)
+	}
+	lifetime, exists := v.GetLifetime(args[0].Bulk)
+	if !exists {
+		return Integer(-2)
+	}
+	if lifetime.IsZero() {
+		return Integer(-1)
+	}
+
+	if absolute {
+		if millis {
+			return Integer(lifetime.UnixMilli())
+		}
+		return Integer(lifetime.Unix())
+	}
+	ttl := time.Until(lifetime).Milliseconds()
+	if ttl < 0 {
+		ttl = 0
+	}
+	if millis {
+		return Integer(ttl)
+	}
+	return Integer((ttl + 500) / 1000)
+}
+
+// Persist removes the time to live of a key.
+func Persist(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("persist")
+	}
+	removed := v.Persist(args[0].Bulk)
+	if removed == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(removed))
+}
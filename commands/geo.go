@@ -0,0 +1,342 @@
+package commands
+
+import (
+	"math"
+	"rednav/app"
+	"rednav/interfaces"
+	"strconv"
+	"strings"
+)
+
+// geoUnits maps the distance units of the geo commands to meters.
+var geoUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"ft": 0.3048,
+	"mi": 1609.34,
+}
+
+func parseGeoUnit(arg string) (float64, *Command) {
+	conversion, ok := geoUnits[strings.ToLower(arg)]
+	if !ok {
+		reply := Error("ERR unsupported unit provided. please use M, KM, FT, MI")
+		return 0, &reply
+	}
+	return conversion, nil
+}
+
+// parseLonLat parses a longitude and latitude pair and checks that it can
+// be indexed.
+func parseLonLat(lon string, lat string) (float64, float64, *Command) {
+	longitude, ok1 := app.ParseFloat(lon)
+	latitude, ok2 := app.ParseFloat(lat)
+	if !ok1 || !ok2 {
+		reply := Error("ERR value is not a valid float")
+		return 0, 0, &reply
+	}
+	if longitude < app.GEO_LONG_MIN || longitude > app.GEO_LONG_MAX ||
+		latitude < app.GEO_LAT_MIN || latitude > app.GEO_LAT_MAX {
+		reply := Errorf("ERR invalid longitude,latitude pair %f,%f", longitude, latitude)
+		return 0, 0, &reply
+	}
+	return longitude, latitude, nil
+}
+
+// geoDistance replies with a distance rounded to four decimal places.
+func geoDistance(d float64) Command {
+	return BulkString(strconv.FormatFloat(d, 'f', 4, 64))
+}
+
+// GeoAdd adds positions to a geo index:
+// GEOADD key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+func GeoAdd(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 4 {
+		return WrongArgs("geoadd")
+	}
+	flags := 0
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Bulk) {
+		case "NX":
+			flags |= app.ZADD_NX
+		case "XX":
+			flags |= app.ZADD_XX
+		case "CH":
+			flags |= app.ZADD_CH
+		default:
+			break options
+		}
+	}
+	rest := args[i:]
+	if len(rest) == 0 || len(rest)%3 != 0 {
+		return ErrorReply(app.ErrSyntax)
+	}
+	if flags&app.ZADD_NX != 0 && flags&app.ZADD_XX != 0 {
+		return Error("ERR XX and NX options at the same time are not compatible")
+	}
+	pairs := make([]app.ScoreMember, 0, len(rest)/3)
+	for j := 0; j < len(rest); j += 3 {
+		longitude, latitude, reply := parseLonLat(rest[j].Bulk, rest[j+1].Bulk)
+		if reply != nil {
+			return *reply
+		}
+		score, _ := app.GeoEncode(longitude, latitude)
+		pairs = append(pairs, app.ScoreMember{Member: rest[j+2].Bulk, Score: score})
+	}
+
+	n, _, performed, err := v.ZAdd(args[0].Bulk, pairs, flags)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !performed {
+		actions.PropagateAs()
+	}
+	return Integer(int64(n))
+}
+
+// GeoDist returns the distance between two members of a geo index:
+// GEODIST key member1 member2 [M|KM|FT|MI]
+func GeoDist(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 && len(args) != 4 {
+		if len(args) > 4 {
+			return ErrorReply(app.ErrSyntax)
+		}
+		return WrongArgs("geodist")
+	}
+	conversion := 1.0
+	if len(args) == 4 {
+		var reply *Command
+		if conversion, reply = parseGeoUnit(args[3].Bulk); reply != nil {
+			return *reply
+		}
+	}
+	scores, found, err := v.ZMScore(args[0].Bulk, []string{args[1].Bulk, args[2].Bulk})
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !found[0] || !found[1] {
+		return Null()
+	}
+	lon1, lat1 := app.GeoDecode(scores[0])
+	lon2, lat2 := app.GeoDecode(scores[1])
+	return geoDistance(app.GeoDistance(lon1, lat1, lon2, lat2) / conversion)
+}
+
+// GeoPos returns the positions of members of a geo index:
+// GEOPOS key [member ...]
+func GeoPos(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("geopos")
+	}
+	scores, found, err := v.ZMScore(args[0].Bulk, bulks(args[1:]))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	replies := make([]Command, len(scores))
+	for i, score := range scores {
+		if !found[i] {
+			replies[i] = NullArray()
+			continue
+		}
+		longitude, latitude := app.GeoDecode(score)
+		replies[i] = Array(HumanDouble(longitude), HumanDouble(latitude))
+	}
+	return Array(replies...)
+}
+
+// GeoHash returns the standard geohashes of members of a geo index:
+// GEOHASH key [member ...]
+func GeoHash(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("geohash")
+	}
+	scores, found, err := v.ZMScore(args[0].Bulk, bulks(args[1:]))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	replies := make([]Command, len(scores))
+	for i, score := range scores {
+		if found[i] {
+			replies[i] = BulkString(app.GeoHashString(score))
+		} else {
+			replies[i] = Null()
+		}
+	}
+	return Array(replies...)
+}
+
+// geoSearchOptions holds the parsed arguments of GEOSEARCH and
+// GEOSEARCHSTORE.
+type geoSearchOptions struct {
+	spec      app.GeoSearchSpec
+	withDist  bool
+	withHash  bool
+	withCoord bool
+	storeDist bool
+}
+
+func parseGeoSearch(args []Command, name string, store bool) (geoSearchOptions, *Command) {
+	var opts geoSearchOptions
+	fail := func(reply Command) (geoSearchOptions, *Command) {
+		return opts, &reply
+	}
+	shape := &opts.spec.Shape
+	fromLonLat, byRadius, byBox := false, false, false
+	for i := 0; i < len(args); i++ {
+		left := len(args) - i - 1
+		switch option := strings.ToUpper(args[i].Bulk); {
+		case option == "FROMMEMBER" && left >= 1:
+			if fromLonLat {
+				return fail(Errorf("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for %s", name))
+			}
+			shape.FromMember, shape.Member = true, args[i+1].Bulk
+			i++
+		case option == "FROMLONLAT" && left >= 2:
+			if shape.FromMember {
+				return fail(Errorf("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for %s", name))
+			}
+			var reply *Command
+			if shape.Longitude, shape.Latitude, reply = parseLonLat(args[i+1].Bulk, args[i+2].Bulk); reply != nil {
+				return fail(*reply)
+			}
+			fromLonLat = true
+			i += 2
+		case option == "BYRADIUS" && left >= 2:
+			if byBox {
+				return fail(Errorf("ERR exactly one of BYRADIUS and BYBOX can be specified for %s", name))
+			}
+			radius, ok := app.ParseFloat(args[i+1].Bulk)
+			if !ok {
+				return fail(Error("ERR need numeric radius"))
+			}
+			if radius < 0 {
+				return fail(Error("ERR radius cannot be negative"))
+			}
+			var reply *Command
+			if shape.Conversion, reply = parseGeoUnit(args[i+2].Bulk); reply != nil {
+				return fail(*reply)
+			}
+			shape.Radius, byRadius = radius, true
+			i += 2
+		case option == "BYBOX" && left >= 3:
+			if byRadius {
+				return fail(Errorf("ERR exactly one of BYRADIUS and BYBOX can be specified for %s", name))
+			}
+			width, ok := app.ParseFloat(args[i+1].Bulk)
+			if !ok {
+				return fail(Error("ERR need numeric width"))
+			}
+			height, ok := app.ParseFloat(args[i+2].Bulk)
+			if !ok {
+				return fail(Error("ERR need numeric height"))
+			}
+			if width < 0 || height < 0 {
+				return fail(Error("ERR height or width cannot be negative"))
+			}
+			var reply *Command
+			if shape.Conversion, reply = parseGeoUnit(args[i+3].Bulk); reply != nil {
+				return fail(*reply)
+			}
+			shape.Box, shape.Width, shape.Height, byBox = true, width, height, true
+			i += 3
+		case option == "ASC":
+			opts.spec.Sort = app.GEO_SORT_ASC
+		case option == "DESC":
+			opts.spec.Sort = app.GEO_SORT_DESC
+		case option == "COUNT" && left >= 1:
+			count, ok := app.ParseInt(args[i+1].Bulk)
+			if !ok {
+				return fail(ErrorReply(app.ErrNotInteger))
+			}
+			if count <= 0 {
+				return fail(Error("ERR COUNT must be > 0"))
+			}
+			opts.spec.Count = int(min(count, math.MaxInt32))
+			i++
+			if i+1 < len(args) && strings.ToUpper(args[i+1].Bulk) == "ANY" {
+				opts.spec.Any = true
+				i++
+			}
+		case option == "ANY":
+			return fail(Error("ERR the ANY argument requires COUNT argument"))
+		case option == "WITHDIST":
+			opts.withDist = true
+		case option == "WITHHASH":
+			opts.withHash = true
+		case option == "WITHCOORD":
+			opts.withCoord = true
+		case option == "STOREDIST" && store:
+			opts.storeDist = true
+		default:
+			return fail(ErrorReply(app.ErrSyntax))
+		}
+	}
+	if shape.FromMember == fromLonLat {
+		return fail(Errorf("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for %s", name))
+	}
+	if byRadius == byBox {
+		return fail(Errorf("ERR exactly one of BYRADIUS and BYBOX can be specified for %s", name))
+	}
+	if store && (opts.withDist || opts.withHash || opts.withCoord) {
+		return fail(Errorf("ERR %s is not compatible with WITHDIST, WITHHASH and WITHCOORD options", name))
+	}
+	return opts, nil
+}
+
+// GeoSearch returns the members of a geo index within a radius or a box:
+// GEOSEARCH key FROMMEMBER member|FROMLONLAT longitude latitude
+// BYRADIUS radius M|KM|FT|MI|BYBOX width height M|KM|FT|MI
+// [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func GeoSearch(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 6 {
+		return WrongArgs("geosearch")
+	}
+	opts, reply := parseGeoSearch(args[1:], "GEOSEARCH", false)
+	if reply != nil {
+		return *reply
+	}
+	points, err := v.GeoSearch(args[0].Bulk, opts.spec)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	replies := make([]Command, len(points))
+	for i, p := range points {
+		if !opts.withDist && !opts.withHash && !opts.withCoord {
+			replies[i] = BulkString(p.Member)
+			continue
+		}
+		point := []Command{BulkString(p.Member)}
+		if opts.withDist {
+			point = append(point, geoDistance(p.Dist))
+		}
+		if opts.withHash {
+			point = append(point, Integer(int64(p.Score)))
+		}
+		if opts.withCoord {
+			point = append(point, Array(HumanDouble(p.Longitude), HumanDouble(p.Latitude)))
+		}
+		replies[i] = Array(point...)
+	}
+	return Array(replies...)
+}
+
+// GeoSearchStore stores the members of a geo index within a radius or a box
+// in a sorted set, scored by geohash or by distance:
+// GEOSEARCHSTORE destination source FROMMEMBER member|FROMLONLAT longitude latitude
+// BYRADIUS radius M|KM|FT|MI|BYBOX width height M|KM|FT|MI
+// [ASC|DESC] [COUNT count [ANY]] [STOREDIST]
+func GeoSearchStore(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 7 {
+		return WrongArgs("geosearchstore")
+	}
+	opts, reply := parseGeoSearch(args[2:], "GEOSEARCHSTORE", true)
+	if reply != nil {
+		return *reply
+	}
+	n, err := v.GeoSearchStore(args[0].Bulk, args[1].Bulk, opts.spec, opts.storeDist)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
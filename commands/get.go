@@ -3,20 +3,89 @@ package commands
 import (
 	"rednav/app"
 	"rednav/interfaces"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func Get(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
-	if len(args) < 1 {
-		return Command{Typ: "error", Err: "ERR wrong number of arguments for 'get' command"}
+	if len(args) != 1 {
+		return WrongArgs("get")
 	}
 	key := args[0].Bulk
 
-	// Retrieve the value from the vault, interfaced return as string.
-	value := v.GetMemory(key)
+	// Retrieve the value from the vault.
+	value, exists, err := v.GetString(key)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !exists {
+		return Null()
+	}
+
+	return BulkString(value)
+}
 
-	if value == nil {
-		return Command{Typ: "nil"}
+// GetDel returns the value of a key and deletes it: GETDEL key
+func GetDel(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("getdel")
 	}
+	value, exists, err := v.GetDel(args[0].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !exists {
+		actions.PropagateAs()
+		return Null()
+	}
+	actions.PropagateAs("DEL", args[0].Bulk)
+	return BulkString(value)
+}
 
-	return Command{Typ: "string", Str: value.(string)}
+// GetEx returns the value of a key and optionally changes its expiration:
+// GETEX key [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|PERSIST]
+func GetEx(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("getex")
+	}
+	key := args[0].Bulk
+
+	var lifetime time.Time
+	change := false
+	for i := 1; i < len(args); i++ {
+		option := strings.ToUpper(args[i].Bulk)
+		switch {
+		case option == "PERSIST" && !change:
+			change = true
+		case (option == "EX" || option == "PX" || option == "EXAT" || option == "PXAT") && !change && i+1 < len(args):
+			i++
+			var reply *Command
+			if lifetime, reply = parseExpireTime(args[i].Bulk, option, "getex"); reply != nil {
+				return *reply
+			}
+			change = true
+		default:
+			return ErrorReply(app.ErrSyntax)
+		}
+	}
+
+	value, exists, deleted, err := v.GetEx(key, lifetime, change)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	switch {
+	case !exists || !change:
+		actions.PropagateAs()
+	case deleted:
+		actions.PropagateAs("DEL", key)
+	case lifetime.IsZero():
+		actions.PropagateAs("PERSIST", key)
+	default:
+		actions.PropagateAs("PEXPIREAT", key, strconv.FormatInt(lifetime.UnixMilli(), 10))
+	}
+	if !exists {
+		return Null()
+	}
+	return BulkString(value)
 }
@@ -0,0 +1,501 @@
+package commands
+
+import (
+	"math"
+	"rednav/app"
+	"rednav/interfaces"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HSet sets fields of a hash: HSET key field value [field value ...]
+func HSet(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return WrongArgs("hset")
+	}
+	added, err := v.HSet(args[0].Bulk, bulks(args[1:]), false)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(added))
+}
+
+// HMSet sets fields of a hash: HMSET key field value [field value ...]
+func HMSet(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return WrongArgs("hmset")
+	}
+	if _, err := v.HSet(args[0].Bulk, bulks(args[1:]), false); err != nil {
+		return ErrorReply(err)
+	}
+	return OK()
+}
+
+// HSetNX sets a field of a hash unless it exists: HSETNX key field value
+func HSetNX(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("hsetnx")
+	}
+	added, err := v.HSet(args[0].Bulk, bulks(args[1:]), true)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if added == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(added))
+}
+
+// HGet returns the value of a field: HGET key field
+func HGet(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("hget")
+	}
+	value, exists, err := v.HGet(args[0].Bulk, args[1].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !exists {
+		return Null()
+	}
+	return BulkString(value)
+}
+
+// HMGet returns the values of several fields: HMGET key field [field ...]
+func HMGet(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("hmget")
+	}
+	values, found, err := v.HMGet(args[0].Bulk, bulks(args[1:]))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	replies := make([]Command, len(values))
+	for i, value := range values {
+		if found[i] {
+			replies[i] = BulkString(value)
+		} else {
+			replies[i] = Null()
+		}
+	}
+	return Array(replies...)
+}
+
+// HDel removes fields of a hash: HDEL key field [field ...]
+func HDel(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("hdel")
+	}
+	removed, err := v.HDel(args[0].Bulk, bulks(args[1:]))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if removed == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(removed))
+}
+
+// HLen returns the number of fields of a hash: HLEN key
+func HLen(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("hlen")
+	}
+	n, err := v.HLen(args[0].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
+
+// HExists reports whether a field exists: HEXISTS key field
+func HExists(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("hexists")
+	}
+	_, exists, err := v.HGet(args[0].Bulk, args[1].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if exists {
+		return Integer(1)
+	}
+	return Integer(0)
+}
+
+// HStrLen returns the length of the value of a field: HSTRLEN key field
+func HStrLen(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("hstrlen")
+	}
+	value, _, err := v.HGet(args[0].Bulk, args[1].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(len(value)))
+}
+
+// HGetAll returns all fields and values of a hash: HGETALL key
+func HGetAll(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("hgetall")
+	}
+	fields, values, err := v.HGetAll(args[0].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	pairs := make([]Command, 0, 2*len(fields))
+	for i := range fields {
+		pairs = append(pairs, BulkString(fields[i]), BulkString(values[i]))
+	}
+	return Map(pairs...)
+}
+
+// HKeys returns all fields of a hash: HKEYS key
+func HKeys(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("hkeys")
+	}
+	fields, _, err := v.HGetAll(args[0].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return BulkList(fields)
+}
+
+// HVals returns all values of a hash: HVALS key
+func HVals(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("hvals")
+	}
+	_, values, err := v.HGetAll(args[0].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return BulkList(values)
+}
+
+// HIncrBy increments the integer value of a field: HINCRBY key field increment
+func HIncrBy(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("hincrby")
+	}
+	delta, ok := app.ParseInt(args[2].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	n, err := v.HIncrBy(args[0].Bulk, args[1].Bulk, delta)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(n)
+}
+
+// HIncrByFloat increments the numeric value of a field by a floating point
+// value: HINCRBYFLOAT key field increment. Like INCRBYFLOAT it is propagated
+// as the resulting value.
+func HIncrByFloat(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("hincrbyfloat")
+	}
+	delta, ok := app.ParseFloat(args[2].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotFloat)
+	}
+	value, err := v.HIncrByFloat(args[0].Bulk, args[1].Bulk, delta)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	actions.PropagateAs("HSET", args[0].Bulk, args[1].Bulk, value)
+	return BulkString(value)
+}
+
+// HRandField returns random fields of a hash:
+// HRANDFIELD key [count [WITHVALUES]]
+func HRandField(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 || len(args) > 3 {
+		return WrongArgs("hrandfield")
+	}
+	if len(args) == 1 {
+		fields, _, err := v.HRandField(args[0].Bulk, 1)
+		if err != nil {
+			return ErrorReply(err)
+		}
+		if len(fields) == 0 {
+			return Null()
+		}
+		return BulkString(fields[0])
+	}
+
+	count, ok := app.ParseInt(args[1].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	withValues := false
+	if len(args) == 3 {
+		if strings.ToUpper(args[2].Bulk) != "WITHVALUES" {
+			return ErrorReply(app.ErrSyntax)
+		}
+		withValues = true
+	}
+	if count < -math.MaxInt64/2 || (withValues && count < -math.MaxInt64/4) {
+		return Error("ERR value is out of range")
+	}
+	fields, values, err := v.HRandField(args[0].Bulk, count)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !withValues {
+		return BulkList(fields)
+	}
+	return fieldValuePairs(fields, values, actions.Protocol())
+}
+
+// fieldValuePairs replies field value pairs as a flat array to RESP2
+// clients and as an array of two element arrays to RESP3 ones.
+func fieldValuePairs(fields []string, values []string, proto int) Command {
+	replies := make([]Command, 0, 2*len(fields))
+	for i := range fields {
+		if proto == RESP3 {
+			replies = append(replies, BulkList([]string{fields[i], values[i]}))
+		} else {
+			replies = append(replies, BulkString(fields[i]), BulkString(values[i]))
+		}
+	}
+	return Array(replies...)
+}
+
+// HScan incrementally iterates the fields of a hash:
+// HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+func HScan(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("hscan")
+	}
+	cursor, err := strconv.ParseUint(args[1].Bulk, 10, 64)
+	if err != nil {
+		return Error("ERR invalid cursor")
+	}
+	noValues := false
+	options := args[2:]
+	if len(options)%2 == 1 && strings.ToUpper(options[len(options)-1].Bulk) == "NOVALUES" {
+		noValues = true
+		options = options[:len(options)-1]
+	}
+	opts, reply := parseScanOptions(options, false)
+	if reply != nil {
+		return *reply
+	}
+
+	next, fields, values, err := v.HScan(args[0].Bulk, cursor, opts.count, opts.pattern)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	items := make([]string, 0, 2*len(fields))
+	for i := range fields {
+		items = append(items, fields[i])
+		if !noValues {
+			items = append(items, values[i])
+		}
+	}
+	return Array(BulkString(strconv.FormatUint(next, 10)), BulkList(items))
+}
+
+// HExpire sets the time to live of hash fields in seconds:
+// HEXPIRE key seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+func HExpire(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return hexpireGeneric(v, args, actions, "hexpire", time.Second, false)
+}
+
+// HPExpire sets the time to live of hash fields in milliseconds.
+func HPExpire(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return hexpireGeneric(v, args, actions, "hpexpire", time.Millisecond, false)
+}
+
+// HExpireAt sets the expiration of hash fields as a unix time in seconds.
+func HExpireAt(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return hexpireGeneric(v, args, actions, "hexpireat", time.Second, true)
+}
+
+// HPExpireAt sets the expiration of hash fields as a unix time in
+// milliseconds.
+func HPExpireAt(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return hexpireGeneric(v, args, actions, "hpexpireat", time.Millisecond, true)
+}
+
+// HASH_MAX_EXPIRE is the largest expiration accepted for hash fields, in
+// milliseconds.
+const HASH_MAX_EXPIRE = 1 << 48
+
+// hexpireGeneric implements the HEXPIRE family, propagated as HPEXPIREAT
+// like the key level commands.
+func hexpireGeneric(v *app.Vault, args []Command, actions interfaces.ServerActions, name string, unit time.Duration, absolute bool) Command {
+	if len(args) < 5 {
+		return WrongArgs(name)
+	}
+	key := args[0].Bulk
+	when, ok := app.ParseInt(args[1].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	fieldsAt := 2
+	var flagArgs []Command
+	if strings.ToUpper(args[2].Bulk) != "FIELDS" {
+		flagArgs = args[2:3]
+		fieldsAt = 3
+	}
+	flags, reply := parseExpireFlags(flagArgs)
+	if reply != nil {
+		return *reply
+	}
+	fields, reply := parseFields(args[fieldsAt:])
+	if reply != nil {
+		return *reply
+	}
+
+	invalid := Error("ERR invalid expire time, must be >= 0 && <= 2^48")
+	if when < 0 || when > HASH_MAX_EXPIRE {
+		return invalid
+	}
+	if unit == time.Second {
+		when *= 1000
+	}
+	if !absolute {
+		when += time.Now().UnixMilli()
+	}
+	if when > HASH_MAX_EXPIRE {
+		return invalid
+	}
+
+	results, err := v.HExpire(key, time.UnixMilli(when), flags, fields)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	changed := false
+	for _, result := range results {
+		changed = changed || result == app.HFIELD_UPDATED || result == app.HFIELD_DELETED
+	}
+	if changed {
+		propagated := []string{"HPEXPIREAT", key, strconv.FormatInt(when, 10)}
+		actions.PropagateAs(append(propagated, bulks(args[2:])...)...)
+	} else {
+		actions.PropagateAs()
+	}
+	return fieldResults(results, len(fields))
+}
+
+// parseFields parses the FIELDS numfields field [field ...] argument of the
+// per field expiration commands.
+func parseFields(args []Command) ([]string, *Command) {
+	if len(args) < 2 || strings.ToUpper(args[0].Bulk) != "FIELDS" {
+		reply := Error("ERR Mandatory argument FIELDS is missing or not at the right position")
+		return nil, &reply
+	}
+	n, ok := app.ParseInt(args[1].Bulk)
+	if !ok || n <= 0 {
+		reply := Error("ERR Parameter `numFields` should be greater than 0")
+		return nil, &reply
+	}
+	if n != int64(len(args)-2) {
+		reply := Error("ERR The `numfields` parameter must match the number of arguments")
+		return nil, &reply
+	}
+	return bulks(args[2:]), nil
+}
+
+// fieldResults replies one integer per field, or -2 for every field when
+// the key does not exist.
+func fieldResults(results []int, n int) Command {
+	replies := make([]Command, n)
+	for i := range replies {
+		if results == nil {
+			replies[i] = Integer(app.HFIELD_MISSING)
+		} else {
+			replies[i] = Integer(int64(results[i]))
+		}
+	}
+	return Array(replies...)
+}
+
+// HPersist removes the expiration of hash fields:
+// HPERSIST key FIELDS numfields field [field ...]
+func HPersist(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 4 {
+		return WrongArgs("hpersist")
+	}
+	fields, reply := parseFields(args[1:])
+	if reply != nil {
+		return *reply
+	}
+	results, err := v.HPersist(args[0].Bulk, fields)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return fieldResults(results, len(fields))
+}
+
+// HTTL returns the remaining time to live of hash fields in seconds:
+// HTTL key FIELDS numfields field [field ...]
+func HTTL(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return httlGeneric(v, args, "httl", false, false)
+}
+
+// HPTTL returns the remaining time to live of hash fields in milliseconds.
+func HPTTL(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return httlGeneric(v, args, "hpttl", true, false)
+}
+
+// HExpireTime returns the unix time in seconds at which hash fields expire.
+func HExpireTime(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return httlGeneric(v, args, "hexpiretime", false, true)
+}
+
+// HPExpireTime returns the unix time in milliseconds at which hash fields
+// expire.
+func HPExpireTime(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return httlGeneric(v, args, "hpexpiretime", true, true)
+}
+
+// httlGeneric replies, for each field, -2 if it is missing, -1 if it has no
+// expiration and otherwise the remaining or absolute time in the requested
+// unit.
+func httlGeneric(v *app.Vault, args []Command, name string, millis bool, absolute bool) Command {
+	if len(args) < 4 {
+		return WrongArgs(name)
+	}
+	fields, reply := parseFields(args[1:])
+	if reply != nil {
+		return *reply
+	}
+	lifetimes, found, err := v.HLifetimes(args[0].Bulk, fields)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if lifetimes == nil {
+		return fieldResults(nil, len(fields))
+	}
+
+	results := make([]int, len(fields))
+	for i, lifetime := range lifetimes {
+		switch {
+		case !found[i]:
+			results[i] = app.HFIELD_MISSING
+		case lifetime.IsZero():
+			results[i] = app.HFIELD_NO_TTL
+		case absolute && millis:
+			results[i] = int(lifetime.UnixMilli())
+		case absolute:
+			results[i] = int(lifetime.Unix())
+		default:
+			ttl := time.Until(lifetime).Milliseconds()
+			if ttl < 0 {
+				ttl = 0
+			}
+			if !millis {
+				ttl = (ttl + 500) / 1000
+			}
+			results[i] = int(ttl)
+		}
+	}
+	return fieldResults(results, len(fields))
+}
@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"rednav/app"
+	"testing"
+)
+
+func TestHashFieldsArgument(t *testing.T) {
+	v := app.NewVault(app.NewConfig("localhost", 0, "", 0))
+	defer v.Close()
+	dispatch(t, v, "HSET", "h", "f", "v")
+
+	numFields := "-ERR Parameter `numFields` should be greater than 0\r\n"
+	for _, c := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"HEXPIRE", "h", "10", "FIELDS", "0", "f"}, numFields},
+		{[]string{"HEXPIRE", "h", "10", "FIELDS", "-1", "f"}, numFields},
+		{[]string{"HPERSIST", "h", "FIELDS", "0", "f"}, numFields},
+		{[]string{"HPERSIST", "h", "FIELDS", "1"}, "-ERR wrong number of arguments for 'hpersist' command\r\n"},
+		{[]string{"HTTL", "h", "FIELDS", "x", "f"}, numFields},
+		{[]string{"HEXPIRE", "h", "10", "FIELDS", "2", "f"}, "-ERR The `numfields` parameter must match the number of arguments\r\n"},
+		{[]string{"HEXPIRE", "h", "10", "NX", "f", "1"}, "-ERR Mandatory argument FIELDS is missing or not at the right position\r\n"},
+		{[]string{"HEXPIRE", "h", "10", "FIELDS", "1", "f"}, "*1\r\n:1\r\n"},
+	} {
+		if got := dispatch(t, v, c.args...); got != c.want {
+			t.Errorf("%q = %q, want %q", c.args, got, c.want)
+		}
+	}
+}
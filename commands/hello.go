@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"rednav/app"
+	"rednav/interfaces"
+	"strconv"
+	"strings"
+)
+
+const (
+	wrongPass = "WRONGPASS invalid username-password pair or user is disabled."
+	noAuth    = "NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time"
+)
+
+// Hello negotiates the protocol version of the connection and reports
+// information about the server:
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+func Hello(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	proto := actions.Protocol()
+	if len(args) > 0 {
+		ver, err := strconv.Atoi(args[0].Bulk)
+		if err != nil {
+			return Error("ERR Protocol version is not an integer or out of range")
+		}
+		if ver != RESP2 && ver != RESP3 {
+			return Error("NOPROTO unsupported protocol version")
+		}
+		proto = ver
+	}
+
+	var user, pass, name string
+	var hasAuth, hasName bool
+	for i := 1; i < len(args); i++ {
+		option := strings.ToUpper(args[i].Bulk)
+		switch {
+		case option == "AUTH" && i+2 < len(args):
+			user, pass = args[i+1].Bulk, args[i+2].Bulk
+			hasAuth = true
+			i += 2
+		case option == "SETNAME" && i+1 < len(args):
+			name = args[i+1].Bulk
+			hasName = true
+			i++
+		default:
+			return Errorf("ERR Syntax error in HELLO option '%s'", args[i].Bulk)
+		}
+	}
+
+	if hasAuth {
+		if !checkPassword(v, user, pass) {
+			return Error(wrongPass)
+		}
+		actions.SetAuthenticated(true)
+	}
+	if !actions.Authenticated() {
+		return Error(noAuth)
+	}
+	if hasName {
+		if !validClientName(name) {
+			return Error("ERR Client names cannot contain spaces, newlines or special characters.")
+		}
+		actions.SetName(name)
+	}
+
+	actions.SetProtocol(proto)
+	return Map(
+		BulkString("server"), BulkString(app.SERVER_NAME),
+		BulkString("version"), BulkString(app.VERSION),
+		BulkString("proto"), Integer(int64(proto)),
+		BulkString("id"), Integer(actions.ClientID()),
+		BulkString("mode"), BulkString("standalone"),
+		BulkString("role"), BulkString(v.Role()),
+		BulkString("modules"), Array(),
+	)
+}
+
+// Auth authenticates the connection: AUTH [username] password
+func Auth(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	var user, pass string
+	switch len(args) {
+	case 1:
+		if v.GetConfig().RequirePass == "" {
+			return Error("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		}
+		user, pass = "default", args[0].Bulk
+	case 2:
+		user, pass = args[0].Bulk, args[1].Bulk
+	default:
+		return WrongArgs("auth")
+	}
+
+	if !checkPassword(v, user, pass) {
+		return Error(wrongPass)
+	}
+	actions.SetAuthenticated(true)
+	return OK()
+}
+
+// checkPassword validates credentials against the single default user. With
+// no requirepass configured the default user accepts any password.
+func checkPassword(v *app.Vault, user string, pass string) bool {
+	if user != "default" {
+		return false
+	}
+	requirepass := v.GetConfig().RequirePass
+	return requirepass == "" || pass == requirepass
+}
+
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"rednav/app"
+	"rednav/interfaces"
+)
+
+// PFAdd adds elements to a HyperLogLog: PFADD key [element ...]
+func PFAdd(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("pfadd")
+	}
+	changed, err := v.PFAdd(args[0].Bulk, bulks(args[1:]))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !changed {
+		actions.PropagateAs()
+	}
+	return boolInteger(changed)
+}
+
+// PFCount estimates the number of distinct elements added to HyperLogLogs:
+// PFCOUNT key [key ...]
+func PFCount(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("pfcount")
+	}
+	n, err := v.PFCount(bulks(args))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
+
+// PFMerge stores the union of HyperLogLogs: PFMERGE destkey [sourcekey ...]
+func PFMerge(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("pfmerge")
+	}
+	if err := v.PFMerge(args[0].Bulk, bulks(args[1:])); err != nil {
+		return ErrorReply(err)
+	}
+	return OK()
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"math"
+	"rednav/app"
+	"rednav/interfaces"
+)
+
+// Incr increments the integer stored at a key by one: INCR key
+func Incr(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("incr")
+	}
+	return incrGeneric(v, args[0].Bulk, 1)
+}
+
+// Decr decrements the integer stored at a key by one: DECR key
+func Decr(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("decr")
+	}
+	return incrGeneric(v, args[0].Bulk, -1)
+}
+
+// IncrBy increments the integer stored at a key: INCRBY key increment
+func IncrBy(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("incrby")
+	}
+	delta, ok := app.ParseInt(args[1].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	return incrGeneric(v, args[0].Bulk, delta)
+}
+
+// DecrBy decrements the integer stored at a key: DECRBY key decrement
+func DecrBy(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("decrby")
+	}
+	delta, ok := app.ParseInt(args[1].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	if delta == math.MinInt64 {
+		return Error("ERR decrement would overflow")
+	}
+	return incrGeneric(v, args[0].Bulk, -delta)
+}
+
+func incrGeneric(v *app.Vault, key string, delta int64) Command {
+	n, err := v.IncrBy(key, delta)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(n)
+}
+
+// IncrByFloat increments the number stored at a key by a floating point
+// value: INCRBYFLOAT key increment. It is propagated as a SET of the result
+// so replicas do not accumulate rounding differences.
+func IncrByFloat(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("incrbyfloat")
+	}
+	delta, ok := app.ParseFloat(args[1].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotFloat)
+	}
+	value, err := v.IncrByFloat(args[0].Bulk, delta)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	actions.PropagateAs("SET", args[0].Bulk, value, "KEEPTTL")
+	return BulkString(value)
+}
@@ -3,9 +3,13 @@ package commands
 import (
 	"rednav/app"
 	"rednav/interfaces"
+	"strings"
 )
 
 func Info(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
-	//return role of the server
-	return Command{Typ: "string", Str: v.GetInfo()}
+	section := ""
+	if len(args) > 0 {
+		section = strings.ToLower(args[0].Bulk)
+	}
+	return BulkString(v.GetInfo(section))
 }
@@ -0,0 +1,123 @@
+package commands
+
+import (
+	"rednav/app"
+	"rednav/interfaces"
+	"strings"
+)
+
+// bulks returns the values of a slice of arguments.
+func bulks(args []Command) []string {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = arg.Bulk
+	}
+	return values
+}
+
+// Del removes keys: DEL key [key ...]
+func Del(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("del")
+	}
+	deleted := v.Delete(bulks(args))
+	if deleted == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(deleted))
+}
+
+// Unlink removes keys, releasing large values in the background:
+// UNLINK key [key ...]
+func Unlink(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("unlink")
+	}
+	deleted := v.Unlink(bulks(args))
+	if deleted == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(deleted))
+}
+
+// Exists counts how many of the keys exist: EXISTS key [key ...]
+func Exists(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("exists")
+	}
+	return Integer(int64(v.CountExisting(bulks(args))))
+}
+
+// Touch counts how many of the keys exist: TOUCH key [key ...]
+func Touch(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("touch")
+	}
+	return Integer(int64(v.CountExisting(bulks(args))))
+}
+
+// Type returns the type of the value stored at a key: TYPE key
+func Type(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("type")
+	}
+	return SimpleString(v.GetType(args[0].Bulk))
+}
+
+// Rename renames a key, overwriting the destination: RENAME key newkey
+func Rename(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("rename")
+	}
+	if _, err := v.Rename(args[0].Bulk, args[1].Bulk, false); err != nil {
+		return ErrorReply(err)
+	}
+	return OK()
+}
+
+// RenameNX renames a key only if the destination does not exist:
+// RENAMENX key newkey
+func RenameNX(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("renamenx")
+	}
+	renamed, err := v.Rename(args[0].Bulk, args[1].Bulk, true)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if renamed == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(renamed))
+}
+
+// Copy copies the value of a key: COPY source destination [DB destination-db] [REPLACE]
+func Copy(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("copy")
+	}
+	replace := false
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i].Bulk); {
+		case option == "REPLACE":
+			replace = true
+		case option == "DB" && i+1 < len(args):
+			// There is a single database.
+			i++
+			if args[i].Bulk != "0" {
+				return Error("ERR DB index is out of range")
+			}
+		default:
+			return ErrorReply(app.ErrSyntax)
+		}
+	}
+
+	copied, err := v.Copy(args[0].Bulk, args[1].Bulk, replace)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if copied == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(copied))
+}
@@ -0,0 +1,334 @@
+package commands
+
+import (
+	"math"
+	"rednav/app"
+	"rednav/interfaces"
+	"strings"
+)
+
+// LPush prepends values to a list: LPUSH key element [element ...]
+func LPush(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return pushGeneric(v, args, actions, "lpush", true, false)
+}
+
+// RPush appends values to a list: RPUSH key element [element ...]
+func RPush(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return pushGeneric(v, args, actions, "rpush", false, false)
+}
+
+// LPushX prepends values to an existing list: LPUSHX key element [element ...]
+func LPushX(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return pushGeneric(v, args, actions, "lpushx", true, true)
+}
+
+// RPushX appends values to an existing list: RPUSHX key element [element ...]
+func RPushX(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return pushGeneric(v, args, actions, "rpushx", false, true)
+}
+
+func pushGeneric(v *app.Vault, args []Command, actions interfaces.ServerActions, name string, head bool, xx bool) Command {
+	if len(args) < 2 {
+		return WrongArgs(name)
+	}
+	n, err := v.Push(args[0].Bulk, bulks(args[1:]), head, xx)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if n == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(n))
+}
+
+// LPop removes and returns elements from the head of a list: LPOP key [count]
+func LPop(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return popGeneric(v, args, actions, "lpop", true)
+}
+
+// RPop removes and returns elements from the tail of a list: RPOP key [count]
+func RPop(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return popGeneric(v, args, actions, "rpop", false)
+}
+
+func popGeneric(v *app.Vault, args []Command, actions interfaces.ServerActions, name string, head bool) Command {
+	if len(args) < 1 || len(args) > 2 {
+		return WrongArgs(name)
+	}
+	count := int64(1)
+	if len(args) == 2 {
+		var reply *Command
+		if count, reply = parsePositiveCount(args[1].Bulk); reply != nil {
+			return *reply
+		}
+	}
+
+	values, exists, err := v.Pop(args[0].Bulk, int(count), head)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if len(values) == 0 {
+		actions.PropagateAs()
+	}
+	switch {
+	case len(args) == 2 && !exists:
+		return NullArray()
+	case len(args) == 2:
+		return BulkList(values)
+	case !exists:
+		return Null()
+	default:
+		return BulkString(values[0])
+	}
+}
+
+// parsePositiveCount parses the count argument of the pop commands.
+func parsePositiveCount(arg string) (int64, *Command) {
+	count, ok := app.ParseInt(arg)
+	if !ok || count < 0 {
+		reply := Error("ERR value is out of range, must be positive")
+		return 0, &reply
+	}
+	return count, nil
+}
+
+// LLen returns the length of a list: LLEN key
+func LLen(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("llen")
+	}
+	n, err := v.LLen(args[0].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
+
+// LRange returns a range of elements of a list: LRANGE key start stop
+func LRange(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("lrange")
+	}
+	start, ok := app.ParseInt(args[1].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	stop, ok := app.ParseInt(args[2].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	values, err := v.LRange(args[0].Bulk, start, stop)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return BulkList(values)
+}
+
+// LIndex returns an element of a list by its index: LINDEX key index
+func LIndex(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("lindex")
+	}
+	index, ok := app.ParseInt(args[1].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	value, found, err := v.LIndex(args[0].Bulk, index)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !found {
+		return Null()
+	}
+	return BulkString(value)
+}
+
+// LPos returns the index of matching elements of a list:
+// LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+//
+// Without COUNT the first match is returned, or nil; with COUNT an array of
+// matches, 0 meaning all of them.
+func LPos(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("lpos")
+	}
+	rank, count, maxlen := int64(1), int64(0), int64(0)
+	withCount := false
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return ErrorReply(app.ErrSyntax)
+		}
+		n, ok := app.ParseInt(args[i+1].Bulk)
+		if !ok {
+			return ErrorReply(app.ErrNotInteger)
+		}
+		switch strings.ToUpper(args[i].Bulk) {
+		case "RANK":
+			if n == 0 {
+				return Error("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			if n == math.MinInt64 {
+				return Error("ERR value is out of range, value must between -9223372036854775807 and 9223372036854775807")
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return Error("ERR COUNT can't be negative")
+			}
+			count, withCount = n, true
+		case "MAXLEN":
+			if n < 0 {
+				return Error("ERR MAXLEN can't be negative")
+			}
+			maxlen = n
+		default:
+			return ErrorReply(app.ErrSyntax)
+		}
+	}
+	if !withCount {
+		count = 1
+	}
+	positions, err := v.LPos(args[0].Bulk, args[1].Bulk, rank, count, maxlen)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !withCount {
+		if len(positions) == 0 {
+			return Null()
+		}
+		return Integer(int64(positions[0]))
+	}
+	replies := make([]Command, len(positions))
+	for i, position := range positions {
+		replies[i] = Integer(int64(position))
+	}
+	return Array(replies...)
+}
+
+// LSet replaces an element of a list by its index: LSET key index element
+func LSet(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("lset")
+	}
+	index, ok := app.ParseInt(args[1].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	if err := v.LSet(args[0].Bulk, index, args[2].Bulk); err != nil {
+		return ErrorReply(err)
+	}
+	return OK()
+}
+
+// LInsert inserts an element next to another one:
+// LINSERT key BEFORE|AFTER pivot element
+func LInsert(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 4 {
+		return WrongArgs("linsert")
+	}
+	var before bool
+	switch strings.ToUpper(args[1].Bulk) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+		before = false
+	default:
+		return ErrorReply(app.ErrSyntax)
+	}
+	n, err := v.LInsert(args[0].Bulk, before, args[2].Bulk, args[3].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if n <= 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(n))
+}
+
+// LRem removes occurrences of an element from a list: LREM key count element
+func LRem(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("lrem")
+	}
+	count, ok := app.ParseInt(args[1].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	n, err := v.LRem(args[0].Bulk, count, args[2].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if n == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(n))
+}
+
+// LTrim trims a list to a range of elements: LTRIM key start stop
+func LTrim(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("ltrim")
+	}
+	start, ok := app.ParseInt(args[1].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	stop, ok := app.ParseInt(args[2].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	if err := v.LTrim(args[0].Bulk, start, stop); err != nil {
+		return ErrorReply(err)
+	}
+	return OK()
+}
+
+// LMove moves an element between lists:
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func LMove(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 4 {
+		return WrongArgs("lmove")
+	}
+	fromHead, ok := parseListEnd(args[2].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrSyntax)
+	}
+	toHead, ok := parseListEnd(args[3].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrSyntax)
+	}
+	return lmoveGeneric(v, args[0].Bulk, args[1].Bulk, fromHead, toHead, actions)
+}
+
+// RPopLPush moves the tail of a list to the head of another:
+// RPOPLPUSH source destination
+func RPopLPush(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("rpoplpush")
+	}
+	return lmoveGeneric(v, args[0].Bulk, args[1].Bulk, false, true, actions)
+}
+
+func lmoveGeneric(v *app.Vault, src string, dst string, fromHead bool, toHead bool, actions interfaces.ServerActions) Command {
+	value, moved, err := v.LMove(src, dst, fromHead, toHead)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !moved {
+		actions.PropagateAs()
+		return Null()
+	}
+	return BulkString(value)
+}
+
+// parseListEnd parses LEFT or RIGHT, reporting whether it means the head.
+func parseListEnd(arg string) (bool, bool) {
+	switch strings.ToUpper(arg) {
+	case "LEFT":
+		return true, true
+	case "RIGHT":
+		return false, true
+	default:
+		return false, false
+	}
+}
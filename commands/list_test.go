@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"rednav/app"
+	"rednav/interfaces"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testActions stands for a plain connection; only the propagation of
+// writes is needed by the commands under test.
+type testActions struct {
+	interfaces.ServerActions
+}
+
+func (testActions) PropagateAs(...string) {}
+func (testActions) Protocol() int         { return RESP2 }
+
+// dispatch runs a command the way the server does, checking its arity and
+// looking its handler up in Handlers, and returns the encoded reply.
+func dispatch(t *testing.T, v *app.Vault, args ...string) string {
+	t.Helper()
+	name := strings.ToUpper(args[0])
+	handler, exists := Handlers[name]
+	if !exists {
+		t.Fatalf("%s is not registered", name)
+	}
+	if !ArityOK(name, len(args)) {
+		return string(Encode(WrongArgs(strings.ToLower(name))))
+	}
+	cmdArgs := make([]Command, len(args)-1)
+	for i, arg := range args[1:] {
+		cmdArgs[i] = Command{Typ: BULK_STRING, Bulk: arg}
+	}
+	return string(Encode(handler(v, cmdArgs, testActions{})))
+}
+
+func TestLPos(t *testing.T) {
+	v := app.NewVault(app.NewConfig("localhost", 0, "", 0))
+	defer v.Close()
+	dispatch(t, v, "RPUSH", "list", "a", "b", "c", "1", "2", "3", "c", "c")
+	// Spread the matches over several quicklist nodes.
+	for i := 0; i < 300; i++ {
+		dispatch(t, v, "RPUSH", "long", strconv.Itoa(i%100))
+	}
+	dispatch(t, v, "SET", "string", "v")
+
+	for _, c := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"LPOS", "list", "c"}, ":2\r\n"},
+		{[]string{"lpos", "list", "c", "rank", "2"}, ":6\r\n"},
+		{[]string{"LPOS", "list", "c", "RANK", "-1"}, ":7\r\n"},
+		{[]string{"LPOS", "list", "c", "COUNT", "2"}, "*2\r\n:2\r\n:6\r\n"},
+		{[]string{"LPOS", "list", "c", "COUNT", "0"}, "*3\r\n:2\r\n:6\r\n:7\r\n"},
+		{[]string{"LPOS", "list", "c", "RANK", "-1", "COUNT", "2"}, "*2\r\n:7\r\n:6\r\n"},
+		{[]string{"LPOS", "list", "c", "COUNT", "0", "MAXLEN", "7"}, "*2\r\n:2\r\n:6\r\n"},
+		{[]string{"LPOS", "list", "c", "RANK", "4"}, "$-1\r\n"},
+		{[]string{"LPOS", "list", "x"}, "$-1\r\n"},
+		{[]string{"LPOS", "list", "x", "COUNT", "1"}, "*0\r\n"},
+		{[]string{"LPOS", "missing", "x"}, "$-1\r\n"},
+		{[]string{"LPOS", "missing", "x", "COUNT", "1"}, "*0\r\n"},
+		{[]string{"LPOS", "long", "42", "COUNT", "0"}, "*3\r\n:42\r\n:142\r\n:242\r\n"},
+		{[]string{"LPOS", "long", "42", "RANK", "-2"}, ":142\r\n"},
+		{[]string{"LPOS", "list"}, "-ERR wrong number of arguments for 'lpos' command\r\n"},
+		{[]string{"LPOS", "list", "c", "RANK"}, "-ERR syntax error\r\n"},
+		{[]string{"LPOS", "list", "c", "FIRST", "1"}, "-ERR syntax error\r\n"},
+		{[]string{"LPOS", "list", "c", "RANK", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"LPOS", "list", "c", "RANK", "0"}, "-ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list\r\n"},
+		{[]string{"LPOS", "list", "c", "COUNT", "-1"}, "-ERR COUNT can't be negative\r\n"},
+		{[]string{"LPOS", "list", "c", "MAXLEN", "-1"}, "-ERR MAXLEN can't be negative\r\n"},
+		{[]string{"LPOS", "string", "v"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	} {
+		if got := dispatch(t, v, c.args...); got != c.want {
+			t.Errorf("%q = %q, want %q", c.args, got, c.want)
+		}
+	}
+}
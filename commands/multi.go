@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"rednav/app"
+	"rednav/interfaces"
+)
+
+// Watch marks keys to be watched for the next transaction of the
+// connection, which fails if any of them is modified before its EXEC:
+// WATCH key [key ...]
+func Watch(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("watch")
+	}
+	actions.Watch(bulks(args))
+	return OK()
+}
+
+// Unwatch forgets the keys watched by the connection: UNWATCH
+func Unwatch(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 0 {
+		return WrongArgs("unwatch")
+	}
+	actions.Unwatch()
+	return OK()
+}
@@ -6,8 +6,17 @@ import (
 )
 
 func Ping(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	// A RESP2 connection with subscriptions only carries pub/sub messages,
+	// so PING answers in their shape.
+	if actions.Protocol() == RESP2 && actions.Subscriptions() > 0 {
+		message := ""
+		if len(args) > 0 {
+			message = args[0].Bulk
+		}
+		return BulkList([]string{"pong", message})
+	}
 	if len(args) == 0 {
-		return Command{Typ: "string", Str: "+PONG"}
+		return SimpleString("PONG")
 	}
-	return Command{Typ: "string", Str: args[0].Bulk}
+	return BulkString(args[0].Bulk)
 }
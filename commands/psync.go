@@ -6,12 +6,18 @@ import (
 	"rednav/interfaces"
 )
 
+// PSync answers a replica with a full resynchronization: FULLRESYNC and an
+// RDB snapshot of the dataset. The server runs it with every other command
+// held off, so the reply is queued and the replica registered before any
+// write can slip in between the snapshot and the propagation to it.
 func PSync(vault *app.Vault, cmd []Command, actions interfaces.ServerActions) Command {
-	// Add replica connectioon to the server
+	file, err := vault.RDBSnapshot()
+	if err != nil {
+		return Errorf("ERR %s", err)
+	}
 	resp := make([]Command, 2)
-	resp[0] = Command{Typ: "string", Str: fmt.Sprintf("+FULLRESYNC %s %d\r\n", vault.MainReplicaID, vault.MainReplicaOffset)}
-	file := vault.RDBParsed()
-	resp[1] = Command{Typ: "bulk", Bulk: string(file)}
-
-	return Command{Typ: "multi", Str: "OK", Arr: resp}
+	resp[0] = SimpleString(fmt.Sprintf("FULLRESYNC %s %d", vault.MainReplicaID, vault.MainReplicaOffset))
+	resp[1] = Command{Typ: RDB_FILE, Bulk: string(file)}
+	actions.RegisterReplica(Encode(Command{Typ: MULTI, Arr: resp}))
+	return NoReply()
 }
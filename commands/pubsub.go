@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"rednav/app"
+	"rednav/interfaces"
+	"rednav/utils"
+	"strings"
+)
+
+// Subscribe subscribes the connection to channels: SUBSCRIBE channel [channel ...]
+func Subscribe(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("subscribe")
+	}
+	actions.Subscribe(bulks(args), false)
+	return NoReply()
+}
+
+// Unsubscribe unsubscribes the connection from channels, all of them when
+// none is given: UNSUBSCRIBE [channel [channel ...]]
+func Unsubscribe(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	actions.Unsubscribe(bulks(args), false)
+	return NoReply()
+}
+
+// PSubscribe subscribes the connection to glob-style patterns:
+// PSUBSCRIBE pattern [pattern ...]
+func PSubscribe(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("psubscribe")
+	}
+	actions.Subscribe(bulks(args), true)
+	return NoReply()
+}
+
+// PUnsubscribe unsubscribes the connection from patterns, all of them when
+// none is given: PUNSUBSCRIBE [pattern [pattern ...]]
+func PUnsubscribe(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	actions.Unsubscribe(bulks(args), true)
+	return NoReply()
+}
+
+// SSubscribe subscribes the connection to shard channels, which in cluster
+// mode must all hash to the same slot:
+// SSUBSCRIBE shardchannel [shardchannel ...]
+func SSubscribe(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("ssubscribe")
+	}
+	if v.GetConfig().ClusterEnabled && !sameSlot(args) {
+		return crossSlot()
+	}
+	actions.SSubscribe(bulks(args))
+	return NoReply()
+}
+
+// SUnsubscribe unsubscribes the connection from shard channels, all of them
+// when none is given: SUNSUBSCRIBE [shardchannel [shardchannel ...]]
+func SUnsubscribe(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if v.GetConfig().ClusterEnabled && !sameSlot(args) {
+		return crossSlot()
+	}
+	actions.SUnsubscribe(bulks(args))
+	return NoReply()
+}
+
+// sameSlot reports whether the channels all hash to the same slot, which
+// a cluster requires of the shard channels of a command, since a single
+// node owns them.
+func sameSlot(channels []Command) bool {
+	for _, channel := range channels[min(1, len(channels)):] {
+		if utils.KeyHashSlot(channel.Bulk) != utils.KeyHashSlot(channels[0].Bulk) {
+			return false
+		}
+	}
+	return true
+}
+
+func crossSlot() Command {
+	return Error("CROSSSLOT Keys in request don't hash to the same slot")
+}
+
+// Publish posts a message to a channel and returns how many subscribers
+// received it: PUBLISH channel message
+func Publish(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("publish")
+	}
+	return Integer(int64(actions.Publish(args[0].Bulk, args[1].Bulk)))
+}
+
+// SPublish posts a message to a shard channel and returns how many
+// subscribers received it: SPUBLISH shardchannel message
+//
+// Shard messages stay within the shard owning the slot of the channel: this
+// node, which owns every slot, and its replicas.
+func SPublish(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("spublish")
+	}
+	return Integer(int64(actions.SPublish(args[0].Bulk, args[1].Bulk)))
+}
+
+// PubSub inspects the state of pub/sub:
+// PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT |
+// SHARDCHANNELS [pattern] | SHARDNUMSUB [shardchannel ...]
+func PubSub(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("pubsub")
+	}
+	switch sub := strings.ToUpper(args[0].Bulk); {
+	case (sub == "CHANNELS" || sub == "SHARDCHANNELS") && len(args) <= 2:
+		pattern := ""
+		if len(args) == 2 {
+			pattern = args[1].Bulk
+		}
+		return BulkList(actions.PubSubChannels(pattern, sub == "SHARDCHANNELS"))
+	case sub == "NUMSUB" || sub == "SHARDNUMSUB":
+		channels := bulks(args[1:])
+		counts := actions.PubSubNumSub(channels, sub == "SHARDNUMSUB")
+		replies := make([]Command, 0, 2*len(channels))
+		for i, channel := range channels {
+			replies = append(replies, BulkString(channel), Integer(int64(counts[i])))
+		}
+		return Array(replies...)
+	case sub == "NUMPAT" && len(args) == 1:
+		return Integer(int64(actions.PubSubNumPat()))
+	default:
+		return Errorf("ERR unknown subcommand or wrong number of arguments for '%s'. Try PUBSUB HELP.", args[0].Bulk)
+	}
+}
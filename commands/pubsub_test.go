@@ -0,0 +1,18 @@
+package commands
+
+import (
+	"rednav/app"
+	"testing"
+)
+
+func TestShardChannelsCrossSlot(t *testing.T) {
+	config := app.NewConfig("localhost", 0, "", 0)
+	config.ClusterEnabled = true
+	v := app.NewVault(config)
+	defer v.Close()
+	for _, cmd := range []string{"SSUBSCRIBE", "SUNSUBSCRIBE"} {
+		if got := dispatch(t, v, cmd, "a", "b"); got != "-CROSSSLOT Keys in request don't hash to the same slot\r\n" {
+			t.Errorf("%s a b in cluster mode = %q", cmd, got)
+		}
+	}
+}
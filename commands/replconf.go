@@ -10,7 +10,7 @@ import (
 func ReplConf(vault *app.Vault, args []Command, actions interfaces.ServerActions) Command {
 
 	if len(args) < 2 {
-		return Command{Typ: "err", Err: "Not enough arguments for REPLCONF"}
+		return WrongArgs("replconf")
 	}
 
 	option := strings.ToUpper(args[0].Bulk)
@@ -19,16 +19,16 @@ func ReplConf(vault *app.Vault, args []Command, actions interfaces.ServerActions
 		actions.ReplicasConnection(args[1].Bulk)
 		// Handle setting listening port
 		if vault.IsMaster() {
-			return Command{Typ: "string", Str: "+OK"}
+			return OK()
 		} else {
-			return Command{Typ: "list", List: []string{app.RELPCONF, app.ACK, fmt.Sprint(vault.MainReplicaOffset)}}
+			return BulkList([]string{app.RELPCONF, app.ACK, fmt.Sprint(vault.MainReplicaOffset)})
 		}
 
 	case "CAPA":
 		// Handle capabilities
 		// Example: Do something with value (e.g., vault.SetCapabilities(value))
-		return Command{Typ: "string", Str: "+OK"}
+		return OK()
 	default:
-		return Command{Typ: "err", Err: "Unknown REPLCONF option"}
+		return Error("ERR Unrecognized REPLCONF option: " + args[0].Bulk)
 	}
 }
@@ -0,0 +1,322 @@
+package commands
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Reply types understood by Encode. A handler describes its reply with one
+// of these and never writes protocol framing itself.
+const (
+	SIMPLE_STRING = "string"
+	ERROR         = "err"
+	INTEGER       = "integer"
+	BULK_STRING   = "bulk"
+	NULL          = "nil"
+	NULL_ARRAY    = "nilarr"
+	ARRAY         = "arr"
+	LIST          = "list"
+	MULTI         = "multi"
+	RDB_FILE      = "rdb"
+
+	// RESP3 only types, flattened by Encode for RESP2 clients.
+	MAP        = "map"
+	SET        = "set"
+	DOUBLE     = "double"
+	BOOLEAN    = "boolean"
+	BIG_NUMBER = "bignum"
+	VERBATIM   = "verbatim"
+	PUSH       = "push"
+)
+
+// Protocol versions negotiated with HELLO.
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
+// SimpleString builds a status reply such as +OK.
+func SimpleString(s string) Command {
+	return Command{Typ: SIMPLE_STRING, Str: s}
+}
+
+// OK is the canonical +OK status reply.
+func OK() Command {
+	return SimpleString("OK")
+}
+
+// Error builds an error reply. msg must start with the error code, e.g.
+// "ERR syntax error" or "WRONGTYPE ...".
+func Error(msg string) Command {
+	return Command{Typ: ERROR, Err: msg}
+}
+
+// Errorf builds an error reply from a format string.
+func Errorf(format string, a ...interface{}) Command {
+	return Error(fmt.Sprintf(format, a...))
+}
+
+// ErrorReply builds an error reply from an error whose text carries the
+// error code, such as the errors returned by app.
+func ErrorReply(err error) Command {
+	return Error(err.Error())
+}
+
+// WrongArgs is the error returned when a command gets the wrong arity.
+func WrongArgs(name string) Command {
+	return Errorf("ERR wrong number of arguments for '%s' command", name)
+}
+
+// Integer builds an integer reply.
+func Integer(n int64) Command {
+	return Command{Typ: INTEGER, Num: n}
+}
+
+// BulkString builds a binary-safe bulk string reply.
+func BulkString(s string) Command {
+	return Command{Typ: BULK_STRING, Bulk: s}
+}
+
+// Null is the null bulk string reply ($-1).
+func Null() Command {
+	return Command{Typ: NULL}
+}
+
+// NullArray is the null array reply (*-1).
+func NullArray() Command {
+	return Command{Typ: NULL_ARRAY}
+}
+
+// Array builds an array reply from nested replies.
+func Array(items ...Command) Command {
+	if items == nil {
+		items = []Command{}
+	}
+	return Command{Typ: ARRAY, Arr: items}
+}
+
+// BulkList builds an array reply of bulk strings.
+func BulkList(items []string) Command {
+	return Command{Typ: LIST, List: items}
+}
+
+// Map builds a map reply from alternating keys and values.
+func Map(pairs ...Command) Command {
+	if pairs == nil {
+		pairs = []Command{}
+	}
+	return Command{Typ: MAP, Arr: pairs}
+}
+
+// SetOf builds a set reply.
+func SetOf(items ...Command) Command {
+	if items == nil {
+		items = []Command{}
+	}
+	return Command{Typ: SET, Arr: items}
+}
+
+// Double builds a floating point reply.
+func Double(f float64) Command {
+	return Command{Typ: DOUBLE, Double: f}
+}
+
+// HumanDouble builds a floating point reply rendered with 17 decimal
+// places less the trailing zeros, as Redis renders coordinates.
+func HumanDouble(f float64) Command {
+	text := strconv.FormatFloat(f, 'f', 17, 64)
+	text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+	return Command{Typ: DOUBLE, Double: f, Str: text}
+}
+
+// Boolean builds a boolean reply.
+func Boolean(b bool) Command {
+	if b {
+		return Command{Typ: BOOLEAN, Num: 1}
+	}
+	return Command{Typ: BOOLEAN, Num: 0}
+}
+
+// BigNumber builds an arbitrary precision integer reply from its decimal
+// representation.
+func BigNumber(digits string) Command {
+	return Command{Typ: BIG_NUMBER, Str: digits}
+}
+
+// Verbatim builds a verbatim string reply; format is a three letter hint
+// such as "txt" or "mkd".
+func Verbatim(format string, s string) Command {
+	return Command{Typ: VERBATIM, Str: format, Bulk: s}
+}
+
+// Push builds an out of band push message, e.g. a pub/sub delivery.
+func Push(items ...Command) Command {
+	return Command{Typ: PUSH, Arr: items}
+}
+
+// NoReply is the reply of commands answering with pushed messages instead,
+// like SUBSCRIBE. It encodes to nothing.
+func NoReply() Command {
+	return Command{Typ: MULTI}
+}
+
+// FormatDouble renders f the way Redis does in replies and stored values:
+// whole numbers small enough to be exact as integers, anything else in the
+// shortest form that reads back as f, using an exponent like %.17g would.
+func FormatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	case f != 0 && f == math.Trunc(f) && math.Abs(f) < 1<<52:
+		return strconv.FormatInt(int64(f), 10)
+	}
+	text := strconv.FormatFloat(f, 'e', -1, 64)
+	exp, _ := strconv.Atoi(text[strings.IndexByte(text, 'e')+1:])
+	if exp < -4 || exp >= 17 {
+		return text
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Encode serializes a reply to RESP2.
+func Encode(c Command) []byte {
+	return appendReply(nil, c, RESP2)
+}
+
+// EncodeWithProtocol serializes a reply for a client speaking proto. RESP3
+// types are flattened to their RESP2 equivalent for RESP2 clients.
+func EncodeWithProtocol(c Command, proto int) []byte {
+	return appendReply(nil, c, proto)
+}
+
+func appendReply(buf []byte, c Command, proto int) []byte {
+	switch c.Typ {
+	case SIMPLE_STRING:
+		buf = append(buf, '+')
+		buf = append(buf, c.Str...)
+		return append(buf, '\r', '\n')
+	case ERROR:
+		buf = append(buf, '-')
+		buf = append(buf, c.Err...)
+		return append(buf, '\r', '\n')
+	case INTEGER:
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, c.Num, 10)
+		return append(buf, '\r', '\n')
+	case BULK_STRING:
+		return appendBulk(buf, c.Bulk)
+	case NULL:
+		if proto == RESP3 {
+			return append(buf, "_\r\n"...)
+		}
+		return append(buf, "$-1\r\n"...)
+	case NULL_ARRAY:
+		if proto == RESP3 {
+			return append(buf, "_\r\n"...)
+		}
+		return append(buf, "*-1\r\n"...)
+	case LIST:
+		buf = appendHeader(buf, '*', len(c.List))
+		for _, item := range c.List {
+			buf = appendBulk(buf, item)
+		}
+		return buf
+	case ARRAY:
+		return appendAggregate(buf, '*', c.Arr, proto)
+	case MAP:
+		if proto == RESP3 {
+			buf = appendHeader(buf, '%', len(c.Arr)/2)
+			for _, item := range c.Arr {
+				buf = appendReply(buf, item, proto)
+			}
+			return buf
+		}
+		return appendAggregate(buf, '*', c.Arr, proto)
+	case SET:
+		if proto == RESP3 {
+			return appendAggregate(buf, '~', c.Arr, proto)
+		}
+		return appendAggregate(buf, '*', c.Arr, proto)
+	case PUSH:
+		if proto == RESP3 {
+			return appendAggregate(buf, '>', c.Arr, proto)
+		}
+		return appendAggregate(buf, '*', c.Arr, proto)
+	case DOUBLE:
+		text := c.Str
+		if text == "" {
+			text = FormatDouble(c.Double)
+		}
+		if proto == RESP3 {
+			buf = append(buf, ',')
+			buf = append(buf, text...)
+			return append(buf, '\r', '\n')
+		}
+		return appendBulk(buf, text)
+	case BOOLEAN:
+		if proto == RESP3 {
+			if c.Num != 0 {
+				return append(buf, "#t\r\n"...)
+			}
+			return append(buf, "#f\r\n"...)
+		}
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, c.Num, 10)
+		return append(buf, '\r', '\n')
+	case BIG_NUMBER:
+		if proto == RESP3 {
+			buf = append(buf, '(')
+			buf = append(buf, c.Str...)
+			return append(buf, '\r', '\n')
+		}
+		return appendBulk(buf, c.Str)
+	case VERBATIM:
+		if proto == RESP3 {
+			buf = appendHeader(buf, '=', len(c.Bulk)+4)
+			buf = append(buf, c.Str...)
+			buf = append(buf, ':')
+			buf = append(buf, c.Bulk...)
+			return append(buf, '\r', '\n')
+		}
+		return appendBulk(buf, c.Bulk)
+	case MULTI:
+		// Several top-level replies written back to back.
+		for _, item := range c.Arr {
+			buf = appendReply(buf, item, proto)
+		}
+		return buf
+	case RDB_FILE:
+		// An RDB transfer is a bulk payload without the trailing CRLF.
+		buf = appendHeader(buf, '$', len(c.Bulk))
+		return append(buf, c.Bulk...)
+	default:
+		fmt.Printf("Unknown response type: %v\n", c)
+		return append(buf, "-ERR Unknown response type\r\n"...)
+	}
+}
+
+func appendAggregate(buf []byte, prefix byte, items []Command, proto int) []byte {
+	buf = appendHeader(buf, prefix, len(items))
+	for _, item := range items {
+		buf = appendReply(buf, item, proto)
+	}
+	return buf
+}
+
+func appendHeader(buf []byte, prefix byte, n int) []byte {
+	buf = append(buf, prefix)
+	buf = strconv.AppendInt(buf, int64(n), 10)
+	return append(buf, '\r', '\n')
+}
+
+func appendBulk(buf []byte, s string) []byte {
+	buf = appendHeader(buf, '$', len(s))
+	buf = append(buf, s...)
+	return append(buf, '\r', '\n')
+}
@@ -0,0 +1,54 @@
+package commands
+
+import "testing"
+
+func TestEncode(t *testing.T) {
+	cases := []struct {
+		reply Command
+		want  string
+	}{
+		{OK(), "+OK\r\n"},
+		{Error("ERR syntax error"), "-ERR syntax error\r\n"},
+		{Integer(-42), ":-42\r\n"},
+		{BulkString("a\r\nb"), "$4\r\na\r\nb\r\n"},
+		{BulkString(""), "$0\r\n\r\n"},
+		{Null(), "$-1\r\n"},
+		{NullArray(), "*-1\r\n"},
+		{Array(), "*0\r\n"},
+		{BulkList([]string{"foo", "bar"}), "*2\r\n$3\r\nfoo\r\n$3\r\nbar\r\n"},
+		{Array(Integer(1), Array(BulkString("x"), Null())), "*2\r\n:1\r\n*2\r\n$1\r\nx\r\n$-1\r\n"},
+		{Command{Typ: MULTI, Arr: []Command{SimpleString("FULLRESYNC id 0"), {Typ: RDB_FILE, Bulk: "REDIS"}}}, "+FULLRESYNC id 0\r\n$5\r\nREDIS"},
+	}
+
+	for _, c := range cases {
+		if got := string(Encode(c.reply)); got != c.want {
+			t.Errorf("Encode(%v) = %q, want %q", c.reply, got, c.want)
+		}
+	}
+}
+
+func TestEncodeWithProtocol(t *testing.T) {
+	cases := []struct {
+		reply Command
+		resp2 string
+		resp3 string
+	}{
+		{Null(), "$-1\r\n", "_\r\n"},
+		{Map(BulkString("a"), Integer(1)), "*2\r\n$1\r\na\r\n:1\r\n", "%1\r\n$1\r\na\r\n:1\r\n"},
+		{SetOf(BulkString("x")), "*1\r\n$1\r\nx\r\n", "~1\r\n$1\r\nx\r\n"},
+		{Double(1.5), "$3\r\n1.5\r\n", ",1.5\r\n"},
+		{Boolean(true), ":1\r\n", "#t\r\n"},
+		{BigNumber("12345678901234567890"), "$20\r\n12345678901234567890\r\n", "(12345678901234567890\r\n"},
+		{Verbatim("txt", "hi"), "$2\r\nhi\r\n", "=6\r\ntxt:hi\r\n"},
+		{Push(BulkString("message")), "*1\r\n$7\r\nmessage\r\n", ">1\r\n$7\r\nmessage\r\n"},
+	}
+
+	for _, c := range cases {
+		if got := string(EncodeWithProtocol(c.reply, RESP2)); got != c.resp2 {
+			t.Errorf("RESP2 %v = %q, want %q", c.reply, got, c.resp2)
+		}
+		if got := string(EncodeWithProtocol(c.reply, RESP3)); got != c.resp3 {
+			t.Errorf("RESP3 %v = %q, want %q", c.reply, got, c.resp3)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"rednav/app"
+	"rednav/interfaces"
+)
+
+// Save writes the dataset to the RDB file before replying.
+func Save(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if err := v.SaveRDB(); err != nil {
+		if err == app.ErrBgsaveInProgress || err == app.ErrSaveInProgress {
+			return Error(err.Error())
+		}
+		return Errorf("ERR %s", err)
+	}
+	return OK()
+}
+
+// BgSave writes the dataset to the RDB file in the background.
+func BgSave(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) > 0 {
+		return Error("ERR syntax error")
+	}
+	if err := v.BackgroundSaveRDB(); err != nil {
+		if err == app.ErrBgsaveInProgress || err == app.ErrSaveInProgress {
+			return Error(err.Error())
+		}
+		return Errorf("ERR %s", err)
+	}
+	return SimpleString("Background saving started")
+}
+
+// LastSave returns the Unix time of the last successful save.
+func LastSave(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return Integer(v.LastSave().Unix())
+}
@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"rednav/app"
+	"rednav/interfaces"
+	"strconv"
+	"strings"
+)
+
+// Keys returns all keys matching a glob pattern: KEYS pattern
+func Keys(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("keys")
+	}
+	return BulkList(v.KeysMatching(args[0].Bulk))
+}
+
+// Scan incrementally iterates the keyspace:
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func Scan(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("scan")
+	}
+	cursor, err := strconv.ParseUint(args[0].Bulk, 10, 64)
+	if err != nil {
+		return Error("ERR invalid cursor")
+	}
+	opts, reply := parseScanOptions(args[1:], true)
+	if reply != nil {
+		return *reply
+	}
+
+	next, keys := v.Scan(cursor, opts.count, opts.pattern, opts.typ)
+	return Array(BulkString(strconv.FormatUint(next, 10)), BulkList(keys))
+}
+
+type scanOptions struct {
+	pattern string
+	count   int
+	typ     string
+}
+
+// parseScanOptions parses the MATCH and COUNT options shared by the SCAN
+// family, and TYPE when allowed.
+func parseScanOptions(args []Command, allowType bool) (scanOptions, *Command) {
+	opts := scanOptions{count: 10}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(args[i].Bulk)
+		if i+1 >= len(args) {
+			reply := ErrorReply(app.ErrSyntax)
+			return opts, &reply
+		}
+		i++
+		switch {
+		case option == "MATCH":
+			opts.pattern = args[i].Bulk
+		case option == "COUNT":
+			count, err := strconv.Atoi(args[i].Bulk)
+			if err != nil {
+				reply := ErrorReply(app.ErrNotInteger)
+				return opts, &reply
+			}
+			if count < 1 {
+				reply := ErrorReply(app.ErrSyntax)
+				return opts, &reply
+			}
+			opts.count = count
+		case option == "TYPE" && allowType:
+			opts.typ = strings.ToLower(args[i].Bulk)
+		default:
+			reply := ErrorReply(app.ErrSyntax)
+			return opts, &reply
+		}
+	}
+	return opts, nil
+}
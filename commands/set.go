@@ -2,35 +2,166 @@ package commands
 
 import (
 	"fmt"
+	"math"
 	"rednav/app"
 	"rednav/interfaces"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// Set stores a string value:
+// SET key value [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|KEEPTTL]
 func Set(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
 	if len(args) < 2 {
-		return Command{Typ: "error", Err: "ERR wrong number of arguments for 'set' command"}
+		return WrongArgs("set")
 	}
 	key := args[0].Bulk
 	value := args[1].Bulk
 
-	var expiration *time.Time
+	var opts app.SetOptions
+	hasExpire := false
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(args[i].Bulk)
+		switch {
+		case option == "NX" && !opts.XX:
+			opts.NX = true
+		case option == "XX" && !opts.NX:
+			opts.XX = true
+		case option == "GET":
+			opts.Get = true
+		case option == "KEEPTTL" && !hasExpire:
+			opts.KeepTTL = true
+		case (option == "EX" || option == "PX" || option == "EXAT" || option == "PXAT") && !hasExpire && !opts.KeepTTL && i+1 < len(args):
+			i++
+			lifetime, reply := parseExpireTime(args[i].Bulk, option, "set")
+			if reply != nil {
+				return *reply
+			}
+			opts.Lifetime = lifetime
+			hasExpire = true
+		default:
+			return ErrorReply(app.ErrSyntax)
+		}
+	}
 
-	// Check for optional "PX" argument for expiration time
+	fmt.Printf("Cmd: SET key=%s, value=%s, expiration=%v\n", key, value, opts.Lifetime)
+	old, existed, stored, err := v.SetString(key, value, opts)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if stored {
+		propagateSet(actions, key, value, opts.Lifetime, opts.KeepTTL)
+	} else {
+		actions.PropagateAs()
+	}
 
-	if len(args) >= 4 && args[2].Bulk == "px" {
-		ms, err := strconv.Atoi(args[3].Bulk)
-		if err != nil {
-			return Command{Typ: "error", Err: "ERR invalid expiration time"}
-		}
-		exp := time.Now().Add(time.Duration(ms) * time.Millisecond)
-		expiration = &exp
+	switch {
+	case opts.Get && existed:
+		return BulkString(old)
+	case opts.Get || !stored:
+		return Null()
+	default:
+		return OK()
+	}
+}
+
+// SetNX sets a key only if it does not exist: SETNX key value
+func SetNX(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("setnx")
+	}
+	_, _, stored, err := v.SetString(args[0].Bulk, args[1].Bulk, app.SetOptions{NX: true})
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !stored {
+		actions.PropagateAs()
+		return Integer(0)
+	}
+	return Integer(1)
+}
+
+// SetEx sets a key with a time to live in seconds: SETEX key seconds value
+func SetEx(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return setExGeneric(v, args, actions, "setex", "EX")
+}
+
+// PSetEx sets a key with a time to live in milliseconds.
+func PSetEx(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return setExGeneric(v, args, actions, "psetex", "PX")
+}
+
+func setExGeneric(v *app.Vault, args []Command, actions interfaces.ServerActions, name string, unit string) Command {
+	if len(args) != 3 {
+		return WrongArgs(name)
 	}
+	key, value := args[0].Bulk, args[2].Bulk
+	lifetime, reply := parseExpireTime(args[1].Bulk, unit, name)
+	if reply != nil {
+		return *reply
+	}
+	if _, _, _, err := v.SetString(key, value, app.SetOptions{Lifetime: lifetime}); err != nil {
+		return ErrorReply(err)
+	}
+	propagateSet(actions, key, value, lifetime, false)
+	return OK()
+}
 
-	fmt.Printf("Cmd: SET key=%s, value=%s, expiration=%v\n", key, value, expiration)
-	// Store the key-value pair using SetMemory
-	v.SetMemory(key, value, expiration)
+// GetSet sets a key and returns its previous value: GETSET key value
+func GetSet(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("getset")
+	}
+	old, existed, _, err := v.SetString(args[0].Bulk, args[1].Bulk, app.SetOptions{Get: true})
+	if err != nil {
+		return ErrorReply(err)
+	}
+	actions.PropagateAs("SET", args[0].Bulk, args[1].Bulk)
+	if !existed {
+		return Null()
+	}
+	return BulkString(old)
+}
 
-	return Command{Typ: "string", Str: "+OK"}
+// parseExpireTime converts the argument of an EX, PX, EXAT or PXAT option to
+// an absolute lifetime. Non positive values are rejected like Redis does.
+func parseExpireTime(arg string, unit string, name string) (time.Time, *Command) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		reply := ErrorReply(app.ErrNotInteger)
+		return time.Time{}, &reply
+	}
+	invalid := Errorf("ERR invalid expire time in '%s' command", name)
+	if n <= 0 {
+		return time.Time{}, &invalid
+	}
+
+	if unit == "EX" || unit == "EXAT" {
+		if n > math.MaxInt64/1000 {
+			return time.Time{}, &invalid
+		}
+		n *= 1000
+	}
+	if unit == "EX" || unit == "PX" {
+		now := time.Now().UnixMilli()
+		if n > math.MaxInt64-now {
+			return time.Time{}, &invalid
+		}
+		n += now
+	}
+	return time.UnixMilli(n), nil
+}
+
+// propagateSet sends a SET to replicas with its lifetime as an absolute
+// PXAT, so they expire the key at the same instant as the master.
+func propagateSet(actions interfaces.ServerActions, key string, value string, lifetime time.Time, keepTTL bool) {
+	switch {
+	case keepTTL:
+		actions.PropagateAs("SET", key, value, "KEEPTTL")
+	case lifetime.IsZero():
+		actions.PropagateAs("SET", key, value)
+	default:
+		actions.PropagateAs("SET", key, value, "PXAT", strconv.FormatInt(lifetime.UnixMilli(), 10))
+	}
 }
@@ -0,0 +1,293 @@
+package commands
+
+import (
+	"math"
+	"rednav/app"
+	"rednav/interfaces"
+	"strconv"
+	"strings"
+)
+
+// SAdd adds members to a set: SADD key member [member ...]
+func SAdd(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("sadd")
+	}
+	added, err := v.SAdd(args[0].Bulk, bulks(args[1:]))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if added == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(added))
+}
+
+// SRem removes members from a set: SREM key member [member ...]
+func SRem(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("srem")
+	}
+	removed, err := v.SRem(args[0].Bulk, bulks(args[1:]))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if removed == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(removed))
+}
+
+// SCard returns the number of members of a set: SCARD key
+func SCard(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("scard")
+	}
+	n, err := v.SCard(args[0].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
+
+// SIsMember reports whether a member belongs to a set: SISMEMBER key member
+func SIsMember(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("sismember")
+	}
+	found, err := v.SMIsMember(args[0].Bulk, bulks(args[1:]))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return boolInteger(found[0])
+}
+
+// SMIsMember reports whether each member belongs to a set:
+// SMISMEMBER key member [member ...]
+func SMIsMember(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("smismember")
+	}
+	found, err := v.SMIsMember(args[0].Bulk, bulks(args[1:]))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	replies := make([]Command, len(found))
+	for i := range found {
+		replies[i] = boolInteger(found[i])
+	}
+	return Array(replies...)
+}
+
+func boolInteger(b bool) Command {
+	if b {
+		return Integer(1)
+	}
+	return Integer(0)
+}
+
+// SMembers returns the members of a set: SMEMBERS key
+func SMembers(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("smembers")
+	}
+	members, err := v.SMembers(args[0].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return bulkSet(members)
+}
+
+// bulkSet replies members as a set, an array to RESP2 clients.
+func bulkSet(members []string) Command {
+	replies := make([]Command, len(members))
+	for i, member := range members {
+		replies[i] = BulkString(member)
+	}
+	return SetOf(replies...)
+}
+
+// SPop removes and returns random members of a set: SPOP key [count]. It is
+// propagated as the SREM of the popped members.
+func SPop(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 || len(args) > 2 {
+		return WrongArgs("spop")
+	}
+	count := int64(1)
+	if len(args) == 2 {
+		var reply *Command
+		if count, reply = parsePositiveCount(args[1].Bulk); reply != nil {
+			return *reply
+		}
+	}
+	popped, err := v.SPop(args[0].Bulk, count)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if len(popped) == 0 {
+		actions.PropagateAs()
+	} else {
+		actions.PropagateAs(append([]string{"SREM", args[0].Bulk}, popped...)...)
+	}
+
+	if len(args) == 2 {
+		return bulkSet(popped)
+	}
+	if len(popped) == 0 {
+		return Null()
+	}
+	return BulkString(popped[0])
+}
+
+// SRandMember returns random members of a set: SRANDMEMBER key [count]
+func SRandMember(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 || len(args) > 2 {
+		return WrongArgs("srandmember")
+	}
+	if len(args) == 1 {
+		members, err := v.SRandMember(args[0].Bulk, 1)
+		if err != nil {
+			return ErrorReply(err)
+		}
+		if len(members) == 0 {
+			return Null()
+		}
+		return BulkString(members[0])
+	}
+	count, ok := app.ParseInt(args[1].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	if count < -math.MaxInt64/2 {
+		return Error("ERR value is out of range")
+	}
+	members, err := v.SRandMember(args[0].Bulk, count)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return BulkList(members)
+}
+
+// SMove moves a member between sets: SMOVE source destination member
+func SMove(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("smove")
+	}
+	moved, err := v.SMove(args[0].Bulk, args[1].Bulk, args[2].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !moved {
+		actions.PropagateAs()
+	}
+	return boolInteger(moved)
+}
+
+// SScan incrementally iterates the members of a set:
+// SSCAN key cursor [MATCH pattern] [COUNT count]
+func SScan(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("sscan")
+	}
+	cursor, err := strconv.ParseUint(args[1].Bulk, 10, 64)
+	if err != nil {
+		return Error("ERR invalid cursor")
+	}
+	opts, reply := parseScanOptions(args[2:], false)
+	if reply != nil {
+		return *reply
+	}
+	next, members, err := v.SScan(args[0].Bulk, cursor, opts.count, opts.pattern)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Array(BulkString(strconv.FormatUint(next, 10)), BulkList(members))
+}
+
+// SInter returns the intersection of sets: SINTER key [key ...]
+func SInter(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return setOpGeneric(v, args, "sinter", app.SET_OP_INTER)
+}
+
+// SUnion returns the union of sets: SUNION key [key ...]
+func SUnion(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return setOpGeneric(v, args, "sunion", app.SET_OP_UNION)
+}
+
+// SDiff returns the members of the first set missing from the others:
+// SDIFF key [key ...]
+func SDiff(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return setOpGeneric(v, args, "sdiff", app.SET_OP_DIFF)
+}
+
+func setOpGeneric(v *app.Vault, args []Command, name string, op int) Command {
+	if len(args) < 1 {
+		return WrongArgs(name)
+	}
+	members, err := v.SetOp(op, bulks(args))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return bulkSet(members)
+}
+
+// SInterStore stores the intersection of sets:
+// SINTERSTORE destination key [key ...]
+func SInterStore(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return setOpStoreGeneric(v, args, "sinterstore", app.SET_OP_INTER)
+}
+
+// SUnionStore stores the union of sets: SUNIONSTORE destination key [key ...]
+func SUnionStore(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return setOpStoreGeneric(v, args, "sunionstore", app.SET_OP_UNION)
+}
+
+// SDiffStore stores the difference of sets: SDIFFSTORE destination key [key ...]
+func SDiffStore(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return setOpStoreGeneric(v, args, "sdiffstore", app.SET_OP_DIFF)
+}
+
+func setOpStoreGeneric(v *app.Vault, args []Command, name string, op int) Command {
+	if len(args) < 2 {
+		return WrongArgs(name)
+	}
+	n, err := v.SetOpStore(op, args[0].Bulk, bulks(args[1:]))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
+
+// SInterCard returns the cardinality of the intersection of sets:
+// SINTERCARD numkeys key [key ...] [LIMIT limit]
+func SInterCard(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("sintercard")
+	}
+	numKeys, ok := app.ParseInt(args[0].Bulk)
+	if !ok || numKeys <= 0 {
+		return Error("ERR numkeys should be greater than 0")
+	}
+	if numKeys > int64(len(args)-1) {
+		return Error("ERR Number of keys can't be greater than number of args")
+	}
+	limit := int64(0)
+	rest := args[1+numKeys:]
+	switch {
+	case len(rest) == 0:
+	case len(rest) == 2 && strings.ToUpper(rest[0].Bulk) == "LIMIT":
+		if limit, ok = app.ParseInt(rest[1].Bulk); !ok || limit < 0 {
+			return Error("ERR LIMIT can't be negative")
+		}
+	default:
+		return ErrorReply(app.ErrSyntax)
+	}
+	if limit > math.MaxInt32 {
+		limit = 0
+	}
+	n, err := v.SInterCard(bulks(args[1:1+numKeys]), int(limit))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
@@ -0,0 +1,965 @@
+package commands
+
+import (
+	"errors"
+	"math"
+	"rednav/app"
+	"rednav/interfaces"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XAUTOCLAIM_DEFAULT_COUNT is the number of entries XAUTOCLAIM claims
+// when COUNT is not given.
+const XAUTOCLAIM_DEFAULT_COUNT = 100
+
+// entryReply replies with a stream entry as its ID and fields, or as its ID
+// alone when justID is set. A deleted entry has null fields.
+func entryReply(entry app.StreamEntry, justID bool) Command {
+	if justID {
+		return BulkString(entry.ID.String())
+	}
+	if entry.Fields == nil {
+		return Array(BulkString(entry.ID.String()), NullArray())
+	}
+	return Array(BulkString(entry.ID.String()), BulkList(entry.Fields))
+}
+
+func entriesReply(entries []app.StreamEntry, justID bool) Command {
+	replies := make([]Command, len(entries))
+	for i, entry := range entries {
+		replies[i] = entryReply(entry, justID)
+	}
+	return Array(replies...)
+}
+
+func streamIDs(ids []app.StreamID) Command {
+	replies := make([]Command, len(ids))
+	for i, id := range ids {
+		replies[i] = BulkString(id.String())
+	}
+	return Array(replies...)
+}
+
+// noGroup builds the NOGROUP error replies, which name the key and group.
+func noGroup(key string, group string, suffix string) Command {
+	return Errorf("NOGROUP No such key '%s' or consumer group '%s'%s", key, group, suffix)
+}
+
+func noConsumerGroup(key string, group string) Command {
+	return Errorf("NOGROUP No such consumer group '%s' for key name '%s'", group, key)
+}
+
+// parseTrim parses the trimming options of XADD and XTRIM starting at
+// args[i]: MAXLEN|MINID [=|~] threshold [LIMIT count]. It returns how many
+// arguments it consumed, zero if args[i] is not a trimming option.
+func parseTrim(args []Command, i int, trim *app.StreamTrim) (int, *Command) {
+	fail := func(reply Command) (int, *Command) {
+		return 0, &reply
+	}
+	strategy := app.STREAM_TRIM_NONE
+	switch strings.ToUpper(args[i].Bulk) {
+	case "MAXLEN":
+		strategy = app.STREAM_TRIM_MAXLEN
+	case "MINID":
+		strategy = app.STREAM_TRIM_MINID
+	case "LIMIT":
+		if i+1 >= len(args) {
+			return fail(ErrorReply(app.ErrSyntax))
+		}
+		limit, ok := app.ParseInt(args[i+1].Bulk)
+		if !ok {
+			return fail(ErrorReply(app.ErrNotInteger))
+		}
+		if limit < 0 {
+			return fail(Error("ERR The LIMIT argument must be >= 0."))
+		}
+		trim.Limit = limit
+		return 2, nil
+	default:
+		return 0, nil
+	}
+	if trim.Strategy != app.STREAM_TRIM_NONE && trim.Strategy != strategy {
+		return fail(Error("ERR syntax error, MAXLEN and MINID options at the same time are not compatible"))
+	}
+	trim.Strategy = strategy
+
+	n := 1
+	if i+n < len(args) && (args[i+n].Bulk == "=" || args[i+n].Bulk == "~") {
+		trim.Approx = args[i+n].Bulk == "~"
+		n++
+	}
+	if i+n >= len(args) {
+		return fail(ErrorReply(app.ErrSyntax))
+	}
+	threshold := args[i+n].Bulk
+	n++
+	if strategy == app.STREAM_TRIM_MAXLEN {
+		maxLen, ok := app.ParseInt(threshold)
+		if !ok {
+			return fail(ErrorReply(app.ErrNotInteger))
+		}
+		if maxLen < 0 {
+			return fail(Error("ERR The MAXLEN argument must be >= 0."))
+		}
+		trim.MaxLen = maxLen
+	} else {
+		minID, ok := app.ParseStreamID(threshold, 0)
+		if !ok {
+			return fail(ErrorReply(app.ErrStreamID))
+		}
+		trim.MinID = minID
+	}
+	return n, nil
+}
+
+// checkTrim validates the trimming options once they are all parsed.
+func checkTrim(trim *app.StreamTrim, limitGiven bool) *Command {
+	if limitGiven && !trim.Approx {
+		reply := Error("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		return &reply
+	}
+	if trim.Approx && !limitGiven {
+		trim.Limit = app.STREAM_TRIM_DEFAULT_LIMIT
+	}
+	return nil
+}
+
+// XAdd appends an entry to a stream:
+// XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func XAdd(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 4 {
+		return WrongArgs("xadd")
+	}
+	var trim app.StreamTrim
+	noMkStream, limitGiven := false, false
+	i := 1
+	for ; i < len(args); i++ {
+		if strings.ToUpper(args[i].Bulk) == "NOMKSTREAM" {
+			noMkStream = true
+			continue
+		}
+		limitGiven = limitGiven || strings.ToUpper(args[i].Bulk) == "LIMIT"
+		n, reply := parseTrim(args, i, &trim)
+		if reply != nil {
+			return *reply
+		}
+		if n == 0 {
+			break
+		}
+		i += n - 1
+	}
+	if reply := checkTrim(&trim, limitGiven); reply != nil {
+		return *reply
+	}
+	if i >= len(args) {
+		return ErrorReply(app.ErrSyntax)
+	}
+	fields := args[i+1:]
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return WrongArgs("xadd")
+	}
+	requested, ok := app.ParseStreamAddID(args[i].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrStreamID)
+	}
+
+	id, added, err := v.XAdd(args[0].Bulk, requested, bulks(fields), noMkStream, trim)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !added {
+		actions.PropagateAs()
+		return Null()
+	}
+	// Replicas must store the entry under the same ID.
+	propagated := bulks(args)
+	propagated[i] = id.String()
+	actions.PropagateAs(append([]string{"XADD"}, propagated...)...)
+	return BulkString(id.String())
+}
+
+// XLen returns the number of entries of a stream: XLEN key
+func XLen(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("xlen")
+	}
+	n, err := v.XLen(args[0].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
+
+// parseRangeID parses an end of an interval of stream IDs, where a leading
+// "(" excludes it. A missing sequence number is seq.
+func parseRangeID(arg string, seq uint64, start bool) (app.StreamID, *Command) {
+	exclusive := len(arg) > 1 && arg[0] == '('
+	if !exclusive {
+		id, ok := app.ParseStreamID(arg, seq)
+		if !ok {
+			reply := ErrorReply(app.ErrStreamID)
+			return id, &reply
+		}
+		return id, nil
+	}
+	id, ok := app.ParseStreamID(arg[1:], seq)
+	if !ok || arg[1:] == "-" || arg[1:] == "+" {
+		reply := ErrorReply(app.ErrStreamID)
+		return id, &reply
+	}
+	if start {
+		id, ok = id.Next()
+	} else {
+		id, ok = id.Prev()
+	}
+	if !ok {
+		reply := Error("ERR invalid start ID for the interval")
+		if !start {
+			reply = Error("ERR invalid end ID for the interval")
+		}
+		return id, &reply
+	}
+	return id, nil
+}
+
+// XRange returns the entries of a stream within a range of IDs:
+// XRANGE key start end [COUNT count]
+func XRange(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return xrangeGeneric(v, args, "xrange", false)
+}
+
+// XRevRange returns the entries of a stream within a range of IDs in
+// reverse order: XREVRANGE key end start [COUNT count]
+func XRevRange(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return xrangeGeneric(v, args, "xrevrange", true)
+}
+
+func xrangeGeneric(v *app.Vault, args []Command, name string, rev bool) Command {
+	if len(args) != 3 && len(args) != 5 {
+		if len(args) < 3 {
+			return WrongArgs(name)
+		}
+		return ErrorReply(app.ErrSyntax)
+	}
+	startArg, endArg := args[1].Bulk, args[2].Bulk
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	start, reply := parseRangeID(startArg, 0, true)
+	if reply != nil {
+		return *reply
+	}
+	end, reply := parseRangeID(endArg, math.MaxUint64, false)
+	if reply != nil {
+		return *reply
+	}
+	count := int64(0)
+	if len(args) == 5 {
+		if strings.ToUpper(args[3].Bulk) != "COUNT" {
+			return ErrorReply(app.ErrSyntax)
+		}
+		var ok bool
+		if count, ok = app.ParseInt(args[4].Bulk); !ok {
+			return ErrorReply(app.ErrNotInteger)
+		}
+		if count <= 0 {
+			return Array()
+		}
+	}
+	if count > math.MaxInt32 {
+		count = math.MaxInt32
+	}
+	entries, err := v.XRange(args[0].Bulk, start, end, int(count), rev)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return entriesReply(entries, false)
+}
+
+// XDel deletes entries from a stream: XDEL key id [id ...]
+func XDel(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("xdel")
+	}
+	ids, reply := parseStreamIDs(args[1:])
+	if reply != nil {
+		return *reply
+	}
+	deleted, err := v.XDel(args[0].Bulk, ids)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if deleted == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(deleted))
+}
+
+func parseStreamIDs(args []Command) ([]app.StreamID, *Command) {
+	ids := make([]app.StreamID, len(args))
+	for i, arg := range args {
+		id, ok := app.ParseStreamID(arg.Bulk, 0)
+		if !ok || arg.Bulk == "-" || arg.Bulk == "+" {
+			reply := ErrorReply(app.ErrStreamID)
+			return nil, &reply
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// XTrim evicts old entries of a stream:
+// XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func XTrim(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 3 {
+		return WrongArgs("xtrim")
+	}
+	var trim app.StreamTrim
+	limitGiven := false
+	for i := 1; i < len(args); {
+		limitGiven = limitGiven || strings.ToUpper(args[i].Bulk) == "LIMIT"
+		n, reply := parseTrim(args, i, &trim)
+		if reply != nil {
+			return *reply
+		}
+		if n == 0 {
+			return ErrorReply(app.ErrSyntax)
+		}
+		i += n
+	}
+	if trim.Strategy == app.STREAM_TRIM_NONE {
+		return ErrorReply(app.ErrSyntax)
+	}
+	if reply := checkTrim(&trim, limitGiven); reply != nil {
+		return *reply
+	}
+	evicted, err := v.XTrim(args[0].Bulk, trim)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if evicted == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(evicted))
+}
+
+// streamsReply replies with what XREAD or XREADGROUP read: a map from keys
+// to entries for RESP3 and an array of key and entries pairs for RESP2.
+func streamsReply(streams []app.StreamRead, proto int) Command {
+	replies := make([]Command, 0, 2*len(streams))
+	for _, stream := range streams {
+		if proto == RESP3 {
+			replies = append(replies, BulkString(stream.Key), entriesReply(stream.Entries, false))
+		} else {
+			replies = append(replies, Array(BulkString(stream.Key), entriesReply(stream.Entries, false)))
+		}
+	}
+	if proto == RESP3 {
+		return Map(replies...)
+	}
+	return Array(replies...)
+}
+
+// xreadOptions holds the options shared by XREAD and XREADGROUP.
+type xreadOptions struct {
+	count   int64
+	block   bool
+	timeout time.Duration
+	noAck   bool
+	group   string
+	member  string
+	keys    []string
+	ids     []string
+}
+
+func parseXRead(args []Command, name string, group bool) (xreadOptions, *Command) {
+	var opts xreadOptions
+	fail := func(reply Command) (xreadOptions, *Command) {
+		return opts, &reply
+	}
+	i := 0
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(args[i].Bulk)
+		switch {
+		case option == "STREAMS":
+		case option == "COUNT" && i+1 < len(args):
+			count, ok := app.ParseInt(args[i+1].Bulk)
+			if !ok {
+				return fail(ErrorReply(app.ErrNotInteger))
+			}
+			if count < 0 {
+				count = 0
+			}
+			opts.count = count
+			i++
+			continue
+		case option == "BLOCK" && i+1 < len(args):
+			ms, ok := app.ParseInt(args[i+1].Bulk)
+			if !ok {
+				return fail(Error("ERR timeout is not an integer or out of range"))
+			}
+			if ms < 0 {
+				return fail(Error("ERR timeout is negative"))
+			}
+			opts.block, opts.timeout = true, time.Duration(ms)*time.Millisecond
+			i++
+			continue
+		case option == "GROUP" && group && i+2 < len(args):
+			opts.group, opts.member = args[i+1].Bulk, args[i+2].Bulk
+			i += 2
+			continue
+		case option == "NOACK" && group:
+			opts.noAck = true
+			continue
+		default:
+			return fail(ErrorReply(app.ErrSyntax))
+		}
+		break
+	}
+	if i >= len(args) {
+		return fail(ErrorReply(app.ErrSyntax))
+	}
+	rest := args[i+1:]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		return fail(Errorf("ERR Unbalanced '%s' list of streams: for each stream key an ID or '$' must be specified.", name))
+	}
+	if group && opts.group == "" {
+		return fail(Error("ERR Missing GROUP option for XREADGROUP"))
+	}
+	opts.keys = bulks(rest[:len(rest)/2])
+	opts.ids = bulks(rest[len(rest)/2:])
+	for _, id := range opts.ids {
+		switch {
+		case id == "$" && group:
+			return fail(Error("ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set."))
+		case id == ">" && !group:
+			return fail(Error("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option."))
+		case id == "$" || id == ">":
+		default:
+			if _, ok := app.ParseStreamID(id, 0); !ok || id == "-" || id == "+" {
+				return fail(ErrorReply(app.ErrStreamID))
+			}
+		}
+	}
+	if opts.count > math.MaxInt32 {
+		opts.count = math.MaxInt32
+	}
+	return opts, nil
+}
+
+// XRead reads entries from streams, blocking until some are added when
+// asked to: XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func XRead(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	opts, reply := parseXRead(args, "xread", false)
+	if reply != nil {
+		return *reply
+	}
+	req := app.BlockRequest{
+		Keys:   opts.keys,
+		Count:  int(opts.count),
+		Stream: true,
+		IDs:    opts.ids,
+	}
+	result := blockGeneric(v, req, opts.block, opts.timeout, actions)
+	switch {
+	case result == nil:
+		return NullArray()
+	case result.Err != nil:
+		return ErrorReply(result.Err)
+	default:
+		return streamsReply(result.Streams, actions.Protocol())
+	}
+}
+
+// XReadGroup reads entries from streams on behalf of a consumer of a
+// group, blocking until new ones are added when asked to:
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func XReadGroup(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	opts, reply := parseXRead(args, "xreadgroup", true)
+	if reply != nil {
+		return *reply
+	}
+	// Replicas replay the read in its non blocking form, for the served key
+	// alone when the client was parked.
+	propagated := func(keys []string, ids []string) []string {
+		cmd := []string{"XREADGROUP", "GROUP", opts.group, opts.member}
+		if opts.count > 0 {
+			cmd = append(cmd, "COUNT", strconv.FormatInt(opts.count, 10))
+		}
+		if opts.noAck {
+			cmd = append(cmd, "NOACK")
+		}
+		cmd = append(cmd, "STREAMS")
+		cmd = append(cmd, keys...)
+		return append(cmd, ids...)
+	}
+	req := app.BlockRequest{
+		Keys:     opts.keys,
+		Count:    int(opts.count),
+		Stream:   true,
+		IDs:      opts.ids,
+		Group:    opts.group,
+		Consumer: opts.member,
+		NoAck:    opts.noAck,
+		Propagate: func(key string, values []string) []string {
+			if key == "" {
+				return propagated(opts.keys, opts.ids)
+			}
+			return propagated([]string{key}, []string{">"})
+		},
+	}
+	result := blockGeneric(v, req, opts.block, opts.timeout, actions)
+	switch {
+	case result == nil:
+		return NullArray()
+	case errors.Is(result.Err, app.ErrNoGroup):
+		return noGroup(result.Key, opts.group, " in XREADGROUP with GROUP option")
+	case result.Err != nil:
+		return ErrorReply(result.Err)
+	default:
+		return streamsReply(result.Streams, actions.Protocol())
+	}
+}
+
+// parseEntriesRead parses the argument of ENTRIESREAD.
+func parseEntriesRead(arg string) (int64, *Command) {
+	n, ok := app.ParseInt(arg)
+	if !ok {
+		reply := ErrorReply(app.ErrNotInteger)
+		return 0, &reply
+	}
+	if n < -1 {
+		reply := Error("ERR value for ENTRIESREAD must be positive or -1")
+		return 0, &reply
+	}
+	return n, nil
+}
+
+// XGroup manages consumer groups:
+// XGROUP CREATE key group id|$ [MKSTREAM] [ENTRIESREAD entries-read]
+// XGROUP SETID key group id|$ [ENTRIESREAD entries-read]
+// XGROUP DESTROY key group
+// XGROUP CREATECONSUMER key group consumer
+// XGROUP DELCONSUMER key group consumer
+func XGroup(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("xgroup")
+	}
+	sub := strings.ToUpper(args[0].Bulk)
+	wrongArgs := Errorf("ERR wrong number of arguments for 'xgroup|%s' command", strings.ToLower(sub))
+	groupError := func(key string, group string, err error) Command {
+		if errors.Is(err, app.ErrNoGroup) {
+			return noConsumerGroup(key, group)
+		}
+		return ErrorReply(err)
+	}
+
+	switch sub {
+	case "CREATE", "SETID":
+		if len(args) < 4 {
+			return wrongArgs
+		}
+		key, group, id := args[1].Bulk, args[2].Bulk, args[3].Bulk
+		mkStream, entriesRead := false, int64(-1)
+		for i := 4; i < len(args); i++ {
+			option := strings.ToUpper(args[i].Bulk)
+			switch {
+			case option == "MKSTREAM" && sub == "CREATE":
+				mkStream = true
+			case option == "ENTRIESREAD" && i+1 < len(args):
+				var reply *Command
+				if entriesRead, reply = parseEntriesRead(args[i+1].Bulk); reply != nil {
+					return *reply
+				}
+				i++
+			default:
+				return ErrorReply(app.ErrSyntax)
+			}
+		}
+		var err error
+		if sub == "CREATE" {
+			err = v.XGroupCreate(key, group, id, mkStream, entriesRead)
+		} else {
+			err = v.XGroupSetID(key, group, id, entriesRead)
+		}
+		if err != nil {
+			actions.PropagateAs()
+			return groupError(key, group, err)
+		}
+		return OK()
+	case "DESTROY":
+		if len(args) != 3 {
+			return wrongArgs
+		}
+		destroyed, err := v.XGroupDestroy(args[1].Bulk, args[2].Bulk)
+		if err != nil {
+			return ErrorReply(err)
+		}
+		if !destroyed {
+			actions.PropagateAs()
+		}
+		return boolInteger(destroyed)
+	case "CREATECONSUMER":
+		if len(args) != 4 {
+			return wrongArgs
+		}
+		created, err := v.XGroupCreateConsumer(args[1].Bulk, args[2].Bulk, args[3].Bulk)
+		if err != nil {
+			return groupError(args[1].Bulk, args[2].Bulk, err)
+		}
+		if !created {
+			actions.PropagateAs()
+		}
+		return boolInteger(created)
+	case "DELCONSUMER":
+		if len(args) != 4 {
+			return wrongArgs
+		}
+		pending, err := v.XGroupDelConsumer(args[1].Bulk, args[2].Bulk, args[3].Bulk)
+		if err != nil {
+			return groupError(args[1].Bulk, args[2].Bulk, err)
+		}
+		return Integer(int64(pending))
+	default:
+		return Errorf("ERR unknown subcommand '%s'. Try XGROUP HELP.", args[0].Bulk)
+	}
+}
+
+// XAck acknowledges entries pending in a consumer group:
+// XACK key group id [id ...]
+func XAck(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 3 {
+		return WrongArgs("xack")
+	}
+	ids, reply := parseStreamIDs(args[2:])
+	if reply != nil {
+		return *reply
+	}
+	acked, err := v.XAck(args[0].Bulk, args[1].Bulk, ids)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if acked == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(acked))
+}
+
+// XPending inspects the entries pending in a consumer group:
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func XPending(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("xpending")
+	}
+	key, group := args[0].Bulk, args[1].Bulk
+	if len(args) == 2 {
+		summary, err := v.XPendingSummary(key, group)
+		if errors.Is(err, app.ErrNoGroup) {
+			return noGroup(key, group, "")
+		}
+		if err != nil {
+			return ErrorReply(err)
+		}
+		if summary.Count == 0 {
+			return Array(Integer(0), Null(), Null(), NullArray())
+		}
+		consumers := make([]Command, len(summary.Consumers))
+		for i, c := range summary.Consumers {
+			consumers[i] = BulkList([]string{c.Name, strconv.Itoa(c.Count)})
+		}
+		return Array(Integer(int64(summary.Count)), BulkString(summary.First.String()),
+			BulkString(summary.Last.String()), Array(consumers...))
+	}
+
+	rest := args[2:]
+	minIdle := int64(0)
+	if strings.ToUpper(rest[0].Bulk) == "IDLE" {
+		if len(rest) < 2 {
+			return ErrorReply(app.ErrSyntax)
+		}
+		var ok bool
+		if minIdle, ok = app.ParseInt(rest[1].Bulk); !ok {
+			return ErrorReply(app.ErrNotInteger)
+		}
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return ErrorReply(app.ErrSyntax)
+	}
+	start, reply := parseRangeID(rest[0].Bulk, 0, true)
+	if reply != nil {
+		return *reply
+	}
+	end, reply := parseRangeID(rest[1].Bulk, math.MaxUint64, false)
+	if reply != nil {
+		return *reply
+	}
+	count, ok := app.ParseInt(rest[2].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > math.MaxInt32 {
+		count = math.MaxInt32
+	}
+	consumer := ""
+	if len(rest) == 4 {
+		consumer = rest[3].Bulk
+	}
+
+	pending, err := v.XPending(key, group, start, end, int(count), consumer, minIdle)
+	if errors.Is(err, app.ErrNoGroup) {
+		return noGroup(key, group, "")
+	}
+	if err != nil {
+		return ErrorReply(err)
+	}
+	replies := make([]Command, len(pending))
+	for i, p := range pending {
+		replies[i] = Array(BulkString(p.ID.String()), BulkString(p.Consumer), Integer(p.Idle), Integer(p.DeliveryCount))
+	}
+	return Array(replies...)
+}
+
+// claimPropagation returns the XCLAIM replicas replay for a claim: the
+// entries claimed or found deleted, regardless of their idle time.
+func claimPropagation(key string, group string, consumer string, claimed []app.StreamEntry, deleted []app.StreamID, options []string) []string {
+	cmd := []string{"XCLAIM", key, group, consumer, "0"}
+	for _, entry := range claimed {
+		cmd = append(cmd, entry.ID.String())
+	}
+	for _, id := range deleted {
+		cmd = append(cmd, id.String())
+	}
+	return append(cmd, options...)
+}
+
+// XClaim transfers pending entries to another consumer:
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+// [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func XClaim(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 5 {
+		return WrongArgs("xclaim")
+	}
+	key, group, consumer := args[0].Bulk, args[1].Bulk, args[2].Bulk
+	minIdle, ok := app.ParseInt(args[3].Bulk)
+	if !ok {
+		return Error("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	if minIdle < 0 {
+		minIdle = 0
+	}
+	i := 4
+	var ids []app.StreamID
+	for ; i < len(args); i++ {
+		id, ok := app.ParseStreamID(args[i].Bulk, 0)
+		if !ok || args[i].Bulk == "-" || args[i].Bulk == "+" {
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	opts := app.StreamClaim{MinIdle: minIdle, RetryCount: -1}
+	var options []string
+	now := time.Now().UnixMilli()
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(args[i].Bulk)
+		switch {
+		case option == "FORCE":
+			opts.Force = true
+		case option == "JUSTID":
+			opts.JustID = true
+		case (option == "IDLE" || option == "TIME" || option == "RETRYCOUNT") && i+1 < len(args):
+			n, ok := app.ParseInt(args[i+1].Bulk)
+			if !ok {
+				return Errorf("ERR Invalid %s option argument for XCLAIM", option)
+			}
+			switch option {
+			case "IDLE":
+				opts.DeliveryTime = now - n
+			case "TIME":
+				opts.DeliveryTime = n
+			default:
+				opts.RetryCount = n
+			}
+			options = append(options, option, args[i+1].Bulk)
+			i++
+			continue
+		case option == "LASTID" && i+1 < len(args):
+			id, ok := app.ParseStreamID(args[i+1].Bulk, 0)
+			if !ok {
+				return ErrorReply(app.ErrStreamID)
+			}
+			opts.LastID = id
+			options = append(options, option, args[i+1].Bulk)
+			i++
+			continue
+		default:
+			return Errorf("ERR Unrecognized XCLAIM option '%s'", args[i].Bulk)
+		}
+		options = append(options, option)
+	}
+
+	claimed, deleted, err := v.XClaim(key, group, consumer, ids, opts)
+	if errors.Is(err, app.ErrNoGroup) {
+		return noGroup(key, group, "")
+	}
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if len(claimed) == 0 && len(deleted) == 0 && opts.LastID.IsZero() {
+		actions.PropagateAs()
+	} else {
+		actions.PropagateAs(claimPropagation(key, group, consumer, claimed, deleted, options)...)
+	}
+	return entriesReply(claimed, opts.JustID)
+}
+
+// XAutoClaim transfers pending entries idle for long enough to another
+// consumer, scanning the pending entries list like SCAN:
+// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+func XAutoClaim(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 5 {
+		return WrongArgs("xautoclaim")
+	}
+	key, group, consumer := args[0].Bulk, args[1].Bulk, args[2].Bulk
+	minIdle, ok := app.ParseInt(args[3].Bulk)
+	if !ok {
+		return Error("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	if minIdle < 0 {
+		minIdle = 0
+	}
+	start, reply := parseRangeID(args[4].Bulk, 0, true)
+	if reply != nil {
+		return *reply
+	}
+	count, justID := int64(XAUTOCLAIM_DEFAULT_COUNT), false
+	for i := 5; i < len(args); i++ {
+		option := strings.ToUpper(args[i].Bulk)
+		switch {
+		case option == "JUSTID":
+			justID = true
+		case option == "COUNT" && i+1 < len(args):
+			if count, ok = app.ParseInt(args[i+1].Bulk); !ok || count < 1 || count > math.MaxInt32/10 {
+				return Error("ERR COUNT must be > 0")
+			}
+			i++
+		default:
+			return ErrorReply(app.ErrSyntax)
+		}
+	}
+
+	next, claimed, deleted, err := v.XAutoClaim(key, group, consumer, minIdle, start, int(count), justID)
+	if errors.Is(err, app.ErrNoGroup) {
+		return noGroup(key, group, "")
+	}
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if len(claimed) == 0 && len(deleted) == 0 {
+		actions.PropagateAs()
+	} else {
+		var options []string
+		if justID {
+			options = []string{"JUSTID"}
+		}
+		actions.PropagateAs(claimPropagation(key, group, consumer, claimed, deleted, options)...)
+	}
+	return Array(BulkString(next.String()), entriesReply(claimed, justID), streamIDs(deleted))
+}
+
+// nullableInteger replies with n, or null when it is -1.
+func nullableInteger(n int64) Command {
+	if n == -1 {
+		return Null()
+	}
+	return Integer(n)
+}
+
+// XInfo describes streams and their consumer groups:
+// XINFO STREAM key | XINFO GROUPS key | XINFO CONSUMERS key group
+func XInfo(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("xinfo")
+	}
+	sub := strings.ToUpper(args[0].Bulk)
+	wrongArgs := Errorf("ERR wrong number of arguments for 'xinfo|%s' command", strings.ToLower(sub))
+	switch sub {
+	case "STREAM":
+		if len(args) != 2 {
+			return wrongArgs
+		}
+		info, exists, err := v.XInfoStream(args[1].Bulk)
+		if err != nil {
+			return ErrorReply(err)
+		}
+		if !exists {
+			return ErrorReply(app.ErrNoSuchKey)
+		}
+		first, last := NullArray(), NullArray()
+		if info.First != nil {
+			first, last = entryReply(*info.First, false), entryReply(*info.Last, false)
+		}
+		return Map(
+			BulkString("length"), Integer(int64(info.Length)),
+			BulkString("last-generated-id"), BulkString(info.LastID.String()),
+			BulkString("max-deleted-entry-id"), BulkString(info.MaxDeletedID.String()),
+			BulkString("entries-added"), Integer(int64(info.EntriesAdded)),
+			BulkString("recorded-first-entry-id"), BulkString(info.FirstID.String()),
+			BulkString("groups"), Integer(int64(info.Groups)),
+			BulkString("first-entry"), first,
+			BulkString("last-entry"), last,
+		)
+	case "GROUPS":
+		if len(args) != 2 {
+			return wrongArgs
+		}
+		groups, exists, err := v.XInfoGroups(args[1].Bulk)
+		if err != nil {
+			return ErrorReply(err)
+		}
+		if !exists {
+			return ErrorReply(app.ErrNoSuchKey)
+		}
+		replies := make([]Command, len(groups))
+		for i, g := range groups {
+			replies[i] = Map(
+				BulkString("name"), BulkString(g.Name),
+				BulkString("consumers"), Integer(int64(g.Consumers)),
+				BulkString("pending"), Integer(int64(g.Pending)),
+				BulkString("last-delivered-id"), BulkString(g.LastID.String()),
+				BulkString("entries-read"), nullableInteger(g.EntriesRead),
+				BulkString("lag"), nullableInteger(g.Lag),
+			)
+		}
+		return Array(replies...)
+	case "CONSUMERS":
+		if len(args) != 3 {
+			return wrongArgs
+		}
+		consumers, err := v.XInfoConsumers(args[1].Bulk, args[2].Bulk)
+		if errors.Is(err, app.ErrNoGroup) {
+			return noConsumerGroup(args[1].Bulk, args[2].Bulk)
+		}
+		if err != nil {
+			return ErrorReply(err)
+		}
+		replies := make([]Command, len(consumers))
+		for i, c := range consumers {
+			replies[i] = Map(
+				BulkString("name"), BulkString(c.Name),
+				BulkString("pending"), Integer(int64(c.Pending)),
+				BulkString("idle"), Integer(c.Idle),
+				BulkString("inactive"), Integer(c.Inactive),
+			)
+		}
+		return Array(replies...)
+	default:
+		return Errorf("ERR unknown subcommand '%s'. Try XINFO HELP.", args[0].Bulk)
+	}
+}
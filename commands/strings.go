@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"rednav/app"
+	"rednav/interfaces"
+	"strings"
+)
+
+// Append appends a value to a string: APPEND key value
+func Append(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("append")
+	}
+	n, err := v.Append(args[0].Bulk, args[1].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
+
+// StrLen returns the length of a string: STRLEN key
+func StrLen(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("strlen")
+	}
+	n, err := v.StrLen(args[0].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
+
+// GetRange returns a substring: GETRANGE key start end
+func GetRange(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("getrange")
+	}
+	start, ok := app.ParseInt(args[1].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	end, ok := app.ParseInt(args[2].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	value, err := v.GetRange(args[0].Bulk, start, end)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return BulkString(value)
+}
+
+// SetRange overwrites part of a string: SETRANGE key offset value
+func SetRange(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("setrange")
+	}
+	offset, ok := app.ParseInt(args[1].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	if offset < 0 {
+		return Error("ERR offset is out of range")
+	}
+	if offset > app.MAX_STRING_SIZE {
+		return ErrorReply(app.ErrStringTooLong)
+	}
+	n, err := v.SetRange(args[0].Bulk, int(offset), args[2].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if args[2].Bulk == "" {
+		actions.PropagateAs()
+	}
+	return Integer(int64(n))
+}
+
+// MGet returns the values of several keys: MGET key [key ...]
+func MGet(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 1 {
+		return WrongArgs("mget")
+	}
+	values, found := v.MGet(bulks(args))
+	replies := make([]Command, len(values))
+	for i, value := range values {
+		if found[i] {
+			replies[i] = BulkString(value)
+		} else {
+			replies[i] = Null()
+		}
+	}
+	return Array(replies...)
+}
+
+// MSet sets several keys at once: MSET key value [key value ...]
+func MSet(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return WrongArgs("mset")
+	}
+	v.MSet(bulks(args), false)
+	return OK()
+}
+
+// MSetNX sets several keys at once unless any of them exists:
+// MSETNX key value [key value ...]
+func MSetNX(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return WrongArgs("msetnx")
+	}
+	if !v.MSet(bulks(args), true) {
+		actions.PropagateAs()
+		return Integer(0)
+	}
+	return Integer(1)
+}
+
+// LCS returns the longest common subsequence of two strings:
+// LCS key1 key2 [LEN] [IDX] [MINMATCHLEN min-match-len] [WITHMATCHLEN]
+func LCS(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("lcs")
+	}
+	getLen, getIdx, withMatchLen := false, false, false
+	minMatchLen := int64(0)
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i].Bulk); {
+		case option == "LEN":
+			getLen = true
+		case option == "IDX":
+			getIdx = true
+		case option == "WITHMATCHLEN":
+			withMatchLen = true
+		case option == "MINMATCHLEN" && i+1 < len(args):
+			i++
+			n, ok := app.ParseInt(args[i].Bulk)
+			if !ok {
+				return ErrorReply(app.ErrNotInteger)
+			}
+			if n > 0 {
+				minMatchLen = n
+			}
+		default:
+			return ErrorReply(app.ErrSyntax)
+		}
+	}
+	if getLen && getIdx {
+		return Error("ERR If you want both the length and indexes, please just use IDX.")
+	}
+
+	a, b, err := v.GetStringPair(args[0].Bulk, args[1].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	lcs, matches, err := app.LCS(a, b, int(minMatchLen))
+	if err != nil {
+		return ErrorReply(err)
+	}
+
+	switch {
+	case getIdx:
+		replies := make([]Command, len(matches))
+		for i, m := range matches {
+			match := []Command{
+				Array(Integer(int64(m.AStart)), Integer(int64(m.AEnd))),
+				Array(Integer(int64(m.BStart)), Integer(int64(m.BEnd))),
+			}
+			if withMatchLen {
+				match = append(match, Integer(int64(m.Len())))
+			}
+			replies[i] = Array(match...)
+		}
+		return Map(BulkString("matches"), Array(replies...), BulkString("len"), Integer(int64(len(lcs))))
+	case getLen:
+		return Integer(int64(len(lcs)))
+	default:
+		return BulkString(lcs)
+	}
+}
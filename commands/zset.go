@@ -0,0 +1,620 @@
+package commands
+
+import (
+	"math"
+	"rednav/app"
+	"rednav/interfaces"
+	"strconv"
+	"strings"
+)
+
+// ZAdd adds members to a sorted set or updates their score:
+// ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func ZAdd(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 3 {
+		return WrongArgs("zadd")
+	}
+	flags := 0
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Bulk) {
+		case "NX":
+			flags |= app.ZADD_NX
+		case "XX":
+			flags |= app.ZADD_XX
+		case "GT":
+			flags |= app.ZADD_GT
+		case "LT":
+			flags |= app.ZADD_LT
+		case "CH":
+			flags |= app.ZADD_CH
+		case "INCR":
+			flags |= app.ZADD_INCR
+		default:
+			break options
+		}
+	}
+	rest := args[i:]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		return ErrorReply(app.ErrSyntax)
+	}
+	if flags&app.ZADD_NX != 0 && flags&app.ZADD_XX != 0 {
+		return Error("ERR XX and NX options at the same time are not compatible")
+	}
+	if (flags&app.ZADD_GT != 0 && flags&app.ZADD_LT != 0) ||
+		(flags&app.ZADD_NX != 0 && flags&(app.ZADD_GT|app.ZADD_LT) != 0) {
+		return Error("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if flags&app.ZADD_INCR != 0 && len(rest) > 2 {
+		return Error("ERR INCR option supports a single increment-element pair")
+	}
+	pairs, reply := parseScorePairs(rest)
+	if reply != nil {
+		return *reply
+	}
+
+	n, score, performed, err := v.ZAdd(args[0].Bulk, pairs, flags)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !performed {
+		actions.PropagateAs()
+	}
+	if flags&app.ZADD_INCR != 0 {
+		if !performed {
+			return Null()
+		}
+		return Double(score)
+	}
+	return Integer(int64(n))
+}
+
+func parseScorePairs(args []Command) ([]app.ScoreMember, *Command) {
+	pairs := make([]app.ScoreMember, len(args)/2)
+	for i := range pairs {
+		score, ok := app.ParseScore(args[2*i].Bulk)
+		if !ok {
+			reply := ErrorReply(app.ErrNotFloat)
+			return nil, &reply
+		}
+		pairs[i] = app.ScoreMember{Member: args[2*i+1].Bulk, Score: score}
+	}
+	return pairs, nil
+}
+
+// ZIncrBy increments the score of a sorted set member:
+// ZINCRBY key increment member
+func ZIncrBy(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("zincrby")
+	}
+	pairs, reply := parseScorePairs(args[1:])
+	if reply != nil {
+		return *reply
+	}
+	_, score, _, err := v.ZAdd(args[0].Bulk, pairs, app.ZADD_INCR)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Double(score)
+}
+
+// ZCard returns the number of members of a sorted set: ZCARD key
+func ZCard(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 1 {
+		return WrongArgs("zcard")
+	}
+	n, err := v.ZCard(args[0].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
+
+// ZScore returns the score of a sorted set member: ZSCORE key member
+func ZScore(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 2 {
+		return WrongArgs("zscore")
+	}
+	score, found, err := v.ZScore(args[0].Bulk, args[1].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if !found {
+		return Null()
+	}
+	return Double(score)
+}
+
+// ZMScore returns the scores of sorted set members:
+// ZMSCORE key member [member ...]
+func ZMScore(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("zmscore")
+	}
+	scores, found, err := v.ZMScore(args[0].Bulk, bulks(args[1:]))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	replies := make([]Command, len(scores))
+	for i := range scores {
+		if found[i] {
+			replies[i] = Double(scores[i])
+		} else {
+			replies[i] = Null()
+		}
+	}
+	return Array(replies...)
+}
+
+// ZRank returns the rank of a member, lowest score first:
+// ZRANK key member [WITHSCORE]
+func ZRank(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zrankGeneric(v, args, "zrank", false)
+}
+
+// ZRevRank returns the rank of a member, highest score first:
+// ZREVRANK key member [WITHSCORE]
+func ZRevRank(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zrankGeneric(v, args, "zrevrank", true)
+}
+
+func zrankGeneric(v *app.Vault, args []Command, name string, rev bool) Command {
+	if len(args) != 2 && len(args) != 3 {
+		return WrongArgs(name)
+	}
+	withScore := len(args) == 3
+	if withScore && strings.ToUpper(args[2].Bulk) != "WITHSCORE" {
+		return ErrorReply(app.ErrSyntax)
+	}
+	rank, score, found, err := v.ZRank(args[0].Bulk, args[1].Bulk, rev)
+	switch {
+	case err != nil:
+		return ErrorReply(err)
+	case !found && withScore:
+		return NullArray()
+	case !found:
+		return Null()
+	case withScore:
+		return Array(Integer(int64(rank)), Double(score))
+	default:
+		return Integer(int64(rank))
+	}
+}
+
+// scoreMembers replies with members, followed by their score when
+// withScores is set: flat for RESP2 and as pairs for RESP3.
+func scoreMembers(members []app.ScoreMember, withScores bool, proto int) Command {
+	replies := make([]Command, 0, 2*len(members))
+	for _, m := range members {
+		switch {
+		case !withScores:
+			replies = append(replies, BulkString(m.Member))
+		case proto == RESP3:
+			replies = append(replies, Array(BulkString(m.Member), Double(m.Score)))
+		default:
+			replies = append(replies, BulkString(m.Member), Double(m.Score))
+		}
+	}
+	return Array(replies...)
+}
+
+// ZRange returns a range of members of a sorted set:
+// ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func ZRange(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zrangeGeneric(v, args, actions, "zrange", app.ZRANGE_RANK, false, true)
+}
+
+// ZRevRange returns a range of members by rank, highest score first:
+// ZREVRANGE key start stop [WITHSCORES]
+func ZRevRange(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zrangeGeneric(v, args, actions, "zrevrange", app.ZRANGE_RANK, true, false)
+}
+
+// ZRangeByScore returns the members within a range of scores:
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func ZRangeByScore(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zrangeGeneric(v, args, actions, "zrangebyscore", app.ZRANGE_SCORE, false, false)
+}
+
+// ZRevRangeByScore returns the members within a range of scores, highest
+// first: ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func ZRevRangeByScore(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zrangeGeneric(v, args, actions, "zrevrangebyscore", app.ZRANGE_SCORE, true, false)
+}
+
+// ZRangeByLex returns the members within a lexicographical range:
+// ZRANGEBYLEX key min max [LIMIT offset count]
+func ZRangeByLex(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zrangeGeneric(v, args, actions, "zrangebylex", app.ZRANGE_LEX, false, false)
+}
+
+// ZRevRangeByLex returns the members within a lexicographical range in
+// reverse order: ZREVRANGEBYLEX key max min [LIMIT offset count]
+func ZRevRangeByLex(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zrangeGeneric(v, args, actions, "zrevrangebylex", app.ZRANGE_LEX, true, false)
+}
+
+func zrangeGeneric(v *app.Vault, args []Command, actions interfaces.ServerActions, name string, by int, rev bool, auto bool) Command {
+	if len(args) < 3 {
+		return WrongArgs(name)
+	}
+	spec, withScores, reply := parseZRange(args[1:], by, rev, auto, false)
+	if reply != nil {
+		return *reply
+	}
+	members, err := v.ZRange(args[0].Bulk, spec)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return scoreMembers(members, withScores, actions.Protocol())
+}
+
+// ZRangeStore stores a range of members of a sorted set:
+// ZRANGESTORE dst src min max [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+func ZRangeStore(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 4 {
+		return WrongArgs("zrangestore")
+	}
+	spec, _, reply := parseZRange(args[2:], app.ZRANGE_RANK, false, true, true)
+	if reply != nil {
+		return *reply
+	}
+	n, err := v.ZRangeStore(args[0].Bulk, args[1].Bulk, spec)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
+
+// parseZRange parses "start stop [options]" of the ZRANGE family. by and rev
+// are fixed by the legacy commands; with auto the BYSCORE, BYLEX and REV
+// options choose them instead.
+func parseZRange(args []Command, by int, rev bool, auto bool, store bool) (app.ZRangeSpec, bool, *Command) {
+	spec := app.ZRangeSpec{Count: -1}
+	withScores, limit := false, false
+	fail := func(reply Command) (app.ZRangeSpec, bool, *Command) {
+		return spec, false, &reply
+	}
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(args[i].Bulk)
+		switch {
+		case option == "WITHSCORES" && !store:
+			withScores = true
+		case option == "LIMIT" && i+2 < len(args):
+			offset, ok := app.ParseInt(args[i+1].Bulk)
+			count, ok2 := app.ParseInt(args[i+2].Bulk)
+			if !ok || !ok2 {
+				return fail(ErrorReply(app.ErrNotInteger))
+			}
+			spec.Offset, spec.Count, limit = offset, count, true
+			i += 2
+		case option == "BYSCORE" && auto && by == app.ZRANGE_RANK:
+			by = app.ZRANGE_SCORE
+		case option == "BYLEX" && auto && by == app.ZRANGE_RANK:
+			by = app.ZRANGE_LEX
+		case option == "REV" && auto:
+			rev = true
+		default:
+			return fail(ErrorReply(app.ErrSyntax))
+		}
+	}
+	if limit && by == app.ZRANGE_RANK {
+		return fail(Error("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX"))
+	}
+	if withScores && by == app.ZRANGE_LEX {
+		return fail(Error("ERR syntax error, WITHSCORES not supported in combination with BYLEX"))
+	}
+	spec.By, spec.Rev = by, rev
+
+	min, max := args[0].Bulk, args[1].Bulk
+	if rev && by != app.ZRANGE_RANK {
+		min, max = max, min
+	}
+	var err error
+	switch by {
+	case app.ZRANGE_RANK:
+		var ok, ok2 bool
+		spec.Start, ok = app.ParseInt(min)
+		spec.Stop, ok2 = app.ParseInt(max)
+		if !ok || !ok2 {
+			return fail(ErrorReply(app.ErrNotInteger))
+		}
+	case app.ZRANGE_SCORE:
+		spec.Score, err = app.ParseScoreRange(min, max)
+	case app.ZRANGE_LEX:
+		spec.Lex, err = app.ParseLexRange(min, max)
+	}
+	if err != nil {
+		return fail(ErrorReply(err))
+	}
+	return spec, withScores, nil
+}
+
+// ZRem removes members from a sorted set: ZREM key member [member ...]
+func ZRem(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("zrem")
+	}
+	removed, err := v.ZRem(args[0].Bulk, bulks(args[1:]))
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if removed == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(removed))
+}
+
+// ZRemRangeByRank removes the members within a range of ranks:
+// ZREMRANGEBYRANK key start stop
+func ZRemRangeByRank(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zremrangeGeneric(v, args, actions, "zremrangebyrank", app.ZRANGE_RANK)
+}
+
+// ZRemRangeByScore removes the members within a range of scores:
+// ZREMRANGEBYSCORE key min max
+func ZRemRangeByScore(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zremrangeGeneric(v, args, actions, "zremrangebyscore", app.ZRANGE_SCORE)
+}
+
+// ZRemRangeByLex removes the members within a lexicographical range:
+// ZREMRANGEBYLEX key min max
+func ZRemRangeByLex(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zremrangeGeneric(v, args, actions, "zremrangebylex", app.ZRANGE_LEX)
+}
+
+func zremrangeGeneric(v *app.Vault, args []Command, actions interfaces.ServerActions, name string, by int) Command {
+	if len(args) != 3 {
+		return WrongArgs(name)
+	}
+	spec, _, reply := parseZRange(args[1:], by, false, false, true)
+	if reply != nil {
+		return *reply
+	}
+	removed, err := v.ZRemRange(args[0].Bulk, spec)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if removed == 0 {
+		actions.PropagateAs()
+	}
+	return Integer(int64(removed))
+}
+
+// ZCount counts the members within a range of scores: ZCOUNT key min max
+func ZCount(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("zcount")
+	}
+	r, err := app.ParseScoreRange(args[1].Bulk, args[2].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	n, err := v.ZCount(args[0].Bulk, r)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
+
+// ZLexCount counts the members within a lexicographical range:
+// ZLEXCOUNT key min max
+func ZLexCount(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) != 3 {
+		return WrongArgs("zlexcount")
+	}
+	r, err := app.ParseLexRange(args[1].Bulk, args[2].Bulk)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	n, err := v.ZLexCount(args[0].Bulk, r)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return Integer(int64(n))
+}
+
+// ZPopMin pops the members with the lowest scores: ZPOPMIN key [count]
+func ZPopMin(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zpopGeneric(v, args, actions, "zpopmin", false)
+}
+
+// ZPopMax pops the members with the highest scores: ZPOPMAX key [count]
+func ZPopMax(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zpopGeneric(v, args, actions, "zpopmax", true)
+}
+
+func zpopGeneric(v *app.Vault, args []Command, actions interfaces.ServerActions, name string, max bool) Command {
+	if len(args) != 1 && len(args) != 2 {
+		return WrongArgs(name)
+	}
+	count := int64(1)
+	if len(args) == 2 {
+		var reply *Command
+		if count, reply = parsePositiveCount(args[1].Bulk); reply != nil {
+			return *reply
+		}
+	}
+	if count > math.MaxInt32 {
+		count = math.MaxInt32
+	}
+	members, err := v.ZPop(args[0].Bulk, int(count), max)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	if len(members) == 0 {
+		actions.PropagateAs()
+	}
+	if len(args) == 1 {
+		return scoreMembers(members, true, RESP2)
+	}
+	return scoreMembers(members, true, actions.Protocol())
+}
+
+// BZPopMin pops the member with the lowest score from the first non-empty
+// sorted set, blocking until one is available: BZPOPMIN key [key ...] timeout
+func BZPopMin(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return bzpopGeneric(v, args, actions, "bzpopmin", false)
+}
+
+// BZPopMax pops the member with the highest score from the first non-empty
+// sorted set, blocking until one is available: BZPOPMAX key [key ...] timeout
+func BZPopMax(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return bzpopGeneric(v, args, actions, "bzpopmax", true)
+}
+
+func bzpopGeneric(v *app.Vault, args []Command, actions interfaces.ServerActions, name string, max bool) Command {
+	if len(args) < 2 {
+		return WrongArgs(name)
+	}
+	timeout, reply := parseTimeout(args[len(args)-1].Bulk)
+	if reply != nil {
+		return *reply
+	}
+	req := app.BlockRequest{
+		Keys:  bulks(args[:len(args)-1]),
+		Head:  !max,
+		Count: 1,
+		ZSet:  true,
+		Propagate: func(key string, values []string) []string {
+			if max {
+				return []string{"ZPOPMAX", key}
+			}
+			return []string{"ZPOPMIN", key}
+		},
+	}
+	result := blockGeneric(v, req, true, timeout, actions)
+	switch {
+	case result == nil:
+		return NullArray()
+	case result.Err != nil:
+		return ErrorReply(result.Err)
+	default:
+		m := result.Members[0]
+		return Array(BulkString(result.Key), BulkString(m.Member), Double(m.Score))
+	}
+}
+
+// ZUnion returns the union of sorted sets:
+// ZUNION numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func ZUnion(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zsetOpGeneric(v, args, actions, "zunion", app.SET_OP_UNION, false)
+}
+
+// ZInter returns the intersection of sorted sets:
+// ZINTER numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func ZInter(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zsetOpGeneric(v, args, actions, "zinter", app.SET_OP_INTER, false)
+}
+
+// ZUnionStore stores the union of sorted sets:
+// ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+func ZUnionStore(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zsetOpGeneric(v, args, actions, "zunionstore", app.SET_OP_UNION, true)
+}
+
+// ZInterStore stores the intersection of sorted sets:
+// ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+func ZInterStore(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	return zsetOpGeneric(v, args, actions, "zinterstore", app.SET_OP_INTER, true)
+}
+
+func zsetOpGeneric(v *app.Vault, args []Command, actions interfaces.ServerActions, name string, op int, store bool) Command {
+	var dst string
+	if store {
+		if len(args) < 1 {
+			return WrongArgs(name)
+		}
+		dst, args = args[0].Bulk, args[1:]
+	}
+	if len(args) < 2 {
+		return WrongArgs(name)
+	}
+	numKeys, ok := app.ParseInt(args[0].Bulk)
+	if !ok {
+		return ErrorReply(app.ErrNotInteger)
+	}
+	if numKeys < 1 {
+		return Errorf("ERR at least 1 input key is needed for '%s' command", name)
+	}
+	if numKeys > int64(len(args)-1) {
+		return ErrorReply(app.ErrSyntax)
+	}
+	keys := bulks(args[1 : 1+numKeys])
+
+	var weights []float64
+	aggregate := app.ZAGGREGATE_SUM
+	withScores := false
+	options := args[1+numKeys:]
+	for i := 0; i < len(options); i++ {
+		option := strings.ToUpper(options[i].Bulk)
+		switch {
+		case option == "WEIGHTS" && i+len(keys) < len(options):
+			weights = make([]float64, len(keys))
+			for j := range weights {
+				weight, ok := app.ParseScore(options[i+1+j].Bulk)
+				if !ok {
+					return ErrorReply(app.ErrWeightNotFloat)
+				}
+				weights[j] = weight
+			}
+			i += len(keys)
+		case option == "AGGREGATE" && i+1 < len(options):
+			switch strings.ToUpper(options[i+1].Bulk) {
+			case "SUM":
+				aggregate = app.ZAGGREGATE_SUM
+			case "MIN":
+				aggregate = app.ZAGGREGATE_MIN
+			case "MAX":
+				aggregate = app.ZAGGREGATE_MAX
+			default:
+				return ErrorReply(app.ErrSyntax)
+			}
+			i++
+		case option == "WITHSCORES" && !store:
+			withScores = true
+		default:
+			return ErrorReply(app.ErrSyntax)
+		}
+	}
+
+	if store {
+		n, err := v.ZSetOpStore(op, dst, keys, weights, aggregate)
+		if err != nil {
+			return ErrorReply(err)
+		}
+		return Integer(int64(n))
+	}
+	members, err := v.ZSetOp(op, keys, weights, aggregate)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return scoreMembers(members, withScores, actions.Protocol())
+}
+
+// ZScan incrementally iterates the members of a sorted set:
+// ZSCAN key cursor [MATCH pattern] [COUNT count]
+func ZScan(v *app.Vault, args []Command, actions interfaces.ServerActions) Command {
+	if len(args) < 2 {
+		return WrongArgs("zscan")
+	}
+	cursor, err := strconv.ParseUint(args[1].Bulk, 10, 64)
+	if err != nil {
+		return Error("ERR invalid cursor")
+	}
+	opts, reply := parseScanOptions(args[2:], false)
+	if reply != nil {
+		return *reply
+	}
+	next, members, err := v.ZScan(args[0].Bulk, cursor, opts.count, opts.pattern)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	items := make([]string, 0, 2*len(members))
+	for _, m := range members {
+		items = append(items, m.Member, FormatDouble(m.Score))
+	}
+	return Array(BulkString(strconv.FormatUint(next, 10)), BulkList(items))
+}
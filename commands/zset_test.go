@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"rednav/app"
+	"testing"
+)
+
+func TestZSetLargeScores(t *testing.T) {
+	v := app.NewVault(app.NewConfig("localhost", 0, "", 0))
+	defer v.Close()
+	dispatch(t, v, "ZADD", "z", "1234567", "a", "1e7", "b", "1700000000123", "c", "0.1", "d", "-2.5e-7", "e", "1e20", "f")
+
+	for _, c := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ZSCORE", "z", "a"}, "$7\r\n1234567\r\n"},
+		{[]string{"ZSCORE", "z", "b"}, "$8\r\n10000000\r\n"},
+		{[]string{"ZINCRBY", "z", "1", "b"}, "$8\r\n10000001\r\n"},
+		{[]string{"ZSCORE", "z", "c"}, "$13\r\n1700000000123\r\n"},
+		{[]string{"ZSCORE", "z", "d"}, "$3\r\n0.1\r\n"},
+		{[]string{"ZSCORE", "z", "e"}, "$8\r\n-2.5e-07\r\n"},
+		{[]string{"ZSCORE", "z", "f"}, "$5\r\n1e+20\r\n"},
+		{[]string{"ZRANGE", "z", "2", "3", "WITHSCORES"}, "*4\r\n$1\r\na\r\n$7\r\n1234567\r\n$1\r\nb\r\n$8\r\n10000001\r\n"},
+	} {
+		if got := dispatch(t, v, c.args...); got != c.want {
+			t.Errorf("%q = %q, want %q", c.args, got, c.want)
+		}
+	}
+}
@@ -1,5 +1,47 @@
 package interfaces
 
+import "time"
+
+// ServerActions is handed to every command handler. It exposes server level
+// operations as well as the state of the connection issuing the command.
 type ServerActions interface {
 	ReplicasConnection(string)
+	RegisterReplica(fullResync []byte)
+	PropagateAs(...string)
+
+	// CanBlock reports whether the connection may be parked by a blocking
+	// command, and Block parks it until ready is closed, the timeout (zero
+	// meaning none) elapses or the client disconnects. It reports whether
+	// ready was closed.
+	CanBlock() bool
+	Block(ready <-chan struct{}, timeout time.Duration) bool
+
+	// Watch adds keys to those the connection WATCHes for its next
+	// transaction and Unwatch forgets them all.
+	Watch(keys []string)
+	Unwatch()
+
+	// Subscribe and Unsubscribe change the channel, or pattern,
+	// subscriptions of the connection, confirming each change with a
+	// pushed message; Unsubscribe without channels drops them all.
+	Subscribe(channels []string, pattern bool)
+	Unsubscribe(channels []string, pattern bool)
+	SSubscribe(channels []string)
+	SUnsubscribe(channels []string)
+	Subscriptions() int
+	// Publish and SPublish return how many subscribers received the message.
+	Publish(channel string, message string) int
+	SPublish(channel string, message string) int
+	PubSubChannels(pattern string, shard bool) []string
+	PubSubNumSub(channels []string, shard bool) []int
+	PubSubNumPat() int
+
+	// Per-connection state.
+	ClientID() int64
+	Protocol() int
+	SetProtocol(int)
+	Name() string
+	SetName(string)
+	Authenticated() bool
+	SetAuthenticated(bool)
 }
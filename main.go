@@ -16,8 +16,18 @@ func main() {
 	port := flag.Int("port", 3312, "Port to listen on")
 	host := flag.String("host", "localhost", "Host to listen on")
 	flag.StringVar(&replica_of, "replica_of", "", "Host to replicate from")
+	requirepass := flag.String("requirepass", "", "Password clients must AUTH with")
+	dir := flag.String("dir", ".", "Directory the RDB file is loaded from and saved to")
+	dbfilename := flag.String("dbfilename", "dump.rdb", "Name of the RDB file")
+	notifyKeyspaceEvents := flag.String("notify-keyspace-events", "", "Classes of keyspace events to publish, like \"KEA\"")
 	flag.Parse()
 
+	notifyFlags, err := app.ParseKeyspaceEvents(*notifyKeyspaceEvents)
+	if err != nil {
+		fmt.Println("Invalid --notify-keyspace-events:", err)
+		return
+	}
+
 	var replicaHost string
 	var replicaPort int
 	if replica_of != "" {
@@ -35,7 +45,15 @@ func main() {
 	}
 
 	config := app.NewConfig(*host, *port, replicaHost, replicaPort)
+	config.RequirePass = *requirepass
+	config.NotifyKeyspaceEvents = notifyFlags
+	config.Dir = *dir
+	config.DBFilename = *dbfilename
 	vault := app.NewVault(config)
+	if err := vault.LoadRDBFile(); err != nil {
+		fmt.Println("Failed to load the RDB file:", err)
+		return
+	}
 
 	local_server := server.NewServer(vault, fmt.Sprintf("%s:%d", *host, *port))
 
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"rednav/app"
+	"rednav/utils"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var nextClientID int64
+
+// Client holds the state of a single client connection. It embeds the
+// server so it can be passed to handlers as their ServerActions.
+type Client struct {
+	*Server
+	conn          net.Conn
+	reader        *utils.Conn
+	id            int64
+	proto         int
+	name          string
+	authenticated bool
+
+	// wmu serializes flushes of the connection and writer goroutines.
+	wmu sync.Mutex
+	// out holds the replies and pushed messages not written yet. Other
+	// clients publishing, or writing when this is a replica, append to it
+	// too, so it is guarded by omu, and wake tells the writer goroutine
+	// there is something to flush.
+	omu  sync.Mutex
+	out  []byte
+	wake chan struct{}
+
+	replica     bool
+	registered  bool
+	replicaAddr string
+
+	// Set by handlers through PropagateAs for the command being executed.
+	propagate    []string
+	propagateSet bool
+
+	// Transaction state: multi is set from MULTI to EXEC or DISCARD, while
+	// commands are queued, and multiFailed once one could not be. executing
+	// is set while EXEC runs them.
+	multi       bool
+	multiFailed bool
+	queued      []queuedCommand
+	executing   bool
+	watch       app.Watch
+
+	// Pub/sub subscriptions, changed under the server's pubsub mutex.
+	channels      map[string]struct{}
+	patterns      map[string]struct{}
+	shardChannels map[string]struct{}
+}
+
+func NewClient(s *Server, conn net.Conn) *Client {
+	return &Client{
+		Server:        s,
+		conn:          conn,
+		id:            atomic.AddInt64(&nextClientID, 1),
+		proto:         2,
+		authenticated: s.vault.GetConfig().RequirePass == "",
+		wake:          make(chan struct{}, 1),
+		channels:      make(map[string]struct{}),
+		patterns:      make(map[string]struct{}),
+		shardChannels: make(map[string]struct{}),
+	}
+}
+
+// write queues a reply, to be sent by the next flush.
+func (c *Client) write(p []byte) {
+	c.omu.Lock()
+	c.out = append(c.out, p...)
+	c.omu.Unlock()
+}
+
+// push queues a message on behalf of another client and wakes the writer
+// goroutine, without waiting for the message to be sent. A subscriber whose
+// backlog passes PUBSUB_OUTPUT_LIMIT is disconnected instead; replicas are
+// not, their backlog starting with the whole RDB file.
+func (c *Client) push(p []byte) {
+	c.omu.Lock()
+	if !c.replica && len(c.out)+len(p) > PUBSUB_OUTPUT_LIMIT {
+		c.omu.Unlock()
+		fmt.Printf("INFO || Client %d disconnected for exceeding the pubsub output limit\n", c.id)
+		c.conn.Close()
+		return
+	}
+	c.out = append(c.out, p...)
+	c.omu.Unlock()
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// flush writes everything queued so far. Holding wmu while taking the
+// queue keeps concurrent flushes in queue order.
+func (c *Client) flush() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.omu.Lock()
+	buf := c.out
+	c.out = nil
+	c.omu.Unlock()
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// writeLoop flushes the messages pushed to the client until done is
+// closed.
+func (c *Client) writeLoop(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-c.wake:
+			if err := c.flush(); err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) ClientID() int64 {
+	return c.id
+}
+
+func (c *Client) Protocol() int {
+	return c.proto
+}
+
+func (c *Client) SetProtocol(proto int) {
+	c.proto = proto
+}
+
+func (c *Client) Name() string {
+	return c.name
+}
+
+func (c *Client) SetName(name string) {
+	c.name = name
+}
+
+func (c *Client) Authenticated() bool {
+	return c.authenticated
+}
+
+func (c *Client) SetAuthenticated(authenticated bool) {
+	c.authenticated = authenticated
+}
+
+// ReplicasConnection records the address a replica announced with REPLCONF
+// listening-port.
+func (c *Client) ReplicasConnection(address string) {
+	c.replicaAddr = address
+}
+
+// RegisterReplica queues the reply to PSYNC and marks the connection as a
+// replica, propagating writes to it from then on, right after the reply.
+func (c *Client) RegisterReplica(fullResync []byte) {
+	c.replica = true
+	c.write(fullResync)
+	c.Server.addReplica(c)
+}
+
+// PropagateAs replaces the form in which the current command is sent to
+// replicas. Calling it without arguments suppresses propagation.
+func (c *Client) PropagateAs(args ...string) {
+	c.propagate = args
+	c.propagateSet = true
+}
+
+func (c *Client) resetPropagation() {
+	c.propagate = nil
+	c.propagateSet = false
+}
+
+// flagTransaction makes EXEC fail when a command could not be queued.
+func (c *Client) flagTransaction() {
+	if c.multi {
+		c.multiFailed = true
+	}
+}
+
+func (c *Client) resetTransaction() {
+	c.multi = false
+	c.multiFailed = false
+	c.queued = nil
+}
+
+func (c *Client) Watch(keys []string) {
+	c.vault.Watch(&c.watch, keys)
+}
+
+func (c *Client) Unwatch() {
+	c.vault.Unwatch(&c.watch)
+}
+
+// CanBlock reports whether blocking commands may park this connection.
+// Commands applied from the master link or run by EXEC never block.
+func (c *Client) CanBlock() bool {
+	return c != c.masterClient && c.reader != nil && !c.executing
+}
+
+// Block parks the calling handler until ready is closed or the timeout
+// elapses, releasing the hold the running command has on the server.
+// Meanwhile the connection keeps being read, so a client that disconnects
+// is noticed; anything it pipelines is buffered for later.
+func (c *Client) Block(ready <-chan struct{}, timeout time.Duration) bool {
+	// Let transactions run while this client waits.
+	c.execMu.RUnlock()
+	defer c.execMu.RLock()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	gone := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			err := c.reader.Fill(c.conn)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				c.reader.State = utils.STATE_REQ
+				return
+			}
+			if err != nil {
+				close(gone)
+				return
+			}
+		}
+	}()
+	defer func() {
+		c.conn.SetReadDeadline(time.Now())
+		<-done
+		c.conn.SetReadDeadline(time.Time{})
+	}()
+
+	select {
+	case <-ready:
+		return true
+	case <-expired:
+		return false
+	case <-gone:
+		return false
+	}
+}
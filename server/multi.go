@@ -0,0 +1,157 @@
+package server
+
+import (
+	"rednav/commands"
+	"strings"
+)
+
+// queuedCommand is a command sent after MULTI, waiting for EXEC.
+type queuedCommand struct {
+	name string
+	args []commands.Command
+}
+
+// isTransactionCommand reports whether cmd opens, runs or discards a
+// transaction. Those are handled by the server rather than commands.Handlers
+// and are never queued.
+func isTransactionCommand(cmd string) bool {
+	switch cmd {
+	case "MULTI", "EXEC", "DISCARD":
+		return true
+	}
+	return false
+}
+
+// isNoMultiCommand reports whether cmd is refused inside a transaction.
+// Subscriptions answer with pushed messages, which have no place among the
+// replies of EXEC.
+func isNoMultiCommand(cmd string) bool {
+	switch cmd {
+	case "PSYNC", "SUBSCRIBE", "UNSUBSCRIBE", "PSUBSCRIBE", "PUNSUBSCRIBE", "SSUBSCRIBE", "SUNSUBSCRIBE":
+		return true
+	}
+	return false
+}
+
+// execute runs a command for client. Once the client sent MULTI, commands
+// are checked and queued instead, to be run together by EXEC.
+func (s *Server) execute(client *Client, cmdName string, args []commands.Command) commands.Command {
+	if (client.multi || isTransactionCommand(cmdName)) && !commands.ArityOK(cmdName, len(args)+1) {
+		client.flagTransaction()
+		return commands.WrongArgs(strings.ToLower(cmdName))
+	}
+	switch {
+	case cmdName == "MULTI":
+		return s.multi(client)
+	case cmdName == "EXEC":
+		return s.exec(client)
+	case cmdName == "DISCARD":
+		return s.discard(client)
+	case client.multi && cmdName == "WATCH":
+		return commands.Error("ERR WATCH inside MULTI is not allowed")
+	case client.multi && isNoMultiCommand(cmdName):
+		client.flagTransaction()
+		return commands.Error("ERR Command not allowed inside a transaction")
+	case client.multi:
+		client.queued = append(client.queued, queuedCommand{name: cmdName, args: args})
+		return commands.SimpleString("QUEUED")
+	}
+
+	if cmdName == "PSYNC" {
+		// Nothing may run between the snapshot and the registration of
+		// the replica.
+		s.execMu.Lock()
+		defer s.execMu.Unlock()
+	} else {
+		s.execMu.RLock()
+		defer s.execMu.RUnlock()
+	}
+	reply, propagated := s.call(client, cmdName, args)
+	if propagated != nil && client != s.masterClient {
+		s.propagate(propagated[0], toArgs(propagated[1:]))
+	}
+	s.serveBlocked()
+	return reply
+}
+
+// call runs the handler of a command and returns its reply along with the
+// command replicating it, nil when it is not propagated.
+func (s *Server) call(client *Client, cmdName string, args []commands.Command) (commands.Command, []string) {
+	client.resetPropagation()
+	reply := commands.Handlers[cmdName](s.vault, args, client)
+	if !isWriteCommand(cmdName) || reply.Typ == commands.ERROR {
+		return reply, nil
+	}
+	if client.propagateSet {
+		if len(client.propagate) == 0 {
+			return reply, nil
+		}
+		return reply, client.propagate
+	}
+	propagated := make([]string, 0, len(args)+1)
+	propagated = append(propagated, cmdName)
+	for _, arg := range args {
+		propagated = append(propagated, arg.Bulk)
+	}
+	return reply, propagated
+}
+
+func (s *Server) multi(client *Client) commands.Command {
+	if client.multi {
+		return commands.Error("ERR MULTI calls can not be nested")
+	}
+	client.multi = true
+	return commands.OK()
+}
+
+func (s *Server) discard(client *Client) commands.Command {
+	if !client.multi {
+		return commands.Error("ERR DISCARD without MULTI")
+	}
+	client.resetTransaction()
+	s.vault.Unwatch(&client.watch)
+	return commands.OK()
+}
+
+// exec runs the queued commands of client while holding off every other
+// command, unless queuing one of them failed or a watched key was modified.
+// The writes are propagated wrapped in MULTI and EXEC so that replicas apply
+// them atomically too.
+func (s *Server) exec(client *Client) commands.Command {
+	if !client.multi {
+		return commands.Error("ERR EXEC without MULTI")
+	}
+	queued, failed := client.queued, client.multiFailed
+	client.resetTransaction()
+	defer s.vault.Unwatch(&client.watch)
+	if failed {
+		return commands.Error("EXECABORT Transaction discarded because of previous errors.")
+	}
+
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+	if s.vault.WatchDirty(&client.watch) {
+		return commands.NullArray()
+	}
+	client.executing = true
+	replies := make([]commands.Command, len(queued))
+	var writes []commands.Command
+	for i, cmd := range queued {
+		reply, propagated := s.call(client, cmd.name, cmd.args)
+		replies[i] = reply
+		if propagated != nil {
+			writes = append(writes, commands.BulkList(propagated))
+		}
+	}
+	client.executing = false
+
+	if len(writes) > 0 && client != s.masterClient {
+		if len(writes) > 1 {
+			writes = append([]commands.Command{commands.BulkList([]string{"MULTI"})}, writes...)
+			writes = append(writes, commands.BulkList([]string{"EXEC"}))
+		}
+		s.propagateEncoded(commands.Encode(commands.Command{Typ: commands.MULTI, Arr: writes}))
+	}
+	s.serveBlocked()
+	return commands.Array(replies...)
+}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"rednav/commands"
+	"rednav/utils"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PUBSUB_OUTPUT_LIMIT is the backlog of messages past which a subscriber
+// that does not keep up is disconnected, like the hard pubsub limit of the
+// Redis client-output-buffer-limit.
+const PUBSUB_OUTPUT_LIMIT = 32 << 20
+
+// pubsub holds the channel, pattern and shard channel subscriptions of
+// every client. The subscriptions of a client are also kept on the client,
+// to count and drop them; both sides are only changed under mu.
+type pubsub struct {
+	mu       sync.Mutex
+	channels map[string]map[*Client]struct{}
+	patterns map[string]map[*Client]struct{}
+	shards   map[string]map[*Client]struct{}
+}
+
+func newPubSub() *pubsub {
+	return &pubsub{
+		channels: make(map[string]map[*Client]struct{}),
+		patterns: make(map[string]map[*Client]struct{}),
+		shards:   make(map[string]map[*Client]struct{}),
+	}
+}
+
+// A subscriptionKind tells channels, patterns and shard channels apart.
+type subscriptionKind int
+
+const (
+	SUBSCRIPTION_CHANNEL subscriptionKind = iota
+	SUBSCRIPTION_PATTERN
+	SUBSCRIPTION_SHARD
+)
+
+// subscriptions selects the subscriptions of a client and the server a
+// (un)subscription of kind applies to, along with the name of its
+// confirmations.
+func (c *Client) subscriptions(kind subscriptionKind) (map[string]struct{}, map[string]map[*Client]struct{}, string) {
+	switch kind {
+	case SUBSCRIPTION_PATTERN:
+		return c.patterns, c.pubsub.patterns, "psubscribe"
+	case SUBSCRIPTION_SHARD:
+		return c.shardChannels, c.pubsub.shards, "ssubscribe"
+	}
+	return c.channels, c.pubsub.channels, "subscribe"
+}
+
+// Subscriptions returns how many channels, patterns and shard channels the
+// client is subscribed to.
+func (c *Client) Subscriptions() int {
+	return len(c.channels) + len(c.patterns) + len(c.shardChannels)
+}
+
+// Subscribe subscribes the client to channels, or patterns, confirming
+// each of them with a message.
+func (c *Client) Subscribe(channels []string, pattern bool) {
+	kind := SUBSCRIPTION_CHANNEL
+	if pattern {
+		kind = SUBSCRIPTION_PATTERN
+	}
+	c.subscribe(kind, channels)
+}
+
+// SSubscribe subscribes the client to shard channels, confirming each of
+// them with a message.
+func (c *Client) SSubscribe(channels []string) {
+	c.subscribe(SUBSCRIPTION_SHARD, channels)
+}
+
+// subscribe adds subscriptions of kind. Confirmations are queued along
+// with published messages, so none is delivered ahead of its confirmation.
+func (c *Client) subscribe(kind subscriptionKind, channels []string) {
+	c.pubsub.mu.Lock()
+	defer c.pubsub.mu.Unlock()
+	subscribed, all, name := c.subscriptions(kind)
+	for _, channel := range channels {
+		if _, exists := subscribed[channel]; !exists {
+			subscribed[channel] = struct{}{}
+			if all[channel] == nil {
+				all[channel] = make(map[*Client]struct{})
+			}
+			all[channel][c] = struct{}{}
+		}
+		c.confirm(kind, name, commands.BulkString(channel))
+	}
+}
+
+// Unsubscribe unsubscribes the client from channels, or patterns, or from
+// all of them when none is given, confirming each with a message.
+func (c *Client) Unsubscribe(channels []string, pattern bool) {
+	kind := SUBSCRIPTION_CHANNEL
+	if pattern {
+		kind = SUBSCRIPTION_PATTERN
+	}
+	c.unsubscribeAndConfirm(kind, channels)
+}
+
+// SUnsubscribe unsubscribes the client from shard channels, or from all of
+// them when none is given, confirming each with a message.
+func (c *Client) SUnsubscribe(channels []string) {
+	c.unsubscribeAndConfirm(SUBSCRIPTION_SHARD, channels)
+}
+
+func (c *Client) unsubscribeAndConfirm(kind subscriptionKind, channels []string) {
+	c.pubsub.mu.Lock()
+	defer c.pubsub.mu.Unlock()
+	subscribed, all, name := c.subscriptions(kind)
+	name = strings.TrimSuffix(name, "subscribe") + "unsubscribe"
+	if len(channels) == 0 {
+		if len(subscribed) == 0 {
+			c.confirm(kind, name, commands.Null())
+			return
+		}
+		for channel := range subscribed {
+			channels = append(channels, channel)
+		}
+		sort.Strings(channels)
+	}
+	for _, channel := range channels {
+		c.unsubscribe(subscribed, all, channel)
+		c.confirm(kind, name, commands.BulkString(channel))
+	}
+}
+
+// unsubscribe drops one subscription of the client. The caller must hold
+// the pubsub mutex.
+func (c *Client) unsubscribe(subscribed map[string]struct{}, all map[string]map[*Client]struct{}, channel string) {
+	if _, exists := subscribed[channel]; !exists {
+		return
+	}
+	delete(subscribed, channel)
+	delete(all[channel], c)
+	if len(all[channel]) == 0 {
+		delete(all, channel)
+	}
+}
+
+// confirm pushes the confirmation of a (un)subscription, which carries the
+// number of subscriptions left: shard channels are counted apart from the
+// others, as in Redis. The caller must hold the pubsub mutex.
+func (c *Client) confirm(kind subscriptionKind, name string, channel commands.Command) {
+	count := len(c.channels) + len(c.patterns)
+	if kind == SUBSCRIPTION_SHARD {
+		count = len(c.shardChannels)
+	}
+	reply := commands.Push(commands.BulkString(name), channel, commands.Integer(int64(count)))
+	c.push(commands.EncodeWithProtocol(reply, c.proto))
+}
+
+// unsubscribeAll drops every subscription of a client that went away.
+func (s *Server) unsubscribeAll(c *Client) {
+	s.pubsub.mu.Lock()
+	defer s.pubsub.mu.Unlock()
+	for channel := range c.channels {
+		c.unsubscribe(c.channels, s.pubsub.channels, channel)
+	}
+	for pattern := range c.patterns {
+		c.unsubscribe(c.patterns, s.pubsub.patterns, pattern)
+	}
+	for channel := range c.shardChannels {
+		c.unsubscribe(c.shardChannels, s.pubsub.shards, channel)
+	}
+}
+
+// Publish delivers a message to the subscribers of channel and of the
+// patterns matching it, and returns how many deliveries were made.
+func (c *Client) Publish(channel string, message string) int {
+	return c.pubsub.publish(channel, message)
+}
+
+// publish implements Publish, for clients and keyspace events alike.
+// Messages are only queued on the subscribers, so a slow one holds nobody
+// up.
+func (ps *pubsub) publish(channel string, message string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	receivers := 0
+	msg := encoder(commands.Push(commands.BulkString("message"), commands.BulkString(channel), commands.BulkString(message)))
+	for sub := range ps.channels[channel] {
+		sub.push(msg(sub.proto))
+		receivers++
+	}
+	for pattern, subs := range ps.patterns {
+		if !utils.StringMatch(pattern, channel, false) {
+			continue
+		}
+		pmsg := encoder(commands.Push(commands.BulkString("pmessage"), commands.BulkString(pattern), commands.BulkString(channel), commands.BulkString(message)))
+		for sub := range subs {
+			sub.push(pmsg(sub.proto))
+			receivers++
+		}
+	}
+	return receivers
+}
+
+// SPublish delivers a message to the subscribers of a shard channel and
+// returns how many there were. Patterns never match shard channels.
+func (c *Client) SPublish(channel string, message string) int {
+	ps := c.pubsub
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	msg := encoder(commands.Push(commands.BulkString("smessage"), commands.BulkString(channel), commands.BulkString(message)))
+	for sub := range ps.shards[channel] {
+		sub.push(msg(sub.proto))
+	}
+	return len(ps.shards[channel])
+}
+
+// encoder returns a function encoding reply in a protocol, at most once
+// per protocol.
+func encoder(reply commands.Command) func(int) []byte {
+	var encoded [commands.RESP3 + 1][]byte
+	return func(proto int) []byte {
+		if encoded[proto] == nil {
+			encoded[proto] = commands.EncodeWithProtocol(reply, proto)
+		}
+		return encoded[proto]
+	}
+}
+
+// PubSubChannels returns the channels, or shard channels, with subscribers
+// matching pattern, or all of them when pattern is empty.
+func (c *Client) PubSubChannels(pattern string, shard bool) []string {
+	c.pubsub.mu.Lock()
+	defer c.pubsub.mu.Unlock()
+	all := c.pubsub.channels
+	if shard {
+		all = c.pubsub.shards
+	}
+	channels := make([]string, 0, len(all))
+	for channel := range all {
+		if pattern == "" || utils.StringMatch(pattern, channel, false) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// PubSubNumSub returns the number of subscribers of each channel, or shard
+// channel.
+func (c *Client) PubSubNumSub(channels []string, shard bool) []int {
+	c.pubsub.mu.Lock()
+	defer c.pubsub.mu.Unlock()
+	all := c.pubsub.channels
+	if shard {
+		all = c.pubsub.shards
+	}
+	counts := make([]int, len(channels))
+	for i, channel := range channels {
+		counts[i] = len(all[channel])
+	}
+	return counts
+}
+
+// PubSubNumPat returns the number of patterns subscribed to.
+func (c *Client) PubSubNumPat() int {
+	c.pubsub.mu.Lock()
+	defer c.pubsub.mu.Unlock()
+	return len(c.pubsub.patterns)
+}
+
+// isSubscribeContextCommand reports whether cmd may be sent by a RESP2
+// client with subscriptions, whose connection only carries pub/sub traffic.
+func isSubscribeContextCommand(cmd string) bool {
+	switch cmd {
+	case "SUBSCRIBE", "PSUBSCRIBE", "SSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "SUNSUBSCRIBE", "PING":
+		return true
+	}
+	return false
+}
+
+func subscribeContextError(cmd string) commands.Command {
+	return commands.Errorf("ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", strings.ToLower(cmd))
+}
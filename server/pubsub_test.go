@@ -0,0 +1,199 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubscribeConfirmations(t *testing.T) {
+	_, address := startServer(t, "")
+	sub := dial(t, address)
+
+	sub.send("SUBSCRIBE", "a", "b")
+	for _, want := range []string{
+		"*3\r\n$9\r\nsubscribe\r\n$1\r\na\r\n:1\r\n",
+		"*3\r\n$9\r\nsubscribe\r\n$1\r\nb\r\n:2\r\n",
+	} {
+		if got := sub.reply(); got != want {
+			t.Errorf("SUBSCRIBE confirmation = %q, want %q", got, want)
+		}
+	}
+	if got := sub.do("PSUBSCRIBE", "news.*"); got != "*3\r\n$10\r\npsubscribe\r\n$6\r\nnews.*\r\n:3\r\n" {
+		t.Errorf("PSUBSCRIBE confirmation = %q", got)
+	}
+	if got := sub.do("GET", "k"); got != "-ERR Can't execute 'get': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context\r\n" {
+		t.Errorf("GET while subscribed = %q", got)
+	}
+	if got := sub.do("PING"); got != "*2\r\n$4\r\npong\r\n$0\r\n\r\n" {
+		t.Errorf("PING while subscribed = %q", got)
+	}
+
+	pub := dial(t, address)
+	if got := pub.do("PUBLISH", "news.tech", "hello"); got != ":1\r\n" {
+		t.Errorf("PUBLISH = %q, want one receiver", got)
+	}
+	if got, want := sub.reply(), "*4\r\n$8\r\npmessage\r\n$6\r\nnews.*\r\n$9\r\nnews.tech\r\n$5\r\nhello\r\n"; got != want {
+		t.Errorf("pattern message = %q, want %q", got, want)
+	}
+	if got := pub.do("PUBSUB", "NUMSUB", "a", "c"); got != "*4\r\n$1\r\na\r\n:1\r\n$1\r\nc\r\n:0\r\n" {
+		t.Errorf("PUBSUB NUMSUB = %q", got)
+	}
+
+	if got := sub.do("UNSUBSCRIBE", "a"); got != "*3\r\n$11\r\nunsubscribe\r\n$1\r\na\r\n:2\r\n" {
+		t.Errorf("UNSUBSCRIBE confirmation = %q", got)
+	}
+	if got := sub.do("PUNSUBSCRIBE"); got != "*3\r\n$12\r\npunsubscribe\r\n$6\r\nnews.*\r\n:1\r\n" {
+		t.Errorf("PUNSUBSCRIBE confirmation = %q", got)
+	}
+	if got := sub.do("UNSUBSCRIBE"); got != "*3\r\n$11\r\nunsubscribe\r\n$1\r\nb\r\n:0\r\n" {
+		t.Errorf("UNSUBSCRIBE confirmation = %q", got)
+	}
+	if got := sub.do("GET", "k"); got != "$-1\r\n" {
+		t.Errorf("GET after unsubscribing from everything = %q", got)
+	}
+}
+
+func TestResp3Push(t *testing.T) {
+	_, address := startServer(t, "")
+	sub := dial(t, address)
+	if got := sub.do("HELLO", "3"); !strings.HasPrefix(got, "%") {
+		t.Fatalf("HELLO 3 = %q", got)
+	}
+	if got := sub.do("SUBSCRIBE", "ch"); got != ">3\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n:1\r\n" {
+		t.Errorf("SUBSCRIBE confirmation = %q", got)
+	}
+	// RESP3 connections may run any command while subscribed.
+	if got := sub.do("SET", "k", "v"); got != "+OK\r\n" {
+		t.Errorf("SET while subscribed = %q", got)
+	}
+
+	dial(t, address).do("PUBLISH", "ch", "hi")
+	if got := sub.reply(); got != ">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$2\r\nhi\r\n" {
+		t.Errorf("message = %q", got)
+	}
+}
+
+func TestPublishReachesReplicas(t *testing.T) {
+	masterServer, masterAddr := startServer(t, "")
+	_, replicaAddr := startServer(t, masterAddr)
+	waitForReplicas(t, masterServer, 1)
+	sub := dial(t, replicaAddr)
+	sub.do("SUBSCRIBE", "ch")
+
+	dial(t, masterAddr).do("PUBLISH", "ch", "from master")
+	if got := sub.reply(); got != "*3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$11\r\nfrom master\r\n" {
+		t.Errorf("message on the replica = %q", got)
+	}
+}
+
+func TestSlowSubscriberIsDisconnected(t *testing.T) {
+	_, address := startServer(t, "")
+	slow := dial(t, address)
+	slow.do("SUBSCRIBE", "ch")
+
+	// The subscriber reads nothing while more than PUBSUB_OUTPUT_LIMIT is
+	// published, so its backlog grows past the limit.
+	pub := dial(t, address)
+	message := strings.Repeat("x", 1<<20)
+	for i := 0; i < 2*PUBSUB_OUTPUT_LIMIT>>20; i++ {
+		if got := pub.do("PUBLISH", "ch", message); got != ":1\r\n" && got != ":0\r\n" {
+			t.Fatalf("PUBLISH = %q", got)
+		}
+	}
+	waitFor(t, "the subscriber to be dropped", func() bool {
+		return pub.do("PUBSUB", "NUMSUB", "ch") == "*2\r\n$2\r\nch\r\n:0\r\n"
+	})
+
+	// What was sent before the disconnection is followed by the end of the
+	// stream.
+	slow.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, err := slow.readReply(); err != nil {
+			break
+		}
+	}
+}
+
+func TestShardedSubscribe(t *testing.T) {
+	_, address := startServer(t, "")
+	sub := dial(t, address)
+
+	// Outside cluster mode shard channels may hash to different slots.
+	sub.send("SSUBSCRIBE", "a", "b")
+	for _, want := range []string{
+		"*3\r\n$10\r\nssubscribe\r\n$1\r\na\r\n:1\r\n",
+		"*3\r\n$10\r\nssubscribe\r\n$1\r\nb\r\n:2\r\n",
+	} {
+		if got := sub.reply(); got != want {
+			t.Errorf("SSUBSCRIBE confirmation = %q, want %q", got, want)
+		}
+	}
+	if got := dial(t, address).do("SPUBLISH", "b", "hi"); got != ":1\r\n" {
+		t.Errorf("SPUBLISH = %q", got)
+	}
+	if got := sub.reply(); got != "*3\r\n$8\r\nsmessage\r\n$1\r\nb\r\n$2\r\nhi\r\n" {
+		t.Errorf("shard message = %q", got)
+	}
+	sub.send("SUNSUBSCRIBE", "a", "b")
+	for _, want := range []string{
+		"*3\r\n$12\r\nsunsubscribe\r\n$1\r\na\r\n:1\r\n",
+		"*3\r\n$12\r\nsunsubscribe\r\n$1\r\nb\r\n:0\r\n",
+	} {
+		if got := sub.reply(); got != want {
+			t.Errorf("SUNSUBSCRIBE confirmation = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestKeyspaceEventClasses(t *testing.T) {
+	_, address := startServer(t, "")
+	sub := dial(t, address)
+	if got := sub.do("PSUBSCRIBE", "__keyevent@0__:*"); !strings.HasPrefix(got, "*3\r\n$10\r\npsubscribe\r\n") {
+		t.Fatalf("PSUBSCRIBE confirmation = %q", got)
+	}
+	c := dial(t, address)
+	if got := c.do("CONFIG", "SET", "notify-keyspace-events", "AEmn"); got != "+OK\r\n" {
+		t.Fatalf("CONFIG SET notify-keyspace-events = %q", got)
+	}
+
+	// Every class but d, which only modules publish, and e, as nothing is
+	// evicted, runs commands and then waits for an event of that class,
+	// skipping the others. pause comes before the last command.
+	for _, tt := range []struct {
+		class    string
+		commands [][]string
+		pause    time.Duration
+		event    string
+	}{
+		{"n", [][]string{{"SET", "s", "v"}}, 0, "new"},
+		{"$", [][]string{{"SET", "s", "w"}}, 0, "set"},
+		{"g", [][]string{{"DEL", "s"}}, 0, "del"},
+		{"l", [][]string{{"LPUSH", "l", "a"}}, 0, "lpush"},
+		{"s", [][]string{{"SADD", "set", "a"}}, 0, "sadd"},
+		{"h", [][]string{{"HSET", "h", "f", "v"}}, 0, "hset"},
+		{"z", [][]string{{"ZADD", "z", "1", "a"}}, 0, "zadd"},
+		{"t", [][]string{{"XADD", "x", "*", "f", "v"}}, 0, "xadd"},
+		{"x", [][]string{{"SET", "tmp", "v", "PX", "1"}, {"EXISTS", "tmp"}}, 5 * time.Millisecond, "expired"},
+		{"m", [][]string{{"GET", "missing"}}, 0, "keymiss"},
+	} {
+		for i, command := range tt.commands {
+			if i == len(tt.commands)-1 {
+				time.Sleep(tt.pause)
+			}
+			c.do(command...)
+		}
+		want := "$" + strconv.Itoa(len("__keyevent@0__:")+len(tt.event)) + "\r\n__keyevent@0__:" + tt.event + "\r\n"
+		sub.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			got, err := sub.readReply()
+			if err != nil {
+				t.Fatalf("class %s published no %s event: %v", tt.class, tt.event, err)
+			}
+			if strings.Contains(got, want) {
+				break
+			}
+		}
+	}
+}
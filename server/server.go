@@ -1,6 +1,7 @@
 package server
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	"os"
@@ -8,12 +9,7 @@ import (
 	"rednav/commands"
 	"rednav/utils"
 	"strings"
-	"time"
-)
-
-var (
-	kMaxArgs = 128
-	kMaxMsg  = 4096
+	"sync"
 )
 
 type Server struct {
@@ -24,10 +20,19 @@ type Server struct {
 	talkingWithReplica bool
 	address            string
 	masterConn         net.Conn
-	Replicas           []*net.Conn
+	masterClient       *Client
+	Replicas           []*Client
 	ReplicasStatus     map[string]bool
+	replicasMutex      sync.Mutex
 	role               string
 	quitch             chan struct{}
+	// execMu is held for reading while a command runs and for writing
+	// while EXEC runs a transaction, so nothing interleaves with it.
+	execMu sync.RWMutex
+	pubsub *pubsub
+	// fullSync is set on a replica between the FULLRESYNC reply of the
+	// master and the RDB file following it.
+	fullSync bool
 }
 
 func NewServer(vault *app.Vault, local_addr string) *Server {
@@ -37,38 +42,54 @@ func NewServer(vault *app.Vault, local_addr string) *Server {
 	}
 	server := &Server{
 		address:            local_addr,
-		Replicas:           make([]*net.Conn, 0),
+		Replicas:           make([]*Client, 0),
 		ReplicasStatus:     make(map[string]bool),
 		talkingWithMain:    false,
 		talkingWithReplica: false,
 		vault:              vault,
 		quitch:             make(chan struct{}),
 		role:               role,
+		pubsub:             newPubSub(),
 	}
 	if !server.vault.IsMaster() {
 		server.masterConn = server.vault.MasterConn
+		server.masterClient = NewClient(server, server.masterConn)
+	}
+	vault.SetKeyspaceNotifier(func(channel string, message string) {
+		server.pubsub.publish(channel, message)
+	})
+	if vault.IsMaster() {
+		vault.SetExpiryPropagator(func(command []string) {
+			server.propagate(command[0], toArgs(command[1:]))
+		})
+		vault.StartActiveExpiry(&server.execMu)
 	}
 	return server
 }
 
-func (s *Server) ReplicasConnection(address string) {
+// addReplica starts propagating writes to a client that sent PSYNC.
+func (s *Server) addReplica(client *Client) {
+	s.replicasMutex.Lock()
+	defer s.replicasMutex.Unlock()
 	s.talkingWithReplica = true
 	s.vault.ReplicaPresent = true
-	var conn net.Conn
-	var err error
-	for attempt := 0; attempt < 5; attempt++ {
-		conn, err = net.Dial("tcp", address)
-		if err == nil {
+	s.ReplicasStatus[client.replicaAddr] = true
+	s.Replicas = append(s.Replicas, client)
+	client.registered = true
+	fmt.Printf("INFO || Replica %s registered\n", client.replicaAddr)
+}
+
+func (s *Server) removeReplica(client *Client) {
+	s.replicasMutex.Lock()
+	defer s.replicasMutex.Unlock()
+	for i, replica := range s.Replicas {
+		if replica == client {
+			s.Replicas = append(s.Replicas[:i], s.Replicas[i+1:]...)
 			break
 		}
-		fmt.Printf("Attempt %d: Error connecting to replica: %v\n", attempt+1, err)
-		time.Sleep(250 * time.Millisecond)
-	}
-	if err != nil {
-		fmt.Println("Error connecting to replica: ", err)
-		return
 	}
-	s.Replicas = append(s.Replicas, &conn)
+	delete(s.ReplicasStatus, client.replicaAddr)
+	s.vault.ReplicaPresent = len(s.Replicas) > 0
 }
 
 func (s *Server) HeyListenMaster() {
@@ -78,36 +99,91 @@ func (s *Server) HeyListenMaster() {
 
 func (s *Server) acceptMasterLoop(conn net.Conn) {
 	defer conn.Close()
-	buffer := make([]byte, kMaxMsg)
+	reader := utils.NewConn()
 	for {
-		n, err := conn.Read(buffer)
-		if err != nil {
+		if err := reader.Fill(conn); err != nil {
 			fmt.Println("Error accepting connection from master: ", err)
 			return
 		}
-		s.handleMasterConnection(buffer[:n])
+		if err := s.handleMasterConnection(reader); err != nil {
+			fmt.Println("Failed to parse commands from master:", err)
+			return
+		}
 	}
 }
 
-func (s *Server) handleMasterConnection(data []byte) {
-	commands, err := utils.ParseReq(data, uint32(len(data)))
-	if err != nil {
-		fmt.Println("Failed to parse commands from master:", err)
-		return
+// handleMasterConnection applies every complete command buffered on the
+// master link, and loads the RDB file that follows FULLRESYNC. Replies to
+// the handshake are skipped.
+func (s *Server) handleMasterConnection(reader *utils.Conn) error {
+	defer reader.Compact()
+	for {
+		buffered := reader.Buffered()
+		if len(buffered) == 0 {
+			return nil
+		}
+		if s.fullSync && buffered[0] == '$' {
+			rdb, err := reader.NextRDB()
+			if err == utils.ErrIncomplete {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			s.fullSync = false
+			if err := s.loadRDB(rdb); err != nil {
+				return err
+			}
+			continue
+		}
+		if buffered[0] != '*' {
+			s.fullSync = s.fullSync || bytes.HasPrefix(buffered, []byte("+FULLRESYNC "))
+			err := reader.DiscardReply()
+			if err == utils.ErrIncomplete {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		command, err := reader.NextRequest()
+		if err == utils.ErrIncomplete {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(command) > 0 {
+			s.handleMasterCommands(command)
+		}
 	}
-	s.handleMasterCommands(commands)
+}
+
+// loadRDB replaces the dataset with the snapshot of the master, with no
+// command running.
+func (s *Server) loadRDB(rdb []byte) error {
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+	if err := s.vault.LoadRDB(rdb); err != nil {
+		return err
+	}
+	fmt.Printf("INFO || Loaded %d bytes of RDB from master\n", len(rdb))
+	return nil
 }
 
 func (s *Server) handleMasterCommands(command []string) {
-	cmdName := command[0]
+	cmdName := strings.ToUpper(command[0])
 	args := make([]commands.Command, len(command)-1)
 	for i, arg := range command[1:] {
 		args[i] = commands.Command{Typ: "bulk", Bulk: arg}
 	}
 
 	// Process command without sending response
-	if handler, exists := commands.Handlers[cmdName]; exists {
-		handler(s.vault, args, nil) // nil as ServerActions since we don't need any server actions in this context
+	if _, exists := commands.Handlers[cmdName]; exists || isTransactionCommand(cmdName) {
+		s.vault.SetMasterLink(true)
+		s.execute(s.masterClient, cmdName, args)
+		s.vault.SetMasterLink(false)
 	} else {
 		fmt.Printf("Unknown command from master: %s\n", cmdName)
 	}
@@ -127,41 +203,69 @@ func (s *Server) HeyListen() {
 func (s *Server) acceptLoop() {
 	for {
 		conn, err := s.listener.Accept()
-		s.conn = conn
-		fmt.Printf("INFO || Connection accepted, conn %v\n", conn.LocalAddr().String())
 		if err != nil {
+			select {
+			case <-s.quitch:
+				return
+			default:
+			}
 			os.Exit(1)
 		}
+		s.conn = conn
+		fmt.Printf("INFO || Connection accepted, conn %v\n", conn.LocalAddr().String())
 		go s.handleConnection(conn)
 	}
 }
 
 func (sm *Server) handleConnection(conn net.Conn) {
 	defer conn.Close()
-	for {
-		buf := make([]byte, kMaxMsg)
-		n, err := conn.Read(buf)
-		if err != nil {
+	client := NewClient(sm, conn)
+	done := make(chan struct{})
+	go client.writeLoop(done)
+	defer func() {
+		close(done)
+		if client.registered {
+			sm.removeReplica(client)
+		}
+		sm.unsubscribeAll(client)
+		sm.vault.Unwatch(&client.watch)
+	}()
+	reader := utils.NewConn()
+	client.reader = reader
+	for reader.State != utils.STATE_END {
+		if err := reader.Fill(conn); err != nil {
 			break
 		}
 
-		request_parsed, err := utils.ParseReq(buf[:n], uint32(kMaxMsg))
-		if err != nil {
-			//send the err back to the client
-			conn.Write([]byte(err.Error()))
-			return
+		// Answer every complete request in the buffer, keeping a trailing
+		// partial one for the next read.
+		for {
+			request_parsed, err := reader.NextRequest()
+			if err == utils.ErrIncomplete {
+				break
+			}
+			if err != nil {
+				//send the err back to the client and disconnect it
+				client.write([]byte("-" + err.Error() + "\r\n"))
+				reader.State = utils.STATE_END
+				break
+			}
+			if len(request_parsed) == 0 {
+				continue
+			}
+			client.write(sm.handleCommand(client, request_parsed))
 		}
+		reader.Compact()
 
-		response := sm.handleCommand(request_parsed)
-		conn.Write(response)
-		// disconect the client
+		if err := client.flush(); err != nil {
+			break
+		}
 	}
 }
 
-func (s *Server) handleCommand(message []string) []byte {
-	result := []byte("-ERR Unknown command\r\n")
+func (s *Server) handleCommand(client *Client, message []string) []byte {
 	if len(message) == 0 {
-		return []byte("-ERR Empty command\r\n")
+		return commands.EncodeWithProtocol(commands.Error("ERR Empty command"), client.proto)
 	}
 
 	cmdName := strings.ToUpper(message[0])
@@ -171,57 +275,89 @@ func (s *Server) handleCommand(message []string) []byte {
 	}
 
 	// Check if the command exists in the handlers map
-	if handler, exists := commands.Handlers[cmdName]; exists {
-		response := handler(s.vault, args, s)
-		result = formatResponse(response)
+	if _, exists := commands.Handlers[cmdName]; !exists && !isTransactionCommand(cmdName) {
+		client.flagTransaction()
+		return commands.EncodeWithProtocol(commands.Errorf("ERR unknown command '%s', with args beginning with: %s", message[0], formatArgs(message[1:])), client.proto)
 	}
-
-	if s.vault.IsMaster() && isWriteCommand(cmdName) {
-		fmt.Printf("INFO || Sending to replicas: %s\n", cmdName)
-		s.sendToReplicas(cmdName, args)
+	if !client.authenticated && cmdName != "AUTH" && cmdName != "HELLO" {
+		client.flagTransaction()
+		return commands.EncodeWithProtocol(commands.Error("NOAUTH Authentication required."), client.proto)
 	}
-
-	if !s.vault.IsMaster() && isWriteCommand(cmdName) {
-		fmt.Printf("INFO || Sending to master: %s\n", cmdName)
-		s.sendToMaster(cmdName, args)
+	if client.proto == commands.RESP2 && client.Subscriptions() > 0 && !isSubscribeContextCommand(cmdName) {
+		return commands.EncodeWithProtocol(subscribeContextError(cmdName), client.proto)
 	}
+	// Replicas only change through what their master sends on the master
+	// link, which does not come through here.
+	if !s.vault.IsMaster() && isWriteCommand(cmdName) && !isPublishCommand(cmdName) {
+		client.flagTransaction()
+		return commands.EncodeWithProtocol(commands.Error("READONLY You can't write against a read only replica."), client.proto)
+	}
+	reply := s.execute(client, cmdName, args)
+	result := commands.EncodeWithProtocol(reply, client.proto)
 
 	fmt.Printf("INFO || Command Result %s\n", result)
 	return result
 }
 
-func (s *Server) sendToMaster(cmd string, args []commands.Command) {
-	encoded := EncodeCommand(cmd, args)
-	response, err := s.vault.MasterConn.Write(encoded)
+// propagate sends a write to the replicas. A replica has none: it only
+// applies what its master sends.
+func (s *Server) propagate(cmd string, args []commands.Command) {
+	if !s.vault.IsMaster() {
+		return
+	}
+	fmt.Printf("INFO || Sending to replicas: %s\n", cmd)
+	s.sendToReplicas(EncodeCommand(cmd, args))
+}
 
-	if err != nil {
-		fmt.Println("Error sending to master: ", err)
+// propagateEncoded sends already encoded commands where propagate does.
+func (s *Server) propagateEncoded(encoded []byte) {
+	if s.vault.IsMaster() {
+		s.sendToReplicas(encoded)
 	}
+}
 
-	fmt.Printf("Response from master: %d\n", response)
+// serveBlocked hands the elements pushed by the last command to blocked
+// clients and propagates the pops they performed, right after the push
+// itself so replicas apply them in the same order.
+func (s *Server) serveBlocked() {
+	for _, served := range s.vault.ServeBlocked() {
+		s.propagate(served[0], toArgs(served[1:]))
+	}
 }
 
-// Propagate commands to replicas
-func (s *Server) sendToReplicas(cmd string, args []commands.Command) {
-	encoded := EncodeCommand(cmd, args)
+// sendToReplicas queues commands on every replica, behind the RDB file of
+// those still receiving it, to be written by their writer goroutines.
+func (s *Server) sendToReplicas(encoded []byte) {
+	s.replicasMutex.Lock()
+	defer s.replicasMutex.Unlock()
 	for _, replica := range s.Replicas {
-		(*replica).SetWriteDeadline(time.Now().Add(5 * time.Second)) // Set deadline to avoid blocking
-		_, err := (*replica).Write(encoded)
-		if err != nil {
-			fmt.Println("Error writing to replica: ", err)
-		}
+		replica.push(encoded)
 	}
 }
 
 func (s *Server) Shutdown() {
 	close(s.quitch)
+	s.vault.Close()
 	if s.listener != nil {
 		s.listener.Close()
 	}
 }
 
 func isWriteCommand(cmd string) bool {
-	writeCommands := []string{"SET", "DEL"}
+	writeCommands := []string{"SET", "DEL", "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT", "PERSIST",
+		"SETNX", "SETEX", "PSETEX", "GETSET", "GETDEL", "GETEX",
+		"UNLINK", "RENAME", "RENAMENX", "COPY",
+		"INCR", "DECR", "INCRBY", "DECRBY", "INCRBYFLOAT",
+		"APPEND", "SETRANGE", "MSET", "MSETNX", "SETBIT", "BITOP", "BITFIELD",
+		"PFADD", "PFMERGE",
+		"LPUSH", "RPUSH", "LPUSHX", "RPUSHX", "LPOP", "RPOP", "LSET", "LINSERT", "LREM", "LTRIM", "LMOVE", "RPOPLPUSH", "LMPOP",
+		"BLPOP", "BRPOP", "BLMOVE", "BRPOPLPUSH", "BLMPOP",
+		"HSET", "HMSET", "HSETNX", "HDEL", "HINCRBY", "HINCRBYFLOAT", "HEXPIRE", "HPEXPIRE", "HEXPIREAT", "HPEXPIREAT", "HPERSIST",
+		"SADD", "SREM", "SPOP", "SMOVE", "SINTERSTORE", "SUNIONSTORE", "SDIFFSTORE",
+		"ZADD", "ZINCRBY", "ZREM", "ZREMRANGEBYRANK", "ZREMRANGEBYSCORE", "ZREMRANGEBYLEX", "ZPOPMIN", "ZPOPMAX",
+		"BZPOPMIN", "BZPOPMAX", "ZRANGESTORE", "ZUNIONSTORE", "ZINTERSTORE",
+		"GEOADD", "GEOSEARCHSTORE", "PUBLISH", "SPUBLISH",
+		"XADD", "XDEL", "XTRIM", "XGROUP", "XREADGROUP", "XACK", "XCLAIM", "XAUTOCLAIM"}
 	for _, wc := range writeCommands {
 		if wc == cmd {
 			return true
@@ -230,41 +366,36 @@ func isWriteCommand(cmd string) bool {
 	return false
 }
 
-func EncodeCommand(cmd string, args []commands.Command) []byte {
-	var sb strings.Builder
-
-	// Write array header (cmdName + args)
-	sb.WriteString(fmt.Sprintf("*%d\r\n", len(args)+1))
-	sb.WriteString(fmt.Sprintf("$%d\r\n%s\r\n", len(cmd), cmd))
+// isPublishCommand reports whether cmd publishes a message. Those are
+// propagated like writes but, as in Redis, are allowed on replicas, where
+// they reach the local subscribers only.
+func isPublishCommand(cmd string) bool {
+	return cmd == "PUBLISH" || cmd == "SPUBLISH"
+}
 
-	// Write each argument in bulk string format
-	for _, cmd := range args {
-		sb.WriteString(fmt.Sprintf("$%d\r\n%s\r\n", len(cmd.Bulk), cmd.Bulk))
+func toArgs(values []string) []commands.Command {
+	args := make([]commands.Command, len(values))
+	for i, value := range values {
+		args[i] = commands.Command{Typ: commands.BULK_STRING, Bulk: value}
 	}
+	return args
+}
 
-	return []byte(sb.String())
+func EncodeCommand(cmd string, args []commands.Command) []byte {
+	parts := make([]string, 0, len(args)+1)
+	parts = append(parts, cmd)
+	for _, arg := range args {
+		parts = append(parts, arg.Bulk)
+	}
+	return commands.Encode(commands.BulkList(parts))
 }
 
-func formatResponse(cmd commands.Command) []byte {
-	switch cmd.Typ {
-	case "string":
-		return []byte(cmd.Str + "\r\n")
-	case "list":
-		return []byte("*" + fmt.Sprint(len(cmd.List)) + "\r\n" + strings.Join(cmd.List, "\r\n") + "\r\n")
-	case "nil":
-		return []byte("$-1\r\n")
-	case "err":
-		return []byte("-ERR " + cmd.Err + "\r\n")
-	case "arr", "multi":
-		var response []byte
-		for _, subCmd := range cmd.Arr {
-			response = append(response, formatResponse(subCmd)...)
-		}
-		return []byte(fmt.Sprintf("*%d\r\n%s", len(cmd.Arr), response))
-	case "bulk":
-		return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(cmd.Bulk), cmd.Bulk))
-	default:
-		fmt.Printf("Unknown response type: %v\n", cmd)
-		return []byte("-ERR Unknown response type\r\n")
+// formatArgs quotes arguments the way Redis echoes them in unknown command
+// errors.
+func formatArgs(args []string) string {
+	var sb strings.Builder
+	for _, arg := range args {
+		sb.WriteString(fmt.Sprintf("'%s' ", arg))
 	}
+	return sb.String()
 }
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"rednav/app"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startServer runs a server on a free local port until the test ends. With
+// a master address it runs as a replica of it.
+func startServer(t *testing.T, master string, configure ...func(*app.Config)) (*Server, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	var masterHost string
+	var masterPort int
+	if master != "" {
+		host, p, _ := net.SplitHostPort(master)
+		masterHost = host
+		masterPort, _ = strconv.Atoi(p)
+	}
+	config := app.NewConfig("127.0.0.1", port, masterHost, masterPort)
+	config.Dir = t.TempDir()
+	for _, f := range configure {
+		f(config)
+	}
+	s := NewServer(app.NewVault(config), fmt.Sprintf("127.0.0.1:%d", port))
+	go s.HeyListen()
+	if master != "" {
+		go s.HeyListenMaster()
+	}
+	t.Cleanup(s.Shutdown)
+
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+	waitFor(t, "the server to listen", func() bool {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	})
+	return s, address
+}
+
+// waitForReplicas waits until n replicas are registered on master, so that
+// the writes that follow are propagated rather than part of the snapshot.
+func waitForReplicas(t *testing.T, master *Server, n int) {
+	t.Helper()
+	waitFor(t, "the replicas to register", func() bool {
+		master.replicasMutex.Lock()
+		defer master.replicasMutex.Unlock()
+		return len(master.Replicas) == n
+	})
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// testClient speaks RESP to a server and returns replies as raw text, so
+// that tests check exactly what goes on the wire.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, address string) *testClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// send writes a command without waiting for its reply.
+func (c *testClient) send(args ...string) {
+	c.t.Helper()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(sb.String())); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// do sends a command and returns its reply.
+func (c *testClient) do(args ...string) string {
+	c.t.Helper()
+	c.send(args...)
+	return c.reply()
+}
+
+// reply reads the next reply or push.
+func (c *testClient) reply() string {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := c.readReply()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return reply
+}
+
+func (c *testClient) readReply() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	switch line[0] {
+	case '$', '=', '!':
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if size < 0 {
+			return line, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return "", err
+		}
+		return line + string(data), nil
+	case '*', '>', '~', '%', '|':
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if line[0] == '%' || line[0] == '|' {
+			n *= 2
+		}
+		for i := 0; i < n; i++ {
+			element, err := c.readReply()
+			if err != nil {
+				return "", err
+			}
+			line += element
+		}
+	}
+	return line, nil
+}
+
+func TestReplicaRejectsWrites(t *testing.T) {
+	masterServer, masterAddr := startServer(t, "")
+	master := dial(t, masterAddr)
+	if got := master.do("SET", "cnt", "10"); got != "+OK\r\n" {
+		t.Fatalf("SET = %q", got)
+	}
+	_, replicaAddr := startServer(t, masterAddr)
+	waitForReplicas(t, masterServer, 1)
+	replica := dial(t, replicaAddr)
+
+	for _, cmd := range [][]string{{"INCR", "cnt"}, {"RPUSH", "list", "a"}, {"EXPIRE", "cnt", "100"}} {
+		if got := replica.do(cmd...); got != "-READONLY You can't write against a read only replica.\r\n" {
+			t.Errorf("%s on the replica = %q", cmd[0], got)
+		}
+	}
+	if got := replica.do("MULTI"); got != "+OK\r\n" {
+		t.Fatalf("MULTI = %q", got)
+	}
+	replica.do("INCR", "cnt")
+	if got := replica.do("EXEC"); !strings.HasPrefix(got, "-EXECABORT") {
+		t.Errorf("EXEC of a queued write = %q", got)
+	}
+	if got := replica.do("PUBLISH", "ch", "m"); got != ":0\r\n" {
+		t.Errorf("PUBLISH on the replica = %q", got)
+	}
+
+	// Writes on the master are applied once on each side.
+	if got := master.do("INCR", "cnt"); got != ":11\r\n" {
+		t.Errorf("INCR on the master = %q", got)
+	}
+	master.do("RPUSH", "list", "a")
+	master.do("PEXPIRE", "cnt", "100000")
+	waitFor(t, "the replica to catch up", func() bool {
+		return replica.do("EXISTS", "list") == ":1\r\n"
+	})
+	waitFor(t, "the expiry to reach the replica", func() bool {
+		return replica.do("PTTL", "cnt") != ":-1\r\n"
+	})
+	for _, c := range []*testClient{master, replica} {
+		if got := c.do("GET", "cnt"); got != "$2\r\n11\r\n" {
+			t.Errorf("GET cnt = %q, want 11", got)
+		}
+		if got := c.do("LRANGE", "list", "0", "-1"); got != "*1\r\n$1\r\na\r\n" {
+			t.Errorf("LRANGE list = %q, want one element", got)
+		}
+	}
+}
+
+func TestSetOptions(t *testing.T) {
+	masterServer, masterAddr := startServer(t, "")
+	_, replicaAddr := startServer(t, masterAddr)
+	waitForReplicas(t, masterServer, 1)
+	master, replica := dial(t, masterAddr), dial(t, replicaAddr)
+
+	for _, step := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"set", "lock", "me", "nx", "px", "30000"}, "+OK\r\n"},
+		{[]string{"SET", "lock", "you", "NX", "PX", "30000"}, "$-1\r\n"},
+		{[]string{"SET", "lock", "you", "XX", "GET"}, "$2\r\nme\r\n"},
+		{[]string{"PTTL", "lock"}, ":-1\r\n"},
+		{[]string{"SET", "missing", "v", "XX"}, "$-1\r\n"},
+		{[]string{"SET", "k", "v", "NX", "XX"}, "-ERR syntax error\r\n"},
+		{[]string{"SET", "k", "v", "EX", "10", "KEEPTTL"}, "-ERR syntax error\r\n"},
+		{[]string{"SET", "k", "v", "EX", "0"}, "-ERR invalid expire time in 'set' command\r\n"},
+		{[]string{"SETEX", "session", "100", "data"}, "+OK\r\n"},
+		{[]string{"SET", "session", "data2", "KEEPTTL"}, "+OK\r\n"},
+		{[]string{"GETSET", "lock", "again"}, "$3\r\nyou\r\n"},
+		{[]string{"GETDEL", "lock"}, "$5\r\nagain\r\n"},
+		{[]string{"GETEX", "session", "PERSIST"}, "$5\r\ndata2\r\n"},
+		{[]string{"GETEX", "session", "PXAT", "4102444800000"}, "$5\r\ndata2\r\n"},
+	} {
+		if got := master.do(step.args...); got != step.want {
+			t.Errorf("%q = %q, want %q", step.args, got, step.want)
+		}
+	}
+
+	// Replicas get the absolute deadline, not a relative one.
+	master.do("SET", "timed", "v", "EX", "100")
+	want := master.do("PEXPIRETIME", "timed")
+	waitFor(t, "the replica to catch up", func() bool {
+		return replica.do("PEXPIRETIME", "timed") == want
+	})
+	for key, want := range map[string]string{"lock": "$-1\r\n", "session": "$5\r\ndata2\r\n"} {
+		if got := replica.do("GET", key); got != want {
+			t.Errorf("GET %s on the replica = %q, want %q", key, got, want)
+		}
+	}
+	if got := replica.do("PEXPIRETIME", "session"); got != ":4102444800000\r\n" {
+		t.Errorf("PEXPIRETIME session on the replica = %q", got)
+	}
+}
+
+func TestReplicaWaitsForMasterExpiry(t *testing.T) {
+	masterServer, masterAddr := startServer(t, "")
+	_, replicaAddr := startServer(t, masterAddr)
+	waitForReplicas(t, masterServer, 1)
+	master, replica := dial(t, masterAddr), dial(t, replicaAddr)
+
+	master.do("SET", "k", "v", "PX", "100")
+	waitFor(t, "the replica to get the key", func() bool {
+		return replica.do("EXISTS", "k") == ":1\r\n"
+	})
+	// Replicas never delete keys themselves, so the key only leaves the
+	// keyspace of the replica through the DEL of the master.
+	waitFor(t, "the master to propagate the expiry", func() bool {
+		return !strings.Contains(replica.do("INFO", "keyspace"), "db0:")
+	})
+	if got := replica.do("GET", "k"); got != "$-1\r\n" {
+		t.Errorf("GET k on the replica = %q", got)
+	}
+}
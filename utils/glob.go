@@ -0,0 +1,122 @@
+package utils
+
+// StringMatch reports whether str matches the glob-style pattern, with the
+// same rules as Redis: '*' matches any sequence, '?' any single byte,
+// "[abc]", "[a-z]" and "[^x]" match classes of bytes and '\' escapes the
+// next byte.
+func StringMatch(pattern string, str string, nocase bool) bool {
+	return stringMatch(pattern, str, nocase, 0)
+}
+
+func stringMatch(p string, s string, nocase bool, nesting int) bool {
+	// Bound the recursion of patterns like "a*a*a*a*...".
+	if nesting > 1000 {
+		return false
+	}
+
+	for len(p) > 0 && len(s) > 0 {
+		switch p[0] {
+		case '*':
+			for len(p) > 1 && p[1] == '*' {
+				p = p[1:]
+			}
+			if len(p) == 1 {
+				return true
+			}
+			for len(s) > 0 {
+				if stringMatch(p[1:], s, nocase, nesting+1) {
+					return true
+				}
+				s = s[1:]
+			}
+			return false
+		case '?':
+			s = s[1:]
+		case '[':
+			p = p[1:]
+			not := len(p) > 0 && p[0] == '^'
+			if not {
+				p = p[1:]
+			}
+			match := false
+			for len(p) > 0 {
+				if p[0] == '\\' && len(p) >= 2 {
+					p = p[1:]
+					if p[0] == s[0] {
+						match = true
+					}
+				} else if p[0] == ']' {
+					break
+				} else if len(p) >= 3 && p[1] == '-' {
+					start, end, c := p[0], p[2], s[0]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, c = toLower(start), toLower(end), toLower(c)
+					}
+					p = p[2:]
+					if c >= start && c <= end {
+						match = true
+					}
+				} else if equalByte(p[0], s[0], nocase) {
+					match = true
+				}
+				p = p[1:]
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			s = s[1:]
+		case '\\':
+			if len(p) >= 2 {
+				p = p[1:]
+			}
+			fallthrough
+		default:
+			if !equalByte(p[0], s[0], nocase) {
+				return false
+			}
+			s = s[1:]
+		}
+		// An unterminated class consumes the rest of the pattern.
+		if len(p) > 0 {
+			p = p[1:]
+		}
+	}
+	// Trailing stars also match the empty rest of the string.
+	if len(s) == 0 {
+		for len(p) > 0 && p[0] == '*' {
+			p = p[1:]
+		}
+	}
+	return len(p) == 0 && len(s) == 0
+}
+
+func equalByte(a byte, b byte, nocase bool) bool {
+	if nocase {
+		return toLower(a) == toLower(b)
+	}
+	return a == b
+}
+
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
+
+// IsGlobPattern reports whether pattern contains glob special characters.
+func IsGlobPattern(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+	return false
+}
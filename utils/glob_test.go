@@ -0,0 +1,42 @@
+package utils
+
+import "testing"
+
+func TestStringMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		str     string
+		nocase  bool
+		want    bool
+	}{
+		{"*", "", false, true},
+		{"*", "anything", false, true},
+		{"h?llo", "hello", false, true},
+		{"h?llo", "hllo", false, false},
+		{"h*llo", "heeeello", false, true},
+		{"h[ae]llo", "hallo", false, true},
+		{"h[ae]llo", "hillo", false, false},
+		{"h[^e]llo", "hallo", false, true},
+		{"h[^e]llo", "hello", false, false},
+		{"h[a-b]llo", "hbllo", false, true},
+		{"h[b-a]llo", "hallo", false, true},
+		{"h[a-b]llo", "hcllo", false, false},
+		{"h\\*llo", "h*llo", false, true},
+		{"h\\*llo", "hello", false, false},
+		{"[\\]]", "]", false, true},
+		{"user:*:name", "user:42:name", false, true},
+		{"user:*:name", "user:42:email", false, false},
+		{"HELLO", "hello", true, true},
+		{"H[A-Z]LLO", "hello", true, true},
+		{"abc*", "abc", false, true},
+		{"a[bc", "ab", false, true},
+		{"", "", false, true},
+		{"", "a", false, false},
+	}
+
+	for _, c := range cases {
+		if got := StringMatch(c.pattern, c.str, c.nocase); got != c.want {
+			t.Errorf("StringMatch(%q, %q, %v) = %v, want %v", c.pattern, c.str, c.nocase, got, c.want)
+		}
+	}
+}
@@ -3,52 +3,412 @@ package utils
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"io"
 	"strconv"
 )
 
 const (
-	kMaxMsg  = 4096
-	kMaxArgs = 128
+	kMaxMsg       = 4096
+	kMaxArgs      = 1024 * 1024
+	kMaxBulkLen   = 512 * 1024 * 1024
+	kMaxInlineLen = 64 * 1024
 )
 
+// ErrIncomplete is returned when the buffer does not yet hold a whole request.
+var ErrIncomplete = errors.New("incomplete request")
+
+// Conn holds the buffered state of a single client connection. Rbuf
+// accumulates bytes read from the socket until complete requests can be
+// parsed out of it, Wbuf accumulates replies until they are flushed.
 type Conn struct {
 	Rbuf     []byte
 	RbufSize int
 	Wbuf     []byte
 	WbufSize int
 	State    int
+
+	rpos int
+	req  multibulk
+}
+
+// multibulk is the progress made on a multibulk request that is not fully
+// buffered yet, so that parsing resumes where it stopped after the next
+// Fill instead of starting over. pos is relative to the start of the
+// request and numArgs is 0 until the header has been read.
+type multibulk struct {
+	pos     int
+	numArgs int
+	args    []string
 }
 
+// maxPrealloc bounds the capacity reserved up front for the arguments of a
+// request, so that a client cannot make us allocate for a million of them
+// by only sending the header.
+const maxPrealloc = 1024
+
 const (
 	STATE_REQ = iota
 	STATE_RES
 	STATE_END
 )
 
-func ParseReq(data []byte, length uint32) ([]string, error) {
-	if length < 4 {
-		return nil, errors.New("invalid length")
+func NewConn() *Conn {
+	return &Conn{
+		Rbuf:  make([]byte, kMaxMsg),
+		Wbuf:  make([]byte, 0, kMaxMsg),
+		State: STATE_REQ,
+	}
+}
+
+// Fill performs a single read from r, appending to the read buffer. The
+// buffer doubles whenever it is full so large payloads are never truncated.
+func (c *Conn) Fill(r io.Reader) error {
+	if c.RbufSize == len(c.Rbuf) {
+		grown := make([]byte, 2*len(c.Rbuf))
+		copy(grown, c.Rbuf[:c.RbufSize])
+		c.Rbuf = grown
 	}
+	n, err := r.Read(c.Rbuf[c.RbufSize:])
+	c.RbufSize += n
+	if err != nil {
+		c.State = STATE_END
+		return err
+	}
+	c.State = STATE_REQ
+	return nil
+}
+
+// Buffered returns the bytes read but not yet consumed.
+func (c *Conn) Buffered() []byte {
+	return c.Rbuf[c.rpos:c.RbufSize]
+}
+
+// NextRequest parses the next complete request from the read buffer. It
+// returns ErrIncomplete when more bytes are needed; any other error is a
+// protocol error after which the connection should be closed.
+func (c *Conn) NextRequest() ([]string, error) {
+	args, n, err := c.req.parse(c.Buffered())
+	if err != nil {
+		return nil, err
+	}
+	c.rpos += n
+	return args, nil
+}
+
+// DiscardReply consumes a single reply frame (simple string, error, integer
+// or bulk payload) from the read buffer. It is used on the master link,
+// where replies and the RDB transfer are interleaved with propagated
+// commands. A bulk payload may or may not be terminated by CRLF.
+func (c *Conn) DiscardReply() error {
+	data := c.Buffered()
+	if len(data) == 0 {
+		return ErrIncomplete
+	}
+	line, n, err := readLine(data)
+	if err != nil {
+		return err
+	}
+	switch data[0] {
+	case '+', '-', ':':
+		c.rpos += n
+		return nil
+	case '$':
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return fmt.Errorf("ERR Protocol error: invalid bulk length")
+		}
+		if size < 0 {
+			c.rpos += n
+			return nil
+		}
+		if len(data) < n+size {
+			return ErrIncomplete
+		}
+		n += size
+		if bytes.HasPrefix(data[n:], []byte("\r\n")) {
+			n += 2
+		}
+		c.rpos += n
+		return nil
+	default:
+		return fmt.Errorf("ERR Protocol error: unexpected reply type '%c'", data[0])
+	}
+}
+
+// NextRDB consumes the RDB file a master sends after FULLRESYNC: a bulk
+// length followed by the file, with no CRLF after it. The file is returned
+// as a copy, the read buffer being reused.
+func (c *Conn) NextRDB() ([]byte, error) {
+	data := c.Buffered()
+	line, n, err := readLine(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, fmt.Errorf("ERR Protocol error: expected the RDB payload")
+	}
+	size, err := strconv.Atoi(string(line[1:]))
+	if err != nil || size < 0 || size > kMaxBulkLen {
+		return nil, fmt.Errorf("ERR Protocol error: invalid bulk length")
+	}
+	if len(data) < n+size {
+		return nil, ErrIncomplete
+	}
+	rdb := append([]byte(nil), data[n:n+size]...)
+	c.rpos += n + size
+	return rdb, nil
+}
+
+// Compact drops consumed bytes, moving any partial request to the start of
+// the read buffer so the next Fill appends to it.
+func (c *Conn) Compact() {
+	if c.rpos == 0 {
+		return
+	}
+	c.RbufSize = copy(c.Rbuf, c.Rbuf[c.rpos:c.RbufSize])
+	c.rpos = 0
+}
 
+// Write queues a reply to be sent on the next Flush.
+func (c *Conn) Write(p []byte) {
+	c.Wbuf = append(c.Wbuf, p...)
+	c.WbufSize = len(c.Wbuf)
+}
+
+// Flush sends every queued reply to w in a single write.
+func (c *Conn) Flush(w io.Writer) error {
+	if c.WbufSize == 0 {
+		return nil
+	}
+	c.State = STATE_RES
+	_, err := w.Write(c.Wbuf[:c.WbufSize])
+	c.Wbuf = c.Wbuf[:0]
+	c.WbufSize = 0
+	if err != nil {
+		c.State = STATE_END
+		return err
+	}
+	c.State = STATE_REQ
+	return nil
+}
+
+// ParseReq parses one request from the start of data and returns its
+// arguments together with the number of bytes consumed. Multibulk requests
+// read bulk strings by their declared length, so they may contain CRLF;
+// anything not starting with '*' is parsed as an inline command. ErrIncomplete
+// is returned when data ends before the request does.
+func ParseReq(data []byte, length uint32) ([]string, int, error) {
+	req := multibulk{}
+	return req.parse(data[:length])
+}
+
+// parse carries on parsing the request data starts with. On ErrIncomplete
+// the arguments read so far are kept for the next call, which must be given
+// the same request with more bytes appended; otherwise the state is reset.
+func (req *multibulk) parse(data []byte) ([]string, int, error) {
+	if len(data) == 0 {
+		return nil, 0, ErrIncomplete
+	}
 	if data[0] != '*' {
-		return nil, errors.New("invalid protocol")
+		return parseInline(data)
+	}
+	args, n, err := req.resume(data)
+	if err != ErrIncomplete {
+		*req = multibulk{}
+	}
+	return args, n, err
+}
+
+func (req *multibulk) resume(data []byte) ([]string, int, error) {
+	if req.numArgs == 0 {
+		// Read number of arguments
+		line, n, err := readLine(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		numArgs, err := strconv.Atoi(string(line[1:]))
+		if err != nil || numArgs > kMaxArgs {
+			return nil, 0, errors.New("ERR Protocol error: invalid multibulk length")
+		}
+		if numArgs <= 0 {
+			return []string{}, n, nil
+		}
+		req.pos, req.numArgs = n, numArgs
+		req.args = make([]string, 0, min(numArgs, maxPrealloc))
+	}
+
+	for len(req.args) < req.numArgs {
+		pos := req.pos
+		if pos >= len(data) {
+			return nil, 0, ErrIncomplete
+		}
+		if data[pos] != '$' {
+			return nil, 0, fmt.Errorf("ERR Protocol error: expected '$', got '%c'", data[pos])
+		}
+		line, n, err := readLine(data[pos:])
+		if err != nil {
+			return nil, 0, err
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > kMaxBulkLen {
+			return nil, 0, errors.New("ERR Protocol error: invalid bulk length")
+		}
+		pos += n
+		if len(data) < pos+size+2 {
+			return nil, 0, ErrIncomplete
+		}
+		if data[pos+size] != '\r' || data[pos+size+1] != '\n' {
+			return nil, 0, errors.New("ERR Protocol error: bulk string not terminated by CRLF")
+		}
+		req.args = append(req.args, string(data[pos:pos+size]))
+		req.pos = pos + size + 2
 	}
 
-	// Read number of arguments
-	parts := bytes.Split(data[1:length], []byte("\r\n"))
-	if len(parts) < 3 {
-		return nil, errors.New("invalid message format")
+	return req.args, req.pos, nil
+}
+
+// readLine returns the first CRLF terminated line of data without the
+// terminator, and the number of bytes it spans including the terminator.
+func readLine(data []byte) ([]byte, int, error) {
+	end := bytes.Index(data, []byte("\r\n"))
+	if end < 0 {
+		if len(data) > 64*1024 {
+			return nil, 0, errors.New("ERR Protocol error: too big request header")
+		}
+		return nil, 0, ErrIncomplete
 	}
+	return data[:end], end + 2, nil
+}
 
-	numArgs, err := strconv.Atoi(string(parts[0]))
-	if err != nil || numArgs < 1 || numArgs > kMaxArgs {
-		return nil, errors.New("invalid number of arguments")
+// parseInline parses a single newline terminated inline command, as typed
+// into telnet or nc. Arguments are separated by spaces and may be quoted.
+func parseInline(data []byte) ([]string, int, error) {
+	end := bytes.IndexByte(data, '\n')
+	if end < 0 {
+		if len(data) > kMaxInlineLen {
+			return nil, 0, errors.New("ERR Protocol error: too big inline request")
+		}
+		return nil, 0, ErrIncomplete
 	}
+	line := data[:end]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	args, err := SplitArgs(string(line))
+	if err != nil {
+		return nil, 0, err
+	}
+	return args, end + 1, nil
+}
 
-	var out []string
-	for i := 1; i < len(parts)-1; i += 2 {
-		out = append(out, string(parts[i+1]))
+// SplitArgs splits a line into arguments the way redis-cli and the inline
+// protocol do. Double quoted arguments support the escapes \n, \r, \t, \b,
+// \a, \\, \" and \xHH; single quoted arguments only support \'.
+func SplitArgs(line string) ([]string, error) {
+	unbalanced := errors.New("ERR Protocol error: unbalanced quotes in request")
+	args := []string{}
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var arg []byte
+		inDouble, inSingle, done := false, false, false
+		for !done {
+			switch {
+			case inDouble:
+				if i >= len(line) {
+					return nil, unbalanced
+				}
+				c := line[i]
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]) {
+					arg = append(arg, hexValue(line[i+2])<<4|hexValue(line[i+3]))
+					i += 3
+				} else if c == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						arg = append(arg, '\n')
+					case 'r':
+						arg = append(arg, '\r')
+					case 't':
+						arg = append(arg, '\t')
+					case 'b':
+						arg = append(arg, '\b')
+					case 'a':
+						arg = append(arg, '\a')
+					default:
+						arg = append(arg, line[i])
+					}
+				} else if c == '"' {
+					// The closing quote must be followed by a space or the end.
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, unbalanced
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			case inSingle:
+				if i >= len(line) {
+					return nil, unbalanced
+				}
+				c := line[i]
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					arg = append(arg, '\'')
+				} else if c == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, unbalanced
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			default:
+				if i >= len(line) {
+					done = true
+					break
+				}
+				switch c := line[i]; {
+				case isSpace(c):
+					done = true
+				case c == '"':
+					inDouble = true
+				case c == '\'':
+					inSingle = true
+				default:
+					arg = append(arg, c)
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+		args = append(args, string(arg))
 	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
 
-	return out, nil
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
 }
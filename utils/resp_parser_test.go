@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseReqPipelined(t *testing.T) {
+	data := []byte("*1\r\n$4\r\nPING\r\n*3\r\n$3\r\nSET\r\n$3\r\nfoo\r\n$3\r\nbar\r\n")
+
+	args, n, err := ParseReq(data, uint32(len(data)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(args) != 1 || args[0] != "PING" {
+		t.Fatalf("Unexpected first request: %q", args)
+	}
+
+	args, m, err := ParseReq(data[n:], uint32(len(data)-n))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(args, " ") != "SET foo bar" || n+m != len(data) {
+		t.Fatalf("Unexpected second request: %q (consumed %d of %d)", args, n+m, len(data))
+	}
+}
+
+func TestParseReqBinarySafe(t *testing.T) {
+	data := []byte("*2\r\n$4\r\nECHO\r\n$6\r\na\r\nb\r\n\r\n")
+	args, _, err := ParseReq(data, uint32(len(data)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if args[1] != "a\r\nb\r\n" {
+		t.Errorf("Unexpected value. Got: %q", args[1])
+	}
+}
+
+func TestParseReqIncomplete(t *testing.T) {
+	data := []byte("*2\r\n$4\r\nECHO\r\n$10\r\nhello")
+	if _, _, err := ParseReq(data, uint32(len(data))); err != ErrIncomplete {
+		t.Errorf("Expected ErrIncomplete, got: %v", err)
+	}
+}
+
+func TestConnResumesMultibulk(t *testing.T) {
+	c := NewConn()
+	c.RbufSize = copy(c.Rbuf, "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\nva")
+	if _, err := c.NextRequest(); err != ErrIncomplete {
+		t.Fatalf("Expected ErrIncomplete, got: %v", err)
+	}
+	if len(c.req.args) != 2 || c.req.pos != 20 {
+		t.Fatalf("Parsed %q up to %d, want the first two arguments", c.req.args, c.req.pos)
+	}
+	if cap(c.req.args) != 3 {
+		t.Errorf("Reserved %d arguments, want 3", cap(c.req.args))
+	}
+	c.RbufSize += copy(c.Rbuf[c.RbufSize:], "lue\r\n")
+	args, err := c.NextRequest()
+	if err != nil || strings.Join(args, " ") != "SET k value" {
+		t.Fatalf("Unexpected request: %q, %v", args, err)
+	}
+	if c.req.numArgs != 0 || len(c.Buffered()) != 0 {
+		t.Errorf("State left behind after a complete request: %+v", c.req)
+	}
+
+	c.RbufSize = copy(c.Rbuf, "*1000000\r\n")
+	c.rpos = 0
+	if _, err := c.NextRequest(); err != ErrIncomplete {
+		t.Fatalf("Expected ErrIncomplete, got: %v", err)
+	}
+	if cap(c.req.args) > maxPrealloc {
+		t.Errorf("Reserved %d arguments for a header alone", cap(c.req.args))
+	}
+}
+
+func TestConnSplitReads(t *testing.T) {
+	value := strings.Repeat("x", 3*kMaxMsg)
+	payload := "*3\r\n$3\r\nSET\r\n$3\r\nbig\r\n$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n*1\r\n$4\r\nPING\r\n"
+
+	// Deliver the stream a few bytes at a time to simulate TCP segmentation.
+	reader := &chunkReader{data: []byte(payload), chunk: 7}
+	c := NewConn()
+	var got [][]string
+	for len(got) < 2 {
+		if err := c.Fill(reader); err != nil {
+			t.Fatalf("Unexpected read error: %v", err)
+		}
+		for {
+			args, err := c.NextRequest()
+			if err == ErrIncomplete {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got = append(got, args)
+		}
+		c.Compact()
+	}
+
+	if got[0][2] != value {
+		t.Errorf("Large value truncated: got %d bytes, want %d", len(got[0][2]), len(value))
+	}
+	if got[1][0] != "PING" {
+		t.Errorf("Pipelined command lost. Got: %q", got[1])
+	}
+}
+
+func TestConnDiscardReply(t *testing.T) {
+	c := NewConn()
+	c.Fill(bytes.NewReader([]byte("+FULLRESYNC abc 0\r\n$5\r\nREDIS*1\r\n$4\r\nPING\r\n")))
+	for i := 0; i < 2; i++ {
+		if err := c.DiscardReply(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	args, err := c.NextRequest()
+	if err != nil || args[0] != "PING" {
+		t.Errorf("Unexpected request after replies: %q, %v", args, err)
+	}
+}
+
+func TestConnNextRDB(t *testing.T) {
+	c := NewConn()
+	c.Fill(bytes.NewReader([]byte("$7\r\nRED")))
+	if _, err := c.NextRDB(); err != ErrIncomplete {
+		t.Fatalf("NextRDB on a partial payload = %v, want ErrIncomplete", err)
+	}
+	c.Fill(bytes.NewReader([]byte("IS\r\n*1\r\n$4\r\nPING\r\n")))
+	rdb, err := c.NextRDB()
+	if err != nil || string(rdb) != "REDIS\r\n" {
+		t.Fatalf("NextRDB = %q, %v", rdb, err)
+	}
+	args, err := c.NextRequest()
+	if err != nil || args[0] != "PING" {
+		t.Errorf("Unexpected request after the RDB file: %q, %v", args, err)
+	}
+}
+
+type chunkReader struct {
+	data  []byte
+	chunk int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	n := r.chunk
+	if n > len(r.data) {
+		n = len(r.data)
+	}
+	if n > len(p) {
+		n = len(p)
+	}
+	copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestParseReqInline(t *testing.T) {
+	data := []byte("SET foo \"hello world\\n\"\r\n*1\r\n$4\r\nPING\r\nget 'it\\'s'\n")
+
+	args, n, err := ParseReq(data, uint32(len(data)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(args) != 3 || args[2] != "hello world\n" {
+		t.Fatalf("Unexpected inline request: %q", args)
+	}
+
+	args, m, err := ParseReq(data[n:], uint32(len(data)-n))
+	if err != nil || args[0] != "PING" {
+		t.Fatalf("Unexpected multibulk request after inline: %q, %v", args, err)
+	}
+	n += m
+
+	args, _, err = ParseReq(data[n:], uint32(len(data)-n))
+	if err != nil || strings.Join(args, "|") != "get|it's" {
+		t.Fatalf("Unexpected single quoted request: %q, %v", args, err)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	args, err := SplitArgs(`  a "b\x41c" '' d  `)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(args, "|") != "a|bAc||d" {
+		t.Errorf("Unexpected args: %q", args)
+	}
+
+	for _, line := range []string{`"unterminated`, `"closed"x`, `'open`} {
+		if _, err := SplitArgs(line); err == nil {
+			t.Errorf("Expected unbalanced quotes error for %q", line)
+		}
+	}
+}
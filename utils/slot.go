@@ -0,0 +1,36 @@
+package utils
+
+import "strings"
+
+// CLUSTER_SLOTS is the number of hash slots keys and shard channels are
+// distributed over in a Redis cluster.
+const CLUSTER_SLOTS = 16384
+
+// crc16 computes the CRC16-CCITT (XMODEM) checksum Redis cluster hashes
+// keys with.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// KeyHashSlot returns the hash slot of a key or a shard channel. When it
+// holds a non-empty "{tag}", only the tag is hashed, so that related keys
+// can be kept in the same slot.
+func KeyHashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) % CLUSTER_SLOTS
+}
@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestKeyHashSlot(t *testing.T) {
+	if got := crc16("123456789"); got != 0x31C3 {
+		t.Errorf("crc16(123456789) = %#x, want 0x31c3", got)
+	}
+	cases := []struct {
+		key  string
+		slot int
+	}{
+		{"", 0},
+		{"foo", 12182},
+		{"bar", 5061},
+		{"{user1000}.following", 3443},
+		{"{user1000}.followers", 3443},
+		{"foo{}{bar}", 8363},
+		{"foo{{bar}}zap", 4015},
+		{"foo{bar}{zap}", 5061},
+	}
+	for _, tt := range cases {
+		if got := KeyHashSlot(tt.key); got != tt.slot {
+			t.Errorf("KeyHashSlot(%q) = %d, want %d", tt.key, got, tt.slot)
+		}
+	}
+}